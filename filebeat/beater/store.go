@@ -18,6 +18,7 @@
 package beater
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/elastic/beats/v7/filebeat/config"
@@ -25,6 +26,8 @@ import (
 	"github.com/elastic/beats/v7/libbeat/logp"
 	"github.com/elastic/beats/v7/libbeat/paths"
 	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/boltstore"
 	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
 )
 
@@ -35,21 +38,38 @@ type filebeatStore struct {
 }
 
 func openStateStore(info beat.Info, logger *logp.Logger, cfg config.Registry) (*filebeatStore, error) {
-	memlog, err := memlog.New(logger, memlog.Settings{
-		Root:     paths.Resolve(paths.Data, cfg.Path),
-		FileMode: cfg.Permissions,
-	})
+	reg, err := openRegistryBackend(logger, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	return &filebeatStore{
-		registry:      statestore.NewRegistry(memlog),
+		registry:      statestore.NewRegistry(reg),
 		storeName:     info.Beat,
 		cleanInterval: cfg.CleanInterval,
 	}, nil
 }
 
+func openRegistryBackend(logger *logp.Logger, cfg config.Registry) (backend.Registry, error) {
+	root := paths.Resolve(paths.Data, cfg.Path)
+
+	switch cfg.Backend {
+	case "", "memlog":
+		return memlog.New(logger, memlog.Settings{
+			Root:     root,
+			FileMode: cfg.Permissions,
+		})
+	case "bbolt":
+		// Existing memlog stores are migrated when accessed the first time.
+		return boltstore.New(logger, boltstore.Settings{
+			Root:     root,
+			FileMode: cfg.Permissions,
+		})
+	default:
+		return nil, fmt.Errorf("unknown registry backend '%v'", cfg.Backend)
+	}
+}
+
 func (s *filebeatStore) Close() {
 	s.registry.Close()
 }
@@ -51,6 +51,7 @@ type Config struct {
 }
 
 type Registry struct {
+	Backend       string        `config:"backend"`
 	Path          string        `config:"path"`
 	Permissions   os.FileMode   `config:"file_permissions"`
 	FlushTimeout  time.Duration `config:"flush"`
@@ -61,6 +62,7 @@ type Registry struct {
 var (
 	DefaultConfig = Config{
 		Registry: Registry{
+			Backend:       "memlog",
 			Path:          "registry",
 			Permissions:   0600,
 			MigrateFile:   "",
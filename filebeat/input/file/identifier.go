@@ -19,6 +19,7 @@ package file
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
@@ -31,6 +32,7 @@ const (
 	nativeName      = "native"
 	pathName        = "path"
 	inodeMarkerName = "inode_marker"
+	fingerprintName = "fingerprint"
 
 	DefaultIdentifierName = nativeName
 	identitySep           = "::"
@@ -41,11 +43,19 @@ var (
 		nativeName:      newINodeDeviceIdentifier,
 		pathName:        newPathIdentifier,
 		inodeMarkerName: newINodeMarkerIdentifier,
+		fingerprintName: newFingerprintIdentifier,
 	}
 )
 
 type IdentifierFactory func(*common.Config) (StateIdentifier, error)
 
+// fingerprinter is implemented by identifiers which derive the ID from the
+// contents of the file. The fingerprint is stored in the state, so the ID can
+// be generated again without reading the file.
+type fingerprinter interface {
+	fingerprint(path string, info os.FileInfo) (string, error)
+}
+
 // StateIdentifier generates an ID for a State.
 type StateIdentifier interface {
 	// GenerateID generates and returns the ID of the state and its type
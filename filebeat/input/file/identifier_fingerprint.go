@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/file"
+)
+
+const (
+	defaultFingerprintOffset = 0
+	defaultFingerprintLength = 1024
+)
+
+// fingerprintIdentifier identifies files by the hash of a fixed range of
+// their contents. Files are recognized even if their inode is reused or if
+// they are renamed. Files smaller than the configured range are not
+// identified until they have grown large enough.
+type fingerprintIdentifier struct {
+	name   string
+	offset int64
+	length int64
+}
+
+func newFingerprintIdentifier(cfg *common.Config) (StateIdentifier, error) {
+	config := struct {
+		Offset int64 `config:"offset" validate:"min=0"`
+		Length int64 `config:"length" validate:"min=1"`
+	}{
+		Offset: defaultFingerprintOffset,
+		Length: defaultFingerprintLength,
+	}
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, fmt.Errorf("error while reading configuration of fingerprint file identity: %v", err)
+		}
+	}
+
+	return &fingerprintIdentifier{
+		name:   fingerprintName,
+		offset: config.Offset,
+		length: config.Length,
+	}, nil
+}
+
+// GenerateID returns an empty ID if the fingerprint of the file is not known
+// yet.
+func (f *fingerprintIdentifier) GenerateID(s State) (id, identifierType string) {
+	if s.Fingerprint == "" {
+		return "", f.name
+	}
+
+	stateID := f.name + identitySep + s.Fingerprint
+	return genIDWithHash(s.Meta, stateID), f.name
+}
+
+// fingerprint returns the hex encoded SHA-256 hash of the configured range of
+// the file. An empty fingerprint is returned if the file is too small.
+func (f *fingerprintIdentifier) fingerprint(path string, info os.FileInfo) (string, error) {
+	if info != nil && info.Size() < f.offset+f.length {
+		return "", nil
+	}
+
+	// Open the file like the harvester does, such that the file can still
+	// be removed or renamed on Windows while it is being read.
+	r, err := file.ReadOpen(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.NewSectionReader(r, f.offset, f.length))
+	if err != nil {
+		return "", err
+	}
+	// The file might have been truncated since it was stat'ed.
+	if n < f.length {
+		return "", nil
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestFingerprintIdentifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := common.MustNewConfigFrom(map[string]interface{}{"offset": 2, "length": 8})
+	identifier, err := newFingerprintIdentifier(cfg)
+	require.NoError(t, err)
+
+	newState := func(path string) State {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		return NewState(info, path, "log", nil, identifier)
+	}
+
+	path := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("0123456"), 0644))
+
+	t.Run("file too small is not identified", func(t *testing.T) {
+		st := newState(path)
+		assert.Equal(t, "", st.Id)
+		assert.Equal(t, "", st.Fingerprint)
+		assert.Equal(t, fingerprintName, st.IdentifierName)
+	})
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("0123456789\nline 2\n"), 0644))
+	first := newState(path)
+
+	t.Run("file is identified once large enough", func(t *testing.T) {
+		assert.NotEqual(t, "", first.Id)
+		assert.True(t, strings.HasPrefix(first.Id, fingerprintName+identitySep))
+	})
+
+	t.Run("renamed file keeps its identity", func(t *testing.T) {
+		renamed := filepath.Join(dir, "test.log.1")
+		require.NoError(t, os.Rename(path, renamed))
+		defer os.Rename(renamed, path)
+
+		st := newState(renamed)
+		assert.True(t, first.IsEqual(&st))
+	})
+
+	t.Run("bytes outside of the range are ignored", func(t *testing.T) {
+		other := filepath.Join(dir, "other.log")
+		require.NoError(t, ioutil.WriteFile(other, []byte("xx23456789yy"), 0644))
+
+		st := newState(other)
+		assert.True(t, first.IsEqual(&st))
+	})
+
+	t.Run("different content has a different identity", func(t *testing.T) {
+		other := filepath.Join(dir, "different.log")
+		require.NoError(t, ioutil.WriteFile(other, []byte("01abcdefgh89"), 0644))
+
+		st := newState(other)
+		assert.False(t, first.IsEqual(&st))
+	})
+
+	t.Run("stored fingerprint is used to generate the ID", func(t *testing.T) {
+		st := State{Source: "/does/not/exist", Fingerprint: first.Fingerprint}
+		id, name := identifier.GenerateID(st)
+		assert.Equal(t, first.Id, id)
+		assert.Equal(t, fingerprintName, name)
+	})
+}
+
+func TestFingerprintIdentifierConfig(t *testing.T) {
+	identifier, err := NewStateIdentifier(nil)
+	require.NoError(t, err)
+	assert.IsType(t, &inodeDeviceIdentifier{}, identifier)
+
+	ns := &common.ConfigNamespace{}
+	require.NoError(t, common.MustNewConfigFrom(map[string]interface{}{
+		"fingerprint": map[string]interface{}{"length": 64},
+	}).Unpack(ns))
+	identifier, err = NewStateIdentifier(ns)
+	require.NoError(t, err)
+	require.IsType(t, &fingerprintIdentifier{}, identifier)
+	assert.Equal(t, int64(defaultFingerprintOffset), identifier.(*fingerprintIdentifier).offset)
+	assert.Equal(t, int64(64), identifier.(*fingerprintIdentifier).length)
+
+	ns = &common.ConfigNamespace{}
+	require.NoError(t, common.MustNewConfigFrom(map[string]interface{}{
+		"fingerprint": map[string]interface{}{"length": 0},
+	}).Unpack(ns))
+	_, err = NewStateIdentifier(ns)
+	assert.Error(t, err)
+}
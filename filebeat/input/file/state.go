@@ -25,7 +25,9 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/file"
 )
 
-// State is used to communicate the reading state of a file
+// State is used to communicate the reading state of a file.
+// The Id is empty if the file cannot be identified yet, e.g. because it
+// is smaller than the range used by the fingerprint file identity.
 type State struct {
 	Id             string            `json:"id" struct:"id"`
 	PrevId         string            `json:"prev_id" struct:"prev_id"`
@@ -39,6 +41,17 @@ type State struct {
 	Meta           map[string]string `json:"meta" struct:"meta,omitempty"`
 	FileStateOS    file.StateOS      `json:"FileStateOS" struct:"FileStateOS"`
 	IdentifierName string            `json:"identifier_name" struct:"identifier_name"`
+	Fingerprint    string            `json:"fingerprint" struct:"fingerprint,omitempty"`
+
+	// Compressed is set for compressed files. The offset of a compressed
+	// file counts the bytes of the decompressed content.
+	Compressed bool `json:"compressed" struct:"compressed,omitempty"`
+	// Completed is set once a compressed file has been read to the end.
+	// Compressed files are not appended to, so they are not read again.
+	Completed bool `json:"completed" struct:"completed,omitempty"`
+	// ReadFailed is set if reading a compressed file failed before its end,
+	// for example because the file is still being written.
+	ReadFailed bool `json:"-" struct:"-"`
 }
 
 // NewState creates a new file state
@@ -58,6 +71,10 @@ func NewState(fileInfo os.FileInfo, path string, t string, meta map[string]strin
 		Meta:        meta,
 	}
 
+	if f, ok := identifier.(fingerprinter); ok {
+		// Errors are ignored, the file is retried on the next scan.
+		s.Fingerprint, _ = f.fingerprint(path, fileInfo)
+	}
 	s.Id, s.IdentifierName = identifier.GenerateID(s)
 
 	return s
@@ -71,7 +88,7 @@ func (s *State) IsEqual(c *State) bool {
 // String returns string representation of the struct
 func (s *State) String() string {
 	return fmt.Sprintf(
-		"{Id: %v, Finished: %v, Fileinfo: %v, Source: %v, Offset: %v, Timestamp: %v, TTL: %v, Type: %v, Meta: %v, FileStateOS: %v}",
+		"{Id: %v, Finished: %v, Fileinfo: %v, Source: %v, Offset: %v, Timestamp: %v, TTL: %v, Type: %v, Meta: %v, FileStateOS: %v, Fingerprint: %v, Compressed: %v, Completed: %v}",
 		s.Id,
 		s.Finished,
 		s.Fileinfo,
@@ -81,5 +98,8 @@ func (s *State) String() string {
 		s.TTL,
 		s.Type,
 		s.Meta,
-		s.FileStateOS)
+		s.FileStateOS,
+		s.Fingerprint,
+		s.Compressed,
+		s.Completed)
 }
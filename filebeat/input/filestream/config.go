@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+)
+
+const recursiveGlobDepth = 8
+
+type config struct {
+	// Prospector
+	Paths         []string                `config:"paths"`
+	ExcludeFiles  []match.Matcher         `config:"exclude_files"`
+	RecursiveGlob bool                    `config:"recursive_glob.enabled"`
+	Symlinks      bool                    `config:"symlinks"`
+	ScanFrequency time.Duration           `config:"scan_frequency" validate:"min=0,nonzero"`
+	IgnoreOlder   time.Duration           `config:"ignore_older" validate:"min=0"`
+	CleanRemoved  bool                    `config:"clean_removed"`
+	FileIdentity  *common.ConfigNamespace `config:"file_identity"`
+	MigrateStates bool                    `config:"migrate_log_states"`
+
+	// Harvester
+	Close   closeConfig   `config:"close"`
+	Backoff backoffConfig `config:"backoff"`
+
+	Encoding       string                  `config:"encoding"`
+	BufferSize     int                     `config:"buffer_size" validate:"min=1"`
+	LineTerminator readfile.LineTerminator `config:"line_terminator"`
+	MaxBytes       int                     `config:"message_max_bytes" validate:"min=0,nonzero"`
+	IncludeLines   []match.Matcher         `config:"include_lines"`
+	ExcludeLines   []match.Matcher         `config:"exclude_lines"`
+	Multiline      *multiline.Config       `config:"multiline"`
+}
+
+// closeConfig contains the settings for closing the file handler of a
+// harvester. A closed file is picked up again by the prospector once it
+// changes.
+type closeConfig struct {
+	Inactive time.Duration `config:"inactive" validate:"min=0"`
+	Removed  bool          `config:"removed"`
+	Renamed  bool          `config:"renamed"`
+	EOF      bool          `config:"eof"`
+	Timeout  time.Duration `config:"timeout" validate:"min=0"`
+}
+
+// backoffConfig configures how long a harvester waits for new lines
+// after reaching the end of a file.
+type backoffConfig struct {
+	Init time.Duration `config:"init" validate:"min=0,nonzero"`
+	Max  time.Duration `config:"max" validate:"min=0,nonzero"`
+}
+
+func defaultConfig() config {
+	return config{
+		RecursiveGlob: true,
+		Symlinks:      false,
+		ScanFrequency: 10 * time.Second,
+		IgnoreOlder:   0,
+		CleanRemoved:  true,
+		FileIdentity:  nil,
+		MigrateStates: true,
+		Close: closeConfig{
+			Inactive: 5 * time.Minute,
+			Removed:  true,
+			Renamed:  false,
+			EOF:      false,
+			Timeout:  0,
+		},
+		Backoff: backoffConfig{
+			Init: 1 * time.Second,
+			Max:  10 * time.Second,
+		},
+		Encoding:       "plain",
+		BufferSize:     16 * humanize.KiByte,
+		LineTerminator: readfile.AutoLineTerminator,
+		MaxBytes:       10 * humanize.MiByte,
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("no paths were defined for input")
+	}
+
+	if c.Backoff.Init > c.Backoff.Max {
+		return fmt.Errorf("backoff.init (%v) must not exceed backoff.max (%v)", c.Backoff.Init, c.Backoff.Max)
+	}
+
+	if _, ok := encoding.FindEncoding(c.Encoding); !ok {
+		return fmt.Errorf("unknown encoding('%v')", c.Encoding)
+	}
+
+	if _, err := file.NewStateIdentifier(c.FileIdentity); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// globPatterns returns the absolute glob patterns to scan for, with
+// recursive globs expanded if enabled.
+func (c *config) globPatterns() ([]string, error) {
+	var patterns []string
+	for _, path := range c.Paths {
+		pathAbs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the absolute path for %s: %v", path, err)
+		}
+
+		if !c.RecursiveGlob {
+			patterns = append(patterns, pathAbs)
+			continue
+		}
+
+		expanded, err := file.GlobPatterns(pathAbs, recursiveGlobDepth)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, expanded...)
+	}
+	return patterns, nil
+}
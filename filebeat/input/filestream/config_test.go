@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cases := map[string]struct {
+		settings map[string]interface{}
+		wantErr  bool
+	}{
+		"defaults with paths": {
+			settings: map[string]interface{}{"paths": []string{"/var/log/*.log"}},
+		},
+		"no paths": {
+			settings: map[string]interface{}{},
+			wantErr:  true,
+		},
+		"backoff init exceeds max": {
+			settings: map[string]interface{}{
+				"paths":        []string{"/var/log/*.log"},
+				"backoff.init": "20s",
+				"backoff.max":  "10s",
+			},
+			wantErr: true,
+		},
+		"unknown encoding": {
+			settings: map[string]interface{}{
+				"paths":    []string{"/var/log/*.log"},
+				"encoding": "no-such-encoding",
+			},
+			wantErr: true,
+		},
+		"path file identity": {
+			settings: map[string]interface{}{
+				"paths":                      []string{"/var/log/*.log"},
+				"file_identity.path.enabled": true,
+			},
+		},
+		"unknown file identity": {
+			settings: map[string]interface{}{
+				"paths":                            []string{"/var/log/*.log"},
+				"file_identity.no_such_id.enabled": true,
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig()
+			err := common.MustNewConfigFrom(test.settings).Unpack(&config)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	commonfile "github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/go-concert/ctxtool"
+)
+
+var (
+	errFileTruncated = errors.New("file was truncated")
+	errInactive      = errors.New("file inactive")
+	errRemoved       = errors.New("file was removed")
+	errRenamed       = errors.New("file was renamed")
+	errClosed        = errors.New("reader closed")
+)
+
+// logFile reads from a file. When reaching the end of the file, logFile
+// waits for new data using an exponential backoff, until one of the
+// configured close conditions is met.
+type logFile struct {
+	file   *os.File
+	log    *logp.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeConfig  closeConfig
+	backoffInit  time.Duration
+	backoffMax   time.Duration
+	backoff      time.Duration
+	offset       int64
+	lastTimeRead time.Time
+}
+
+func newLogFile(
+	log *logp.Logger,
+	canceler input.Canceler,
+	f *os.File,
+	offset int64,
+	config config,
+) *logFile {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if config.Close.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctxtool.FromCanceller(canceler), config.Close.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctxtool.FromCanceller(canceler))
+	}
+
+	return &logFile{
+		file:         f,
+		log:          log,
+		ctx:          ctx,
+		cancel:       cancel,
+		closeConfig:  config.Close,
+		backoffInit:  config.Backoff.Init,
+		backoffMax:   config.Backoff.Max,
+		backoff:      config.Backoff.Init,
+		offset:       offset,
+		lastTimeRead: time.Now(),
+	}
+}
+
+// Read reads from the file and updates the offset. The total number of bytes
+// read is returned.
+func (f *logFile) Read(buf []byte) (int, error) {
+	totalN := 0
+
+	for f.ctx.Err() == nil {
+		if err := f.checkFileDisappeared(); err != nil {
+			return totalN, err
+		}
+
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			f.offset += int64(n)
+			f.lastTimeRead = time.Now()
+		}
+		totalN += n
+
+		// Either the end of the file was reached or the buffer is full.
+		if err == nil {
+			f.backoff = f.backoffInit
+			return totalN, nil
+		}
+		buf = buf[n:]
+
+		err = f.errorChecks(err)
+		if err != nil || len(buf) == 0 {
+			return totalN, err
+		}
+
+		f.log.Debugf("End of file reached: %s; Backoff now.", f.file.Name())
+		f.wait()
+	}
+
+	return 0, errClosed
+}
+
+// errorChecks determines the cause of EOF errors and how they are handled
+// based on the close settings.
+func (f *logFile) errorChecks(err error) error {
+	if err != io.EOF {
+		f.log.Errorf("Unexpected state reading from %s; error: %s", f.file.Name(), err)
+		return err
+	}
+
+	if f.closeConfig.EOF {
+		return err
+	}
+
+	info, statErr := f.file.Stat()
+	if statErr != nil {
+		f.log.Errorf("Unexpected error reading from %s; error: %s", f.file.Name(), statErr)
+		return statErr
+	}
+
+	if info.Size() < f.offset {
+		f.log.Debugf("File was truncated as offset (%d) > size (%d): %s", f.offset, info.Size(), f.file.Name())
+		return errFileTruncated
+	}
+
+	if f.closeConfig.Inactive > 0 && time.Since(f.lastTimeRead) > f.closeConfig.Inactive {
+		return errInactive
+	}
+
+	return nil
+}
+
+// checkFileDisappeared checks if the file has been removed or renamed.
+func (f *logFile) checkFileDisappeared() error {
+	if !f.closeConfig.Renamed && !f.closeConfig.Removed {
+		return nil
+	}
+
+	info, statErr := f.file.Stat()
+	if statErr != nil {
+		f.log.Errorf("Unexpected error reading from %s; error: %s", f.file.Name(), statErr)
+		return statErr
+	}
+
+	if f.closeConfig.Renamed && !file.IsSameFile(f.file.Name(), info) {
+		f.log.Debugf("close.renamed is enabled and file %s has been renamed", f.file.Name())
+		return errRenamed
+	}
+
+	if f.closeConfig.Removed && commonfile.IsRemoved(f.file) {
+		f.log.Debugf("close.removed is enabled and file %s has been removed", f.file.Name())
+		return errRemoved
+	}
+
+	return nil
+}
+
+func (f *logFile) wait() {
+	select {
+	case <-f.ctx.Done():
+		return
+	case <-time.After(f.backoff):
+	}
+
+	if f.backoff < f.backoffMax {
+		f.backoff *= 2
+		if f.backoff > f.backoffMax {
+			f.backoff = f.backoffMax
+		}
+	}
+}
+
+// Close stops the reader and closes the file.
+func (f *logFile) Close() error {
+	f.cancel()
+	return f.file.Close()
+}
@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"io"
+	"os"
+
+	"github.com/elastic/beats/v7/filebeat/harvester"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	commonfile "github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+)
+
+// fileSource is a file found by the prospector. The source name is generated
+// by the configured file_identity, such that the state of a file can be
+// followed when it is renamed.
+type fileSource struct {
+	id   string
+	path string
+	info os.FileInfo
+}
+
+// cursorState is the state stored per file in the registry.
+type cursorState struct {
+	Offset int64 `struct:"offset"`
+}
+
+// harvester reads lines from a single file, publishing an event per line.
+type harvester struct {
+	config config
+	source fileSource
+	legacy *legacyStates
+
+	// onStop is called with the last published offset when the harvester returns.
+	onStop func(offset int64)
+}
+
+func (s fileSource) Name() string { return s.id }
+
+// Run collects events from the file until the file is closed or the input is
+// stopped. Run returns an error only if reading from the file failed.
+func (h *harvester) Run(ctx input.Context, cursor cursor.Cursor, publisher cursor.Publisher) error {
+	log := ctx.Logger.With("path", h.source.path)
+
+	var state cursorState
+	defer func() {
+		if h.onStop != nil {
+			h.onStop(state.Offset)
+		}
+	}()
+
+	if !cursor.IsNew() {
+		if err := cursor.Unpack(&state); err != nil {
+			log.Errorf("Failed to read the file state, reading from the beginning: %+v", err)
+			state = cursorState{}
+		}
+	} else if h.legacy != nil {
+		if offset, ok := h.legacy.find(log, h.source.id, h.source.info); ok {
+			log.Infof("Continue reading from offset %v found in the log input state", offset)
+			state.Offset = offset
+		}
+	}
+
+	f, err := h.openFile(log, &state)
+	if err != nil || f == nil {
+		return err
+	}
+
+	r, err := h.newReader(ctx, log, f, state.Offset)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer r.Close()
+
+	for {
+		message, err := r.Next()
+		if err != nil {
+			switch err {
+			case errFileTruncated:
+				log.Infof("File was truncated. Reading file from offset 0.")
+				state.Offset = 0
+				return publisher.Publish(beat.Event{}, state)
+			case errClosed, errInactive, errRemoved, errRenamed, io.EOF:
+				log.Debugf("Stop reading file: %v", err)
+				return nil
+			}
+			if ctx.Cancelation.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		messageOffset := state.Offset
+		state.Offset += int64(message.Bytes)
+
+		text := string(message.Content)
+		if message.IsEmpty() || !h.shouldExportLine(text) {
+			// publish an empty event to update the offset only
+			if err := publisher.Publish(beat.Event{}, state); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		fields := common.MapStr{
+			"log": common.MapStr{
+				"offset": messageOffset, // offset of the first byte of the message
+				"file": common.MapStr{
+					"path": h.source.path,
+				},
+			},
+		}
+		fields.DeepUpdate(message.Fields)
+		fields["message"] = text
+
+		event := beat.Event{Timestamp: message.Ts, Fields: fields}
+		if err := publisher.Publish(event, state); err != nil {
+			return nil
+		}
+	}
+}
+
+// openFile opens the file and seeks to the offset in state. If the file has
+// been replaced since it was found, no file is returned. The offset is reset
+// if the file has been truncated.
+func (h *harvester) openFile(log *logp.Logger, state *cursorState) (*os.File, error) {
+	f, err := commonfile.ReadOpen(h.source.path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		log.Infof("Skipping non regular file")
+		return nil, nil
+	}
+	if !os.SameFile(info, h.source.info) {
+		f.Close()
+		log.Debugf("File has been replaced since the last scan, skipping")
+		return nil, nil
+	}
+
+	if info.Size() < state.Offset {
+		log.Infof("File was truncated. Reading file from offset 0.")
+		state.Offset = 0
+	}
+
+	if _, err := f.Seek(state.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// newReader creates the reader pipeline for decoding lines from the file.
+// Closing the returned reader closes the file.
+func (h *harvester) newReader(ctx input.Context, log *logp.Logger, f *os.File, offset int64) (reader.Reader, error) {
+	encodingFactory, _ := encoding.FindEncoding(h.config.Encoding)
+	enc, err := encodingFactory(f)
+	if err != nil {
+		return nil, err
+	}
+
+	logFile := newLogFile(log, ctx.Cancelation, f, offset, h.config)
+
+	// The encoding reader limit is 4 times the message limit, as UTF-32
+	// characters can be decoded to single byte UTF-8 characters. The message
+	// size is finally limited by the LimitReader.
+	var r reader.Reader
+	r, err = readfile.NewEncodeReader(logFile, readfile.Config{
+		Codec:      enc,
+		BufferSize: h.config.BufferSize,
+		Terminator: h.config.LineTerminator,
+		MaxBytes:   h.config.MaxBytes * 4,
+	})
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	r = readfile.NewStripNewline(r, h.config.LineTerminator)
+
+	if h.config.Multiline != nil {
+		r, err = multiline.New(r, "\n", h.config.MaxBytes, h.config.Multiline)
+		if err != nil {
+			logFile.Close()
+			return nil, err
+		}
+	}
+
+	return readfile.NewLimitReader(r, h.config.MaxBytes), nil
+}
+
+func (h *harvester) shouldExportLine(line string) bool {
+	if len(h.config.IncludeLines) > 0 && !harvester.MatchAny(h.config.IncludeLines, line) {
+		return false
+	}
+	if len(h.config.ExcludeLines) > 0 && harvester.MatchAny(h.config.ExcludeLines, line) {
+		return false
+	}
+	return true
+}
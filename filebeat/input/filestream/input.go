@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const pluginName = "filestream"
+
+// defaultCleanTimeout is the time after which the state of a file that has
+// not been seen by the prospector anymore is removed from the registry. The
+// states of files still found by the prospector are kept alive, so that
+// clean_removed is the fast path for removing states only.
+const defaultCleanTimeout = 24 * time.Hour
+
+// filestream is a DynamicInput collecting lines from files. Each file found
+// by the prospector is collected by its own harvester, with the offset stored
+// per file in the registry.
+type filestream struct {
+	prospector *fileProspector
+}
+
+// Plugin creates a stateful input Plugin collecting logs from files.
+func Plugin(log *logp.Logger, store cursor.StateStore) input.Plugin {
+	return input.Plugin{
+		Name:       pluginName,
+		Stability:  feature.Experimental,
+		Deprecated: false,
+		Info:       "file based log collection",
+		Doc:        "The filestream input collects logs from the local filesystem",
+		Manager: &cursor.InputManager{
+			Logger:              log,
+			StateStore:          store,
+			Type:                pluginName,
+			DefaultCleanTimeout: defaultCleanTimeout,
+			ConfigureDynamic: func(cfg *common.Config) (cursor.DynamicInput, error) {
+				return configure(cfg, store)
+			},
+		},
+	}
+}
+
+func configure(cfg *common.Config, store cursor.StateStore) (cursor.DynamicInput, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	var legacy *legacyStates
+	if config.MigrateStates {
+		legacy = &legacyStates{store: store}
+	}
+
+	prospector, err := newFileProspector(config, legacy)
+	if err != nil {
+		return nil, err
+	}
+	return &filestream{prospector: prospector}, nil
+}
+
+func (inp *filestream) Name() string { return pluginName }
+
+// Test checks that the configured glob patterns are valid.
+func (inp *filestream) Test(_ input.TestContext) error {
+	for _, pattern := range inp.prospector.patterns {
+		if _, err := filepath.Glob(pattern); err != nil {
+			return fmt.Errorf("invalid glob pattern '%v': %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (inp *filestream) Run(ctx input.Context, grp cursor.SourceGroup) error {
+	return inp.prospector.Run(ctx, grp)
+}
@@ -0,0 +1,206 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
+)
+
+type testStateStore struct {
+	registry *statestore.Registry
+}
+
+func TestFilestream_Run(t *testing.T) {
+	t.Run("continue from the last known offset", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "test.log")
+		writeFile(t, path, "line 1\nline 2\n")
+
+		manager := Plugin(logp.NewLogger("test"), newTestStateStore()).Manager
+		cfg := testConfig(dir)
+
+		events := runInput(t, manager.Create, cfg, 2)
+		assert.Equal(t, []string{"line 1", "line 2"}, messages(events))
+		assert.Equal(t, []int64{0, 7}, offsets(events))
+
+		appendFile(t, path, "line 3\n")
+		events = runInput(t, manager.Create, cfg, 1)
+		assert.Equal(t, []string{"line 3"}, messages(events))
+		assert.Equal(t, []int64{14}, offsets(events))
+	})
+
+	t.Run("filtered lines are not published", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		writeFile(t, filepath.Join(dir, "test.log"), "DEBUG a\nINFO b\nDEBUG c\nINFO d\n")
+
+		manager := Plugin(logp.NewLogger("test"), newTestStateStore()).Manager
+		cfg := testConfig(dir)
+		require.NoError(t, cfg.Merge(map[string]interface{}{
+			"exclude_lines": []string{"^DEBUG"},
+		}))
+
+		events := runInput(t, manager.Create, cfg, 2)
+		assert.Equal(t, []string{"INFO b", "INFO d"}, messages(events))
+	})
+
+	t.Run("continue from log input state", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "test.log")
+		writeFile(t, path, "line 1\nline 2\n")
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		identifier, err := file.NewStateIdentifier(nil)
+		require.NoError(t, err)
+		st := file.NewState(info, path, "log", nil, identifier)
+		st.Offset = 7
+
+		store := newTestStateStore()
+		writeLegacyState(t, store, st)
+
+		manager := Plugin(logp.NewLogger("test"), store).Manager
+		events := runInput(t, manager.Create, testConfig(dir), 1)
+		assert.Equal(t, []string{"line 2"}, messages(events))
+		assert.Equal(t, []int64{7}, offsets(events))
+	})
+}
+
+func runInput(
+	t *testing.T,
+	create func(*common.Config) (input.Input, error),
+	cfg *common.Config,
+	n int,
+) []beat.Event {
+	inp, err := create(cfg)
+	require.NoError(t, err)
+
+	ch := make(chan beat.Event, 100)
+	pipeline := pubtest.ConstClient(&pubtest.FakeClient{
+		PublishFunc: func(event beat.Event) {
+			if len(event.Fields) > 0 {
+				ch <- event
+			}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		inp.Run(input.Context{
+			ID:          "test",
+			Logger:      logp.NewLogger("test"),
+			Cancelation: ctx,
+		}, pipeline)
+	}()
+
+	var events []beat.Event
+	timeout := time.After(10 * time.Second)
+	for len(events) < n {
+		select {
+		case event := <-ch:
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("timeout waiting for events, got %v of %v", len(events), n)
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	return events
+}
+
+func testConfig(dir string) *common.Config {
+	return common.MustNewConfigFrom(map[string]interface{}{
+		"paths":          []string{filepath.Join(dir, "*.log")},
+		"scan_frequency": "10ms",
+		"backoff.init":   "1ms",
+		"backoff.max":    "10ms",
+	})
+}
+
+func messages(events []beat.Event) []string {
+	var msgs []string
+	for _, event := range events {
+		msgs = append(msgs, event.Fields["message"].(string))
+	}
+	return msgs
+}
+
+func offsets(events []beat.Event) []int64 {
+	var offs []int64
+	for _, event := range events {
+		off, _ := event.Fields.GetValue("log.offset")
+		offs = append(offs, off.(int64))
+	}
+	return offs
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "filestream")
+	require.NoError(t, err)
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+}
+
+func writeLegacyState(t *testing.T, store testStateStore, st file.State) {
+	s, err := store.Access()
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Set(legacyStatePrefix+st.Id, st))
+}
+
+func newTestStateStore() testStateStore {
+	return testStateStore{registry: statestore.NewRegistry(storetest.NewMemoryStoreBackend())}
+}
+
+func (s testStateStore) Access() (*statestore.Store, error) { return s.registry.Get("filebeat") }
+func (s testStateStore) CleanupInterval() time.Duration     { return time.Hour }
@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"os"
+
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// legacyStatePrefix is the key prefix used by the log input to store the
+// file states in the registry.
+const legacyStatePrefix = "filebeat::logs::"
+
+// legacyStates gives read access to the file states stored by the log input.
+// A filestream input replacing a log input uses the same file identities, so
+// it can continue from the offsets known to the log input instead of reading
+// all files from the beginning.
+// The legacy states are never modified, so switching back to the log input is
+// still possible.
+type legacyStates struct {
+	store cursor.StateStore
+}
+
+// find returns the offset stored by the log input for the file identified by
+// id. No offset is returned if the state is unknown, or if the file has been
+// truncated since.
+func (l *legacyStates) find(log *logp.Logger, id string, info os.FileInfo) (int64, bool) {
+	store, err := l.store.Access()
+	if err != nil {
+		log.Errorf("Failed to access the registry for reading log input states: %+v", err)
+		return 0, false
+	}
+	defer store.Close()
+
+	key := legacyStatePrefix + id
+	if has, err := store.Has(key); err != nil || !has {
+		return 0, false
+	}
+
+	var st file.State
+	if err := store.Get(key, &st); err != nil {
+		log.Errorf("Failed to read log input state '%v': %+v", key, err)
+		return 0, false
+	}
+
+	if st.Offset > info.Size() {
+		log.Debugf("Ignore log input state of truncated file %v", st.Source)
+		return 0, false
+	}
+	return st.Offset, true
+}
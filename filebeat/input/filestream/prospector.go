@@ -0,0 +1,226 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-concert/timed"
+
+	"github.com/elastic/beats/v7/filebeat/harvester"
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// fileProspector scans the configured paths for files and starts a harvester
+// per file via the input managers SourceGroup. Harvesters that have been
+// closed are restarted once the file size changes.
+type fileProspector struct {
+	config     config
+	patterns   []string
+	identifier file.StateIdentifier
+	legacy     *legacyStates
+
+	mu    sync.Mutex
+	files map[string]*fileEntry
+}
+
+// fileEntry tracks a file found by the prospector.
+type fileEntry struct {
+	path    string
+	info    os.FileInfo
+	running bool
+
+	// offset reached by the last harvester, -1 if unknown
+	offset int64
+}
+
+func newFileProspector(config config, legacy *legacyStates) (*fileProspector, error) {
+	patterns, err := config.globPatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	identifier, err := file.NewStateIdentifier(config.FileIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileProspector{
+		config:     config,
+		patterns:   patterns,
+		identifier: identifier,
+		legacy:     legacy,
+		files:      map[string]*fileEntry{},
+	}, nil
+}
+
+// Run scans for files every scan_frequency, until the input is stopped.
+func (p *fileProspector) Run(ctx input.Context, grp cursor.SourceGroup) error {
+	p.scan(ctx.Logger, grp)
+	timed.Periodic(ctx.Cancelation, p.config.ScanFrequency, func() error {
+		p.scan(ctx.Logger, grp)
+		return nil
+	})
+	return nil
+}
+
+func (p *fileProspector) scan(log *logp.Logger, grp cursor.SourceGroup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seen := map[string]struct{}{}
+	for path, info := range p.collectFiles(log) {
+		src := p.newSource(path, info)
+		if src.id == "" {
+			log.Debugf("File cannot be identified yet, skipping: %s", path)
+			continue
+		}
+		seen[src.id] = struct{}{}
+
+		entry := p.files[src.id]
+		if entry == nil {
+			entry = &fileEntry{offset: -1}
+			p.files[src.id] = entry
+		}
+		entry.path, entry.info = path, info
+
+		// keep the state of files still present from expiring
+		grp.Touch(src)
+
+		if entry.running || entry.offset == info.Size() {
+			continue
+		}
+
+		if p.config.IgnoreOlder > 0 && time.Since(info.ModTime()) > p.config.IgnoreOlder {
+			log.Debugf("Ignore file because ignore_older reached: %s", path)
+			continue
+		}
+
+		h := &harvester{
+			config: p.config,
+			source: src,
+			legacy: p.legacy,
+			onStop: func(offset int64) { p.onHarvesterStop(src.id, offset) },
+		}
+		if grp.Start(src, h.Run) {
+			log.Debugf("Start harvester for file: %s", path)
+			entry.running = true
+		}
+	}
+
+	for id, entry := range p.files {
+		if _, exists := seen[id]; exists || entry.running {
+			continue
+		}
+
+		delete(p.files, id)
+		if p.config.CleanRemoved && isRemoved(entry) {
+			log.Debugf("Remove state for file as file removed: %s", entry.path)
+			grp.Remove(fileSource{id: id})
+		}
+	}
+}
+
+func (p *fileProspector) onHarvesterStop(id string, offset int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry := p.files[id]; entry != nil {
+		entry.running = false
+		entry.offset = offset
+	}
+}
+
+func (p *fileProspector) newSource(path string, info os.FileInfo) fileSource {
+	st := file.NewState(info, path, pluginName, nil, p.identifier)
+	return fileSource{id: st.Id, path: path, info: info}
+}
+
+// collectFiles returns the files matching the configured patterns.
+func (p *fileProspector) collectFiles(log *logp.Logger) map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+
+	for _, pattern := range p.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Errorf("glob(%s) failed: %v", pattern, err)
+			continue
+		}
+
+	OUTER:
+		for _, path := range matches {
+			if harvester.MatchAny(p.config.ExcludeFiles, path) {
+				log.Debugf("Exclude file: %s", path)
+				continue
+			}
+
+			// Lstat is used to detect symlinks
+			info, err := os.Lstat(path)
+			if err != nil {
+				log.Debugf("lstat(%s) failed: %s", path, err)
+				continue
+			}
+
+			if info.IsDir() {
+				log.Debugf("Skipping directory: %s", path)
+				continue
+			}
+
+			if info.Mode()&os.ModeSymlink > 0 && !p.config.Symlinks {
+				log.Debugf("File %s skipped as it is a symlink.", path)
+				continue
+			}
+
+			// Stat returns the file info of the original file for symlinks
+			if info, err = os.Stat(path); err != nil {
+				log.Debugf("stat(%s) failed: %s", path, err)
+				continue
+			}
+
+			// The original file and a symlink to it must not be collected both.
+			if p.config.Symlinks {
+				for _, other := range files {
+					if os.SameFile(other, info) {
+						log.Infof("Same file found as symlink and original. Skipping file: %s", path)
+						continue OUTER
+					}
+				}
+			}
+
+			files[path] = info
+		}
+	}
+
+	return files
+}
+
+// isRemoved returns true if the file can not be found under its last known
+// path anymore.
+func isRemoved(entry *fileEntry) bool {
+	info, err := os.Stat(entry.path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return !os.SameFile(info, entry.info)
+}
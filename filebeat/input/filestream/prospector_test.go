@@ -0,0 +1,204 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+type fakeSourceGroup struct {
+	started map[string]cursor.SourceRunner
+	removed []string
+	touched []string
+}
+
+func TestFileProspector_Scan(t *testing.T) {
+	log := logp.NewLogger("test")
+
+	t.Run("start harvesters for new files only", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		writeFile(t, filepath.Join(dir, "a.log"), "a\n")
+		writeFile(t, filepath.Join(dir, "b.txt"), "b\n")
+
+		p := newTestProspector(t, dir, nil)
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		require.Equal(t, 1, len(grp.started))
+
+		// the harvester is still running
+		p.scan(log, grp)
+		require.Equal(t, 1, len(grp.started))
+	})
+
+	t.Run("restart harvester if file has changed", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "a.log")
+		writeFile(t, path, "a\n")
+
+		p := newTestProspector(t, dir, nil)
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		id := grp.onlySource(t)
+		grp.stop(id)
+		p.onHarvesterStop(id, 2)
+
+		p.scan(log, grp)
+		assert.Equal(t, 0, len(grp.started), "unchanged file must not be collected again")
+
+		appendFile(t, path, "b\n")
+		p.scan(log, grp)
+		assert.Equal(t, 1, len(grp.started))
+	})
+
+	t.Run("exclude files", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		writeFile(t, filepath.Join(dir, "a.log"), "a\n")
+		writeFile(t, filepath.Join(dir, "b.log"), "b\n")
+
+		p := newTestProspector(t, dir, map[string]interface{}{
+			"exclude_files": []string{`b\.log$`},
+		})
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		assert.Equal(t, 1, len(grp.started))
+	})
+
+	t.Run("remove state of removed files", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "a.log")
+		writeFile(t, path, "a\n")
+
+		p := newTestProspector(t, dir, nil)
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		id := grp.onlySource(t)
+		grp.stop(id)
+		p.onHarvesterStop(id, 2)
+
+		require.NoError(t, os.Remove(path))
+		p.scan(log, grp)
+		assert.Equal(t, []string{id}, grp.removed)
+	})
+
+	t.Run("keep state of existing files alive", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "a.log")
+		writeFile(t, path, "a\n")
+
+		p := newTestProspector(t, dir, map[string]interface{}{
+			"ignore_older": "1ns",
+		})
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		assert.Equal(t, 0, len(grp.started), "old file must not be collected")
+		p.scan(log, grp)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		id := p.newSource(path, info).id
+		assert.Equal(t, []string{id, id}, grp.touched)
+	})
+
+	t.Run("keep state of removed files if clean_removed is disabled", func(t *testing.T) {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "a.log")
+		writeFile(t, path, "a\n")
+
+		p := newTestProspector(t, dir, map[string]interface{}{
+			"clean_removed": false,
+		})
+		grp := newFakeSourceGroup()
+
+		p.scan(log, grp)
+		id := grp.onlySource(t)
+		grp.stop(id)
+		p.onHarvesterStop(id, 2)
+
+		require.NoError(t, os.Remove(path))
+		p.scan(log, grp)
+		assert.Empty(t, grp.removed)
+	})
+}
+
+func newTestProspector(t *testing.T, dir string, settings map[string]interface{}) *fileProspector {
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"paths": []string{filepath.Join(dir, "*.log")},
+	})
+	if settings != nil {
+		require.NoError(t, cfg.Merge(settings))
+	}
+
+	config := defaultConfig()
+	require.NoError(t, cfg.Unpack(&config))
+
+	p, err := newFileProspector(config, nil)
+	require.NoError(t, err)
+	return p
+}
+
+func newFakeSourceGroup() *fakeSourceGroup {
+	return &fakeSourceGroup{started: map[string]cursor.SourceRunner{}}
+}
+
+func (g *fakeSourceGroup) Start(source cursor.Source, run cursor.SourceRunner) bool {
+	if _, exists := g.started[source.Name()]; exists {
+		return false
+	}
+	g.started[source.Name()] = run
+	return true
+}
+
+func (g *fakeSourceGroup) Stop(source cursor.Source) { g.stop(source.Name()) }
+
+func (g *fakeSourceGroup) Remove(source cursor.Source) {
+	g.removed = append(g.removed, source.Name())
+}
+
+func (g *fakeSourceGroup) Touch(source cursor.Source) {
+	g.touched = append(g.touched, source.Name())
+}
+
+func (g *fakeSourceGroup) stop(id string) { delete(g.started, id) }
+
+func (g *fakeSourceGroup) onlySource(t *testing.T) string {
+	require.Equal(t, 1, len(g.started))
+	for id := range g.started {
+		return id
+	}
+	return ""
+}
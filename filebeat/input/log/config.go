@@ -34,6 +34,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/reader/multiline"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readjson"
+	"github.com/elastic/beats/v7/libbeat/reader/readxml"
 )
 
 type config struct {
@@ -69,6 +70,8 @@ type config struct {
 	MaxBytes       int                     `config:"max_bytes" validate:"min=0,nonzero"`
 	Multiline      *multiline.Config       `config:"multiline"`
 	JSON           *readjson.Config        `config:"json"`
+	XML            *readxml.Config         `config:"xml"`
+	Decompress     bool                    `config:"decompress"`
 
 	// Hidden on purpose, used by the docker input:
 	DockerJSON *struct {
@@ -180,6 +183,10 @@ func (c *config) Validate() error {
 		return fmt.Errorf("When using the JSON decoder and line filtering together, you need to specify a message_key value")
 	}
 
+	if c.JSON != nil && c.XML != nil {
+		return fmt.Errorf("The JSON and XML decoders cannot be used together")
+	}
+
 	if c.ScanSort != "" {
 		cfgwarn.Experimental("scan_sort is used.")
 
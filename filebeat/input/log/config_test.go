@@ -26,6 +26,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/elastic/beats/v7/filebeat/harvester"
+	"github.com/elastic/beats/v7/libbeat/reader/readjson"
+	"github.com/elastic/beats/v7/libbeat/reader/readxml"
 )
 
 func TestCleanOlderError(t *testing.T) {
@@ -70,3 +72,13 @@ func TestCleanOlderIgnoreOlder(t *testing.T) {
 	err := config.Validate()
 	assert.NoError(t, err)
 }
+
+func TestJSONAndXMLError(t *testing.T) {
+	config := config{
+		XML: &readxml.Config{},
+	}
+	assert.NoError(t, config.Validate())
+
+	config.JSON = &readjson.Config{}
+	assert.Error(t, config.Validate())
+}
@@ -18,6 +18,7 @@
 package log
 
 import (
+	"io"
 	"os"
 
 	"github.com/elastic/beats/v7/libbeat/common/file"
@@ -30,3 +31,27 @@ type File struct {
 func (File) Continuable() bool { return true }
 func (File) HasState() bool    { return true }
 func (f File) Removed() bool   { return file.IsRemoved(f.File) }
+
+// compressedFile reads the decompressed content of a compressed file.
+// Compressed files are not appended to, so reading stops at the end of the
+// decompressed content.
+type compressedFile struct {
+	file   *os.File
+	reader io.Reader
+
+	// number of decompressed bytes read
+	offset int64
+}
+
+func (f *compressedFile) Read(p []byte) (int, error) {
+	n, err := f.reader.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *compressedFile) Close() error               { return f.file.Close() }
+func (f *compressedFile) Name() string               { return f.file.Name() }
+func (f *compressedFile) Stat() (os.FileInfo, error) { return f.file.Stat() }
+func (f *compressedFile) Removed() bool              { return file.IsRemoved(f.file) }
+func (*compressedFile) Continuable() bool            { return false }
+func (*compressedFile) HasState() bool               { return true }
@@ -32,7 +32,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -54,6 +56,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
 	"github.com/elastic/beats/v7/libbeat/reader/readjson"
+	"github.com/elastic/beats/v7/libbeat/reader/readxml"
 )
 
 var (
@@ -328,7 +331,12 @@ func (h *Harvester) Run() error {
 			case ErrClosed:
 				logp.Info("Reader was closed: %s. Closing.", h.state.Source)
 			case io.EOF:
-				logp.Info("End of file reached: %s. Closing because close_eof is enabled.", h.state.Source)
+				if h.state.Compressed {
+					logp.Info("End of compressed file reached: %s. Closing.", h.state.Source)
+					h.state.Completed = true
+				} else {
+					logp.Info("End of file reached: %s. Closing because close_eof is enabled.", h.state.Source)
+				}
 			case ErrInactive:
 				logp.Info("File is inactive: %s. Closing because close_inactive of %v reached.", h.state.Source, h.config.CloseInactive)
 			case reader.ErrLineUnparsable:
@@ -337,6 +345,11 @@ func (h *Harvester) Run() error {
 				continue
 			default:
 				logp.Err("Read line error: %v; File: %v", err, h.state.Source)
+				if h.state.Compressed {
+					// The file might still be written, it is read again
+					// once its size changes or close_inactive is reached.
+					h.state.ReadFailed = true
+				}
 			}
 			return nil
 		}
@@ -464,6 +477,20 @@ func (h *Harvester) onMessage(
 		fields["message"] = text
 	}
 
+	// Check if xml fields exist, the message is kept as is
+	if xmlFields, ok := fields["xml"].(common.MapStr); ok && h.config.XML != nil && len(xmlFields) > 0 {
+		id, ts := readxml.MergeXMLFields(fields, xmlFields, *h.config.XML)
+		if !ts.IsZero() {
+			timestamp = ts
+		}
+
+		if id != "" {
+			meta = common.MapStr{
+				"_id": id,
+			}
+		}
+	}
+
 	err := forwarder.Send(beat.Event{
 		Timestamp: timestamp,
 		Fields:    fields,
@@ -531,30 +558,40 @@ func (h *Harvester) openFile() error {
 	harvesterOpenFiles.Add(1)
 
 	// Makes sure file handler is also closed on errors
-	err = h.validateFile(f)
+	source, err := h.validateFile(f)
 	if err != nil {
 		f.Close()
 		harvesterOpenFiles.Add(-1)
 		return err
 	}
 
-	h.source = File{File: f}
+	h.source = source
 	return nil
 }
 
-func (h *Harvester) validateFile(f *os.File) error {
+func (h *Harvester) validateFile(f *os.File) (harvester.Source, error) {
 	info, err := f.Stat()
 	if err != nil {
-		return fmt.Errorf("Failed getting stats for file %s: %s", h.state.Source, err)
+		return nil, fmt.Errorf("Failed getting stats for file %s: %s", h.state.Source, err)
 	}
 
 	if !info.Mode().IsRegular() {
-		return fmt.Errorf("Tried to open non regular file: %q %s", info.Mode(), info.Name())
+		return nil, fmt.Errorf("Tried to open non regular file: %q %s", info.Mode(), info.Name())
 	}
 
 	// Compares the stat of the opened file to the state given by the input. Abort if not match.
 	if !os.SameFile(h.state.Fileinfo, info) {
-		return errors.New("file info is not identical with opened file. Aborting harvesting and retrying file later again")
+		return nil, errors.New("file info is not identical with opened file. Aborting harvesting and retrying file later again")
+	}
+
+	if h.config.Decompress {
+		compression, err := readfile.DetectCompression(f)
+		if err != nil {
+			return nil, fmt.Errorf("Failed detecting compression of file %s: %s", h.state.Source, err)
+		}
+		if compression != readfile.CompressionNone {
+			return h.openCompressedFile(f, compression)
+		}
 	}
 
 	h.encoding, err = h.encodingFactory(f)
@@ -565,19 +602,56 @@ func (h *Harvester) validateFile(f *os.File) error {
 		} else {
 			logp.Err("Initialising encoding for '%v' failed: %v", f, err)
 		}
-		return err
+		return nil, err
 	}
 
 	// get file offset. Only update offset if no error
 	offset, err := h.initFileOffset(f)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	logp.Debug("harvester", "Setting offset for file: %s. Offset: %d ", h.state.Source, offset)
 	h.state.Offset = offset
 
-	return nil
+	return File{File: f}, nil
+}
+
+// openCompressedFile creates the source for reading the decompressed content
+// of a compressed file. As compressed content can not be seeked, the content
+// up to the last known offset is skipped.
+func (h *Harvester) openCompressedFile(f *os.File, compression string) (harvester.Source, error) {
+	r, err := readfile.NewDecompressReader(f, compression)
+	if errors.Is(err, readfile.ErrUnsupportedCompression) {
+		// Unsupported files are read as empty files, such that their state
+		// is completed and they are not opened again.
+		logp.Warn("Skipping %s compressed file: %s. The format is not supported.", compression, h.state.Source)
+		r, err = strings.NewReader(""), nil
+		h.state.Completed = true
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed reading compressed file %s: %s", h.state.Source, err)
+	}
+	source := &compressedFile{file: f, reader: r}
+
+	h.encoding, err = h.encodingFactory(source)
+	if err != nil {
+		logp.Err("Initialising encoding for compressed file '%v' failed: %v", h.state.Source, err)
+		return nil, err
+	}
+
+	if skip := h.state.Offset - source.offset; skip > 0 {
+		logp.Debug("harvester", "Skipping to offset %d in compressed file: %s", h.state.Offset, h.state.Source)
+		if _, err := io.CopyN(ioutil.Discard, source, skip); err != nil {
+			return nil, fmt.Errorf("Failed skipping to offset %d in compressed file %s: %s", h.state.Offset, h.state.Source, err)
+		}
+	}
+
+	logp.Debug("harvester", "Reading %s compressed file: %s. Offset: %d", compression, h.state.Source, source.offset)
+	h.state.Offset = source.offset
+	h.state.Compressed = true
+
+	return source, nil
 }
 
 func (h *Harvester) initFileOffset(file *os.File) (int64, error) {
@@ -636,12 +710,14 @@ func (h *Harvester) cleanup() {
 //
 // It creates a chain of readers which looks as following:
 //
-//   limit -> (multiline -> timeout) -> strip_newline -> json -> encode -> line -> log_file
+//   limit -> xml -> (multiline -> timeout) -> strip_newline -> json -> encode -> line -> log_file
 //
 // Each reader on the left, contains the reader on the right and calls `Next()` to fetch more data.
 // At the base of all readers the the log_file reader. That means in the data is flowing in the opposite direction:
 //
-//   log_file -> line -> encode -> json -> strip_newline -> (timeout -> multiline) -> limit
+//   log_file -> line -> encode -> json -> strip_newline -> (timeout -> multiline) -> xml -> limit
+//
+// XML records are decoded after multiline, as they usually span multiple lines.
 //
 // log_file implements io.Reader interface and encode reader is an adapter for io.Reader to
 // reader.Reader also handling file encodings. All other readers implement reader.Reader
@@ -698,5 +774,9 @@ func (h *Harvester) newLogFileReader() (reader.Reader, error) {
 		}
 	}
 
+	if h.config.XML != nil {
+		r = readxml.NewXMLReader(r, h.config.XML)
+	}
+
 	return readfile.NewLimitReader(r, h.config.MaxBytes), nil
 }
@@ -20,6 +20,9 @@
 package log
 
 import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -28,7 +31,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/beats/v7/filebeat/input/file"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/reader"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
@@ -121,6 +126,124 @@ func TestReadLine(t *testing.T) {
 	assert.Equal(t, err, ErrInactive)
 }
 
+func TestReadCompressedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := gzip.NewWriter(f)
+	_, err = w.Write([]byte("9Characte\nThis is line 2\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		offset int64
+		lines  []string
+	}{
+		"read from the beginning": {
+			offset: 0,
+			lines:  []string{"9Characte", "This is line 2"},
+		},
+		"continue from offset": {
+			offset: 10,
+			lines:  []string{"This is line 2"},
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			h := Harvester{
+				config: config{
+					LogConfig: LogConfig{
+						CloseInactive: 500 * time.Millisecond,
+						Backoff:       100 * time.Millisecond,
+						MaxBackoff:    1 * time.Second,
+						BackoffFactor: 2,
+					},
+					BufferSize:     100,
+					MaxBytes:       1000,
+					LineTerminator: readfile.LineFeed,
+					Decompress:     true,
+				},
+				state: file.State{
+					Source:   path,
+					Fileinfo: info,
+					Offset:   test.offset,
+				},
+			}
+			h.encodingFactory, _ = encoding.FindEncoding(h.config.Encoding)
+
+			require.NoError(t, h.openFile())
+			defer h.source.Close()
+			assert.True(t, h.state.Compressed)
+			assert.Equal(t, test.offset, h.state.Offset)
+
+			r, err := h.newLogFileReader()
+			require.NoError(t, err)
+
+			var lines []string
+			for {
+				_, text, _, _, err := readLine(r)
+				if err != nil {
+					assert.Equal(t, io.EOF, err)
+					break
+				}
+				lines = append(lines, text)
+			}
+			assert.Equal(t, test.lines, lines)
+		})
+	}
+}
+
+func TestReadUnsupportedCompressedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log.zst")
+	require.NoError(t, ioutil.WriteFile(path, []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x00}, 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	h := Harvester{
+		config: config{
+			LogConfig: LogConfig{
+				CloseInactive: 500 * time.Millisecond,
+				Backoff:       100 * time.Millisecond,
+				MaxBackoff:    1 * time.Second,
+				BackoffFactor: 2,
+			},
+			BufferSize:     100,
+			MaxBytes:       1000,
+			LineTerminator: readfile.LineFeed,
+			Decompress:     true,
+		},
+		state: file.State{
+			Source:   path,
+			Fileinfo: info,
+		},
+	}
+	h.encodingFactory, _ = encoding.FindEncoding(h.config.Encoding)
+
+	require.NoError(t, h.openFile())
+	defer h.source.Close()
+	assert.True(t, h.state.Compressed)
+	assert.True(t, h.state.Completed, "unsupported files must not be opened again")
+
+	r, err := h.newLogFileReader()
+	require.NoError(t, err)
+	_, _, _, _, err = readLine(r)
+	assert.Equal(t, io.EOF, err)
+}
+
 // readLine reads a full line into buffer and returns it.
 // In case of partial lines, readLine does return an error and an empty string
 // This could potentially be improved / replaced by https://github.com/elastic/beats/libbeat/tree/master/common/streambuf
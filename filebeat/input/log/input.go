@@ -180,8 +180,10 @@ func (p *Input) loadStates(states []file.State) error {
 
 			// Convert state to current identifier if different
 			// and remove outdated state
+			// States which cannot be identified by the new identifier, e.g.
+			// fingerprint on states without stored fingerprint, are kept as is.
 			newId, identifierName := p.fileStateIdentifier.GenerateID(state)
-			if state.IdentifierName != identifierName {
+			if state.IdentifierName != identifierName && newId != "" {
 				state.PrevId = state.Id
 				state.Id = newId
 				state.IdentifierName = identifierName
@@ -495,6 +497,12 @@ func (p *Input) scan() {
 			logp.Err("Skipping file %s due to error %s", path, err)
 		}
 
+		// Harvesting is deferred until the file can be identified
+		if newState.Id == "" {
+			logp.Debug("input", "File cannot be identified yet, skipping: %s", newState.Source)
+			continue
+		}
+
 		// Load last state
 		isNewState := p.states.IsNew(newState)
 
@@ -529,6 +537,24 @@ func (p *Input) scan() {
 func (p *Input) harvestExistingFile(newState file.State, oldState file.State) {
 	logp.Debug("input", "Update existing file for harvesting: %s, offset: %v", newState.Source, oldState.Offset)
 
+	// Compressed files are read once. The offset counts the decompressed
+	// bytes and can not be compared with the file size. A harvester is only
+	// restarted if it was stopped before reaching the end of the file. If
+	// reading failed, the file is only read again once its size changed or
+	// close_inactive is reached, as it might still be written.
+	if oldState.Compressed {
+		if oldState.Finished && !oldState.Completed && p.retryCompressed(newState, oldState) {
+			logp.Debug("input", "Resuming harvesting of compressed file: %s, offset: %d", newState.Source, oldState.Offset)
+			err := p.startHarvester(newState, oldState.Offset)
+			if err != nil {
+				logp.Err("Harvester could not be started on existing file: %s, Err: %s", newState.Source, err)
+			}
+			return
+		}
+		p.handleRename(newState, oldState)
+		return
+	}
+
 	// No harvester is running for the file, start a new harvester
 	// It is important here that only the size is checked and not modification time, as modification time could be incorrect on windows
 	// https://blogs.technet.microsoft.com/asiasupp/2010/12/14/file-date-modified-property-are-not-updating-while-modifying-a-file-without-closing-it/
@@ -556,6 +582,22 @@ func (p *Input) harvestExistingFile(newState file.State, oldState file.State) {
 		return
 	}
 
+	p.handleRename(newState, oldState)
+}
+
+// retryCompressed checks if reading a compressed file is resumed.
+func (p *Input) retryCompressed(newState file.State, oldState file.State) bool {
+	if !oldState.ReadFailed {
+		return true
+	}
+	if oldState.Fileinfo != nil && newState.Fileinfo.Size() != oldState.Fileinfo.Size() {
+		return true
+	}
+	return time.Since(oldState.Timestamp) >= p.config.CloseInactive
+}
+
+// handleRename updates the state of a file if it was renamed
+func (p *Input) handleRename(newState file.State, oldState file.State) {
 	// Check if file was renamed
 	if oldState.Source != "" && oldState.Source != newState.Source {
 		// This does not start a new harvester as it is assume that the older harvester is still running
@@ -89,6 +89,43 @@ func TestIsCleanInactive(t *testing.T) {
 	}
 }
 
+func TestRetryCompressed(t *testing.T) {
+	p := Input{
+		config: config{
+			LogConfig: LogConfig{CloseInactive: 1 * time.Minute},
+		},
+	}
+	newState := file.State{Fileinfo: TestFileInfo{size: 100}}
+
+	cases := map[string]struct {
+		oldState file.State
+		result   bool
+	}{
+		"interrupted": {
+			oldState: file.State{Fileinfo: TestFileInfo{size: 100}, Timestamp: time.Now()},
+			result:   true,
+		},
+		"failed": {
+			oldState: file.State{Fileinfo: TestFileInfo{size: 100}, Timestamp: time.Now(), ReadFailed: true},
+			result:   false,
+		},
+		"failed and grown": {
+			oldState: file.State{Fileinfo: TestFileInfo{size: 50}, Timestamp: time.Now(), ReadFailed: true},
+			result:   true,
+		},
+		"failed and inactive": {
+			oldState: file.State{Fileinfo: TestFileInfo{size: 100}, Timestamp: time.Now().Add(-2 * time.Minute), ReadFailed: true},
+			result:   true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.result, p.retryCompressed(newState, test.oldState))
+		})
+	}
+}
+
 func TestInputLifecycle(t *testing.T) {
 	cases := []struct {
 		title  string
@@ -279,10 +316,11 @@ func TestMatchesMeta(t *testing.T) {
 
 type TestFileInfo struct {
 	time time.Time
+	size int64
 }
 
 func (t TestFileInfo) Name() string       { return "" }
-func (t TestFileInfo) Size() int64        { return 0 }
+func (t TestFileInfo) Size() int64        { return t.size }
 func (t TestFileInfo) Mode() os.FileMode  { return 0 }
 func (t TestFileInfo) ModTime() time.Time { return t.time }
 func (t TestFileInfo) IsDir() bool        { return false }
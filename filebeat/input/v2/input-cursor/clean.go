@@ -115,6 +115,10 @@ func checkCleanResource(started, now time.Time, resource *resource) bool {
 	defer resource.stateMutex.Unlock()
 
 	ttl := resource.internalState.TTL
+	if ttl < 0 {
+		return false
+	}
+
 	reference := resource.internalState.Updated
 	if started.After(reference) {
 		reference = started
@@ -101,6 +101,25 @@ func TestGCStore(t *testing.T) {
 		checkEqualStoreState(t, initState, backend.snapshot())
 	})
 
+	t.Run("state with negative ttl is never removed", func(t *testing.T) {
+		started := time.Now().Add(-5 * time.Hour)
+
+		initState := map[string]state{
+			"test::key": {
+				TTL:     -1,
+				Updated: started.Add(-24 * time.Hour),
+			},
+		}
+
+		backend := createSampleStore(t, initState)
+		store := testOpenStore(t, "test", backend)
+		defer store.Release()
+
+		gcStore(logp.NewLogger("test"), started, store)
+
+		checkEqualStoreState(t, initState, backend.snapshot())
+	})
+
 	t.Run("old state but resource is accessed", func(t *testing.T) {
 		const ttl = 60 * time.Second
 		started := time.Now().Add(-5 * ttl) // cleanup process is running for a while already
@@ -47,11 +47,23 @@
 // The coordination between inputs guarantees that all updates are always in
 // order.
 //
+// The states of sources that have been removed are written with a TTL to the
+// persistent store, once no input is collecting from the source and all
+// pending updates have been written. This way the persistent store expires
+// the entries right away, instead of waiting for the garbage collector.
+//
 // When a shutdown signal is received, the publisher is directly disconnected
 // from the outputs. As all coordination is directly handled by the
 // InputManager, shutdown will be immediate (once the input itself has
 // returned), and can not be blocked by the outputs.
 //
+// Inputs that discover their sources at runtime (e.g. files matching a glob
+// pattern) implement the DynamicInput interface and set ConfigureDynamic
+// instead of Configure. A DynamicInput uses the SourceGroup passed to Run to
+// start and stop collecting from sources. Each source started this way is
+// handled like a configured source: it gets its own go-routine, cursor and
+// publisher, and its state is subject to the same garbage collection.
+//
 // An input that is about to collect a source that is already collected by
 // another input will wait until the other input has returned or the current
 // input did receive a shutdown signal.
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cursor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-concert/ctxtool"
+	"github.com/elastic/go-concert/unison"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// DynamicInput is implemented by inputs that discover the sources to collect
+// from at runtime, e.g. by scanning for files matching a glob pattern.
+// The InputManager creates a DynamicInput if ConfigureDynamic is set.
+type DynamicInput interface {
+	Name() string
+
+	// Test checks the configuration and runs additional checks if the input
+	// can actually collect data for the given configuration.
+	Test(input.TestContext) error
+
+	// Run discovers sources and uses the SourceGroup to collect from them.
+	// Run must return an error only if the error is fatal making it impossible
+	// for the input to recover. All sources still being collected are stopped
+	// after Run has returned.
+	Run(input.Context, SourceGroup) error
+}
+
+// SourceGroup starts and stops the go-routines collecting from the sources
+// discovered by a DynamicInput. Each source is collected by at most one
+// go-routine, with its own cursor and publisher, just like sources configured
+// for an Input.
+type SourceGroup interface {
+	// Start starts a go-routine calling run for the source. Start returns
+	// false if the source is already collected by the input.
+	Start(source Source, run SourceRunner) bool
+
+	// Stop signals the go-routine collecting from source to shut down.
+	Stop(source Source)
+
+	// Remove marks the state of the source as expired. The state will be
+	// removed from the persistent store by the cleaner, once the source is not
+	// collected anymore and all pending updates have been written.
+	Remove(source Source)
+
+	// Touch marks the source as still existing, such that its state does not
+	// expire while the source is not collected. Touch has no effect if no state
+	// is known for the source.
+	Touch(source Source)
+}
+
+// SourceRunner collects events from a single source. The go-routine running
+// the SourceRunner holds the lock on the source until it returns.
+type SourceRunner func(input.Context, Cursor, Publisher) error
+
+// dynamicInput implements the v2.Input interface for DynamicInputs.
+type dynamicInput struct {
+	manager      *InputManager
+	userID       string
+	input        DynamicInput
+	cleanTimeout time.Duration
+}
+
+// sourceGroup implements the SourceGroup interface. Errors returned by
+// SourceRunners are logged only, as a failing source must not stop the
+// collection of other sources.
+type sourceGroup struct {
+	ctx      input.Context
+	input    *dynamicInput
+	pipeline beat.PipelineConnector
+	tasks    unison.TaskGroup
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// Name is required to implement the v2.Input interface
+func (inp *dynamicInput) Name() string { return inp.input.Name() }
+
+// Test runs the Test method of the DynamicInput.
+func (inp *dynamicInput) Test(ctx input.TestContext) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("input panic with: %+v\n%s", v, debug.Stack())
+			ctx.Logger.Errorf("Input crashed with: %+v", err)
+		}
+	}()
+	return inp.input.Test(ctx)
+}
+
+// Run runs the DynamicInput until it returns or the input is stopped. All
+// sources are stopped before Run returns.
+func (inp *dynamicInput) Run(
+	ctx input.Context,
+	pipeline beat.PipelineConnector,
+) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("input panic with: %+v\n%s", v, debug.Stack())
+			ctx.Logger.Errorf("Input crashed with: %+v", err)
+		}
+	}()
+
+	grp := &sourceGroup{
+		ctx:      ctx,
+		input:    inp,
+		pipeline: pipeline,
+		running:  map[string]context.CancelFunc{},
+	}
+	defer grp.tasks.Stop()
+
+	return inp.input.Run(ctx, grp)
+}
+
+func (grp *sourceGroup) Start(source Source, run SourceRunner) bool {
+	key := grp.input.manager.sourceKey(grp.input.userID, source)
+
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	if _, exists := grp.running[key]; exists {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(ctxtool.FromCanceller(grp.ctx.Cancelation))
+	err := grp.tasks.Go(func(canceler unison.Canceler) error {
+		defer grp.finished(key)
+		defer cancel()
+
+		// stop the source if the task group is stopped
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-canceler.Done():
+				cancel()
+			}
+		}()
+
+		srcCtx := grp.ctx
+		srcCtx.ID = grp.ctx.ID + "::" + source.Name()
+		srcCtx.Logger = grp.ctx.Logger.With("source", source.Name())
+		srcCtx.Cancelation = ctx
+
+		if err := grp.runSource(srcCtx, key, run); err != nil && ctx.Err() == nil {
+			srcCtx.Logger.Errorf("Collecting from source failed: %+v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		cancel()
+		return false
+	}
+
+	grp.running[key] = cancel
+	return true
+}
+
+func (grp *sourceGroup) runSource(ctx input.Context, key string, run SourceRunner) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("input panic with: %+v\n%s", v, debug.Stack())
+			ctx.Logger.Errorf("Input crashed with: %+v", err)
+		}
+	}()
+
+	inp := grp.input
+	return runWithResource(ctx, inp.manager, inp.manager.store, key, inp.cleanTimeout, grp.pipeline, run)
+}
+
+func (grp *sourceGroup) finished(key string) {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	delete(grp.running, key)
+}
+
+func (grp *sourceGroup) Stop(source Source) {
+	key := grp.input.manager.sourceKey(grp.input.userID, source)
+
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	if cancel, exists := grp.running[key]; exists {
+		cancel()
+	}
+}
+
+func (grp *sourceGroup) Remove(source Source) {
+	key := grp.input.manager.sourceKey(grp.input.userID, source)
+	store := grp.input.manager.store
+
+	resource := store.ephemeralStore.Find(key, false)
+	if resource == nil {
+		return
+	}
+	defer resource.Release()
+	store.UpdateTTL(resource, 0)
+}
+
+func (grp *sourceGroup) Touch(source Source) {
+	key := grp.input.manager.sourceKey(grp.input.userID, source)
+	store := grp.input.manager.store
+
+	resource := store.ephemeralStore.Find(key, false)
+	if resource == nil {
+		return
+	}
+	defer resource.Release()
+	store.Touch(resource)
+}
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cursor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/tests/resources"
+)
+
+type fakeDynamicInput struct {
+	OnTest func(input.TestContext) error
+	OnRun  func(input.Context, SourceGroup) error
+}
+
+func TestManager_CreateDynamic(t *testing.T) {
+	t.Run("fail if no input runner is returned", func(t *testing.T) {
+		manager := dynamicManager(t, nil)
+		_, err := manager.Create(common.NewConfig())
+		require.Error(t, err)
+	})
+
+	t.Run("configure ok", func(t *testing.T) {
+		manager := dynamicManager(t, &fakeDynamicInput{})
+		_, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+	})
+}
+
+func TestManager_DynamicInputsRun(t *testing.T) {
+	t.Run("sources are started only once", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		runs := map[string]int{}
+		manager := dynamicManager(t, &fakeDynamicInput{
+			OnRun: func(ctx input.Context, grp SourceGroup) error {
+				run := func(ctx input.Context, _ Cursor, _ Publisher) error {
+					mu.Lock()
+					runs[ctx.ID]++
+					mu.Unlock()
+					<-ctx.Cancelation.Done()
+					return nil
+				}
+
+				assert.True(t, grp.Start(stringSource("a"), run))
+				assert.True(t, grp.Start(stringSource("b"), run))
+				assert.False(t, grp.Start(stringSource("a"), run))
+				return nil
+			},
+		})
+
+		inp, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+
+		var clientCounters pubtest.ClientCounter
+		err = inp.Run(input.Context{
+			ID:          "test",
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, clientCounters.BuildConnector())
+		require.NoError(t, err)
+		require.Equal(t, 0, clientCounters.Active())
+		assert.Equal(t, map[string]int{"test::a": 1, "test::b": 1}, runs)
+	})
+
+	t.Run("stopped source can be restarted", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		manager := dynamicManager(t, &fakeDynamicInput{
+			OnRun: func(ctx input.Context, grp SourceGroup) error {
+				done := make(chan struct{})
+				run := func(ctx input.Context, _ Cursor, _ Publisher) error {
+					defer close(done)
+					<-ctx.Cancelation.Done()
+					return nil
+				}
+
+				require.True(t, grp.Start(stringSource("a"), run))
+				grp.Stop(stringSource("a"))
+				<-done
+
+				for !grp.Start(stringSource("a"), func(input.Context, Cursor, Publisher) error { return nil }) {
+					time.Sleep(1 * time.Millisecond)
+				}
+				return nil
+			},
+		})
+
+		inp, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+
+		var clientCounters pubtest.ClientCounter
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, clientCounters.BuildConnector())
+		require.NoError(t, err)
+	})
+
+	t.Run("continue sending from last known position", func(t *testing.T) {
+		log := logp.NewLogger("test")
+
+		manager := dynamicManager(t, &fakeDynamicInput{
+			OnRun: func(ctx input.Context, grp SourceGroup) error {
+				var wg sync.WaitGroup
+				wg.Add(1)
+				grp.Start(stringSource("test"), func(_ input.Context, cursor Cursor, pub Publisher) error {
+					defer wg.Done()
+
+					state := struct{ N int }{}
+					if err := cursor.Unpack(&state); err != nil {
+						return err
+					}
+					for i := 0; i < 3; i++ {
+						event := beat.Event{Fields: common.MapStr{"n": state.N}}
+						state.N++
+						pub.Publish(event, state)
+					}
+					return nil
+				})
+				wg.Wait()
+				return nil
+			},
+		})
+
+		var ids []int
+		pipeline := pubtest.ConstClient(&pubtest.FakeClient{
+			PublishFunc: func(event beat.Event) {
+				ids = append(ids, event.Fields["n"].(int))
+			},
+		})
+
+		for i := 0; i < 2; i++ {
+			inp, err := manager.Create(common.NewConfig())
+			require.NoError(t, err)
+			require.NoError(t, inp.Run(input.Context{
+				Logger:      log,
+				Cancelation: context.Background(),
+			}, pipeline))
+		}
+
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, ids)
+	})
+
+	t.Run("remove expires the source state", func(t *testing.T) {
+		store := createSampleStore(t, nil)
+		manager := dynamicManager(t, &fakeDynamicInput{
+			OnRun: func(ctx input.Context, grp SourceGroup) error {
+				done := make(chan struct{})
+				grp.Start(stringSource("key"), func(input.Context, Cursor, Publisher) error {
+					close(done)
+					return nil
+				})
+				<-done
+				grp.Remove(stringSource("key"))
+				return nil
+			},
+		})
+		manager.StateStore = store
+		manager.DefaultCleanTimeout = time.Hour
+
+		inp, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+
+		var clientCounters pubtest.ClientCounter
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, clientCounters.BuildConnector())
+		require.NoError(t, err)
+
+		_, exists := store.snapshot()["test::key"]
+		assert.False(t, exists, "removed state must be expired in the persistent store")
+	})
+}
+
+func dynamicManager(t *testing.T, inp DynamicInput) *InputManager {
+	return &InputManager{
+		Logger:     logp.NewLogger("test"),
+		StateStore: createSampleStore(t, nil),
+		Type:       "test",
+		ConfigureDynamic: func(_ *common.Config) (DynamicInput, error) {
+			return inp, nil
+		},
+	}
+}
+
+func (f *fakeDynamicInput) Name() string { return "test" }
+
+func (f *fakeDynamicInput) Test(ctx input.TestContext) error {
+	if f.OnTest != nil {
+		return f.OnTest(ctx)
+	}
+	return nil
+}
+
+func (f *fakeDynamicInput) Run(ctx input.Context, grp SourceGroup) error {
+	if f.OnRun != nil {
+		return f.OnRun(ctx, grp)
+	}
+	return nil
+}
@@ -145,6 +145,25 @@ func (inp *managedInput) runSource(
 		}
 	}()
 
+	resourceKey := inp.manager.sourceKey(inp.userID, source)
+	return runWithResource(ctx, inp.manager, store, resourceKey, inp.cleanTimeout, pipeline,
+		func(ctx input.Context, cursor Cursor, publisher Publisher) error {
+			return inp.input.Run(ctx, source, cursor, publisher)
+		})
+}
+
+// runWithResource connects to the publisher pipeline and locks the resource
+// for key before calling run. The lock and the pipeline connection are
+// released when run returns.
+func runWithResource(
+	ctx input.Context,
+	manager *InputManager,
+	store *store,
+	key string,
+	cleanTimeout time.Duration,
+	pipeline beat.PipelineConnector,
+	run SourceRunner,
+) error {
 	client, err := pipeline.ConnectWith(beat.ClientConfig{
 		CloseRef:   ctx.Cancelation,
 		ACKHandler: newInputACKHandler(ctx.Logger),
@@ -154,25 +173,19 @@ func (inp *managedInput) runSource(
 	}
 	defer client.Close()
 
-	resourceKey := inp.createSourceID(source)
-	resource, err := inp.manager.lock(ctx, resourceKey)
+	resource, err := manager.lock(ctx, key)
 	if err != nil {
 		return err
 	}
 	defer releaseResource(resource)
 
-	store.UpdateTTL(resource, inp.cleanTimeout)
+	store.own(resource)
+	defer store.disown(resource)
+	store.UpdateTTL(resource, cleanTimeout)
 
 	cursor := makeCursor(store, resource)
 	publisher := &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &cursor}
-	return inp.input.Run(ctx, source, cursor, publisher)
-}
-
-func (inp *managedInput) createSourceID(s Source) string {
-	if inp.userID != "" {
-		return fmt.Sprintf("%v::%v::%v", inp.manager.Type, inp.userID, s.Name())
-	}
-	return fmt.Sprintf("%v::%v", inp.manager.Type, s.Name())
+	return run(ctx, cursor, publisher)
 }
 
 func newInputACKHandler(log *logp.Logger) beat.ACKer {
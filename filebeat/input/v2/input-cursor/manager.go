@@ -19,6 +19,7 @@ package cursor
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -57,13 +58,19 @@ type InputManager struct {
 	Type string
 
 	// DefaultCleanTimeout configures the key/value garbage collection interval.
-	// The InputManager will only collect keys for the configured 'Type'
+	// The InputManager will only collect keys for the configured 'Type'.
+	// A negative timeout disables the garbage collection of inactive keys.
 	DefaultCleanTimeout time.Duration
 
 	// Configure returns an array of Sources, and a configured Input instances
 	// that will be used to collect events from each source.
 	Configure func(cfg *common.Config) ([]Source, Input, error)
 
+	// ConfigureDynamic is used instead of Configure by inputs that discover
+	// the sources to collect from at runtime. Only one of Configure and
+	// ConfigureDynamic must be set.
+	ConfigureDynamic func(cfg *common.Config) (DynamicInput, error)
+
 	initOnce sync.Once
 	initErr  error
 	store    *store
@@ -87,7 +94,7 @@ type StateStore interface {
 
 func (cim *InputManager) init() error {
 	cim.initOnce.Do(func() {
-		if cim.DefaultCleanTimeout <= 0 {
+		if cim.DefaultCleanTimeout == 0 {
 			cim.DefaultCleanTimeout = 30 * time.Minute
 		}
 
@@ -158,6 +165,23 @@ func (cim *InputManager) Create(config *common.Config) (input.Input, error) {
 		return nil, err
 	}
 
+	if cim.ConfigureDynamic != nil {
+		inp, err := cim.ConfigureDynamic(config)
+		if err != nil {
+			return nil, err
+		}
+		if inp == nil {
+			return nil, errNoInputRunner
+		}
+
+		return &dynamicInput{
+			manager:      cim,
+			userID:       settings.ID,
+			input:        inp,
+			cleanTimeout: settings.CleanTimeout,
+		}, nil
+	}
+
 	sources, inp, err := cim.Configure(config)
 	if err != nil {
 		return nil, err
@@ -178,6 +202,15 @@ func (cim *InputManager) Create(config *common.Config) (input.Input, error) {
 	}, nil
 }
 
+// sourceKey creates the key used to store the state of source in the
+// persistent store.
+func (cim *InputManager) sourceKey(userID string, s Source) string {
+	if userID != "" {
+		return fmt.Sprintf("%v::%v::%v", cim.Type, userID, s.Name())
+	}
+	return fmt.Sprintf("%v::%v", cim.Type, s.Name())
+}
+
 // Lock locks a key for exclusive access and returns an resource that can be used to modify
 // the cursor state and unlock the key.
 func (cim *InputManager) lock(ctx input.Context, key string) (*resource, error) {
@@ -141,7 +141,7 @@ func (op *updateOp) Execute(n uint) {
 		resource.internalState.Updated = op.timestamp
 	}
 
-	err := op.store.persistentStore.Set(resource.key, resource.inSyncStateSnapshot())
+	err := op.store.persist(resource)
 	if err != nil {
 		if !statestore.IsClosed(err) {
 			op.store.log.Errorf("Failed to update state in the registry for '%v'", resource.key)
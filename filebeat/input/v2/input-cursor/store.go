@@ -18,7 +18,6 @@
 package cursor
 
 import (
-	"strings"
 	"sync"
 	"time"
 
@@ -82,6 +81,9 @@ type resource struct {
 	// stored indicates that the state is available in the registry file. It is false for new entries.
 	stored bool
 
+	// owned is true while an input holds the lock on the resource.
+	owned bool
+
 	// internalInSync is true if all 'Internal' metadata like TTL or update timestamp are in sync.
 	// Normally resources are added when being created. But if operations failed we will retry inserting
 	// them on each update operation until we eventually succeeded
@@ -162,6 +164,77 @@ func (s *store) close() {
 	}
 }
 
+// Touch sets the update timestamp of a resource to the current time, such that
+// the resource does not expire while its source still exists. The timestamp is
+// only written to the persistent store once half of the TTL has passed, so
+// sources being touched on every scan do not cause a registry write each time.
+// Resources without TTL or already marked as removed are not modified.
+func (s *store) Touch(resource *resource) {
+	resource.stateMutex.Lock()
+	defer resource.stateMutex.Unlock()
+
+	ttl := resource.internalState.TTL
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if resource.stored && now.Sub(resource.internalState.Updated) < ttl/2 {
+		return
+	}
+
+	resource.internalState.Updated = now
+	s.persistInternal(resource)
+}
+
+// own marks the resource as being collected by an input.
+func (s *store) own(resource *resource) {
+	resource.stateMutex.Lock()
+	defer resource.stateMutex.Unlock()
+	resource.owned = true
+}
+
+// disown marks the resource as not being collected by an input anymore. The
+// state of a removed resource without pending updates is written again, such
+// that it expires in the persistent store.
+func (s *store) disown(resource *resource) {
+	resource.stateMutex.Lock()
+	defer resource.stateMutex.Unlock()
+
+	resource.owned = false
+	if resource.stored && resource.internalState.TTL == 0 && resource.activeCursorOperations == 0 {
+		s.persistInternal(resource)
+	}
+}
+
+// persistInternal writes the in-sync state of the resource, logging errors
+// on failure. The caller must hold the resource its stateMutex.
+func (s *store) persistInternal(resource *resource) {
+	if err := s.persist(resource); err != nil {
+		s.log.Errorf("Failed to update resource management fields for '%v'", resource.key)
+		resource.internalInSync = false
+	} else {
+		resource.stored = true
+		resource.internalInSync = true
+	}
+}
+
+// persist writes the in-sync state of the resource to the persistent store.
+// The state of a removed resource (TTL of 0), that is neither collected by an
+// input nor has pending updates, is written as expired. The persistent store
+// hides the entry immediately, and the entry is not loaded again after a
+// restart, even if the Beat is stopped before the cleaner did remove it.
+// Other states are not expired by the persistent store, as the cleaner does
+// not count the time the Beat was stopped.
+// The caller must hold the resource its stateMutex.
+func (s *store) persist(resource *resource) error {
+	st := resource.inSyncStateSnapshot()
+	if resource.internalState.TTL == 0 && !resource.owned && resource.activeCursorOperations == 0 {
+		return s.persistentStore.SetWithTTL(resource.key, st, 0)
+	}
+	return s.persistentStore.Set(resource.key, st)
+}
+
 // Get returns the resource for the key.
 // A new shared resource is generated if the key is not known. The generated
 // resource is not synced to disk yet.
@@ -184,19 +257,7 @@ func (s *store) UpdateTTL(resource *resource, ttl time.Duration) {
 	if resource.internalState.Updated.IsZero() {
 		resource.internalState.Updated = time.Now()
 	}
-
-	err := s.persistentStore.Set(resource.key, state{
-		TTL:     resource.internalState.TTL,
-		Updated: resource.internalState.Updated,
-		Cursor:  resource.cursor,
-	})
-	if err != nil {
-		s.log.Errorf("Failed to update resource management fields for '%v'", resource.key)
-		resource.internalInSync = false
-	} else {
-		resource.stored = true
-		resource.internalInSync = true
-	}
+	s.persistInternal(resource)
 }
 
 // Find returns the resource for a given key. If the key is unknown and create is set to false nil will be returned.
@@ -289,11 +350,7 @@ func readStates(log *logp.Logger, store *statestore.Store, prefix string) (*stat
 		table: map[string]*resource{},
 	}
 
-	err := store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
-		if !strings.HasPrefix(string(key), keyPrefix) {
-			return true, nil
-		}
-
+	err := store.EachPrefix(keyPrefix, func(key string, dec statestore.ValueDecoder) (bool, error) {
 		var st state
 		if err := dec.Decode(&st); err != nil {
 			log.Errorf("Failed to read regisry state for '%v', cursor state will be ignored. Error was: %+v",
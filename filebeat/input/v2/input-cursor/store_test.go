@@ -227,6 +227,111 @@ func TestStore_UpdateTTL(t *testing.T) {
 	})
 }
 
+func TestStore_Touch(t *testing.T) {
+	t.Run("refresh timestamp of expiring resource", func(t *testing.T) {
+		updated := time.Now().Add(-time.Hour)
+		backend := createSampleStore(t, map[string]state{
+			"test::key": {
+				TTL:     time.Hour,
+				Updated: updated,
+				Cursor:  "test",
+			},
+		})
+		store := testOpenStore(t, "test", backend)
+		defer store.Release()
+
+		res := store.Get("test::key")
+		defer res.Release()
+		store.Touch(res)
+
+		assert.True(t, res.internalState.Updated.After(updated))
+		want := map[string]state{
+			"test::key": {
+				TTL:     time.Hour,
+				Updated: res.internalState.Updated,
+				Cursor:  "test",
+			},
+		}
+		checkEqualStoreState(t, want, backend.snapshot())
+	})
+
+	t.Run("recently updated resource is not written", func(t *testing.T) {
+		updated := time.Now().Add(-time.Minute)
+		store := testOpenStore(t, "test", createSampleStore(t, map[string]state{
+			"test::key": {
+				TTL:     time.Hour,
+				Updated: updated,
+				Cursor:  "test",
+			},
+		}))
+		defer store.Release()
+
+		res := store.Get("test::key")
+		defer res.Release()
+		store.Touch(res)
+
+		assert.True(t, res.internalState.Updated.Equal(updated))
+	})
+
+	t.Run("removed resource stays removed", func(t *testing.T) {
+		updated := time.Now().Add(-time.Hour)
+		store := testOpenStore(t, "test", createSampleStore(t, map[string]state{
+			"test::key": {
+				TTL:     0,
+				Updated: updated,
+				Cursor:  "test",
+			},
+		}))
+		defer store.Release()
+
+		res := store.Get("test::key")
+		defer res.Release()
+		store.Touch(res)
+
+		assert.True(t, res.internalState.Updated.Equal(updated))
+	})
+}
+
+func TestStore_Disown(t *testing.T) {
+	t.Run("removed state is kept while owned", func(t *testing.T) {
+		backend := createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Hour, Cursor: "test"},
+		})
+		store := testOpenStore(t, "test", backend)
+		defer store.Release()
+
+		res := store.Get("test::key")
+		defer res.Release()
+		store.own(res)
+		store.UpdateTTL(res, 0)
+
+		_, exists := backend.snapshot()["test::key"]
+		assert.True(t, exists)
+
+		store.disown(res)
+		_, exists = backend.snapshot()["test::key"]
+		assert.False(t, exists, "removed state must expire once disowned")
+	})
+
+	t.Run("state with TTL does not expire", func(t *testing.T) {
+		backend := createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Nanosecond, Cursor: "test"},
+		})
+		store := testOpenStore(t, "test", backend)
+		defer store.Release()
+
+		res := store.Get("test::key")
+		defer res.Release()
+		store.own(res)
+		store.UpdateTTL(res, time.Millisecond)
+		store.disown(res)
+
+		time.Sleep(10 * time.Millisecond)
+		_, exists := backend.snapshot()["test::key"]
+		assert.True(t, exists, "only the cleaner must remove states with TTL")
+	})
+}
+
 func closeStoreWith(fn func(s *store)) func() {
 	old := closeStore
 	closeStore = fn
@@ -44,6 +44,11 @@ type Client interface {
 type ClientConfig struct {
 	PublishMode PublishMode
 
+	// Priority of the client's events in the queue. If the queue has
+	// priority levels configured, events with higher priority are forwarded
+	// to the outputs first. The default priority 0 is the lowest.
+	Priority int
+
 	Processing ProcessingConfig
 
 	CloseRef CloseRef
@@ -0,0 +1,440 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/common/terminal"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/spool"
+)
+
+// queueCmdFlags are the flags shared by all queue subcommands.
+type queueCmdFlags struct {
+	// Overrides the queue directory (disk queue) or file (spool) from the
+	// beat configuration.
+	path string
+
+	// Inspect the spool file instead of the disk queue.
+	spool bool
+}
+
+// genQueueCmd initializes the queue command to inspect and repair the files
+// of a disk queue or spool while the beat is stopped, with the following
+// subcommands:
+//  - list
+//  - state
+//  - dump
+//  - verify
+//  - truncate
+func genQueueCmd(settings instance.Settings) *cobra.Command {
+	flags := &queueCmdFlags{}
+	queueCmd := cobra.Command{
+		Use:   "queue",
+		Short: "Inspect the disk queue or spool of a stopped beat",
+	}
+	queueCmd.PersistentFlags().StringVar(&flags.path, "queue.path", "",
+		"Path of the disk queue directory or spool file, overriding the configuration")
+	queueCmd.PersistentFlags().BoolVar(&flags.spool, "spool", false,
+		"Inspect the spool file rather than the disk queue")
+
+	queueCmd.AddCommand(genListQueueCmd(settings, flags))
+	queueCmd.AddCommand(genStateQueueCmd(settings, flags))
+	queueCmd.AddCommand(genDumpQueueCmd(settings, flags))
+	queueCmd.AddCommand(genVerifyQueueCmd(settings, flags))
+	queueCmd.AddCommand(genTruncateQueueCmd(settings, flags))
+
+	return &queueCmd
+}
+
+func genListQueueCmd(settings instance.Settings, flags *queueCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List disk queue segments or the spool file",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			if useSpool(b, flags) {
+				path, err := spoolPath(b, flags)
+				if err != nil {
+					return err
+				}
+				return listSpool(path)
+			}
+			queueSettings, err := diskQueueSettings(b, flags)
+			if err != nil {
+				return err
+			}
+			return listSegments(queueSettings)
+		}),
+	}
+}
+
+func genStateQueueCmd(settings instance.Settings, flags *queueCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "state",
+		Short: "Show the acknowledged position of the disk queue, or the number of pending spool events",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			if useSpool(b, flags) {
+				path, err := spoolPath(b, flags)
+				if err != nil {
+					return err
+				}
+				// The spool only keeps events that were not acknowledged.
+				events, _, err := countSpoolEvents(path)
+				if err != nil {
+					return fmt.Errorf("error reading spool file: %s", err)
+				}
+				fmt.Printf("pending events: %d\n", events)
+				return nil
+			}
+			queueSettings, err := diskQueueSettings(b, flags)
+			if err != nil {
+				return err
+			}
+			position, err := diskqueue.ReadQueuePosition(queueSettings)
+			if err != nil {
+				return fmt.Errorf("error reading queue state: %s", err)
+			}
+			fmt.Printf("segment: %d\noffset: %d\n", position.SegmentID, position.Offset)
+			return nil
+		}),
+	}
+}
+
+func genDumpQueueCmd(settings instance.Settings, flags *queueCmdFlags) *cobra.Command {
+	var flagSegment int64
+	var flagAll bool
+	command := &cobra.Command{
+		Use:   "dump",
+		Short: "Print the queued events as NDJSON",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			encoder := json.New(b.Info.Version, json.Config{})
+			printEvent := func(event publisher.Event) error {
+				serialized, err := encoder.Encode(b.Info.Beat, &event.Content)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", serialized)
+				return err
+			}
+
+			if useSpool(b, flags) {
+				path, err := spoolPath(b, flags)
+				if err != nil {
+					return err
+				}
+				_, err = spool.Inspect(path, printEvent, func(err error) {
+					fmt.Fprintf(os.Stderr, "Skipping event that could not be decoded: %s\n", err)
+				})
+				return err
+			}
+
+			queueSettings, err := diskQueueSettings(b, flags)
+			if err != nil {
+				return err
+			}
+			segments, err := selectSegments(queueSettings, flagSegment)
+			if err != nil {
+				return err
+			}
+			// Unless all events were requested, skip the ones that were already
+			// acknowledged but not yet deleted.
+			position := diskqueue.QueuePosition{}
+			if !flagAll {
+				position, err = diskqueue.ReadQueuePosition(queueSettings)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("error reading queue state: %s", err)
+				}
+			}
+			for _, segment := range segments {
+				if segment.ID < position.SegmentID {
+					continue
+				}
+				_, err := diskqueue.ScanSegment(queueSettings, segment.ID,
+					func(frame diskqueue.FrameInfo) error {
+						if segment.ID == position.SegmentID && frame.Offset < position.Offset {
+							return nil
+						}
+						return printEvent(frame.Event)
+					})
+				if err != nil {
+					return fmt.Errorf("segment %d: %s", segment.ID, err)
+				}
+			}
+			return nil
+		}),
+	}
+	command.Flags().Int64Var(&flagSegment, "segment", -1, "Only dump the segment with this id")
+	command.Flags().BoolVar(&flagAll, "all", false, "Include events that were already acknowledged")
+	return command
+}
+
+func genVerifyQueueCmd(settings instance.Settings, flags *queueCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the checksums and encoding of all disk queue segments or spool events",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			if useSpool(b, flags) {
+				path, err := spoolPath(b, flags)
+				if err != nil {
+					return err
+				}
+				return verifySpool(path)
+			}
+			queueSettings, err := diskQueueSettings(b, flags)
+			if err != nil {
+				return err
+			}
+			segments, err := diskqueue.ListSegments(queueSettings)
+			if err != nil {
+				return err
+			}
+
+			corrupt := 0
+			for _, segment := range segments {
+				frames := 0
+				validEnd, err := diskqueue.ScanSegment(queueSettings, segment.ID,
+					func(diskqueue.FrameInfo) error {
+						frames++
+						return nil
+					})
+				if err != nil {
+					corrupt++
+					fmt.Printf("segment %d: %d valid frames (%d bytes), then: %s\n",
+						segment.ID, frames, validEnd, err)
+				} else {
+					fmt.Printf("segment %d: OK (%d frames)\n", segment.ID, frames)
+				}
+			}
+			if corrupt > 0 {
+				return fmt.Errorf("%d of %d segments are corrupt", corrupt, len(segments))
+			}
+			return nil
+		}),
+	}
+}
+
+func genTruncateQueueCmd(settings instance.Settings, flags *queueCmdFlags) *cobra.Command {
+	var flagForce bool
+	command := &cobra.Command{
+		Use:   "truncate SEGMENT_ID",
+		Short: "Remove the corrupt tail of a disk queue segment",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("exactly one segment id must be provided")
+			}
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid segment id '%s': %s", args[0], err)
+			}
+
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %s", err)
+			}
+			if useSpool(b, flags) {
+				return errors.New("the spool file is written in transactions and never has a corrupt tail, use verify to check its events")
+			}
+			queueSettings, err := diskQueueSettings(b, flags)
+			if err != nil {
+				return err
+			}
+			return truncateSegment(queueSettings, id, flagForce)
+		}),
+	}
+	command.Flags().BoolVar(&flagForce, "force", false, "Truncate without asking for confirmation")
+	return command
+}
+
+// useSpool reports whether the commands inspect the spool file rather than
+// the disk queue.
+func useSpool(b *instance.Beat, flags *queueCmdFlags) bool {
+	return flags.spool || b.Config.Pipeline.Queue.Name() == "spool"
+}
+
+// diskQueueSettings returns the settings of the disk queue configured for
+// the beat, or the default settings if another queue type is configured.
+func diskQueueSettings(b *instance.Beat, flags *queueCmdFlags) (diskqueue.Settings, error) {
+	settings := diskqueue.DefaultSettings()
+	if queueConfig := b.Config.Pipeline.Queue; queueConfig.Name() == "disk" {
+		var err error
+		settings, err = diskqueue.SettingsForUserConfig(queueConfig.Config())
+		if err != nil {
+			return diskqueue.Settings{}, fmt.Errorf("error reading disk queue configuration: %s", err)
+		}
+	}
+	if flags.path != "" {
+		settings.Path = flags.path
+	}
+	return settings, nil
+}
+
+// spoolPath returns the path of the spool file configured for the beat.
+func spoolPath(b *instance.Beat, flags *queueCmdFlags) (string, error) {
+	if flags.path != "" {
+		return flags.path, nil
+	}
+	queueConfig := b.Config.Pipeline.Queue
+	if queueConfig.Name() != "spool" {
+		return spool.ConfiguredPath(nil)
+	}
+	path, err := spool.ConfiguredPath(queueConfig.Config())
+	if err != nil {
+		return "", fmt.Errorf("error reading spool configuration: %s", err)
+	}
+	return path, nil
+}
+
+// selectSegments returns the segment with the given id, or all segments if
+// the id is negative.
+func selectSegments(settings diskqueue.Settings, id int64) ([]diskqueue.SegmentInfo, error) {
+	segments, err := diskqueue.ListSegments(settings)
+	if err != nil || id < 0 {
+		return segments, err
+	}
+	for _, segment := range segments {
+		if segment.ID == uint64(id) {
+			return []diskqueue.SegmentInfo{segment}, nil
+		}
+	}
+	return nil, fmt.Errorf("segment %d not found", id)
+}
+
+func listSegments(settings diskqueue.Settings) error {
+	segments, err := diskqueue.ListSegments(settings)
+	if err != nil {
+		return err
+	}
+	position, err := diskqueue.ReadQueuePosition(settings)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Could not read queue state: %s\n", err)
+	}
+
+	fmt.Printf("%-10s %12s %8s %8s %12s %10s\n",
+		"SEGMENT", "SIZE", "VERSION", "CODEC", "COMPRESSION", "ENCRYPTED")
+	for _, segment := range segments {
+		marker := ""
+		if err == nil && segment.ID == position.SegmentID {
+			marker = fmt.Sprintf("  <- read position (offset %d)", position.Offset)
+		}
+		fmt.Printf("%-10d %12d %8d %8s %12s %10t%s\n",
+			segment.ID, segment.Size, segment.Version, segment.Serialization,
+			segment.Compression, segment.Encrypted, marker)
+	}
+	return nil
+}
+
+// countSpoolEvents returns the number of pending events in the spool file,
+// and the number of events that could not be decoded.
+func countSpoolEvents(path string) (int, int, error) {
+	invalid := 0
+	events, err := spool.Inspect(path,
+		func(publisher.Event) error { return nil },
+		func(error) { invalid++ })
+	return events, invalid, err
+}
+
+func listSpool(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	events, invalid, err := countSpoolEvents(path)
+	if err != nil {
+		return fmt.Errorf("error reading spool file: %s", err)
+	}
+
+	fmt.Printf("%-40s %12s %10s %10s\n", "FILE", "SIZE", "EVENTS", "INVALID")
+	fmt.Printf("%-40s %12d %10d %10d\n", path, info.Size(), events, invalid)
+	return nil
+}
+
+func verifySpool(path string) error {
+	index, invalid := 0, 0
+	events, err := spool.Inspect(path,
+		func(publisher.Event) error {
+			index++
+			return nil
+		},
+		func(err error) {
+			index++
+			invalid++
+			fmt.Printf("event %d: %s\n", index, err)
+		})
+	if err != nil {
+		return fmt.Errorf("error reading spool file: %s", err)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d events could not be decoded", invalid, events+invalid)
+	}
+	fmt.Printf("spool: OK (%d events)\n", events)
+	return nil
+}
+
+func truncateSegment(settings diskqueue.Settings, id uint64, force bool) error {
+	frames := 0
+	validEnd, scanErr := diskqueue.ScanSegment(settings, id,
+		func(diskqueue.FrameInfo) error {
+			frames++
+			return nil
+		})
+	if scanErr == nil {
+		fmt.Printf("Segment %d is valid, nothing to truncate.\n", id)
+		return nil
+	}
+	fmt.Printf("Segment %d: %d valid frames (%d bytes), then: %s\n",
+		id, frames, validEnd, scanErr)
+
+	if !force {
+		prompt := fmt.Sprintf("Truncate segment %d to %d bytes of data?", id, validEnd)
+		if !terminal.PromptYesNo(prompt, false) {
+			fmt.Println("Exiting without modifying the segment.")
+			return nil
+		}
+	}
+	if err := diskqueue.TruncateSegment(settings, id, validEnd); err != nil {
+		return fmt.Errorf("error truncating segment %d: %s", id, err)
+	}
+	fmt.Printf("Truncated segment %d\n", id)
+	return nil
+}
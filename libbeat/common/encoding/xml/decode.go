@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package xml decodes XML documents into common.MapStr.
+package xml
+
+import (
+	goxml "encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// TextKey is the key of the text content of elements which also have
+// attributes or child elements.
+const TextKey = "#text"
+
+var errNoElement = errors.New("no XML element found")
+
+// Config holds the options of the XML decoder.
+type Config struct {
+	// AttributePrefix is prepended to the names of attributes, such that they
+	// can be distinguished from child elements.
+	AttributePrefix string `config:"attribute_prefix"`
+
+	// ToLower lowercases the names of elements and attributes.
+	ToLower bool `config:"to_lower"`
+
+	// ForceArray lists elements which are always decoded into an array, even
+	// if they occur only once. Repeated elements are always decoded into an
+	// array.
+	ForceArray []string `config:"force_array"`
+}
+
+// Decoder decodes XML documents.
+type Decoder struct {
+	prefix     string
+	toLower    bool
+	forceArray map[string]struct{}
+}
+
+// NewDecoder creates a new Decoder from the configuration.
+func NewDecoder(config Config) *Decoder {
+	d := &Decoder{
+		prefix:     config.AttributePrefix,
+		toLower:    config.ToLower,
+		forceArray: map[string]struct{}{},
+	}
+	for _, name := range config.ForceArray {
+		d.forceArray[d.key(name)] = struct{}{}
+	}
+	return d
+}
+
+// Decode decodes the first XML element found in r. The result holds the
+// element under its name.
+//
+// Elements without attributes and child elements are decoded into their text
+// content. Other elements are decoded into a map holding the attributes, the
+// child elements and the text content under TextKey. Namespaces are removed
+// from names.
+func (d *Decoder) Decode(r io.Reader) (common.MapStr, error) {
+	dec := goxml.NewDecoder(r)
+	dec.Strict = true
+	// The input has already been converted to UTF-8, the encoding
+	// declared by the document is ignored.
+	dec.CharsetReader = func(_ string, in io.Reader) (io.Reader, error) {
+		return in, nil
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, errNoElement
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(goxml.StartElement); ok {
+			value, err := d.decodeElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+
+			name := d.key(start.Name.Local)
+			if _, ok := d.forceArray[name]; ok {
+				value = []interface{}{value}
+			}
+			return common.MapStr{name: value}, nil
+		}
+	}
+}
+
+func (d *Decoder) decodeElement(dec *goxml.Decoder, start goxml.StartElement) (interface{}, error) {
+	fields := common.MapStr{}
+	for _, attr := range start.Attr {
+		// namespace declarations
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		fields[d.prefix+d.key(attr.Name.Local)] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case goxml.StartElement:
+			value, err := d.decodeElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			d.addChild(fields, d.key(t.Name.Local), value)
+
+		case goxml.CharData:
+			text.Write(t)
+
+		case goxml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(fields) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				fields[TextKey] = content
+			}
+			return fields, nil
+		}
+	}
+}
+
+// addChild adds the value of a child element. Repeated elements are collected
+// in an array.
+func (d *Decoder) addChild(fields common.MapStr, name string, value interface{}) {
+	existing, exists := fields[name]
+	if !exists {
+		if _, ok := d.forceArray[name]; ok {
+			value = []interface{}{value}
+		}
+		fields[name] = value
+		return
+	}
+
+	if arr, ok := existing.([]interface{}); ok {
+		fields[name] = append(arr, value)
+		return
+	}
+	fields[name] = []interface{}{existing, value}
+}
+
+func (d *Decoder) key(name string) string {
+	if d.toLower {
+		return strings.ToLower(name)
+	}
+	return name
+}
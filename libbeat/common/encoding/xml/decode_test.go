@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		config   Config
+		input    string
+		expected common.MapStr
+	}{
+		"text element": {
+			input:    `<message>hello</message>`,
+			expected: common.MapStr{"message": "hello"},
+		},
+		"declaration and comments": {
+			input: `<?xml version="1.0" encoding="ISO-8859-1"?>
+<!-- comment -->
+<message>hello</message>`,
+			expected: common.MapStr{"message": "hello"},
+		},
+		"attributes, children and text": {
+			input: `<event id="42" xmlns="urn:example" xmlns:ex="urn:other">
+  <ex:level>error</ex:level>
+  text
+  <empty/>
+</event>`,
+			expected: common.MapStr{
+				"event": common.MapStr{
+					"id":    "42",
+					"level": "error",
+					"empty": "",
+					TextKey: "text",
+				},
+			},
+		},
+		"repeated elements": {
+			input: `<list><item>a</item><other>x</other><item>b</item><item><n>c</n></item></list>`,
+			expected: common.MapStr{
+				"list": common.MapStr{
+					"item":  []interface{}{"a", "b", common.MapStr{"n": "c"}},
+					"other": "x",
+				},
+			},
+		},
+		"attribute prefix": {
+			config: Config{AttributePrefix: "-"},
+			input:  `<event id="42"><id>1</id></event>`,
+			expected: common.MapStr{
+				"event": common.MapStr{"-id": "42", "id": "1"},
+			},
+		},
+		"lowercase keys": {
+			config: Config{ToLower: true, ForceArray: []string{"Item"}},
+			input:  `<List Name="x"><Item>a</Item></List>`,
+			expected: common.MapStr{
+				"list": common.MapStr{"name": "x", "item": []interface{}{"a"}},
+			},
+		},
+		"force array": {
+			config: Config{ForceArray: []string{"item", "list"}},
+			input:  `<list><item>a</item><other>x</other></list>`,
+			expected: common.MapStr{
+				"list": []interface{}{
+					common.MapStr{"item": []interface{}{"a"}, "other": "x"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			actual, err := NewDecoder(test.config).Decode(strings.NewReader(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":        ``,
+		"no element":   `just text`,
+		"not closed":   `<a><b>text</b>`,
+		"mismatched":   `<a><b>text</a></b>`,
+		"invalid name": `<a><1></1></a>`,
+	}
+
+	for name, input := range tests {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			_, err := NewDecoder(Config{}).Decode(strings.NewReader(input))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -158,8 +159,10 @@ func OrderIntervalLogs(filename string) string {
 	return ""
 }
 
-// IntervalLogIndex returns n as int given a log filename in the form [prefix]-[formattedDate]-n
+// IntervalLogIndex returns n as int given a log filename in the form [prefix]-[formattedDate]-n.
+// The suffix of compressed files is ignored.
 func IntervalLogIndex(filename string) (uint64, int, error) {
+	filename = strings.TrimSuffix(filename, CompressedSuffix)
 	i := len(filename) - 1
 	for ; i >= 0; i-- {
 		if '0' > filename[i] || filename[i] > '9' {
@@ -18,10 +18,13 @@
 package file
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +35,9 @@ import (
 // greater will result in an error.
 const MaxBackupsLimit = 1024
 
+// CompressedSuffix is the suffix of rotated files compressed by the Rotator.
+const CompressedSuffix = ".gz"
+
 // rotateReason is the reason why file rotation occurred.
 type rotateReason uint32
 
@@ -71,15 +77,22 @@ type Rotator struct {
 	rotateOnStartup bool
 	intervalRotator *intervalRotator // Optional, may be nil
 	redirectStderr  bool
+	compress        bool
 
 	file  *os.File
 	size  uint
 	mutex sync.Mutex
+
+	// compressing tracks the compression of the last rotated file, which
+	// runs in the background.
+	compressing sync.WaitGroup
 }
 
-// Logger allows the rotator to write debug information.
+// Logger allows the rotator to write debug information and to report errors
+// of background operations.
 type Logger interface {
 	Debugw(msg string, keysAndValues ...interface{}) // Debug
+	Errorw(msg string, keysAndValues ...interface{}) // Error
 }
 
 // RotatorOption is a configuration option for Rotator.
@@ -142,6 +155,16 @@ func RedirectStderr(redirect bool) RotatorOption {
 	}
 }
 
+// Compress enables gzip compression of rotated files. Compressed files get
+// the CompressedSuffix appended to their name. Files are compressed in the
+// background, with errors being reported to the logger set by WithLogger. A
+// file that failed to be compressed is kept uncompressed.
+func Compress(compress bool) RotatorOption {
+	return func(r *Rotator) {
+		r.compress = compress
+	}
+}
+
 // NewFileRotator returns a new Rotator.
 func NewFileRotator(filename string, options ...RotatorOption) (*Rotator, error) {
 	r := &Rotator{
@@ -179,6 +202,7 @@ func NewFileRotator(filename string, options ...RotatorOption) (*Rotator, error)
 			"max_backups", r.maxBackups,
 			"permissions", r.permissions,
 			"interval", r.interval,
+			"compress", r.compress,
 		)
 	}
 
@@ -235,25 +259,35 @@ func (r *Rotator) Sync() error {
 	return r.file.Sync()
 }
 
-// Rotate triggers a file rotation.
+// Rotate triggers a file rotation. Rotate waits for the rotated file being
+// compressed.
 func (r *Rotator) Rotate() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return r.rotate(rotateReasonManualTrigger)
+	err := r.rotate(rotateReasonManualTrigger)
+	r.compressing.Wait()
+	return err
 }
 
-// Close closes the currently open file.
+// Close closes the currently open file, and waits for the last rotated file
+// being compressed.
 func (r *Rotator) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return r.closeFile()
+	err := r.closeFile()
+	r.compressing.Wait()
+	return err
 }
 
 func (r *Rotator) backupName(n uint) string {
 	if n == 0 {
 		return r.filename
 	}
-	return r.filename + "." + strconv.Itoa(int(n))
+	name := r.filename + "." + strconv.Itoa(int(n))
+	if r.compress {
+		name += CompressedSuffix
+	}
+	return name
 }
 
 func (r *Rotator) dir() string {
@@ -392,39 +426,72 @@ func (r *Rotator) purgeOldSizedBackups() error {
 	return nil
 }
 
+// rotate renames the current file to the first backup. If compression is
+// enabled, the backup is compressed and old backups are purged in the
+// background, so that writes are not blocked. The previous compression must
+// have finished before the backups are renamed again, so rotate blocks if
+// compressing a file takes longer than filling the next one.
 func (r *Rotator) rotate(reason rotateReason) error {
+	r.compressing.Wait()
+
 	if err := r.closeFile(); err != nil {
 		return errors.Wrap(err, "error file closing current file")
 	}
 
+	var uncompressed string
 	var err error
 	if r.intervalRotator != nil {
 		// Interval and size rotation use different filename patterns, so we use
 		// rotateByInterval if interval rotation is enabled, even if this specific
 		// rotation is triggered by size.
-		err = r.rotateByInterval(reason)
+		uncompressed, err = r.rotateByInterval(reason)
 	} else {
-		err = r.rotateBySize(reason)
+		uncompressed, err = r.rotateBySize(reason)
 	}
 	if err != nil {
 		return errors.Wrap(err, "failed to rotate backups")
 	}
 
-	return r.purgeOldBackups()
+	if uncompressed == "" {
+		return r.purgeOldBackups()
+	}
+
+	r.compressing.Add(1)
+	go func() {
+		defer r.compressing.Done()
+		r.compressBackup(uncompressed)
+	}()
+	return nil
+}
+
+// compressBackup compresses the rotated file src and purges old backups.
+// Errors are logged only, as the rotation itself has already succeeded.
+func (r *Rotator) compressBackup(src string) {
+	err := compressFile(src, src+CompressedSuffix, r.permissions)
+	if err != nil && r.log != nil {
+		r.log.Errorw("Failed to compress rotated file", "filename", src, "error", err)
+	}
+
+	err = r.purgeOldBackups()
+	if err != nil && r.log != nil {
+		r.log.Errorw("Failed to purge old files after rotation", "filename", r.filename, "error", err)
+	}
 }
 
-func (r *Rotator) rotateByInterval(reason rotateReason) error {
+// rotateByInterval renames the current file to the next backup of the
+// interval. The name of the backup is returned if it must be compressed.
+func (r *Rotator) rotateByInterval(reason rotateReason) (string, error) {
 	fi, err := os.Stat(r.filename)
 	if os.IsNotExist(err) {
-		return nil
+		return "", nil
 	} else if err != nil {
-		return errors.Wrap(err, "failed to rotate backups")
+		return "", errors.Wrap(err, "failed to rotate backups")
 	}
 
 	logPrefix := r.intervalRotator.LogPrefix(r.filename, fi.ModTime())
 	files, err := filepath.Glob(logPrefix + "*")
 	if err != nil {
-		return errors.Wrap(err, "failed to list logs during rotation")
+		return "", errors.Wrap(err, "failed to list logs during rotation")
 	}
 
 	var targetFilename string
@@ -434,13 +501,13 @@ func (r *Rotator) rotateByInterval(reason rotateReason) error {
 		r.intervalRotator.SortIntervalLogs(files)
 		lastLogIndex, _, err := IntervalLogIndex(files[len(files)-1])
 		if err != nil {
-			return errors.Wrap(err, "failed to locate last log index during rotation")
+			return "", errors.Wrap(err, "failed to locate last log index during rotation")
 		}
 		targetFilename = logPrefix + strconv.Itoa(int(lastLogIndex)+1)
 	}
 
 	if err := os.Rename(r.filename, targetFilename); err != nil {
-		return errors.Wrap(err, "failed to rotate backups")
+		return "", errors.Wrap(err, "failed to rotate backups")
 	}
 
 	if r.log != nil {
@@ -449,10 +516,17 @@ func (r *Rotator) rotateByInterval(reason rotateReason) error {
 
 	r.intervalRotator.Rotate()
 
-	return nil
+	if r.compress {
+		return targetFilename, nil
+	}
+	return "", nil
 }
 
-func (r *Rotator) rotateBySize(reason rotateReason) error {
+// rotateBySize shifts the backups by one and renames the current file to the
+// first backup. The name of the first backup is returned if it must be
+// compressed. Until then the backup has no CompressedSuffix.
+func (r *Rotator) rotateBySize(reason rotateReason) (string, error) {
+	var uncompressed string
 	for i := r.maxBackups + 1; i > 0; i-- {
 		old := r.backupName(i - 1)
 		older := r.backupName(i)
@@ -460,14 +534,20 @@ func (r *Rotator) rotateBySize(reason rotateReason) error {
 		if _, err := os.Stat(old); os.IsNotExist(err) {
 			continue
 		} else if err != nil {
-			return errors.Wrap(err, "failed to rotate backups")
+			return "", errors.Wrap(err, "failed to rotate backups")
 		}
 
 		if err := os.Remove(older); err != nil && !os.IsNotExist(err) {
-			return errors.Wrap(err, "failed to rotate backups")
+			return "", errors.Wrap(err, "failed to rotate backups")
+		}
+
+		if i == 1 && r.compress {
+			// the active file is compressed into the first backup later on
+			older = strings.TrimSuffix(older, CompressedSuffix)
+			uncompressed = older
 		}
 		if err := os.Rename(old, older); err != nil {
-			return errors.Wrap(err, "failed to rotate backups")
+			return "", errors.Wrap(err, "failed to rotate backups")
 		} else if i == 1 {
 			// Log when rotation of the main file occurs.
 			if r.log != nil {
@@ -475,5 +555,36 @@ func (r *Rotator) rotateBySize(reason rotateReason) error {
 			}
 		}
 	}
-	return nil
+	return uncompressed, nil
+}
+
+// compressFile writes the gzip compressed contents of src to dst. src is
+// removed once dst has been written completely.
+func compressFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return errors.Wrapf(err, "failed to compress %v", src)
+	}
+
+	in.Close()
+	return os.Remove(src)
 }
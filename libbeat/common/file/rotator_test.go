@@ -18,6 +18,7 @@
 package file_test
 
 import (
+	"compress/gzip"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -171,6 +172,109 @@ func TestDailyRotation(t *testing.T) {
 	AssertDirContents(t, dir, logname+"-"+today+"-1", logname+"-"+today+"-2", logname)
 }
 
+func TestFileRotatorCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_rotator_compressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sample.log")
+	r, err := file.NewFileRotator(filename, file.MaxBackups(2), file.Compress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	WriteMsg(t, r)
+	Rotate(t, r)
+	AssertDirContents(t, dir, "sample.log.1.gz")
+	assert.Equal(t, logMessage, ReadGzipFile(t, filepath.Join(dir, "sample.log.1.gz")))
+
+	WriteMsg(t, r)
+	WriteMsg(t, r)
+	Rotate(t, r)
+	AssertDirContents(t, dir, "sample.log.1.gz", "sample.log.2.gz")
+	assert.Equal(t, logMessage+logMessage, ReadGzipFile(t, filepath.Join(dir, "sample.log.1.gz")))
+	assert.Equal(t, logMessage, ReadGzipFile(t, filepath.Join(dir, "sample.log.2.gz")))
+
+	WriteMsg(t, r)
+	Rotate(t, r)
+	AssertDirContents(t, dir, "sample.log.1.gz", "sample.log.2.gz")
+}
+
+func TestFileRotatorCompressedOnWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_rotator_compressed_write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sample.log")
+	r, err := file.NewFileRotator(filename,
+		file.MaxSizeBytes(uint(len(logMessage))),
+		file.MaxBackups(2),
+		file.Compress(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second write rotates the file, compressing it in the background
+	WriteMsg(t, r)
+	WriteMsg(t, r)
+
+	// Close waits for the compression to finish
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	AssertDirContents(t, dir, "sample.log", "sample.log.1.gz")
+	assert.Equal(t, logMessage, ReadGzipFile(t, filepath.Join(dir, "sample.log.1.gz")))
+}
+
+func TestDailyRotationCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daily_file_rotator_compressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logname := "daily"
+	dateFormat := "2006-01-02"
+	today := time.Now().Format(dateFormat)
+	yesterday := time.Now().AddDate(0, 0, -1).Format(dateFormat)
+
+	// seed directory with existing compressed and uncompressed log files
+	files := []string{
+		logname + "-" + yesterday + "-1.gz",
+		logname + "-" + yesterday + "-2.gz",
+		logname + "-" + yesterday + "-3",
+		logname + "-" + yesterday + "-10.gz",
+	}
+	for _, f := range files {
+		CreateFile(t, filepath.Join(dir, f))
+	}
+
+	filename := filepath.Join(dir, logname)
+	r, err := file.NewFileRotator(filename, file.MaxBackups(2), file.Interval(24*time.Hour), file.Compress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	Rotate(t, r)
+	AssertDirContents(t, dir, logname+"-"+yesterday+"-3", logname+"-"+yesterday+"-10.gz")
+
+	WriteMsg(t, r)
+	Rotate(t, r)
+	AssertDirContents(t, dir, logname+"-"+yesterday+"-10.gz", logname+"-"+today+"-1.gz")
+	assert.Equal(t, logMessage, ReadGzipFile(t, filepath.Join(dir, logname+"-"+today+"-1.gz")))
+
+	WriteMsg(t, r)
+	Rotate(t, r)
+	AssertDirContents(t, dir, logname+"-"+today+"-1.gz", logname+"-"+today+"-2.gz")
+}
+
 // Tests the FileConfig.RotateOnStartup parameter
 func TestRotateOnStartup(t *testing.T) {
 	dir, err := ioutil.TempDir("", "rotate_on_open")
@@ -261,3 +365,23 @@ func Rotate(t *testing.T, r *file.Rotator) {
 		t.Fatal(err)
 	}
 }
+
+func ReadGzipFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
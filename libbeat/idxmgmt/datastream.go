@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package idxmgmt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// DataStreamConfig configures the naming of the data streams events are
+// written to. Data streams are named `<type>-<dataset>-<namespace>`. The
+// configured values are used as defaults for events not setting the
+// `data_stream.type`, `data_stream.dataset`, or `data_stream.namespace`
+// fields.
+type DataStreamConfig struct {
+	Enabled   bool   `config:"enabled"`
+	Type      string `config:"type"`
+	Dataset   string `config:"dataset"`
+	Namespace string `config:"namespace"`
+}
+
+type dataStreamSelector struct {
+	defaults DataStreamConfig
+}
+
+const maxDataStreamPartLen = 100
+
+// dataStreamInvalidChars lists the characters not allowed in a data stream
+// name. The dash is used as separator between the name parts and is not
+// allowed within a part.
+const dataStreamInvalidChars = `\/*?"<>| ,#:-`
+
+func defaultDataStreamConfig() DataStreamConfig {
+	return DataStreamConfig{
+		Enabled:   false,
+		Type:      "logs",
+		Dataset:   "generic",
+		Namespace: "default",
+	}
+}
+
+// Validate checks that the configured defaults are valid data stream name parts.
+func (c *DataStreamConfig) Validate() error {
+	parts := []struct{ name, value string }{
+		{"type", c.Type},
+		{"dataset", c.Dataset},
+		{"namespace", c.Namespace},
+	}
+	for _, part := range parts {
+		if part.value == "" {
+			return fmt.Errorf("data_stream.%s must not be empty", part.name)
+		}
+		if sanitizeDataStreamPart(part.value) != part.value {
+			return fmt.Errorf("data_stream.%s '%s' must be lowercase, at most %d bytes, and must not contain any of '%s'",
+				part.name, part.value, maxDataStreamPartLen, dataStreamInvalidChars)
+		}
+	}
+	return nil
+}
+
+// readDataStreamConfig reads the data stream settings from the
+// elasticsearch output. Data streams are disabled for all other outputs.
+func readDataStreamConfig(out common.ConfigNamespace) (DataStreamConfig, error) {
+	config := defaultDataStreamConfig()
+	if out.Name() != "elasticsearch" || !out.Config().HasField("data_stream") {
+		return config, nil
+	}
+
+	sub, err := out.Config().Child("data_stream", -1)
+	if err != nil {
+		return config, err
+	}
+	if err := sub.Unpack(&config); err != nil {
+		return config, fmt.Errorf("invalid data_stream settings: %w", err)
+	}
+	return config, nil
+}
+
+func (s dataStreamSelector) Select(evt *beat.Event) (string, error) {
+	if len(evt.Meta) > 0 {
+		if idx, err := events.GetMetaStringValue(*evt, events.FieldMetaRawIndex); err == nil {
+			return strings.ToLower(idx), nil
+		}
+	}
+
+	typ := dataStreamField(evt, "type", s.defaults.Type)
+	dataset := dataStreamField(evt, "dataset", s.defaults.Dataset)
+	namespace := dataStreamField(evt, "namespace", s.defaults.Namespace)
+	if typ == "" || dataset == "" || namespace == "" {
+		return "", errors.New("incomplete data stream name")
+	}
+	return fmt.Sprintf("%s-%s-%s", typ, dataset, namespace), nil
+}
+
+// dataStreamField reads data_stream.<name> from the event, falling back to
+// def if the field is missing or not a string.
+func dataStreamField(evt *beat.Event, name, def string) string {
+	v, err := evt.Fields.GetValue("data_stream." + name)
+	if err != nil {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return def
+	}
+	return sanitizeDataStreamPart(s)
+}
+
+// sanitizeDataStreamPart converts a string into a valid data stream name part,
+// by lowercasing it, replacing invalid characters with `_`, and truncating it
+// to the maximum allowed length.
+func sanitizeDataStreamPart(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(dataStreamInvalidChars, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(s))
+	if len(s) > maxDataStreamPartLen {
+		n := maxDataStreamPartLen
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return s
+}
@@ -129,7 +129,12 @@ func MakeDefaultSupport(ilmSupport ilm.SupportFactory) SupportFactory {
 			return nil, err
 		}
 
-		return newIndexSupport(log, info, ilmSupport, cfg.Template, cfg.ILM, cfg.Migration.Enabled())
+		dataStream, err := readDataStreamConfig(cfg.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		return newIndexSupport(log, info, ilmSupport, cfg.Template, cfg.ILM, dataStream, cfg.Migration.Enabled())
 	}
 }
 
@@ -39,6 +39,7 @@ type indexSupport struct {
 	info         beat.Info
 	migration    bool
 	templateCfg  template.TemplateConfig
+	dataStream   DataStreamConfig
 	defaultIndex string
 
 	st indexState
@@ -101,6 +102,7 @@ func newIndexSupport(
 	ilmFactory ilm.SupportFactory,
 	tmplConfig *common.Config,
 	ilmConfig *common.Config,
+	dataStream DataStreamConfig,
 	migration bool,
 ) (*indexSupport, error) {
 	if ilmFactory == nil {
@@ -122,6 +124,7 @@ func newIndexSupport(
 		ilm:          ilmSupporter,
 		info:         info,
 		templateCfg:  tmplCfg,
+		dataStream:   dataStream,
 		migration:    migration,
 		defaultIndex: fmt.Sprintf("%v-%v-%%{+yyyy.MM.dd}", info.IndexPrefix, info.Version),
 	}, nil
@@ -157,6 +160,14 @@ func (s *indexSupport) BuildSelector(cfg *common.Config) (outputs.IndexSelector,
 	var err error
 	log := s.log
 
+	// With data streams the target is derived from the data_stream fields of
+	// the event. Index and ILM alias settings do not apply.
+	if s.dataStream.Enabled {
+		log.Infof("Data streams enabled, events are indexed into '%s-%s-%s' unless overwritten by the event.",
+			s.dataStream.Type, s.dataStream.Dataset, s.dataStream.Namespace)
+		return dataStreamSelector{defaults: s.dataStream}, nil
+	}
+
 	// we construct our own configuration object based on the available settings
 	// in cfg and defaultIndex. The configuration object provided must not be
 	// modified.
@@ -283,7 +294,15 @@ func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
 		tmplCfg := m.support.templateCfg
 		tmplCfg.Overwrite, tmplCfg.Enabled = templateComponent.overwrite, templateComponent.enabled
 
-		if ilmComponent.enabled {
+		if dataStream := m.support.dataStream; dataStream.Enabled {
+			tmplCfg = applyDataStreamSettings(log, tmplCfg, dataStream)
+			if ilmComponent.enabled {
+				tmplCfg, err = applyDataStreamILMSettings(log, tmplCfg, m.support.ilm.Policy())
+				if err != nil {
+					return err
+				}
+			}
+		} else if ilmComponent.enabled {
 			tmplCfg, err = applyILMSettings(log, tmplCfg, m.support.ilm.Policy(), m.support.ilm.Alias())
 			if err != nil {
 				return err
@@ -298,7 +317,9 @@ func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
 		log.Info("Loaded index template.")
 	}
 
-	if ilmComponent.load {
+	// Data streams are created by Elasticsearch on first write and roll over
+	// without a write alias.
+	if ilmComponent.load && !m.support.dataStream.Enabled {
 		// ensure alias is created after the template is created
 		if err := m.ilm.EnsureAlias(); err != nil {
 			if ilm.ErrReason(err) != ilm.ErrAliasAlreadyExists {
@@ -413,7 +434,79 @@ func applyILMSettings(
 	}
 
 	// rollover_alias and lifecycle.name can't be configured and will be overwritten
+	lifecycle, err := copyLifecycleSettings(&tmpl)
+	if err != nil {
+		return tmpl, err
+	}
+
+	// add rollover_alias and name to index.lifecycle settings
+	if _, exists := lifecycle["rollover_alias"]; !exists {
+		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
+		lifecycle["rollover_alias"] = alias.Name
+	}
+	if _, exists := lifecycle["name"]; !exists {
+		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
+		lifecycle["name"] = policy.Name
+	}
 
+	return tmpl, nil
+}
+
+// applyDataStreamSettings configures the template to be installed as
+// composable index template matching the data streams of the configured type.
+func applyDataStreamSettings(
+	log *logp.Logger,
+	tmpl template.TemplateConfig,
+	dataStream DataStreamConfig,
+) template.TemplateConfig {
+	if !tmpl.Enabled {
+		return tmpl
+	}
+
+	tmpl.Type = template.IndexTemplateIndex
+	tmpl.DataStream = true
+	if tmpl.Pattern == "" {
+		tmpl.Pattern = fmt.Sprintf("%s-*-*", dataStream.Type)
+		if log != nil {
+			log.Infof("Set setup.template.pattern to '%s' as data streams are enabled.", tmpl.Pattern)
+		}
+	}
+	return tmpl
+}
+
+// applyDataStreamILMSettings adds the ILM policy to the template. Data streams
+// roll over without a write alias, so only the policy name is configured.
+func applyDataStreamILMSettings(
+	log *logp.Logger,
+	tmpl template.TemplateConfig,
+	policy ilm.Policy,
+) (template.TemplateConfig, error) {
+	if !tmpl.Enabled {
+		return tmpl, nil
+	}
+
+	if policy.Name == "" {
+		return tmpl, errors.New("no ilm policy name configured")
+	}
+
+	lifecycle, err := copyLifecycleSettings(&tmpl)
+	if err != nil {
+		return tmpl, err
+	}
+	if _, exists := lifecycle["name"]; !exists {
+		if log != nil {
+			log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
+		}
+		lifecycle["name"] = policy.Name
+	}
+
+	return tmpl, nil
+}
+
+// copyLifecycleSettings copies the index and index.lifecycle settings of the
+// template, such that they can be modified without changing the user
+// configuration. The copied index.lifecycle settings are returned.
+func copyLifecycleSettings(tmpl *template.TemplateConfig) (map[string]interface{}, error) {
 	// init/copy index settings
 	idxSettings := tmpl.Settings.Index
 	if idxSettings == nil {
@@ -437,19 +530,9 @@ func applyILMSettings(
 			lifecycle[k] = v
 		}
 	} else {
-		return tmpl, errors.New("settings.index.lifecycle must be an object")
+		return nil, errors.New("settings.index.lifecycle must be an object")
 	}
 	idxSettings["lifecycle"] = lifecycle
 
-	// add rollover_alias and name to index.lifecycle settings
-	if _, exists := lifecycle["rollover_alias"]; !exists {
-		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
-		lifecycle["rollover_alias"] = alias.Name
-	}
-	if _, exists := lifecycle["name"]; !exists {
-		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
-		lifecycle["name"] = policy.Name
-	}
-
-	return tmpl, nil
+	return lifecycle, nil
 }
@@ -133,6 +133,7 @@ func TestDefaultSupport_BuildSelector(t *testing.T) {
 		cfg      map[string]interface{}
 		want     nameFunc
 		meta     common.MapStr
+		fields   common.MapStr
 	}{
 		"without ilm": {
 			ilmCalls: noILM,
@@ -230,6 +231,62 @@ func TestDefaultSupport_BuildSelector(t *testing.T) {
 			},
 			want: stable("myindex"),
 		},
+		"data stream defaults": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"output.elasticsearch.data_stream.enabled": true,
+			},
+			cfg:  map[string]interface{}{"index": "test-%{[agent.version]}"},
+			want: stable("logs-generic-default"),
+		},
+		"data stream configured defaults": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"output.elasticsearch.data_stream": map[string]interface{}{
+					"enabled":   true,
+					"type":      "metrics",
+					"dataset":   "system.cpu",
+					"namespace": "prod",
+				},
+			},
+			want: stable("metrics-system.cpu-prod"),
+		},
+		"data stream from event fields": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"output.elasticsearch.data_stream.enabled": true,
+			},
+			fields: common.MapStr{
+				"data_stream": common.MapStr{
+					"dataset":   "nginx.access",
+					"namespace": "testing",
+				},
+			},
+			want: stable("logs-nginx.access-testing"),
+		},
+		"data stream event fields are sanitized": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"output.elasticsearch.data_stream.enabled": true,
+			},
+			fields: common.MapStr{
+				"data_stream": common.MapStr{
+					"dataset":   "My-Data/Set",
+					"namespace": "a b",
+				},
+			},
+			want: stable("logs-my_data_set-a_b"),
+		},
+		"data stream raw index": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"output.elasticsearch.data_stream.enabled": true,
+			},
+			want: stable("logs-custom-default"),
+			meta: common.MapStr{
+				"raw_index": "Logs-custom-default",
+			},
+		},
 	}
 	for name, test := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -244,15 +301,17 @@ func TestDefaultSupport_BuildSelector(t *testing.T) {
 			require.NoError(t, err)
 
 			meta := test.meta
+			fields := common.MapStr{
+				"test": "value",
+				"agent": common.MapStr{
+					"version": "9.9.9",
+				},
+			}
+			fields.DeepUpdate(test.fields)
 			idx, err := sel.Select(&beat.Event{
 				Timestamp: ts,
-				Fields: common.MapStr{
-					"test": "value",
-					"agent": common.MapStr{
-						"version": "9.9.9",
-					},
-				},
-				Meta: meta,
+				Fields:    fields,
+				Meta:      meta,
 			})
 			require.NoError(t, err)
 			assert.Equal(t, test.want(ts), idx)
@@ -355,6 +414,10 @@ func TestIndexManager_Setup(t *testing.T) {
 		}
 		return &s
 	}
+	dataStreamCfg := func(s *template.TemplateConfig) *template.TemplateConfig {
+		s.DataStream = true
+		return s
+	}
 	defaultCfg := template.DefaultConfig()
 
 	cases := map[string]struct {
@@ -464,6 +527,32 @@ func TestIndexManager_Setup(t *testing.T) {
 			loadTemplate: LoadModeDisabled,
 			loadILM:      LoadModeDisabled,
 		},
+		"data streams with ilm default": {
+			cfg: common.MapStr{
+				"output.elasticsearch.data_stream.enabled": true,
+			},
+			tmplCfg: dataStreamCfg(cfgWith(template.DefaultConfig(), map[string]interface{}{
+				"overwrite":                     "true",
+				"type":                          "index",
+				"pattern":                       "logs-*-*",
+				"settings.index.lifecycle.name": "test",
+			})),
+			policy: "test",
+		},
+		"data streams with custom pattern and ilm disabled": {
+			cfg: common.MapStr{
+				"output.elasticsearch.data_stream.enabled": true,
+				"setup.ilm.enabled":                        false,
+				"setup.template.name":                      "custom",
+				"setup.template.pattern":                   "logs-custom-*",
+			},
+			loadTemplate: LoadModeEnabled,
+			tmplCfg: dataStreamCfg(cfgWith(template.DefaultConfig(), map[string]interface{}{
+				"name":    "custom",
+				"type":    "index",
+				"pattern": "logs-custom-*",
+			})),
+		},
 	}
 	for name, test := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hamba/avro"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// Encoder serializes a beat.Event using the Avro binary encoding. The fields
+// of the top-level record in the schema are read from the event fields. The
+// timestamp field is filled with the event timestamp.
+type Encoder struct {
+	buf            bytes.Buffer
+	schemas        schemaSource
+	timestampField string
+}
+
+type schemaSource interface {
+	schemaFor(event *beat.Event) (*avro.RecordSchema, []byte, error)
+}
+
+// staticSchema is the schema source used for local schema files. Events are
+// encoded without any header.
+type staticSchema struct {
+	schema *avro.RecordSchema
+}
+
+func init() {
+	codec.RegisterType("avro", func(_ beat.Info, cfg *common.Config) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("empty avro codec configuration")
+		}
+
+		config := defaultConfig
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		return New(config)
+	})
+}
+
+// New creates a new Avro Encoder.
+func New(config Config) (*Encoder, error) {
+	var schemas schemaSource
+	if config.Schema != "" {
+		definition, err := ioutil.ReadFile(config.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read avro schema: %w", err)
+		}
+
+		s, err := parseSchema(definition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse avro schema %v: %w", config.Schema, err)
+		}
+		schemas = staticSchema{schema: s}
+	} else {
+		r, err := newRegistry(config.SchemaRegistry)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.prefetch(); err != nil {
+			return nil, err
+		}
+		schemas = r
+	}
+
+	return &Encoder{schemas: schemas, timestampField: config.TimestampField}, nil
+}
+
+// Encode serializes a beat event to Avro. Events not matching the schema
+// return an error, so the output can drop the event.
+func (e *Encoder) Encode(_ string, event *beat.Event) ([]byte, error) {
+	s, header, err := e.schemas.schemaFor(event)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := recordToNative(s, func(name string) (interface{}, bool) {
+		if name == e.timestampField {
+			return event.Timestamp, true
+		}
+		v, exists := event.Fields[name]
+		return v, exists
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event does not match the avro schema: %w", err)
+	}
+
+	payload, err := avro.Marshal(s, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event as avro: %w", err)
+	}
+
+	e.buf.Reset()
+	e.buf.Write(header)
+	e.buf.Write(payload)
+	return e.buf.Bytes(), nil
+}
+
+func (s staticSchema) schemaFor(_ *beat.Event) (*avro.RecordSchema, []byte, error) {
+	return s.schema, nil, nil
+}
@@ -0,0 +1,281 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package avro
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+)
+
+const testSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "test",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "message", "type": "string"},
+    {"name": "level", "type": ["null", "string"], "default": null},
+    {"name": "count", "type": "int", "default": 1},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "host", "type": {"type": "record", "name": "Host", "fields": [
+      {"name": "name", "type": "string"}
+    ]}}
+  ]
+}`
+
+func TestEncodeWithSchemaFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avro")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "event.avsc")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testSchema), 0600))
+
+	config := defaultConfig
+	config.Schema = path
+	encoder, err := New(config)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		fields   common.MapStr
+		expected []byte
+		err      string
+	}{
+		"defaults": {
+			fields: common.MapStr{
+				"message": "hi",
+				"tags":    []string{"a"},
+				"host":    common.MapStr{"name": "x"},
+			},
+			expected: []byte{0x04, 0x04, 'h', 'i', 0x00, 0x02, 0x02, 0x02, 'a', 0x00, 0x02, 'x'},
+		},
+		"all fields": {
+			fields: common.MapStr{
+				"message": "hi",
+				"level":   "warn",
+				"count":   int64(-1),
+				"tags":    []interface{}{},
+				"host":    map[string]interface{}{"name": "x"},
+			},
+			expected: []byte{0x04, 0x04, 'h', 'i', 0x02, 0x08, 'w', 'a', 'r', 'n', 0x01, 0x00, 0x02, 'x'},
+		},
+		"type mismatch": {
+			fields: common.MapStr{
+				"message": 42,
+				"tags":    []string{},
+				"host":    common.MapStr{"name": "x"},
+			},
+			err: "message: expected string, got int",
+		},
+		"missing field": {
+			fields: common.MapStr{
+				"message": "hi",
+				"tags":    []string{},
+			},
+			err: "missing value for required field 'host'",
+		},
+		"nested mismatch": {
+			fields: common.MapStr{
+				"message": "hi",
+				"tags":    []string{},
+				"host":    common.MapStr{"name": true},
+			},
+			err: "host: name: expected string, got bool",
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			event := &beat.Event{
+				Timestamp: time.Unix(0, 2*int64(time.Millisecond)),
+				Fields:    test.fields,
+			}
+
+			out, err := encoder.Encode("test", event)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestEncodeWithSchemaRegistry(t *testing.T) {
+	var requests int32
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) != 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path != "/subjects/logs-value/versions/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(common.MapStr{
+			"subject": "logs-value",
+			"version": 3,
+			"id":      42,
+			"schema":  testSchema,
+		}.String()))
+	}))
+	defer server.Close()
+
+	config := defaultConfig
+	config.SchemaRegistry.URL = server.URL
+	config.SchemaRegistry.Subject = fmtstr.MustCompileEvent("%{[dataset]}-value")
+	config.SchemaRegistry.CacheTTL = time.Hour
+	encoder, err := New(config)
+	require.NoError(t, err)
+
+	event := &beat.Event{
+		Timestamp: time.Unix(0, 2*int64(time.Millisecond)),
+		Fields: common.MapStr{
+			"dataset": "logs",
+			"message": "hi",
+			"tags":    []string{"a"},
+			"host":    common.MapStr{"name": "x"},
+		},
+	}
+	expected := []byte{0x00, 0x00, 0x00, 0x00, 0x2a, 0x04, 0x04, 'h', 'i', 0x00, 0x02, 0x02, 0x02, 'a', 0x00, 0x02, 'x'}
+
+	for i := 0; i < 3; i++ {
+		out, err := encoder.Encode("test", event)
+		require.NoError(t, err)
+		assert.Equal(t, expected, out)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "schema must be cached")
+
+	// continue with the cached schema if the registry is not available
+	atomic.StoreInt32(&failing, 1)
+	encoder.schemas.(*registry).ttl = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	out, err := encoder.Encode("test", event)
+	require.NoError(t, err)
+	assert.Equal(t, expected, out)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// unknown subjects fail
+	atomic.StoreInt32(&failing, 0)
+	event.Fields["dataset"] = "metrics"
+	_, err = encoder.Encode("test", event)
+	assert.Error(t, err)
+}
+
+func TestSchemaRegistryRetriesWithoutCachedSchema(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(common.MapStr{"id": 42, "schema": testSchema}.String()))
+	}))
+	defer server.Close()
+
+	config := defaultConfig
+	config.SchemaRegistry.URL = server.URL
+	config.SchemaRegistry.Subject = fmtstr.MustCompileEvent("%{[dataset]}-value")
+	encoder, err := New(config)
+	require.NoError(t, err)
+	encoder.schemas.(*registry).retryInit = time.Millisecond
+
+	_, err = encoder.Encode("test", &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"dataset": "logs",
+			"message": "hi",
+			"tags":    []string{},
+			"host":    common.MapStr{"name": "x"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestSchemaRegistryConstantSubjectFailsSetup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := defaultConfig
+	config.SchemaRegistry.URL = server.URL
+	config.SchemaRegistry.Subject = fmtstr.MustCompileEvent("logs-value")
+	_, err := New(config)
+	assert.Error(t, err)
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	cases := map[string]string{
+		"not a record":  `"string"`,
+		"unknown type":  `{"type": "record", "name": "A", "fields": [{"name": "a", "type": "B"}]}`,
+		"nested unions": `{"type": "record", "name": "A", "fields": [{"name": "a", "type": ["null", ["int"]]}]}`,
+		"invalid json":  `{"type": `,
+	}
+
+	for name, definition := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSchema([]byte(definition))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseSchemaNamedReferences(t *testing.T) {
+	s, err := parseSchema([]byte(`{
+	  "type": "record",
+	  "name": "Node",
+	  "namespace": "test",
+	  "fields": [
+	    {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["LEAF", "INNER"]}},
+	    {"name": "children", "type": {"type": "array", "items": "test.Node"}},
+	    {"name": "labels", "type": {"type": "map", "values": "Kind"}}
+	  ]
+	}`))
+	require.NoError(t, err)
+
+	fields := s.Fields()
+	require.Len(t, fields, 3)
+	items := fields[1].Type().(*avro.ArraySchema).Items()
+	assert.Equal(t, "test.Node", branchName(items))
+	values := fields[2].Type().(*avro.MapSchema).Values()
+	assert.Equal(t, "test.Kind", branchName(values))
+}
@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+)
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Schema is the path of a local Avro schema (.avsc) file.
+	Schema         string         `config:"schema"`
+	SchemaRegistry RegistryConfig `config:"schema_registry"`
+	TimestampField string         `config:"timestamp_field"`
+}
+
+// RegistryConfig configures the schema registry used to look up the latest
+// schema of a subject.
+type RegistryConfig struct {
+	URL      string                    `config:"url"`
+	Subject  *fmtstr.EventFormatString `config:"subject"`
+	Username string                    `config:"username"`
+	Password string                    `config:"password"`
+	TLS      *tlscommon.Config         `config:"ssl"`
+	Timeout  time.Duration             `config:"timeout" validate:"min=0"`
+	CacheTTL time.Duration             `config:"cache_ttl" validate:"min=0"`
+}
+
+var defaultConfig = Config{
+	SchemaRegistry: RegistryConfig{
+		Timeout:  30 * time.Second,
+		CacheTTL: 5 * time.Minute,
+	},
+	TimestampField: "timestamp",
+}
+
+func (c *Config) Validate() error {
+	useRegistry := c.SchemaRegistry.URL != ""
+	if c.Schema == "" && !useRegistry {
+		return errors.New("one of schema or schema_registry.url must be configured")
+	}
+	if c.Schema != "" && useRegistry {
+		return errors.New("schema and schema_registry can not be configured at the same time")
+	}
+	if useRegistry && c.SchemaRegistry.Subject == nil {
+		return errors.New("schema_registry.subject is required")
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/hamba/avro"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// recordToNative converts the fields of a record to the native form encoded
+// by the avro library. The field values are resolved using lookup, missing
+// fields are replaced by their default value or by null if the field schema
+// accepts it.
+func recordToNative(s *avro.RecordSchema, lookup func(name string) (interface{}, bool)) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(s.Fields()))
+	for _, f := range s.Fields() {
+		v, found := lookup(f.Name())
+		if !found && f.HasDefault() {
+			v = f.Default()
+		}
+
+		native, err := toNative(f.Type(), v)
+		if err != nil {
+			if !found && !f.HasDefault() {
+				return nil, fmt.Errorf("missing value for required field '%v'", f.Name())
+			}
+			return nil, fmt.Errorf("%v: %w", f.Name(), err)
+		}
+		record[f.Name()] = native
+	}
+	return record, nil
+}
+
+// toNative converts an event value to the Go type the avro library encodes
+// for the schema. Numbers are converted to the width required by the schema,
+// and union values are wrapped in a map naming the selected branch.
+func toNative(s avro.Schema, v interface{}) (interface{}, error) {
+	switch s := s.(type) {
+	case *avro.RefSchema:
+		return toNative(s.Schema(), v)
+
+	case *avro.RecordSchema:
+		fields, ok := toMapStr(v)
+		if !ok {
+			return nil, typeError("record", v)
+		}
+		return recordToNative(s, func(name string) (interface{}, bool) {
+			value, exists := fields[name]
+			return value, exists
+		})
+
+	case *avro.EnumSchema:
+		str, ok := v.(string)
+		if !ok {
+			return nil, typeError("enum", v)
+		}
+		for _, symbol := range s.Symbols() {
+			if symbol == str {
+				return str, nil
+			}
+		}
+		return nil, fmt.Errorf("'%v' is no symbol of enum '%v'", str, s.FullName())
+
+	case *avro.FixedSchema:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != s.Size() {
+			return nil, fmt.Errorf("fixed '%v' requires %v bytes, got %v", s.FullName(), s.Size(), len(b))
+		}
+		fixed := reflect.New(reflect.ArrayOf(len(b), reflect.TypeOf(byte(0)))).Elem()
+		reflect.Copy(fixed, reflect.ValueOf(b))
+		return fixed.Interface(), nil
+
+	case *avro.ArraySchema:
+		rv := reflect.ValueOf(v)
+		if v == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+			return nil, typeError("array", v)
+		}
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			item, err := toNative(s.Items(), rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[%v]: %w", i, err)
+			}
+			items[i] = item
+		}
+		return items, nil
+
+	case *avro.MapSchema:
+		rv := reflect.ValueOf(v)
+		if v == nil || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return nil, typeError("map", v)
+		}
+		values := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			value, err := toNative(s.Values(), rv.MapIndex(key).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", key.String(), err)
+			}
+			values[key.String()] = value
+		}
+		return values, nil
+
+	case *avro.UnionSchema:
+		return unionToNative(s, v)
+
+	case *avro.PrimitiveSchema:
+		return primitiveToNative(s, v)
+	}
+	return nil, fmt.Errorf("unsupported schema type %v", s.Type())
+}
+
+// unionToNative selects the first union branch accepting the value.
+func unionToNative(s *avro.UnionSchema, v interface{}) (interface{}, error) {
+	for _, branch := range s.Types() {
+		if (v == nil) != (branch.Type() == avro.Null) {
+			continue
+		}
+		if v == nil {
+			return nil, nil
+		}
+
+		native, err := toNative(branch, v)
+		if err == nil {
+			return map[string]interface{}{branchName(branch): native}, nil
+		}
+	}
+
+	if v == nil {
+		return nil, typeError("non-null union", v)
+	}
+	return nil, fmt.Errorf("value of type %T matches no union branch", v)
+}
+
+// branchName returns the name identifying a union branch.
+func branchName(s avro.Schema) string {
+	if ref, ok := s.(*avro.RefSchema); ok {
+		s = ref.Schema()
+	}
+	if named, ok := s.(avro.NamedSchema); ok {
+		return named.FullName()
+	}
+	return string(s.Type())
+}
+
+func primitiveToNative(s *avro.PrimitiveSchema, v interface{}) (interface{}, error) {
+	logical := ""
+	if l := s.Logical(); l != nil {
+		logical = string(l.Type())
+	}
+
+	switch s.Type() {
+	case avro.Null:
+		if v != nil {
+			return nil, typeError("null", v)
+		}
+		return nil, nil
+
+	case avro.Boolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, typeError("boolean", v)
+		}
+		return b, nil
+
+	case avro.Int:
+		n, err := toLong(v, logical)
+		if err != nil {
+			return nil, err
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("value %v overflows int", n)
+		}
+		return int32(n), nil
+
+	case avro.Long:
+		return toLong(v, logical)
+
+	case avro.Float:
+		f, err := toDouble(v)
+		if err != nil {
+			return nil, err
+		}
+		return float32(f), nil
+
+	case avro.Double:
+		return toDouble(v)
+
+	case avro.Bytes:
+		return toBytes(v)
+
+	case avro.String:
+		return toString(v)
+	}
+	return nil, fmt.Errorf("unsupported schema type %v", s.Type())
+}
+
+func toLong(v interface{}, logical string) (int64, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return timeToLong(t, logical)
+	case common.Time:
+		return timeToLong(time.Time(t), logical)
+	case nil:
+		return 0, typeError("number", v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, fmt.Errorf("value %v overflows long", u)
+		}
+		return int64(u), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("value %v is no integer", f)
+		}
+		return int64(f), nil
+	}
+	return 0, typeError("number", v)
+}
+
+func timeToLong(t time.Time, logical string) (int64, error) {
+	switch logical {
+	case "timestamp-millis":
+		return t.UnixNano() / int64(time.Millisecond), nil
+	case "timestamp-micros":
+		return t.UnixNano() / int64(time.Microsecond), nil
+	case "date":
+		days := t.Unix() / 86400
+		if t.Unix() < 0 && t.Unix()%86400 != 0 {
+			days--
+		}
+		return days, nil
+	}
+	return 0, fmt.Errorf("timestamps require a timestamp or date logical type, got '%v'", logical)
+}
+
+func toDouble(v interface{}) (float64, error) {
+	if v == nil {
+		return 0, typeError("number", v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, typeError("number", v)
+}
+
+func toString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case time.Time:
+		return common.Time(s).String(), nil
+	case common.Time:
+		return s.String(), nil
+	}
+	return "", typeError("string", v)
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return nil, typeError("bytes", v)
+}
+
+func toMapStr(v interface{}) (common.MapStr, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return common.MapStr(m), true
+	}
+	return nil, false
+}
+
+func typeError(expected string, v interface{}) error {
+	if v == nil {
+		return fmt.Errorf("expected %v, got null", expected)
+	}
+	return fmt.Errorf("expected %v, got %T", expected, v)
+}
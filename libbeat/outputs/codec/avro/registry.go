@@ -0,0 +1,226 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// wireMagic is the first byte of messages using the schema registry wire
+// format. It is followed by the 4 bytes schema ID and the Avro payload.
+const wireMagic = 0
+
+// registry resolves the schema to use from a schema registry compatible HTTP
+// endpoint. Schemas are cached per subject and refreshed after the cache TTL
+// expired. If the registry is not available, the cached schema is used until
+// the registry can be reached again. Without a cached schema, the request is
+// retried until the registry is available, so events are not dropped.
+type registry struct {
+	log      *logp.Logger
+	url      string
+	subject  *fmtstr.EventFormatString
+	username string
+	password string
+	ttl      time.Duration
+	client   *http.Client
+
+	// backoff of the retries while no schema is cached for a subject
+	retryInit time.Duration
+	retryMax  time.Duration
+
+	mu sync.Mutex
+	// The cached schemas by subject. Entries are replaced, never modified,
+	// so they can be used after releasing mu.
+	schemas map[string]*registrySchema
+}
+
+type registrySchema struct {
+	schema  *avro.RecordSchema
+	header  []byte
+	fetched time.Time
+}
+
+type registryResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+func newRegistry(config RegistryConfig) (*registry, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema registry URL: %w", err)
+	}
+
+	tlsConfig, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.BuildModuleConfig(u.Hostname())
+	}
+
+	return &registry{
+		log:      logp.NewLogger("avro"),
+		url:      strings.TrimRight(config.URL, "/"),
+		subject:  config.Subject,
+		username: config.Username,
+		password: config.Password,
+		ttl:      config.CacheTTL,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		retryInit: 1 * time.Second,
+		retryMax:  60 * time.Second,
+		schemas:   map[string]*registrySchema{},
+	}, nil
+}
+
+// prefetch loads the schema of a constant subject, so an unavailable
+// registry or unknown subject fails the output setup.
+func (r *registry) prefetch() error {
+	if !r.subject.IsConst() {
+		return nil
+	}
+
+	subject, err := r.subject.Run(nil)
+	if err != nil {
+		return err
+	}
+	latest, _, err := r.fetch(subject)
+	if err != nil {
+		return fmt.Errorf("failed to load the schema of subject '%v': %w", subject, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[subject] = latest
+	return nil
+}
+
+// schemaFor returns the schema and the wire format header for the subject
+// computed from the event.
+func (r *registry) schemaFor(event *beat.Event) (*schema, []byte, error) {
+	subject, err := r.subject.Run(event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compute the schema registry subject: %w", err)
+	}
+
+	r.mu.Lock()
+	cached := r.schemas[subject]
+	r.mu.Unlock()
+	if cached != nil && (r.ttl == 0 || time.Since(cached.fetched) < r.ttl) {
+		return cached.schema, cached.header, nil
+	}
+
+	// The registry is queried without holding the lock, so a slow registry
+	// doesn't block events of subjects with a valid cached schema.
+	latest, err := r.fetchWithRetry(subject, cached == nil)
+	if err != nil {
+		if cached == nil {
+			return nil, nil, err
+		}
+
+		r.log.Warnf("Failed to refresh schema of subject '%v', continue using the cached schema: %v", subject, err)
+		latest = &registrySchema{schema: cached.schema, header: cached.header, fetched: time.Now()}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[subject] = latest
+	return latest.schema, latest.header, nil
+}
+
+// fetchWithRetry queries the latest schema of the subject. If retry is set,
+// requests failing because the registry is unavailable are retried until
+// they succeed.
+func (r *registry) fetchWithRetry(subject string, retry bool) (*registrySchema, error) {
+	b := backoff.NewExpBackoff(nil, r.retryInit, r.retryMax)
+	for {
+		latest, temporary, err := r.fetch(subject)
+		if err == nil || !retry || !temporary {
+			return latest, err
+		}
+
+		r.log.Errorf("Failed to load schema of subject '%v', retrying: %v", subject, err)
+		b.Wait()
+	}
+}
+
+// fetch queries the latest schema of the subject. On error, it also reports
+// whether the error is temporary, as for network errors or server errors of
+// the registry.
+func (r *registry) fetch(subject string) (*registrySchema, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url+"/subjects/"+url.PathEscape(subject)+"/versions/latest", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if r.username != "" || r.password != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to query the schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read the schema registry response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		temporary := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, temporary, fmt.Errorf("schema registry returned %v for subject '%v': %s", resp.Status, subject, body)
+	}
+
+	var response registryResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, false, fmt.Errorf("invalid schema registry response: %w", err)
+	}
+
+	s, err := parseSchema([]byte(response.Schema))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid schema for subject '%v': %w", subject, err)
+	}
+
+	header := make([]byte, 5)
+	header[0] = wireMagic
+	binary.BigEndian.PutUint32(header[1:], uint32(response.ID))
+
+	return &registrySchema{schema: s, header: header, fetched: time.Now()}, false, nil
+}
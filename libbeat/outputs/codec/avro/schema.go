@@ -0,0 +1,39 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"errors"
+
+	"github.com/hamba/avro"
+)
+
+// parseSchema parses the schema of the encoded events, which must be a
+// record. Every schema is parsed with its own cache of named types, so
+// schemas of different subjects can not refer to each others types.
+func parseSchema(definition []byte) (*avro.RecordSchema, error) {
+	s, err := avro.ParseWithCache(string(definition), "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, err
+	}
+	record, ok := s.(*avro.RecordSchema)
+	if !ok {
+		return nil, errors.New("the schema of events must be a record")
+	}
+	return record, nil
+}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const timestampType = "google.protobuf.Timestamp"
+
+// loadMessageType reads a FileDescriptorSet and returns the message with the
+// given fully qualified name.
+func loadMessageType(path, name string) (protoreflect.MessageDescriptor, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode descriptor set %v: %w", path, err)
+	}
+
+	files, err := newFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %v: %w", path, err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(name, ".")))
+	if err != nil {
+		return nil, fmt.Errorf("message type '%v' not found in descriptor set %v", name, path)
+	}
+	msg, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%v' in descriptor set %v is no message type", name, path)
+	}
+	return msg, nil
+}
+
+// newFiles builds the files of a descriptor set. Files must be listed after
+// the files they import, as written by protoc.
+func newFiles(set *descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	files := new(protoregistry.Files)
+	for _, file := range set.GetFile() {
+		descriptor, err := protodesc.NewFile(file, files)
+		if err != nil {
+			return nil, err
+		}
+		if err := files.RegisterFile(descriptor); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
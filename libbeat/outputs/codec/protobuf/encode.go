@@ -0,0 +1,333 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// setFields sets the fields of msg to the values resolved using lookup.
+// Missing and null values are not set.
+func setFields(msg protoreflect.Message, lookup func(name string) (interface{}, bool)) error {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		v, _ := lookup(string(field.Name()))
+		if v == nil {
+			if field.Cardinality() == protoreflect.Required {
+				return fmt.Errorf("missing value for required field '%v'", field.Name())
+			}
+			continue
+		}
+
+		if err := setField(msg, field, v); err != nil {
+			return fmt.Errorf("%v: %w", field.Name(), err)
+		}
+	}
+	return nil
+}
+
+func setField(msg protoreflect.Message, field protoreflect.FieldDescriptor, v interface{}) error {
+	if field.IsMap() {
+		return setMap(msg.Mutable(field).Map(), field, v)
+	}
+
+	if !field.IsList() {
+		value, err := toValue(field, func() protoreflect.Value { return msg.NewField(field) }, v)
+		if err != nil {
+			return err
+		}
+		msg.Set(field, value)
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return typeError("list", v)
+	}
+	list := msg.Mutable(field).List()
+	for i := 0; i < rv.Len(); i++ {
+		value, err := toValue(field, list.NewElement, rv.Index(i).Interface())
+		if err != nil {
+			return fmt.Errorf("[%v]: %w", i, err)
+		}
+		list.Append(value)
+	}
+	return nil
+}
+
+func setMap(m protoreflect.Map, field protoreflect.FieldDescriptor, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return typeError("map", v)
+	}
+
+	for _, k := range rv.MapKeys() {
+		name := k.String()
+		key, err := toValue(field.MapKey(), nil, name)
+		if err != nil {
+			return fmt.Errorf("%v: key: %w", name, err)
+		}
+
+		var value protoreflect.Value
+		if inner := rv.MapIndex(k).Interface(); inner != nil {
+			value, err = toValue(field.MapValue(), m.NewValue, inner)
+			if err != nil {
+				return fmt.Errorf("%v: value: %w", name, err)
+			}
+		} else if field.MapValue().Message() != nil {
+			value = m.NewValue()
+		} else {
+			value = field.MapValue().Default()
+		}
+		m.Set(key.MapKey(), value)
+	}
+	return nil
+}
+
+// toValue converts v to the type of the field. newMessage returns the value
+// used for message fields.
+func toValue(field protoreflect.FieldDescriptor, newMessage func() protoreflect.Value, v interface{}) (protoreflect.Value, error) {
+	var err error
+	switch field.Kind() {
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		var f float64
+		if f, err = toDouble(v); err == nil {
+			if field.Kind() == protoreflect.FloatKind {
+				return protoreflect.ValueOfFloat32(float32(f)), nil
+			}
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		if n, err = toInt(v, math.MinInt32, math.MaxInt32); err == nil {
+			return protoreflect.ValueOfInt32(int32(n)), nil
+		}
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		if n, err = toInt(v, math.MinInt64, math.MaxInt64); err == nil {
+			return protoreflect.ValueOfInt64(n), nil
+		}
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		if n, err = toUint(v, math.MaxUint32); err == nil {
+			return protoreflect.ValueOfUint32(uint32(n)), nil
+		}
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		if n, err = toUint(v, math.MaxUint64); err == nil {
+			return protoreflect.ValueOfUint64(n), nil
+		}
+
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+		err = typeError("boolean", v)
+
+	case protoreflect.StringKind:
+		var str string
+		if str, err = toString(v); err == nil {
+			return protoreflect.ValueOfString(str), nil
+		}
+
+	case protoreflect.BytesKind:
+		var raw []byte
+		if raw, err = toBytes(v); err == nil {
+			return protoreflect.ValueOfBytes(raw), nil
+		}
+
+	case protoreflect.EnumKind:
+		var n protoreflect.EnumNumber
+		if n, err = toEnum(field.Enum(), v); err == nil {
+			return protoreflect.ValueOfEnum(n), nil
+		}
+
+	case protoreflect.MessageKind:
+		value := newMessage()
+		if err = setMessage(value.Message(), v); err == nil {
+			return value, nil
+		}
+
+	default:
+		err = fmt.Errorf("unsupported field type %v", field.Kind())
+	}
+	return protoreflect.Value{}, err
+}
+
+func setMessage(msg protoreflect.Message, v interface{}) error {
+	if msg.Descriptor().FullName() == timestampType {
+		if ts, ok := toTime(v); ok {
+			fields := msg.Descriptor().Fields()
+			msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(ts.Unix()))
+			msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(ts.Nanosecond())))
+			return nil
+		}
+	}
+
+	fields, ok := toMapStr(v)
+	if !ok {
+		return typeError("object", v)
+	}
+	return setFields(msg, func(name string) (interface{}, bool) {
+		value, exists := fields[name]
+		return value, exists
+	})
+}
+
+func toInt(v interface{}, min, max int64) (int64, error) {
+	var n int64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, fmt.Errorf("value %v out of range", u)
+		}
+		n = int64(u)
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("value %v is no integer", f)
+		}
+		n = int64(f)
+	default:
+		return 0, typeError("integer", v)
+	}
+
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %v out of range", n)
+	}
+	return n, nil
+}
+
+func toUint(v interface{}, max uint64) (uint64, error) {
+	var n uint64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			return 0, fmt.Errorf("value %v out of range", i)
+		}
+		n = uint64(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("value %v is no unsigned integer", f)
+		}
+		n = uint64(f)
+	default:
+		return 0, typeError("unsigned integer", v)
+	}
+
+	if n > max {
+		return 0, fmt.Errorf("value %v out of range", n)
+	}
+	return n, nil
+}
+
+func toDouble(v interface{}) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, typeError("number", v)
+}
+
+func toEnum(enum protoreflect.EnumDescriptor, v interface{}) (protoreflect.EnumNumber, error) {
+	if name, ok := v.(string); ok {
+		value := enum.Values().ByName(protoreflect.Name(name))
+		if value == nil {
+			return 0, fmt.Errorf("unknown enum value '%v'", name)
+		}
+		return value.Number(), nil
+	}
+
+	n, err := toInt(v, math.MinInt32, math.MaxInt32)
+	if err != nil {
+		return 0, typeError("enum", v)
+	}
+	return protoreflect.EnumNumber(n), nil
+}
+
+func toString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case time.Time:
+		return common.Time(s).String(), nil
+	case common.Time:
+		return s.String(), nil
+	}
+	return "", typeError("string", v)
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return nil, typeError("bytes", v)
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case common.Time:
+		return time.Time(t), true
+	}
+	return time.Time{}, false
+}
+
+func toMapStr(v interface{}) (common.MapStr, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return common.MapStr(m), true
+	}
+	return nil, false
+}
+
+func typeError(expected string, v interface{}) error {
+	return fmt.Errorf("expected %v, got %T", expected, v)
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// Encoder serializes a beat.Event using the protobuf binary encoding. The
+// fields of the configured message type are read from the event fields. The
+// timestamp field is filled with the event timestamp.
+type Encoder struct {
+	buf            []byte
+	message        protoreflect.MessageDescriptor
+	timestampField string
+}
+
+func init() {
+	codec.RegisterType("protobuf", func(_ beat.Info, cfg *common.Config) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("empty protobuf codec configuration")
+		}
+
+		config := defaultConfig
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		return New(config)
+	})
+}
+
+// New creates a new protobuf Encoder.
+func New(config Config) (*Encoder, error) {
+	msg, err := loadMessageType(config.DescriptorSet, config.MessageType)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{message: msg, timestampField: config.TimestampField}, nil
+}
+
+// Encode serializes a beat event to protobuf. Events not matching the
+// message type return an error, so the output can drop the event.
+func (e *Encoder) Encode(_ string, event *beat.Event) ([]byte, error) {
+	msg := dynamicpb.NewMessage(e.message)
+	err := setFields(msg, func(name string) (interface{}, bool) {
+		if name == e.timestampField {
+			return event.Timestamp, true
+		}
+		v, exists := event.Fields[name]
+		return v, exists
+	})
+	if err != nil {
+		return nil, fmt.Errorf("event does not match message type '%v': %w", e.message.FullName(), err)
+	}
+
+	// Deterministic output sorts map entries, so equal events are always
+	// encoded the same way.
+	buf, err := proto.MarshalOptions{Deterministic: true}.MarshalAppend(e.buf[:0], msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event as message type '%v': %w", e.message.FullName(), err)
+	}
+
+	e.buf = buf
+	return buf, nil
+}
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package protobuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestEncodeDescriptorMessage(t *testing.T) {
+	path := writeDescriptorSet(t, protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	encoder, err := New(Config{DescriptorSet: path, MessageType: "google.protobuf.DescriptorProto"})
+	require.NoError(t, err)
+
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"name": "Event",
+			"field": []common.MapStr{
+				{"name": "message", "number": 1, "type": "TYPE_STRING", "label": "LABEL_OPTIONAL"},
+				{"name": "tags", "number": uint64(2), "type": 9, "label": "LABEL_REPEATED", "options": common.MapStr{"packed": false}},
+			},
+			"reserved_name": []string{"a", "b"},
+			"unknown":       "ignored",
+		},
+	}
+
+	out, err := encoder.Encode("test", event)
+	require.NoError(t, err)
+
+	var decoded descriptorpb.DescriptorProto
+	require.NoError(t, proto.Unmarshal(out, &decoded))
+	assert.Equal(t, "Event", decoded.GetName())
+	assert.Equal(t, []string{"a", "b"}, decoded.GetReservedName())
+	require.Len(t, decoded.GetField(), 2)
+	assert.Equal(t, "message", decoded.GetField()[0].GetName())
+	assert.Equal(t, int32(1), decoded.GetField()[0].GetNumber())
+	assert.Equal(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, decoded.GetField()[0].GetType())
+	assert.Equal(t, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, decoded.GetField()[1].GetLabel())
+	assert.Equal(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, decoded.GetField()[1].GetType())
+	assert.False(t, decoded.GetField()[1].GetOptions().GetPacked())
+	assert.NotNil(t, decoded.GetField()[1].GetOptions())
+}
+
+func TestEncodeTimestampsAndMaps(t *testing.T) {
+	path := writeDescriptorSet(t, timestampDescriptor(), eventDescriptor())
+	defer os.RemoveAll(filepath.Dir(path))
+
+	encoder, err := New(Config{DescriptorSet: path, MessageType: "test.Event", TimestampField: "timestamp"})
+	require.NoError(t, err)
+
+	event := &beat.Event{
+		Timestamp: time.Unix(5, 7),
+		Fields: common.MapStr{
+			"message": "hi",
+			"counts":  common.MapStr{"a": 1},
+			"deltas":  []interface{}{-1, 1},
+		},
+	}
+
+	out, err := encoder.Encode("test", event)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x0a, 0x04, 0x08, 0x05, 0x10, 0x07, // timestamp
+		0x12, 0x02, 'h', 'i', // message
+		0x1a, 0x05, 0x0a, 0x01, 'a', 0x10, 0x01, // counts
+		0x22, 0x02, 0x01, 0x02, // deltas, packed in proto3
+	}, out)
+}
+
+func TestEncodeFailures(t *testing.T) {
+	path := writeDescriptorSet(t, timestampDescriptor(), eventDescriptor())
+	defer os.RemoveAll(filepath.Dir(path))
+
+	encoder, err := New(Config{DescriptorSet: path, MessageType: "test.Event", TimestampField: "timestamp"})
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		fields common.MapStr
+		err    string
+	}{
+		"type mismatch": {
+			fields: common.MapStr{"message": 1},
+			err:    "message: expected string, got int",
+		},
+		"out of range": {
+			fields: common.MapStr{"deltas": []int64{1 << 40}},
+			err:    "deltas: [0]: value 1099511627776 out of range",
+		},
+		"invalid map": {
+			fields: common.MapStr{"counts": common.MapStr{"a": "b"}},
+			err:    "counts: a: value: expected integer, got string",
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := encoder.Encode("test", &beat.Event{Timestamp: time.Now(), Fields: test.fields})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	_, err = New(Config{DescriptorSet: path, MessageType: "test.Missing"})
+	assert.Error(t, err)
+}
+
+func writeDescriptorSet(t *testing.T, files ...*descriptorpb.FileDescriptorProto) string {
+	dir, err := ioutil.TempDir("", "protobuf")
+	require.NoError(t, err)
+
+	raw, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "descriptors.pb")
+	require.NoError(t, ioutil.WriteFile(path, raw, 0600))
+	return path
+}
+
+func timestampDescriptor() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("google/protobuf/timestamp.proto"),
+		Package: proto.String("google.protobuf"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Timestamp"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				makeField("seconds", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				makeField("nanos", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			},
+		}},
+	}
+}
+
+func eventDescriptor() *descriptorpb.FileDescriptorProto {
+	deltas := makeField("deltas", 4, descriptorpb.FieldDescriptorProto_TYPE_SINT32, "")
+	deltas.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	counts := makeField("counts", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Event.CountsEntry")
+	counts.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("event.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				makeField("timestamp", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				makeField("message", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				counts,
+				deltas,
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("CountsEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					makeField("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					makeField("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}
+}
+
+func makeField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   typ.Enum(),
+	}
+	if typeName != "" {
+		field.TypeName = proto.String(typeName)
+	}
+	return field
+}
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+)
+
+// adaptiveController limits the bulk size and the number of concurrent bulk
+// requests of all clients of an output. The limits are adjusted AIMD style
+// based on the outcome of the bulk requests: after a successful bulk request
+// using the full bulk size, the bulk size is increased up to bulk_max_size.
+// Once the bulk size can not be increased anymore, the number of concurrent
+// requests is increased by one. Bulk requests that fail, are answered with
+// 429 (Too Many Requests), or exceed the latency threshold, halve the number
+// of concurrent requests first, and the bulk size once only a single request
+// is allowed.
+//
+// The bulk size starts at min_bulk_size and grows by factor 1.5 (slow start),
+// until the first request signals congestion. Afterwards the bulk size is
+// increased additively by min_bulk_size.
+type adaptiveController struct {
+	minBulkSize      int
+	maxBulkSize      int
+	maxConcurrency   int
+	latencyThreshold time.Duration
+	observer         outputs.Observer
+
+	mu          sync.Mutex
+	bulkSize    int
+	concurrency int
+	inFlight    int
+	slowStart   bool
+
+	// generation is incremented whenever the limits are decreased. Congestion
+	// reported by requests started before the last decrease is ignored, so
+	// concurrent requests failing at once decrease the limits only once.
+	generation uint64
+
+	// changed is closed and replaced when a slot is freed or the concurrency
+	// limit is changed.
+	changed chan struct{}
+}
+
+// adaptivePermit is handed out to a client for executing a single bulk
+// request. The permit must be returned via release.
+type adaptivePermit struct {
+	bulkSize   int
+	generation uint64
+	start      time.Time
+}
+
+func newAdaptiveController(
+	config adaptiveConfig,
+	maxBulkSize, maxConcurrency int,
+	observer outputs.Observer,
+) *adaptiveController {
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+
+	c := &adaptiveController{
+		minBulkSize:      config.MinBulkSize,
+		maxBulkSize:      maxBulkSize,
+		maxConcurrency:   maxConcurrency,
+		latencyThreshold: config.LatencyThreshold,
+		observer:         observer,
+		bulkSize:         config.MinBulkSize,
+		concurrency:      1,
+		slowStart:        true,
+		changed:          make(chan struct{}),
+	}
+	c.report()
+	return c
+}
+
+// acquire waits for a free request slot. The returned permit holds the bulk
+// size to be used by the request.
+func (c *adaptiveController) acquire(ctx context.Context) (adaptivePermit, error) {
+	for {
+		c.mu.Lock()
+		if c.inFlight < c.concurrency {
+			c.inFlight++
+			permit := adaptivePermit{
+				bulkSize:   c.bulkSize,
+				generation: c.generation,
+				start:      time.Now(),
+			}
+			c.mu.Unlock()
+			return permit, nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return adaptivePermit{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release returns the permit and updates the limits based on the outcome of
+// the request. events is the number of events that have been sent.
+func (c *adaptiveController) release(permit adaptivePermit, events int, failed bool) {
+	latency := time.Since(permit.start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+	congested := failed || (c.latencyThreshold > 0 && latency > c.latencyThreshold)
+	if congested {
+		if permit.generation == c.generation {
+			c.decrease()
+		}
+	} else if events >= permit.bulkSize {
+		c.increase()
+	}
+	c.notify()
+}
+
+func (c *adaptiveController) increase() {
+	switch {
+	case c.bulkSize < c.maxBulkSize:
+		if c.slowStart {
+			c.bulkSize = int(math.Ceil(1.5 * float64(c.bulkSize)))
+		} else {
+			c.bulkSize += c.minBulkSize
+		}
+		if c.bulkSize > c.maxBulkSize {
+			c.bulkSize = c.maxBulkSize
+		}
+	case c.concurrency < c.maxConcurrency:
+		c.concurrency++
+	default:
+		return
+	}
+	c.report()
+}
+
+func (c *adaptiveController) decrease() {
+	c.slowStart = false
+	c.generation++
+
+	if c.concurrency > 1 {
+		c.concurrency /= 2
+	} else {
+		c.bulkSize /= 2
+		if c.bulkSize < c.minBulkSize {
+			c.bulkSize = c.minBulkSize
+		}
+	}
+	c.report()
+}
+
+func (c *adaptiveController) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *adaptiveController) report() {
+	if c.observer != nil {
+		c.observer.AdaptiveWindow(c.bulkSize, c.concurrency)
+	}
+}
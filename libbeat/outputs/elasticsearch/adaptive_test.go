@@ -0,0 +1,248 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+)
+
+func TestAdaptiveControllerSlowStart(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10}, 50, 2, nil)
+
+	var sizes []int
+	for i := 0; i < 6; i++ {
+		permit, err := c.acquire(context.Background())
+		require.NoError(t, err)
+		sizes = append(sizes, permit.bulkSize)
+		c.release(permit, permit.bulkSize, false)
+	}
+	assert.Equal(t, []int{10, 15, 23, 35, 50, 50}, sizes)
+	assert.Equal(t, 2, c.concurrency, "concurrency must grow once bulk size is at maximum")
+}
+
+func TestAdaptiveControllerPartialBatchDoesNotGrow(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10}, 50, 2, nil)
+
+	permit, err := c.acquire(context.Background())
+	require.NoError(t, err)
+	c.release(permit, 5, false)
+	assert.Equal(t, 10, c.bulkSize)
+	assert.Equal(t, 1, c.concurrency)
+}
+
+func TestAdaptiveControllerDecrease(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10}, 100, 4, nil)
+	c.bulkSize, c.concurrency = 100, 4
+
+	permit, err := c.acquire(context.Background())
+	require.NoError(t, err)
+	c.release(permit, permit.bulkSize, true)
+	assert.Equal(t, 2, c.concurrency, "concurrency must be reduced first")
+	assert.Equal(t, 100, c.bulkSize)
+
+	permit, _ = c.acquire(context.Background())
+	c.release(permit, permit.bulkSize, true)
+	permit, _ = c.acquire(context.Background())
+	c.release(permit, permit.bulkSize, true)
+	assert.Equal(t, 1, c.concurrency)
+	assert.Equal(t, 50, c.bulkSize)
+
+	// no more slow start after congestion, grow additively
+	permit, _ = c.acquire(context.Background())
+	c.release(permit, permit.bulkSize, false)
+	assert.Equal(t, 60, c.bulkSize)
+
+	for i := 0; i < 10; i++ {
+		permit, _ = c.acquire(context.Background())
+		c.release(permit, permit.bulkSize, true)
+	}
+	assert.Equal(t, 10, c.bulkSize, "bulk size must not drop below min_bulk_size")
+}
+
+func TestAdaptiveControllerDecreaseOncePerGeneration(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10}, 100, 4, nil)
+	c.concurrency = 4
+
+	var permits []adaptivePermit
+	for i := 0; i < 4; i++ {
+		permit, err := c.acquire(context.Background())
+		require.NoError(t, err)
+		permits = append(permits, permit)
+	}
+	for _, permit := range permits {
+		c.release(permit, permit.bulkSize, true)
+	}
+	assert.Equal(t, 2, c.concurrency)
+	assert.Equal(t, 0, c.inFlight)
+}
+
+func TestAdaptiveControllerLatencyThreshold(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10, LatencyThreshold: time.Millisecond}, 100, 4, nil)
+	c.concurrency = 2
+
+	permit, err := c.acquire(context.Background())
+	require.NoError(t, err)
+	permit.start = permit.start.Add(-time.Second)
+	c.release(permit, permit.bulkSize, false)
+	assert.Equal(t, 1, c.concurrency)
+}
+
+func TestAdaptiveControllerAcquireBlocks(t *testing.T) {
+	c := newAdaptiveController(adaptiveConfig{MinBulkSize: 10}, 100, 4, nil)
+
+	permit, err := c.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.acquire(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		p, err := c.acquire(context.Background())
+		if assert.NoError(t, err) {
+			c.release(p, 0, false)
+		}
+	}()
+
+	c.release(permit, 0, false)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting acquire was not unblocked on release")
+	}
+}
+
+func TestClientPublishAdaptive(t *testing.T) {
+	bulkStatus := http.StatusOK
+	var bulkItems []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.9.0" } }`)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		items := strings.Count(string(body), "\n") / 2
+		bulkItems = append(bulkItems, items)
+
+		w.WriteHeader(bulkStatus)
+		if bulkStatus != http.StatusOK {
+			fmt.Fprintln(w, `{"error":{"type":"es_rejected_execution_exception"},"status":429}`)
+			return
+		}
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.TrimSuffix(strings.Repeat(`{"index":{"status":201}},`, items), ","))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ClientSettings{
+		ConnectionSettings: eslegclient.ConnectionSettings{URL: ts.URL},
+		Index:              outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+	}, nil)
+	require.NoError(t, err)
+	client.adaptive = newAdaptiveController(adaptiveConfig{MinBulkSize: 2}, 10, 1, nil)
+	require.NoError(t, client.Connect())
+
+	events := make([]beat.Event, 5)
+	for i := range events {
+		events[i] = beat.Event{Fields: common.MapStr{"message": i}}
+	}
+
+	// The batch is split into bulk requests of the growing bulk size.
+	batch := outest.NewBatch(events...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, 5, client.adaptive.bulkSize)
+
+	bulkStatus = http.StatusTooManyRequests
+	batch = outest.NewBatch(events...)
+	assert.Error(t, client.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 5)
+	assert.Equal(t, 2, client.adaptive.bulkSize)
+
+	assert.Equal(t, []int{2, 3, 5}, bulkItems)
+}
+
+func TestClientPublishAdaptiveSmallWindowDropsNothing(t *testing.T) {
+	var received int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.9.0" } }`)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		items := strings.Count(string(body), "\n") / 2
+		received += items
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.TrimSuffix(strings.Repeat(`{"index":{"status":201}},`, items), ","))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ClientSettings{
+		ConnectionSettings: eslegclient.ConnectionSettings{URL: ts.URL},
+		Index:              outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+	}, nil)
+	require.NoError(t, err)
+	client.adaptive = newAdaptiveController(adaptiveConfig{MinBulkSize: 2}, 100, 1, nil)
+	require.NoError(t, client.Connect())
+
+	events := make([]beat.Event, 50)
+	for i := range events {
+		events[i] = beat.Event{Fields: common.MapStr{"message": i}}
+	}
+
+	// Publish like the pipeline does with max_retries: 1, which drops the
+	// events still being retried after the second attempt.
+	const maxRetries = 1
+	pending := events
+	for attempt := 0; len(pending) > 0; attempt++ {
+		require.LessOrEqual(t, attempt, maxRetries, "%v events would be dropped", len(pending))
+
+		batch := outest.NewBatch(pending...)
+		require.NoError(t, client.Publish(context.Background(), batch))
+		require.Len(t, batch.Signals, 1)
+
+		pending = nil
+		for _, event := range batch.Signals[0].Events {
+			pending = append(pending, event.Content)
+		}
+	}
+	assert.Equal(t, len(events), received)
+}
@@ -45,6 +45,15 @@ type Client struct {
 	index    outputs.IndexSelector
 	pipeline *outil.Selector
 
+	deadLetter         deadLetterSink
+	nonIndexablePolicy *common.ConfigNamespace
+
+	dataStreams bool
+
+	// adaptive limits bulk size and number of concurrent requests. It is
+	// shared between all clients of an output, and nil if disabled.
+	adaptive *adaptiveController
+
 	observer outputs.Observer
 
 	log *logp.Logger
@@ -56,6 +65,14 @@ type ClientSettings struct {
 	Index    outputs.IndexSelector
 	Pipeline *outil.Selector
 	Observer outputs.Observer
+
+	// NonIndexablePolicy configures how events rejected by Elasticsearch as
+	// not indexable are handled. Events are dropped if unset.
+	NonIndexablePolicy *common.ConfigNamespace
+
+	// DataStreams makes the client index all events using `create`
+	// operations, as required by data streams.
+	DataStreams bool
 }
 
 type bulkResultStats struct {
@@ -63,6 +80,7 @@ type bulkResultStats struct {
 	duplicates   int // number of events failed with `create` due to ID already being indexed
 	fails        int // number of failed events (can be retried)
 	nonIndexable int // number of failed events (not indexable -> must be dropped)
+	deadLetter   int // number of not indexable events passed to the dead-letter sink
 	tooMany      int // number of events receiving HTTP 429 Too Many Requests
 }
 
@@ -70,6 +88,10 @@ const (
 	defaultEventType = "doc"
 )
 
+// minDataStreamVersion is the first Elasticsearch version supporting data
+// streams.
+var minDataStreamVersion = common.MustNewVersion("7.9.0")
+
 // NewClient instantiates a new client.
 func NewClient(
 	s ClientSettings,
@@ -80,6 +102,11 @@ func NewClient(
 		pipeline = nil
 	}
 
+	deadLetter, err := newDeadLetterSink(s.NonIndexablePolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := eslegclient.NewConnection(eslegclient.ConnectionSettings{
 		URL:              s.URL,
 		Username:         s.Username,
@@ -130,6 +157,11 @@ func NewClient(
 		index:    s.Index,
 		pipeline: pipeline,
 
+		deadLetter:         deadLetter,
+		nonIndexablePolicy: s.NonIndexablePolicy,
+
+		dataStreams: s.DataStreams,
+
 		observer: s.Observer,
 
 		log: logp.NewLogger("elasticsearch"),
@@ -167,8 +199,10 @@ func (client *Client) Clone() *Client {
 				Observer:          nil,
 				EscapeHTML:        false,
 			},
-			Index:    client.index,
-			Pipeline: client.pipeline,
+			Index:              client.index,
+			Pipeline:           client.pipeline,
+			NonIndexablePolicy: client.nonIndexablePolicy,
+			DataStreams:        client.dataStreams,
 		},
 		nil, // XXX: do not pass connection callback?
 	)
@@ -177,6 +211,10 @@ func (client *Client) Clone() *Client {
 
 func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error {
 	events := batch.Events()
+	if client.adaptive != nil {
+		return client.publishAdaptive(ctx, batch, events)
+	}
+
 	rest, err := client.publishEvents(ctx, events)
 	if len(rest) == 0 {
 		batch.ACK()
@@ -186,6 +224,39 @@ func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error
 	return err
 }
 
+// publishAdaptive sends the events in consecutive bulk requests, each no
+// larger than the bulk size of the adaptive controller at the time it is
+// sent. Once a bulk request fails, the failed events and all events not sent
+// yet are retried.
+func (client *Client) publishAdaptive(ctx context.Context, batch publisher.Batch, events []publisher.Event) error {
+	for len(events) > 0 {
+		permit, err := client.adaptive.acquire(ctx)
+		if err != nil {
+			// The remaining events have not been sent, so they are returned
+			// without counting as a retry.
+			batch.CancelledEvents(events)
+			return err
+		}
+
+		n := len(events)
+		if n > permit.bulkSize {
+			n = permit.bulkSize
+		}
+		rest, err := client.publishEvents(ctx, events[:n])
+		client.adaptive.release(permit, n, err != nil)
+		if err != nil {
+			retry := make([]publisher.Event, 0, len(rest)+len(events)-n)
+			retry = append(retry, rest...)
+			batch.RetryEvents(append(retry, events[n:]...))
+			return err
+		}
+		events = events[n:]
+	}
+
+	batch.ACK()
+	return nil
+}
+
 // PublishEvents sends all events to elasticsearch. On error a slice with all
 // events not published or confirmed to be processed by elasticsearch will be
 // returned. The input slice backing memory will be reused by return the value.
@@ -207,7 +278,7 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 	// events slice
 	origCount := len(data)
 	span.Context.SetLabel("events_original", origCount)
-	data, bulkItems := bulkEncodePublishRequest(client.log, client.conn.GetVersion(), client.index, client.pipeline, data)
+	data, bulkItems := bulkEncodePublishRequest(client.log, client.conn.GetVersion(), client.index, client.pipeline, client.dataStreams, data)
 	newCount := len(data)
 	span.Context.SetLabel("events_encoded", newCount)
 	if st != nil && origCount > newCount {
@@ -238,7 +309,7 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		failedEvents = data
 		stats.fails = len(failedEvents)
 	} else {
-		failedEvents, stats = bulkCollectPublishFails(client.log, result, data)
+		failedEvents, stats = bulkCollectPublishFails(client.log, result, data, client.deadLetter)
 	}
 
 	failed := len(failedEvents)
@@ -253,6 +324,7 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		st.Dropped(dropped)
 		st.Duplicate(duplicates)
 		st.ErrTooMany(stats.tooMany)
+		st.DeadLetter(stats.deadLetter)
 	}
 
 	if failed > 0 {
@@ -271,6 +343,7 @@ func bulkEncodePublishRequest(
 	version common.Version,
 	index outputs.IndexSelector,
 	pipeline *outil.Selector,
+	dataStreams bool,
 	data []publisher.Event,
 ) ([]publisher.Event, []interface{}) {
 
@@ -278,7 +351,14 @@ func bulkEncodePublishRequest(
 	bulkItems := []interface{}{}
 	for i := range data {
 		event := &data[i].Content
-		meta, err := createEventBulkMeta(log, version, index, pipeline, event)
+
+		var meta interface{}
+		var err error
+		if dlIndex, ok := deadLetterIndex(&data[i]); ok {
+			meta, err = createDeadLetterBulkMeta(version, dlIndex, dataStreams)
+		} else {
+			meta, err = createEventBulkMeta(log, version, index, pipeline, dataStreams, event)
+		}
 		if err != nil {
 			log.Errorf("Failed to encode event meta data: %+v", err)
 			continue
@@ -299,6 +379,7 @@ func createEventBulkMeta(
 	version common.Version,
 	indexSel outputs.IndexSelector,
 	pipelineSel *outil.Selector,
+	dataStreams bool,
 	event *beat.Event,
 ) (interface{}, error) {
 	eventType := ""
@@ -328,6 +409,14 @@ func createEventBulkMeta(
 		ID:       id,
 	}
 
+	// Data streams are append-only, documents can only be added using `create`.
+	if dataStreams {
+		if opType == events.OpTypeDelete || opType == events.OpTypeIndex {
+			return nil, fmt.Errorf("%s %s is not supported with data streams", events.FieldMetaOpType, opType)
+		}
+		return eslegclient.BulkCreateAction{Create: meta}, nil
+	}
+
 	if opType == events.OpTypeDelete {
 		if id != "" {
 			return eslegclient.BulkDeleteAction{Delete: meta}, nil
@@ -366,11 +455,13 @@ func getPipeline(event *beat.Event, pipelineSel *outil.Selector) (string, error)
 // bulkCollectPublishFails checks per item errors returning all events
 // to be tried again due to error code returned for that items. If indexing an
 // event failed due to some error in the event itself (e.g. does not respect mapping),
-// the event will be dropped.
+// the event will be passed to the dead-letter sink, or dropped if no sink is
+// configured. Events the sink wants to have re-indexed are returned for retry.
 func bulkCollectPublishFails(
 	log *logp.Logger,
 	result eslegclient.BulkResult,
 	data []publisher.Event,
+	deadLetter deadLetterSink,
 ) ([]publisher.Event, bulkResultStats) {
 	reader := newJSONReader(result)
 	if err := bulkReadToItems(reader); err != nil {
@@ -381,6 +472,7 @@ func bulkCollectPublishFails(
 	count := len(data)
 	failed := data[:0]
 	stats := bulkResultStats{}
+	var rejected []rejectedEvent
 	for i := 0; i < count; i++ {
 		status, msg, err := bulkReadItemStatus(log, reader)
 		if err != nil {
@@ -405,6 +497,11 @@ func bulkCollectPublishFails(
 				stats.tooMany++
 			} else {
 				// hard failure, don't collect
+				if _, isDeadLetter := deadLetterIndex(&data[i]); deadLetter != nil && !isDeadLetter {
+					log.Debugf("Passing event to dead-letter sink (status=%v): %s", status, msg)
+					rejected = append(rejected, rejectedEvent{event: data[i], status: status, msg: string(msg)})
+					continue
+				}
 				log.Warnf("Cannot index event %#v (status=%v): %s", data[i], status, msg)
 				stats.nonIndexable++
 				continue
@@ -416,11 +513,31 @@ func bulkCollectPublishFails(
 		failed = append(failed, data[i])
 	}
 
+	if len(rejected) > 0 {
+		retry, err := deadLetter.Add(rejected)
+		if err != nil {
+			log.Errorf("Failed to pass %v events to dead-letter sink: %v", len(rejected), err)
+			stats.nonIndexable += len(rejected)
+		} else {
+			stats.deadLetter = len(rejected)
+			stats.nonIndexable += len(rejected) - len(retry)
+			failed = append(failed, retry...)
+		}
+	}
+
 	return failed, stats
 }
 
 func (client *Client) Connect() error {
-	return client.conn.Connect()
+	if err := client.conn.Connect(); err != nil {
+		return err
+	}
+
+	if version := client.conn.GetVersion(); client.dataStreams && version.LessThan(minDataStreamVersion) {
+		client.conn.Close()
+		return fmt.Errorf("data streams require Elasticsearch %v or newer, but connected to %v", minDataStreamVersion, version)
+	}
+	return nil
 }
 
 func (client *Client) Close() error {
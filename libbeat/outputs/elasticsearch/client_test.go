@@ -21,9 +21,13 @@ package elasticsearch
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -54,7 +58,7 @@ func TestCollectPublishFailsNone(t *testing.T) {
 		events[i] = publisher.Event{Content: beat.Event{Fields: event}}
 	}
 
-	res, _ := bulkCollectPublishFails(logp.L(), response, events)
+	res, _ := bulkCollectPublishFails(logp.L(), response, events, nil)
 	assert.Equal(t, 0, len(res))
 }
 
@@ -71,7 +75,7 @@ func TestCollectPublishFailMiddle(t *testing.T) {
 	eventFail := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event, eventFail, event}
 
-	res, stats := bulkCollectPublishFails(logp.L(), response, events)
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, nil)
 	assert.Equal(t, 1, len(res))
 	if len(res) == 1 {
 		assert.Equal(t, eventFail, res[0])
@@ -91,7 +95,7 @@ func TestCollectPublishFailAll(t *testing.T) {
 	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event, event, event}
 
-	res, stats := bulkCollectPublishFails(logp.L(), response, events)
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, nil)
 	assert.Equal(t, 3, len(res))
 	assert.Equal(t, events, res)
 	assert.Equal(t, stats, bulkResultStats{fails: 3, tooMany: 3})
@@ -132,11 +136,148 @@ func TestCollectPipelinePublishFail(t *testing.T) {
 	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event}
 
-	res, _ := bulkCollectPublishFails(logp.L(), response, events)
+	res, _ := bulkCollectPublishFails(logp.L(), response, events, nil)
 	assert.Equal(t, 1, len(res))
 	assert.Equal(t, events, res)
 }
 
+func TestCollectPublishFailsDeadLetterIndex(t *testing.T) {
+	response := []byte(`
+    { "items": [
+      {"create": {"status": 200}},
+      {"create": {"status": 400, "error": {"type": "mapper_parsing_exception"}}},
+      {"create": {"status": 429, "error": "ups"}}
+    ]}
+  `)
+
+	ts := time.Date(2020, 8, 10, 12, 0, 0, 0, time.UTC)
+	event := publisher.Event{Content: beat.Event{Timestamp: ts, Fields: common.MapStr{"field": 1}}}
+	eventFail := publisher.Event{Content: beat.Event{Timestamp: ts, Fields: common.MapStr{"field": "fail"}}}
+	events := []publisher.Event{event, eventFail, event}
+
+	sink := &deadLetterIndexSink{index: "dead-letter"}
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, sink)
+	assert.Equal(t, bulkResultStats{acked: 1, fails: 1, tooMany: 1, deadLetter: 1}, stats)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, event, res[0])
+
+	dl := res[1]
+	index, ok := deadLetterIndex(&dl)
+	require.True(t, ok)
+	assert.Equal(t, "dead-letter", index)
+	assert.Equal(t, ts, dl.Content.Timestamp)
+	assert.Equal(t, `{"@timestamp":"2020-08-10T12:00:00Z","field":"fail"}`, dl.Content.Fields["message"])
+	assert.Equal(t, common.MapStr{
+		"code":    400,
+		"message": `{"type": "mapper_parsing_exception"}`,
+	}, dl.Content.Fields["error"])
+
+	// dead-letter documents are sent to the dead-letter index without pipeline
+	pipeline := outil.MakeSelector(outil.ConstSelectorExpr("pipeline", outil.SelectorKeepCase))
+	encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion("7.9.0"), nil, &pipeline, false, []publisher.Event{dl})
+	require.Equal(t, 1, len(encoded))
+	require.Equal(t, 2, len(bulkItems))
+	assert.Equal(t, eslegclient.BulkIndexAction{Index: eslegclient.BulkMeta{Index: "dead-letter"}}, bulkItems[0])
+
+	// dead-letter documents rejected again are dropped
+	response = []byte(`{"items": [{"index": {"status": 400, "error": "ups"}}]}`)
+	res, stats = bulkCollectPublishFails(logp.L(), response, []publisher.Event{dl}, sink)
+	assert.Equal(t, 0, len(res))
+	assert.Equal(t, bulkResultStats{nonIndexable: 1}, stats)
+}
+
+func TestCollectPublishFailsDeadLetterFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-dead-letter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	response := []byte(`
+    { "items": [
+      {"create": {"status": 400, "error": "bad"}},
+      {"create": {"status": 200}},
+      {"create": {"status": 404, "error": "missing"}}
+    ]}
+  `)
+
+	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 1}}}
+	eventFail := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": "fail"}}}
+	events := []publisher.Event{eventFail, event, eventFail}
+
+	path := filepath.Join(dir, "dead-letter.ndjson")
+	sink := &deadLetterFileSink{path: path, permissions: 0600}
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, sink)
+	assert.Equal(t, 0, len(res))
+	assert.Equal(t, bulkResultStats{acked: 1, nonIndexable: 2, deadLetter: 2}, stats)
+
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.Equal(t, 2, len(lines))
+
+	var doc struct {
+		Message string
+		Error   struct {
+			Code    int
+			Message string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &doc))
+	assert.Contains(t, doc.Message, `"field":"fail"`)
+	assert.Equal(t, 404, doc.Error.Code)
+	assert.Equal(t, `"missing"`, doc.Error.Message)
+}
+
+func TestNewDeadLetterSink(t *testing.T) {
+	cases := map[string]struct {
+		config  string
+		want    deadLetterSink
+		invalid bool
+	}{
+		"unset": {
+			config: `{}`,
+		},
+		"drop": {
+			config: `{non_indexable_policy.drop: {}}`,
+		},
+		"dead letter index": {
+			config: `{non_indexable_policy.dead_letter_index.index: dlq}`,
+			want:   &deadLetterIndexSink{index: "dlq"},
+		},
+		"dead letter index requires index": {
+			config:  `{non_indexable_policy.dead_letter_index.enabled: true}`,
+			invalid: true,
+		},
+		"dead letter file": {
+			config: `{non_indexable_policy.dead_letter_file.path: /tmp/dlq.ndjson}`,
+			want:   &deadLetterFileSink{path: "/tmp/dlq.ndjson", permissions: 0600},
+		},
+		"unknown policy": {
+			config:  `{non_indexable_policy.retry: {}}`,
+			invalid: true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := common.NewConfigWithYAML([]byte(test.config), "test")
+			require.NoError(t, err)
+
+			var settings struct {
+				Policy *common.ConfigNamespace `config:"non_indexable_policy"`
+			}
+			require.NoError(t, cfg.Unpack(&settings))
+
+			sink, err := newDeadLetterSink(settings.Policy)
+			if test.invalid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, sink)
+		})
+	}
+}
+
 func BenchmarkCollectPublishFailsNone(b *testing.B) {
 	response := []byte(`
     { "items": [
@@ -150,7 +291,7 @@ func BenchmarkCollectPublishFailsNone(b *testing.B) {
 	events := []publisher.Event{event, event, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, nil)
 		if len(res) != 0 {
 			b.Fail()
 		}
@@ -171,7 +312,7 @@ func BenchmarkCollectPublishFailMiddle(b *testing.B) {
 	events := []publisher.Event{event, eventFail, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, nil)
 		if len(res) != 1 {
 			b.Fail()
 		}
@@ -191,7 +332,7 @@ func BenchmarkCollectPublishFailAll(b *testing.B) {
 	events := []publisher.Event{event, event, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, nil)
 		if len(res) != 3 {
 			b.Fail()
 		}
@@ -295,7 +436,7 @@ func TestBulkEncodeEvents(t *testing.T) {
 				}
 			}
 
-			encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion(test.version), index, pipeline, events)
+			encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion(test.version), index, pipeline, false, events)
 			assert.Equal(t, len(events), len(encoded), "all events should have been encoded")
 			assert.Equal(t, 2*len(events), len(bulkItems), "incomplete bulk")
 
@@ -361,7 +502,7 @@ func TestBulkEncodeEventsWithOpType(t *testing.T) {
 		}
 	}
 
-	encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion(version.GetDefaultVersion()), index, pipeline, events)
+	encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion(version.GetDefaultVersion()), index, pipeline, false, events)
 	require.Equal(t, len(events)-1, len(encoded), "all events should have been encoded")
 	require.Equal(t, 9, len(bulkItems), "incomplete bulk")
 
@@ -387,6 +528,51 @@ func TestBulkEncodeEventsWithOpType(t *testing.T) {
 
 }
 
+func TestBulkEncodeEventsWithDataStreams(t *testing.T) {
+	cfg := common.MustNewConfigFrom(common.MapStr{
+		"data_stream.enabled": true,
+	})
+	info := beat.Info{
+		IndexPrefix: "test",
+		Version:     version.GetDefaultVersion(),
+	}
+
+	im, err := idxmgmt.DefaultSupport(nil, info, common.MustNewConfigFrom(common.MapStr{
+		"output.elasticsearch.data_stream.enabled": true,
+	}))
+	require.NoError(t, err)
+
+	index, pipeline, err := buildSelectors(im, info, cfg)
+	require.NoError(t, err)
+
+	events := []publisher.Event{
+		{Content: beat.Event{Fields: common.MapStr{"message": "default"}}},
+		{Content: beat.Event{
+			Meta: common.MapStr{"_id": "123"},
+			Fields: common.MapStr{
+				"message":     "with id",
+				"data_stream": common.MapStr{"dataset": "nginx.access"},
+			},
+		}},
+		{Content: beat.Event{
+			Meta:   common.MapStr{e.FieldMetaOpType: e.OpTypeIndex},
+			Fields: common.MapStr{"message": "index op_type is rejected"},
+		}},
+	}
+
+	encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion("7.9.0"), index, pipeline, true, events)
+	require.Equal(t, 2, len(encoded), "event with unsupported op_type must be dropped")
+	require.Equal(t, 4, len(bulkItems))
+
+	assert.Equal(t, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{
+		Index: "logs-generic-default",
+	}}, bulkItems[0])
+	assert.Equal(t, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{
+		Index: "logs-nginx.access-default",
+		ID:    "123",
+	}}, bulkItems[2])
+}
+
 func TestClientWithAPIKey(t *testing.T) {
 	var headers http.Header
 
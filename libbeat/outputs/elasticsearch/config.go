@@ -45,6 +45,24 @@ type elasticsearchConfig struct {
 	MaxRetries       int               `config:"max_retries"`
 	Timeout          time.Duration     `config:"timeout"`
 	Backoff          Backoff           `config:"backoff"`
+
+	NonIndexablePolicy *common.ConfigNamespace `config:"non_indexable_policy"`
+	DataStream         dataStreamConfig        `config:"data_stream"`
+	Adaptive           adaptiveConfig          `config:"adaptive"`
+}
+
+// dataStreamConfig holds the output side of the data stream settings. The
+// naming of the data streams is handled by the index management.
+type dataStreamConfig struct {
+	Enabled bool `config:"enabled"`
+}
+
+// adaptiveConfig configures the adaptive bulk sizing and concurrency. If
+// enabled, bulk_max_size and the total number of workers become upper limits.
+type adaptiveConfig struct {
+	Enabled          bool          `config:"enabled"`
+	MinBulkSize      int           `config:"min_bulk_size" validate:"min=1"`
+	LatencyThreshold time.Duration `config:"latency_threshold" validate:"min=0"`
 }
 
 type Backoff struct {
@@ -77,6 +95,11 @@ var (
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
+		Adaptive: adaptiveConfig{
+			Enabled:          false,
+			MinBulkSize:      10,
+			LatencyThreshold: 5 * time.Second,
+		},
 	}
 )
 
@@ -91,5 +114,14 @@ func (c *elasticsearchConfig) Validate() error {
 		return fmt.Errorf("cannot set both api_key and username/password")
 	}
 
+	if c.Adaptive.Enabled && c.Adaptive.MinBulkSize > c.BulkMaxSize {
+		return fmt.Errorf("adaptive.min_bulk_size (%v) must not exceed bulk_max_size (%v)",
+			c.Adaptive.MinBulkSize, c.BulkMaxSize)
+	}
+
+	if _, err := newDeadLetterSink(c.NonIndexablePolicy); err != nil {
+		return fmt.Errorf("invalid non_indexable_policy: %w", err)
+	}
+
 	return nil
 }
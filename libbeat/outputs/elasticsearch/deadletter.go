@@ -0,0 +1,218 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// deadLetterSink receives the events Elasticsearch rejected as not indexable
+// (e.g. mapping conflicts), instead of dropping them.
+type deadLetterSink interface {
+	// Add stores the rejected events. Events returned by Add must be sent to
+	// Elasticsearch again.
+	Add(rejected []rejectedEvent) ([]publisher.Event, error)
+}
+
+// rejectedEvent is an event that failed with a non-retryable bulk item
+// status, together with the status and error reported by Elasticsearch.
+type rejectedEvent struct {
+	event  publisher.Event
+	status int
+	msg    string
+}
+
+// deadLetterIndexSink rewrites rejected events into documents holding the
+// original event as a string and re-indexes these into a dedicated index.
+type deadLetterIndexSink struct {
+	index string
+}
+
+// deadLetterFileSink appends rejected events as ndjson to a local file.
+type deadLetterFileSink struct {
+	path        string
+	permissions os.FileMode
+}
+
+type deadLetterIndexConfig struct {
+	Index string `config:"index" validate:"required"`
+}
+
+type deadLetterFileConfig struct {
+	Path        string `config:"path" validate:"required"`
+	Permissions uint32 `config:"permissions"`
+}
+
+// deadLetterCacheKey marks events in the per event output cache that have
+// been rewritten for the dead-letter index.
+const deadLetterCacheKey = "dead_letter_index"
+
+// deadLetterFileMu serializes writes to dead-letter files, which can be
+// shared between all clients of an output.
+var deadLetterFileMu sync.Mutex
+
+// newDeadLetterSink creates the dead-letter sink configured by the
+// non_indexable_policy setting. No sink is returned if non-indexable events
+// are to be dropped.
+func newDeadLetterSink(policy *common.ConfigNamespace) (deadLetterSink, error) {
+	if policy == nil || !policy.IsSet() {
+		return nil, nil
+	}
+
+	switch policy.Name() {
+	case "drop":
+		return nil, nil
+
+	case "dead_letter_index":
+		var config deadLetterIndexConfig
+		if err := policy.Config().Unpack(&config); err != nil {
+			return nil, err
+		}
+		return &deadLetterIndexSink{index: config.Index}, nil
+
+	case "dead_letter_file":
+		config := deadLetterFileConfig{Permissions: 0600}
+		if err := policy.Config().Unpack(&config); err != nil {
+			return nil, err
+		}
+		return &deadLetterFileSink{
+			path:        config.Path,
+			permissions: os.FileMode(config.Permissions),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown non_indexable_policy '%v'", policy.Name())
+	}
+}
+
+// Add replaces the contents of the rejected events with dead-letter documents
+// and returns them for publishing to the dead-letter index.
+func (s *deadLetterIndexSink) Add(rejected []rejectedEvent) ([]publisher.Event, error) {
+	events := make([]publisher.Event, len(rejected))
+	for i, r := range rejected {
+		event := publisher.Event{
+			Content: beat.Event{
+				Timestamp: r.event.Content.Timestamp,
+				Fields: common.MapStr{
+					"message": encodeRejectedEvent(&r.event.Content),
+					"error": common.MapStr{
+						"code":    r.status,
+						"message": r.msg,
+					},
+				},
+			},
+			Flags: r.event.Flags,
+		}
+		if _, err := event.Cache.Put(deadLetterCacheKey, s.index); err != nil {
+			return nil, err
+		}
+		events[i] = event
+	}
+	return events, nil
+}
+
+// Add appends one JSON document per rejected event to the dead-letter file.
+// The file is only opened for the duration of the write, as rejections are
+// expected to be rare.
+func (s *deadLetterFileSink) Add(rejected []rejectedEvent) ([]publisher.Event, error) {
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	for _, r := range rejected {
+		doc := common.MapStr{
+			"@timestamp": now,
+			"message":    encodeRejectedEvent(&r.event.Content),
+			"error": common.MapStr{
+				"code":    r.status,
+				"message": r.msg,
+			},
+		}
+		buf.WriteString(doc.String())
+		buf.WriteByte('\n')
+	}
+
+	deadLetterFileMu.Lock()
+	defer deadLetterFileMu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, s.permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	return nil, nil
+}
+
+// deadLetterIndex returns the dead-letter index if the event has been
+// rewritten by the deadLetterIndexSink.
+func deadLetterIndex(event *publisher.Event) (string, bool) {
+	v, err := event.Cache.GetValue(deadLetterCacheKey)
+	if err != nil {
+		return "", false
+	}
+	index, ok := v.(string)
+	return index, ok
+}
+
+// createDeadLetterBulkMeta creates the bulk meta data for events sent to the
+// dead-letter index. Pipelines are not applied to dead-letter documents.
+func createDeadLetterBulkMeta(version common.Version, index string, dataStreams bool) (interface{}, error) {
+	if index == "" {
+		return nil, errors.New("dead-letter index must not be empty")
+	}
+
+	eventType := ""
+	if version.Major < 7 {
+		eventType = defaultEventType
+	}
+	meta := eslegclient.BulkMeta{
+		Index:   index,
+		DocType: eventType,
+	}
+	if dataStreams {
+		return eslegclient.BulkCreateAction{Create: meta}, nil
+	}
+	return eslegclient.BulkIndexAction{Index: meta}, nil
+}
+
+// encodeRejectedEvent encodes the original event, including timestamp and
+// metadata, as JSON string.
+func encodeRejectedEvent(event *beat.Event) string {
+	doc := common.MapStr{"@timestamp": event.Timestamp}
+	for k, v := range event.Fields {
+		doc[k] = v
+	}
+	if len(event.Meta) > 0 {
+		doc["@metadata"] = event.Meta
+	}
+	return doc.String()
+}
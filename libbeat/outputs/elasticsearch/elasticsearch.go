@@ -82,6 +82,13 @@ func makeES(
 		params = nil
 	}
 
+	// The hosts list contains every host once per worker, such that the
+	// number of hosts is the maximum number of concurrent bulk requests.
+	var adaptive *adaptiveController
+	if config.Adaptive.Enabled {
+		adaptive = newAdaptiveController(config.Adaptive, config.BulkMaxSize, len(hosts), observer)
+	}
+
 	clients := make([]outputs.NetworkClient, len(hosts))
 	for i, host := range hosts {
 		esURL, err := common.MakeURL(config.Protocol, config.Path, host, 9200)
@@ -91,7 +98,7 @@ func makeES(
 		}
 
 		var client outputs.NetworkClient
-		client, err = NewClient(ClientSettings{
+		esClient, err := NewClient(ClientSettings{
 			ConnectionSettings: eslegclient.ConnectionSettings{
 				URL:              esURL,
 				Proxy:            proxyURL,
@@ -108,15 +115,18 @@ func makeES(
 				Observer:         observer,
 				EscapeHTML:       config.EscapeHTML,
 			},
-			Index:    index,
-			Pipeline: pipeline,
-			Observer: observer,
+			Index:              index,
+			Pipeline:           pipeline,
+			Observer:           observer,
+			NonIndexablePolicy: config.NonIndexablePolicy,
+			DataStreams:        config.DataStream.Enabled,
 		}, &connectCallbackRegistry)
 		if err != nil {
 			return outputs.Fail(err)
 		}
+		esClient.adaptive = adaptive
 
-		client = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+		client = outputs.WithBackoff(esClient, config.Backoff.Init, config.Backoff.Max)
 		clients[i] = client
 	}
 
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+)
+
+type config struct {
+	BatchSize int            `config:"bulk_max_size"`
+	Outputs   []branchConfig `config:"outputs" validate:"required"`
+}
+
+// branchConfig configures one output of the fan-out group. Each branch
+// runs its own queue and output, independent of the other branches.
+type branchConfig struct {
+	// Name identifies the branch in logs and metrics. Defaults to the
+	// output type.
+	Name string `config:"name"`
+
+	// Condition selects the events sent to the branch. If not set, all
+	// events are sent.
+	Condition *conditions.Config `config:"when"`
+
+	// QueueFull sets the behavior when the branch's queue is full. "block"
+	// blocks all branches until space is available, "drop" drops the event
+	// for this branch only.
+	QueueFull string `config:"queue_full"`
+
+	Queue  common.ConfigNamespace `config:"queue"`
+	Output common.ConfigNamespace `config:"output"`
+}
+
+var defaultConfig = config{
+	BatchSize: 2048,
+}
+
+func (c *config) Validate() error {
+	if len(c.Outputs) == 0 {
+		return errors.New("no outputs configured")
+	}
+
+	names := map[string]bool{}
+	for i := range c.Outputs {
+		branch := &c.Outputs[i]
+		if !branch.Output.IsSet() {
+			return fmt.Errorf("output %d has no output configured", i)
+		}
+		if branch.Output.Name() == "fanout" {
+			return fmt.Errorf("output %d: fanout outputs can not be nested", i)
+		}
+		switch branch.QueueFull {
+		case "", "block", "drop":
+		default:
+			return fmt.Errorf("output %d: invalid queue_full setting '%v'", i, branch.QueueFull)
+		}
+
+		name := branch.name()
+		if names[name] {
+			return fmt.Errorf("duplicate output name '%v', set a unique name for each output", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+func (b *branchConfig) name() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return b.Output.Name()
+}
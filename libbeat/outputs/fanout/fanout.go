@@ -0,0 +1,364 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+const defaultQueueType = "mem"
+
+// fanout publishes every event to all branches whose condition matches.
+// Each branch is a complete publisher pipeline with its own queue, output
+// workers, retry and ACK handling, so the other branches keep publishing
+// while one output is slow or unavailable. Batches are only ACKed once all
+// branches have ACKed their events though, so unACKed events of the slowest
+// branch also fill the main queue, and once it is full all branches wait.
+type fanout struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	branches []*branch
+}
+
+type branch struct {
+	name      string
+	condition conditions.Condition
+	pipeline  *pipeline.Pipeline
+	client    beat.Client
+}
+
+// pendingBatch is a batch published by the fanout that is waiting for its
+// events to be ACKed by the branches.
+type pendingBatch struct {
+	batch    publisher.Batch
+	observer outputs.Observer
+	events   int
+
+	// The number of event copies not yet ACKed by a branch, plus one while
+	// the fanout is still publishing the batch.
+	pending atomic.Int64
+}
+
+// eventRef is carried in the Private field of every copy of an event sent
+// to a branch. Each copy gets its own eventRef, so the branchACKer can tell
+// apart copies of different events from the same batch.
+type eventRef struct {
+	batch *pendingBatch
+}
+
+// branchACKer forwards the ACKs of a branch pipeline to the pendingBatch
+// of each event. It is used as both the ACK handler and the event
+// callbacks of the branch client.
+type branchACKer struct {
+	mutex sync.Mutex
+	// The eventRef of each event in the branch queue, in publish order.
+	queued []*eventRef
+}
+
+func init() {
+	outputs.RegisterType("fanout", makeFanout)
+}
+
+func makeFanout(
+	im outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *common.Config,
+) (outputs.Group, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	f := &fanout{
+		log:      logp.NewLogger("fanout"),
+		observer: observer,
+	}
+	for i := range config.Outputs {
+		b, err := newBranch(im, beat, &config.Outputs[i])
+		if err != nil {
+			f.Close()
+			return outputs.Fail(fmt.Errorf("failed to initialize fanout output '%v': %w",
+				config.Outputs[i].name(), err))
+		}
+		f.branches = append(f.branches, b)
+	}
+
+	// Events are retried by the branches, the fanout itself never fails a batch.
+	return outputs.Success(config.BatchSize, -1, f)
+}
+
+func newBranch(im outputs.IndexManager, info beat.Info, config *branchConfig) (*branch, error) {
+	name := config.name()
+	log := logp.NewLogger("fanout").With("output", name)
+
+	var condition conditions.Condition
+	if config.Condition != nil {
+		var err error
+		condition, err = conditions.NewCondition(config.Condition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	queueFactory, err := makeQueueFactory(log, &config.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := branchRegistry(name)
+	var outStats outputs.Observer
+	if metrics != nil {
+		outStats = outputs.NewStats(metrics.NewRegistry("output"))
+	}
+	outGroup, err := outputs.Load(im, info, outStats, config.Output.Name(), config.Output.Config())
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := pipeline.New(info, pipeline.Monitors{
+		Metrics: metrics,
+		Logger:  log,
+	}, queueFactory, outGroup, pipeline.Settings{})
+	if err != nil {
+		// The pipeline only takes ownership of the output clients on success.
+		for _, c := range outGroup.Clients {
+			c.Close()
+		}
+		return nil, err
+	}
+
+	publishMode := beat.GuaranteedSend
+	if config.QueueFull == "drop" {
+		publishMode = beat.DropIfFull
+	}
+	acker := &branchACKer{}
+	client, err := p.ConnectWith(beat.ClientConfig{
+		PublishMode: publishMode,
+		ACKHandler:  acker,
+		Events:      acker,
+	})
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return &branch{
+		name:      name,
+		condition: condition,
+		pipeline:  p,
+		client:    client,
+	}, nil
+}
+
+func makeQueueFactory(
+	log *logp.Logger, config *common.ConfigNamespace,
+) (func(queue.ACKListener) (queue.Queue, error), error) {
+	queueType := defaultQueueType
+	if name := config.Name(); name != "" {
+		queueType = name
+	}
+	factory := queue.FindFactory(queueType)
+	if factory == nil {
+		return nil, fmt.Errorf("'%v' is no valid queue type", queueType)
+	}
+
+	queueConfig := config.Config()
+	if queueConfig == nil {
+		queueConfig = common.NewConfig()
+	}
+	return func(ackListener queue.ACKListener) (queue.Queue, error) {
+		return factory(ackListener, log, queueConfig)
+	}, nil
+}
+
+// branchRegistry returns an empty metrics registry for the named branch, or
+// nil if the beat does not collect metrics.
+func branchRegistry(name string) *monitoring.Registry {
+	libbeat := monitoring.Default.GetRegistry("libbeat")
+	if libbeat == nil {
+		return nil
+	}
+
+	// The output can be reloaded, so clear metrics of previous instances.
+	regName := "fanout." + name
+	reg := libbeat.GetRegistry(regName)
+	if reg != nil {
+		reg.Clear()
+	} else {
+		reg = libbeat.NewRegistry(regName)
+	}
+	return reg
+}
+
+func (f *fanout) Close() error {
+	var errs []error
+	for _, b := range f.branches {
+		if err := b.client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := b.pipeline.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close fanout outputs: %v", errs)
+	}
+	return nil
+}
+
+// Publish forwards the batch to the queues of all matching branches. The
+// batch is ACKed once every matching branch has ACKed its copy of each
+// event, or dropped it because of queue_full: drop.
+func (f *fanout) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	f.observer.NewBatch(len(events))
+
+	pending := &pendingBatch{
+		batch:    batch,
+		observer: f.observer,
+		events:   len(events),
+	}
+	// Hold the batch open until all events are published, so fast branches
+	// can't ACK it early.
+	pending.pending.Store(1)
+
+	var targets []*branch
+	var copies []beat.Event
+	for i := range events {
+		event := &events[i].Content
+
+		targets = targets[:0]
+		for _, b := range f.branches {
+			if b.condition == nil || b.condition.Check(event) {
+				targets = append(targets, b)
+			}
+		}
+		if len(targets) == 0 {
+			f.log.Debugf("Event matched no output, dropping: %v", event.Fields)
+			continue
+		}
+
+		// Branches run concurrently, so each gets its own copy of the event,
+		// and all copies are made before any branch can modify one.
+		copies = copies[:0]
+		for range targets {
+			e := *event
+			e.Fields = event.Fields.Clone()
+			if event.Meta != nil {
+				e.Meta = event.Meta.Clone()
+			}
+			e.Private = &eventRef{batch: pending}
+			copies = append(copies, e)
+		}
+		pending.pending.Add(int64(len(targets)))
+		for j, b := range targets {
+			b.client.Publish(copies[j])
+		}
+	}
+
+	pending.done(1)
+	return nil
+}
+
+// done records that count event copies were ACKed, and ACKs the batch
+// once there are none left.
+func (p *pendingBatch) done(count int) {
+	if p.pending.Sub(int64(count)) == 0 {
+		p.batch.ACK()
+		p.observer.Acked(p.events)
+	}
+}
+
+func (a *branchACKer) AddEvent(event beat.Event, published bool) {
+	ref, ok := event.Private.(*eventRef)
+	if !ok {
+		return
+	}
+	if !published {
+		// Dropped by processors, it will never be ACKed by the queue.
+		ref.batch.done(1)
+		return
+	}
+	a.mutex.Lock()
+	a.queued = append(a.queued, ref)
+	a.mutex.Unlock()
+}
+
+func (a *branchACKer) ACKEvents(n int) {
+	a.mutex.Lock()
+	if n > len(a.queued) {
+		n = len(a.queued)
+	}
+	acked := a.queued[:n]
+	a.queued = a.queued[n:]
+	a.mutex.Unlock()
+
+	for _, ref := range acked {
+		ref.batch.done(1)
+	}
+}
+
+func (a *branchACKer) Close() {}
+
+// DroppedOnPublish is called when the branch queue rejects an event after
+// AddEvent, or when the branch client is closing, in which case AddEvent was
+// never called for the event.
+func (a *branchACKer) DroppedOnPublish(event beat.Event) {
+	ref, ok := event.Private.(*eventRef)
+	if !ok {
+		return
+	}
+	a.mutex.Lock()
+	// The dropped event is usually the last one added.
+	for i := len(a.queued) - 1; i >= 0; i-- {
+		if a.queued[i] == ref {
+			a.queued = append(a.queued[:i], a.queued[i+1:]...)
+			break
+		}
+	}
+	a.mutex.Unlock()
+	ref.batch.done(1)
+}
+
+func (a *branchACKer) Closing()                 {}
+func (a *branchACKer) Closed()                  {}
+func (a *branchACKer) Published()               {}
+func (a *branchACKer) FilteredOut(_ beat.Event) {}
+
+func (f *fanout) String() string {
+	names := make([]string, len(f.branches))
+	for i, b := range f.branches {
+		names[i] = b.name
+	}
+	return "fanout(" + strings.Join(names, ",") + ")"
+}
@@ -0,0 +1,293 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package fanout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	_ "github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+)
+
+// recorders holds the events received by each "recorder" output by name.
+var recorders = map[string]chan beat.Event{}
+
+// heldBatches receives the batches of "recorder" outputs configured with
+// hold: true, which are left for the test to ACK.
+var heldBatches = map[string]chan publisher.Batch{}
+
+type recorderClient struct {
+	events chan beat.Event
+	held   chan publisher.Batch
+}
+
+func init() {
+	outputs.RegisterType("recorder", func(
+		_ outputs.IndexManager, _ beat.Info, _ outputs.Observer, cfg *common.Config,
+	) (outputs.Group, error) {
+		config := struct {
+			Name string `config:"name"`
+			Hold bool   `config:"hold"`
+		}{}
+		if err := cfg.Unpack(&config); err != nil {
+			return outputs.Fail(err)
+		}
+		client := &recorderClient{events: recorders[config.Name]}
+		if config.Hold {
+			client.held = heldBatches[config.Name]
+		}
+		return outputs.Success(0, 0, client)
+	})
+}
+
+func (c *recorderClient) Close() error   { return nil }
+func (c *recorderClient) String() string { return "recorder" }
+func (c *recorderClient) Publish(_ context.Context, batch publisher.Batch) error {
+	for _, e := range batch.Events() {
+		c.events <- e.Content
+	}
+	if c.held != nil {
+		c.held <- batch
+		return nil
+	}
+	batch.ACK()
+	return nil
+}
+
+func TestFanoutPublish(t *testing.T) {
+	recorders["all"] = make(chan beat.Event, 10)
+	recorders["audit"] = make(chan beat.Event, 10)
+
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []map[string]interface{}{
+			{
+				"name":            "all",
+				"output.recorder": map[string]interface{}{"name": "all"},
+			},
+			{
+				"name":                       "audit",
+				"when.equals.module":         "auditd",
+				"queue.mem.events":           32,
+				"queue.mem.flush.min_events": 0,
+				"output.recorder":            map[string]interface{}{"name": "audit"},
+			},
+		},
+	})
+	group, err := makeFanout(nil, beat.Info{Beat: "libbeat"}, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+	client := group.Clients[0]
+	defer client.Close()
+
+	assert.Equal(t, "fanout(all,audit)", client.String())
+
+	batch, signals := newSignalBatch(
+		beat.Event{Fields: common.MapStr{"module": "auditd", "id": 1}},
+		beat.Event{Fields: common.MapStr{"module": "system", "id": 2}},
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	all := receiveEvents(t, recorders["all"], 2)
+	audit := receiveEvents(t, recorders["audit"], 1)
+	assert.Equal(t, []interface{}{1, 2}, eventIDs(all))
+	assert.Equal(t, []interface{}{1}, eventIDs(audit))
+	assert.Equal(t, outest.BatchACK, receiveSignal(t, signals).Tag)
+
+	// Every branch gets its own copy of the fields.
+	all[0].Fields["id"] = 3
+	assert.Equal(t, 1, audit[0].Fields["id"])
+	assert.Equal(t, 1, batch.Events()[0].Content.Fields["id"])
+}
+
+func TestFanoutWaitsForAllBranches(t *testing.T) {
+	recorders["fast"] = make(chan beat.Event, 10)
+	recorders["slow"] = make(chan beat.Event, 10)
+	heldBatches["slow"] = make(chan publisher.Batch, 10)
+
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"outputs": []map[string]interface{}{
+			{
+				"name":            "fast",
+				"output.recorder": map[string]interface{}{"name": "fast"},
+			},
+			{
+				"name":                       "slow",
+				"queue.mem.events":           32,
+				"queue.mem.flush.min_events": 0,
+				"output.recorder":            map[string]interface{}{"name": "slow", "hold": true},
+			},
+		},
+	})
+	group, err := makeFanout(nil, beat.Info{Beat: "libbeat"}, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	client := group.Clients[0]
+	defer client.Close()
+
+	batch, signals := newSignalBatch(
+		beat.Event{Fields: common.MapStr{"id": 1}},
+		beat.Event{Fields: common.MapStr{"id": 2}},
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	receiveEvents(t, recorders["fast"], 2)
+	receiveEvents(t, recorders["slow"], 2)
+
+	// The fast branch keeps publishing while the slow branch holds its
+	// events, but neither batch is ACKed until the slow branch catches up.
+	next, nextSignals := newSignalBatch(beat.Event{Fields: common.MapStr{"id": 3}})
+	require.NoError(t, client.Publish(context.Background(), next))
+	assert.Equal(t, []interface{}{3}, eventIDs(receiveEvents(t, recorders["fast"], 1)))
+	receiveEvents(t, recorders["slow"], 1)
+
+	select {
+	case sig := <-signals:
+		t.Fatalf("batch signaled %v before all branches ACKed it", sig.Tag)
+	case sig := <-nextSignals:
+		t.Fatalf("batch signaled %v before all branches ACKed it", sig.Tag)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The slow branch may have received the events in several batches.
+	for acked := 0; acked < 3; {
+		select {
+		case held := <-heldBatches["slow"]:
+			acked += len(held.Events())
+			held.ACK()
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the slow branch")
+		}
+	}
+	assert.Equal(t, outest.BatchACK, receiveSignal(t, signals).Tag)
+	assert.Equal(t, outest.BatchACK, receiveSignal(t, nextSignals).Tag)
+}
+
+func TestBranchACKerDropWhileClosing(t *testing.T) {
+	batch, signals := newSignalBatch(
+		beat.Event{Fields: common.MapStr{"id": 1}},
+		beat.Event{Fields: common.MapStr{"id": 2}},
+	)
+	pending := &pendingBatch{
+		batch:    batch,
+		observer: outputs.NewNilObserver(),
+		events:   2,
+	}
+	pending.pending.Store(3)
+
+	first := beat.Event{Private: &eventRef{batch: pending}}
+	second := beat.Event{Private: &eventRef{batch: pending}}
+
+	// The first event is queued, then the branch client starts closing and
+	// drops the second event without adding it.
+	acker := &branchACKer{}
+	acker.AddEvent(first, true)
+	acker.DroppedOnPublish(second)
+	pending.done(1)
+
+	require.Len(t, acker.queued, 1)
+	assert.Same(t, first.Private, acker.queued[0])
+	select {
+	case sig := <-signals:
+		t.Fatalf("batch signaled %v before the queued event was ACKed", sig.Tag)
+	default:
+	}
+
+	acker.ACKEvents(1)
+	assert.Equal(t, outest.BatchACK, receiveSignal(t, signals).Tag)
+	assert.Empty(t, acker.queued)
+}
+
+func TestFanoutConfigValidation(t *testing.T) {
+	cases := map[string][]map[string]interface{}{
+		"no outputs": {},
+		"missing output": {
+			{"name": "a"},
+		},
+		"duplicate names": {
+			{"output.recorder": map[string]interface{}{}},
+			{"output.recorder": map[string]interface{}{}},
+		},
+		"nested fanout": {
+			{"output.fanout.outputs": []interface{}{}},
+		},
+		"invalid queue_full": {
+			{"output.recorder": map[string]interface{}{}, "queue_full": "wait"},
+		},
+	}
+
+	for name, outputs := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(map[string]interface{}{
+				"outputs": outputs,
+			})
+			config := defaultConfig
+			assert.Error(t, cfg.Unpack(&config))
+		})
+	}
+}
+
+// newSignalBatch returns a test batch that also reports its signals on the
+// returned channel, since the fanout ACKs batches asynchronously.
+func newSignalBatch(events ...beat.Event) (*outest.Batch, chan outest.BatchSignal) {
+	signals := make(chan outest.BatchSignal, 1)
+	batch := outest.NewBatch(events...)
+	batch.OnSignal = func(sig outest.BatchSignal) { signals <- sig }
+	return batch, signals
+}
+
+func receiveSignal(t *testing.T, signals chan outest.BatchSignal) outest.BatchSignal {
+	select {
+	case sig := <-signals:
+		return sig
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the batch to be ACKed")
+		return outest.BatchSignal{}
+	}
+}
+
+func receiveEvents(t *testing.T, ch chan beat.Event, n int) []beat.Event {
+	var events []beat.Event
+	for i := 0; i < n; i++ {
+		select {
+		case event := <-ch:
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+	return events
+}
+
+func eventIDs(events []beat.Event) []interface{} {
+	var ids []interface{}
+	for _, event := range events {
+		id, _ := event.Fields.GetValue("id")
+		ids = append(ids, id)
+	}
+	return ids
+}
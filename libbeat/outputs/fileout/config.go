@@ -19,18 +19,22 @@ package fileout
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/file"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 )
 
 type config struct {
-	Path          string       `config:"path"`
-	Filename      string       `config:"filename"`
-	RotateEveryKb uint         `config:"rotate_every_kb" validate:"min=1"`
-	NumberOfFiles uint         `config:"number_of_files"`
-	Codec         codec.Config `config:"codec"`
-	Permissions   uint32       `config:"permissions"`
+	Path           string        `config:"path"`
+	Filename       string        `config:"filename"`
+	RotateEveryKb  uint          `config:"rotate_every_kb" validate:"min=1"`
+	RotateInterval time.Duration `config:"rotate_interval"`
+	NumberOfFiles  uint          `config:"number_of_files"`
+	Compress       bool          `config:"compress"`
+	Codec          codec.Config  `config:"codec"`
+	Permissions    uint32        `config:"permissions"`
+	MaxOpenFiles   int           `config:"max_open_files" validate:"min=1"`
 }
 
 var (
@@ -38,6 +42,7 @@ var (
 		NumberOfFiles: 7,
 		RotateEveryKb: 10 * 1024,
 		Permissions:   0600,
+		MaxOpenFiles:  128,
 	}
 )
 
@@ -47,5 +52,9 @@ func (c *config) Validate() error {
 			file.MaxBackupsLimit)
 	}
 
+	if c.RotateInterval != 0 && c.RotateInterval < time.Second {
+		return fmt.Errorf("The rotate_interval must be at least 1s")
+	}
+
 	return nil
 }
@@ -18,13 +18,20 @@
 package fileout
 
 import (
+	"container/list"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/joeshaw/multierror"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/logp"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
@@ -40,8 +47,31 @@ type fileOutput struct {
 	filePath string
 	beat     beat.Info
 	observer outputs.Observer
-	rotator  *file.Rotator
 	codec    codec.Codec
+
+	// path and filename are set if the file path depends on the event.
+	path        *fmtstr.EventFormatString
+	filename    *fmtstr.EventFormatString
+	rotatorOpts []file.RotatorOption
+
+	// The open rotators by path, and ordered by last use in lru with the
+	// most recently used first. Once more than maxOpenFiles are open, the
+	// least recently used rotator is closed.
+	mu           sync.Mutex
+	rotators     map[string]*list.Element
+	lru          *list.List
+	maxOpenFiles int
+
+	// closed holds the paths of rotators closed because of maxOpenFiles.
+	// When they are opened again, events are appended to the existing file
+	// instead of rotating it.
+	closed map[string]bool
+}
+
+// openRotator is an entry of fileOutput.lru.
+type openRotator struct {
+	path    string
+	rotator *file.Rotator
 }
 
 // makeFileout instantiates a new file output instance.
@@ -72,25 +102,42 @@ func makeFileout(
 }
 
 func (out *fileOutput) init(beat beat.Info, c config) error {
-	var path string
-	if c.Filename != "" {
-		path = filepath.Join(c.Path, c.Filename)
-	} else {
-		path = filepath.Join(c.Path, out.beat.Beat)
+	filename := c.Filename
+	if filename == "" {
+		filename = out.beat.Beat
 	}
 
-	out.filePath = path
-
-	var err error
-	out.rotator, err = file.NewFileRotator(
-		path,
-		file.MaxSizeBytes(c.RotateEveryKb*1024),
+	out.filePath = filepath.Join(c.Path, filename)
+	out.rotators = map[string]*list.Element{}
+	out.lru = list.New()
+	out.maxOpenFiles = c.MaxOpenFiles
+	out.closed = map[string]bool{}
+	out.rotatorOpts = []file.RotatorOption{
+		file.MaxSizeBytes(c.RotateEveryKb * 1024),
 		file.MaxBackups(c.NumberOfFiles),
 		file.Permissions(os.FileMode(c.Permissions)),
+		file.Interval(c.RotateInterval),
+		file.Compress(c.Compress),
 		file.WithLogger(logp.NewLogger("rotator").With(logp.Namespace("rotator"))),
-	)
+	}
+
+	path, err := fmtstr.CompileEvent(c.Path)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	name, err := fmtstr.CompileEvent(filename)
+	if err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+
+	if path.IsConst() && name.IsConst() {
+		// Open the rotator right away, so configuration errors are reported
+		// on startup.
+		if _, err := out.rotator(out.filePath); err != nil {
+			return err
+		}
+	} else {
+		out.path, out.filename = path, name
 	}
 
 	out.codec, err = codec.CreateEncoder(beat, c.Codec)
@@ -99,15 +146,25 @@ func (out *fileOutput) init(beat beat.Info, c config) error {
 	}
 
 	out.log.Infof("Initialized file output. "+
-		"path=%v max_size_bytes=%v max_backups=%v permissions=%v",
-		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions))
+		"path=%v max_size_bytes=%v max_backups=%v permissions=%v rotate_interval=%v compress=%v",
+		out.filePath, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions),
+		c.RotateInterval, c.Compress)
 
 	return nil
 }
 
 // Implement Outputer
 func (out *fileOutput) Close() error {
-	return out.rotator.Close()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	var errs multierror.Errors
+	for out.lru.Len() > 0 {
+		if err := out.closeRotator(out.lru.Back()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
 }
 
 func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
@@ -121,6 +178,19 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	for i := range events {
 		event := &events[i]
 
+		rotator, err := out.eventRotator(&event.Content)
+		if err != nil {
+			if event.Guaranteed() {
+				out.log.Errorf("Failed to select the output file: %+v", err)
+			} else {
+				out.log.Warnf("Failed to select the output file: %+v", err)
+			}
+			out.log.Debugf("Failed event: %v", event)
+
+			dropped++
+			continue
+		}
+
 		serializedEvent, err := out.codec.Encode(out.beat.Beat, &event.Content)
 		if err != nil {
 			if event.Guaranteed() {
@@ -134,7 +204,7 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 			continue
 		}
 
-		if _, err = out.rotator.Write(append(serializedEvent, '\n')); err != nil {
+		if _, err = rotator.Write(append(serializedEvent, '\n')); err != nil {
 			st.WriteError(err)
 
 			if event.Guaranteed() {
@@ -159,3 +229,77 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 func (out *fileOutput) String() string {
 	return "file(" + out.filePath + ")"
 }
+
+// eventRotator returns the rotator for the file the event is written to.
+func (out *fileOutput) eventRotator(event *beat.Event) (*file.Rotator, error) {
+	if out.path == nil {
+		return out.rotator(out.filePath)
+	}
+
+	dir, err := out.path.Run(event)
+	if err != nil {
+		return nil, err
+	}
+	name, err := out.filename.Run(event)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid filename '%v'", name)
+	}
+
+	// Do not allow event contents to move files out of the configured
+	// directory.
+	for _, elem := range strings.FieldsFunc(dir, isPathSeparator) {
+		if elem == ".." {
+			return nil, fmt.Errorf("invalid path '%v'", dir)
+		}
+	}
+
+	return out.rotator(filepath.Join(dir, name))
+}
+
+// rotator returns the rotator for path, creating it if it does not exist yet.
+func (out *fileOutput) rotator(path string) (*file.Rotator, error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if elem, exists := out.rotators[path]; exists {
+		out.lru.MoveToFront(elem)
+		return elem.Value.(*openRotator).rotator, nil
+	}
+
+	opts := out.rotatorOpts
+	if out.closed[path] {
+		opts = append(opts[:len(opts):len(opts)], file.RotateOnStartup(false))
+	}
+	rotator, err := file.NewFileRotator(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Publish is not called concurrently, so no rotator can be in use while
+	// the least recently used ones are closed.
+	for out.maxOpenFiles > 0 && out.lru.Len() >= out.maxOpenFiles {
+		elem := out.lru.Back()
+		out.log.Debugf("Closing least recently used file %v", elem.Value.(*openRotator).path)
+		if err := out.closeRotator(elem); err != nil {
+			out.log.Warnf("Failed to close file: %+v", err)
+		}
+	}
+	out.rotators[path] = out.lru.PushFront(&openRotator{path: path, rotator: rotator})
+	return rotator, nil
+}
+
+// closeRotator closes and removes the rotator of an lru element. The lock
+// must be held.
+func (out *fileOutput) closeRotator(elem *list.Element) error {
+	entry := out.lru.Remove(elem).(*openRotator)
+	delete(out.rotators, entry.path)
+	out.closed[entry.path] = true
+	return entry.rotator.Close()
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
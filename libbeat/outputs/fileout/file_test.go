@@ -18,3 +18,195 @@
 // +build !integration
 
 package fileout
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+func TestPublishStaticPath(t *testing.T) {
+	dir := tempDir(t)
+
+	config := defaultConfig
+	config.Path = dir
+	out := newTestOutput(t, config)
+
+	batch := outest.NewBatch(testEvent("a", 1), testEvent("b", 2))
+	require.NoError(t, out.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	require.NoError(t, out.Close())
+
+	assert.Equal(t, 2, countLines(t, filepath.Join(dir, "testbeat")))
+	assert.Equal(t, "file("+filepath.Join(dir, "testbeat")+")", out.String())
+}
+
+func TestPublishDynamicPath(t *testing.T) {
+	dir := tempDir(t)
+
+	config := defaultConfig
+	config.Path = filepath.Join(dir, "%{[event.module]:other}")
+	config.Filename = "%{[event.dataset]}"
+	out := newTestOutput(t, config)
+
+	noModule := testEvent("custom", 4)
+	delete(noModule.Fields["event"].(common.MapStr), "module")
+	noDataset := testEvent("system", 5)
+	delete(noDataset.Fields["event"].(common.MapStr), "dataset")
+
+	batch := outest.NewBatch(
+		testEvent("system", 1),
+		testEvent("nginx", 2),
+		testEvent("system", 3),
+		noModule,
+		noDataset,
+		testEvent("..", 6),
+	)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	require.NoError(t, out.Close())
+
+	assert.Equal(t, 2, countLines(t, filepath.Join(dir, "system", "system.log")))
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, "nginx", "nginx.log")))
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, "other", "custom.log")))
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(entries))
+}
+
+func TestPublishClosesLeastRecentlyUsedFiles(t *testing.T) {
+	dir := tempDir(t)
+
+	config := defaultConfig
+	config.Path = dir
+	config.Filename = "%{[event.module]}"
+	config.MaxOpenFiles = 2
+	out := newTestOutput(t, config)
+
+	batch := outest.NewBatch(
+		testEvent("a", 1),
+		testEvent("b", 2),
+		testEvent("c", 3),
+		testEvent("a", 4),
+	)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	// a was closed when c was opened, and b when a was reopened.
+	assert.Equal(t, 2, out.lru.Len())
+	assert.Contains(t, out.rotators, filepath.Join(dir, "a"))
+	assert.Contains(t, out.rotators, filepath.Join(dir, "c"))
+	require.NoError(t, out.Close())
+
+	// The reopened file is appended to instead of being rotated.
+	assert.Equal(t, 2, countLines(t, filepath.Join(dir, "a")))
+	_, err := os.Stat(filepath.Join(dir, "a.1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPublishCompressesRotatedFiles(t *testing.T) {
+	dir := tempDir(t)
+
+	config := defaultConfig
+	config.Path = dir
+	config.RotateEveryKb = 1
+	config.Compress = true
+	out := newTestOutput(t, config)
+
+	events := make([]beat.Event, 50)
+	for i := range events {
+		events[i] = testEvent("system", i)
+	}
+	batch := outest.NewBatch(events...)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.NoError(t, out.Close())
+
+	_, err := os.Stat(filepath.Join(dir, "testbeat.1.gz"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "testbeat.1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConfigValidateRotateInterval(t *testing.T) {
+	for interval, valid := range map[time.Duration]bool{
+		0:                      true,
+		time.Hour:              true,
+		24 * time.Hour:         true,
+		time.Millisecond:       false,
+		500 * time.Millisecond: false,
+	} {
+		config := defaultConfig
+		config.RotateInterval = interval
+		err := config.Validate()
+		if valid {
+			assert.NoError(t, err, "interval %v", interval)
+		} else {
+			assert.Error(t, err, "interval %v", interval)
+		}
+	}
+}
+
+func newTestOutput(t *testing.T, config config) *fileOutput {
+	info := beat.Info{Beat: "testbeat", Version: "1.2.3"}
+	out := &fileOutput{
+		log:      logp.NewLogger("file"),
+		beat:     info,
+		observer: outputs.NewNilObserver(),
+	}
+	require.NoError(t, out.init(info, config))
+	return out
+}
+
+func testEvent(module string, n int) beat.Event {
+	return beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"event": common.MapStr{
+				"module":  module,
+				"dataset": module + ".log",
+			},
+			"n": n,
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fileout")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			n++
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return n
+}
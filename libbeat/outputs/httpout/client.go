@@ -0,0 +1,336 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// client publishes batches of encoded events to an HTTP endpoint. The
+// complete batch is sent in a single request. If the endpoint rejects the
+// request because of its contents, the batch is split up to find and drop
+// the events that are rejected, and the other events are delivered.
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+
+	url              string
+	method           string
+	headers          map[string]string
+	authorization    string
+	batchFormat      string
+	compressionLevel int
+	tls              *tlscommon.TLSConfig
+	timeout          time.Duration
+
+	index string
+	codec codec.Codec
+
+	http *http.Client
+}
+
+// clientSettings contains the settings for a client.
+type clientSettings struct {
+	URL              string
+	Method           string
+	Headers          map[string]string
+	Username         string
+	Password         string
+	BearerToken      string
+	BatchFormat      string
+	CompressionLevel int
+	TLS              *tlscommon.TLSConfig
+	Timeout          time.Duration
+
+	Index    string
+	Codec    codec.Codec
+	Observer outputs.Observer
+}
+
+func newClient(s clientSettings) (*client, error) {
+	if s.Observer == nil {
+		s.Observer = outputs.NewNilObserver()
+	}
+
+	var authorization string
+	switch {
+	case s.BearerToken != "":
+		authorization = "Bearer " + s.BearerToken
+	case s.Username != "" || s.Password != "":
+		credentials := s.Username + ":" + s.Password
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	return &client{
+		log:              logp.NewLogger(logSelector),
+		observer:         s.Observer,
+		url:              s.URL,
+		method:           s.Method,
+		headers:          s.Headers,
+		authorization:    authorization,
+		batchFormat:      s.BatchFormat,
+		compressionLevel: s.CompressionLevel,
+		tls:              s.TLS,
+		timeout:          s.Timeout,
+		index:            s.Index,
+		codec:            s.Codec,
+	}, nil
+}
+
+func (c *client) Connect() error {
+	dialer := transport.NetDialer(c.timeout)
+	tlsDialer, err := transport.TLSDialer(dialer, c.tls, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	dialer = transport.StatsDialer(dialer, c.observer)
+	tlsDialer = transport.StatsDialer(tlsDialer, c.observer)
+
+	c.http = &http.Client{
+		Transport: &http.Transport{
+			Dial:            dialer.Dial,
+			DialTLS:         tlsDialer.Dial,
+			TLSClientConfig: c.tls.ToConfig(),
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: c.timeout,
+	}
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+		c.http = nil
+	}
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	rest, err := c.publishEvents(ctx, events)
+	if len(rest) == 0 {
+		batch.ACK()
+	} else {
+		batch.RetryEvents(rest)
+	}
+	return err
+}
+
+// publishEvents sends all events that can be encoded in one request. Events
+// that fail to encode are dropped. On error the slice of events to be
+// retried is returned. The input slice backing memory will be reused.
+func (c *client) publishEvents(ctx context.Context, data []publisher.Event) ([]publisher.Event, error) {
+	st := c.observer
+
+	body, data := c.encodeBatch(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	status, msg, err := c.send(ctx, body)
+	if err != nil {
+		c.log.Errorf("Failed to publish %v events: %v", len(data), err)
+		st.Failed(len(data))
+		return data, err
+	}
+
+	switch {
+	case status < 300:
+		st.Acked(len(data))
+		return nil, nil
+
+	case isRejected(status):
+		if len(data) == 1 {
+			// Resending the same event would fail again, so it is dropped.
+			c.log.Errorf("Dropping event rejected by %v (status=%v): %s", c.url, status, msg)
+			c.log.Debugf("Rejected event: %v", data[0])
+			st.Dropped(1)
+			return nil, nil
+		}
+		// Only some of the events might be invalid, or the request too
+		// large. Send each half on its own, until the rejected events are
+		// isolated.
+		c.log.Debugf("Request with %v events rejected by %v (status=%v), splitting batch: %s",
+			len(data), c.url, status, msg)
+		return c.publishSplit(ctx, data)
+
+	default:
+		// Temporary failure, or the endpoint is not ready to accept events
+		// yet. Returning an error enforces the backoff before the events are
+		// retried.
+		if status == http.StatusTooManyRequests {
+			st.ErrTooMany(len(data))
+		}
+		st.Failed(len(data))
+		return data, fmt.Errorf("request to %v failed (status=%v): %s", c.url, status, msg)
+	}
+}
+
+// publishSplit publishes both halves of data in separate requests. If the
+// first half fails, the second half is not sent but returned for retry
+// with the remaining events of the first half.
+func (c *client) publishSplit(ctx context.Context, data []publisher.Event) ([]publisher.Event, error) {
+	mid := len(data) / 2
+	first, second := data[:mid], data[mid:]
+
+	rest, err := c.publishEvents(ctx, first)
+	if err != nil {
+		retry := make([]publisher.Event, 0, len(rest)+len(second))
+		retry = append(retry, rest...)
+		return append(retry, second...), err
+	}
+	return c.publishEvents(ctx, second)
+}
+
+// isRejected returns true if the status code indicates that the endpoint
+// will never accept the request, because of the events it contains.
+func isRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// encodeBatch encodes all events into a single request body using the
+// configured batch format. The events successfully encoded are returned.
+func (c *client) encodeBatch(data []publisher.Event) ([]byte, []publisher.Event) {
+	var buf bytes.Buffer
+
+	if c.batchFormat == formatJSONArray {
+		buf.WriteByte('[')
+	}
+
+	okEvents := data[:0]
+	for i := range data {
+		event := &data[i]
+		serialized, err := c.codec.Encode(c.index, &event.Content)
+		if err != nil {
+			if event.Guaranteed() {
+				c.log.Errorf("Failed to encode event: %+v", err)
+			} else {
+				c.log.Warnf("Failed to encode event: %+v", err)
+			}
+			c.log.Debugf("Failed event: %v", event)
+			continue
+		}
+
+		if c.batchFormat == formatJSONArray && len(okEvents) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(bytes.TrimRight(serialized, "\n"))
+		if c.batchFormat == formatNDJSON {
+			buf.WriteByte('\n')
+		}
+		okEvents = append(okEvents, *event)
+	}
+
+	if c.batchFormat == formatJSONArray {
+		buf.WriteByte(']')
+	}
+
+	if dropped := len(data) - len(okEvents); dropped > 0 {
+		c.observer.Dropped(dropped)
+	}
+	return buf.Bytes(), okEvents
+}
+
+// send executes the request and returns the response status code and the
+// beginning of the response body.
+func (c *client) send(ctx context.Context, body []byte) (int, []byte, error) {
+	if c.http == nil {
+		return 0, nil, fmt.Errorf("http client to %v is not connected", c.url)
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if c.compressionLevel > 0 {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, c.compressionLevel)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return 0, nil, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, nil, err
+		}
+		reader = &buf
+	}
+
+	req, err := http.NewRequest(c.method, c.url, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if c.batchFormat == formatJSONArray {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if c.compressionLevel > 0 {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	// read the complete response, so the connection can be reused
+	msg, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return 0, nil, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.StatusCode, msg, nil
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
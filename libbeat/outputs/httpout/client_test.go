@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package httpout
+
+import (
+	"compress/gzip"
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+type failingCodec struct{}
+
+func TestPublishNDJSON(t *testing.T) {
+	requests, url := startServer(t, http.StatusOK)
+	client := newTestClient(t, clientSettings{URL: url, Headers: map[string]string{"X-Test": "test"}})
+
+	batch := outest.NewBatch(testEvent(1), testEvent(2))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchACK)
+
+	req := <-requests
+	assert.Equal(t, "application/x-ndjson", req.header.Get("Content-Type"))
+	assert.Equal(t, "test", req.header.Get("X-Test"))
+	assert.Equal(t, "", req.header.Get("Authorization"))
+
+	lines := strings.Split(req.body, "\n")
+	require.Equal(t, 3, len(lines))
+	assert.Equal(t, "", lines[2])
+	assertEventField(t, 1, lines[0])
+	assertEventField(t, 2, lines[1])
+}
+
+func TestPublishJSONArrayCompressed(t *testing.T) {
+	requests, url := startServer(t, http.StatusOK)
+	client := newTestClient(t, clientSettings{
+		URL:              url,
+		BatchFormat:      formatJSONArray,
+		CompressionLevel: 5,
+		BearerToken:      "secret",
+	})
+
+	batch := outest.NewBatch(testEvent(1), testEvent(2), testEvent(3))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchACK)
+
+	req := <-requests
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", req.header.Get("Authorization"))
+
+	var docs []common.MapStr
+	require.NoError(t, stdjson.Unmarshal([]byte(req.body), &docs))
+	require.Equal(t, 3, len(docs))
+	for i, doc := range docs {
+		assert.Equal(t, float64(i+1), doc["n"])
+	}
+}
+
+func TestPublishBasicAuth(t *testing.T) {
+	requests, url := startServer(t, http.StatusOK)
+	client := newTestClient(t, clientSettings{URL: url, Username: "user", Password: "pass"})
+
+	batch := outest.NewBatch(testEvent(1))
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	req := <-requests
+	r := http.Request{Header: req.header}
+	username, password, ok := r.BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "pass", password)
+}
+
+func TestPublishStatusHandling(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		retry  bool
+	}{
+		"accepted":             {status: http.StatusAccepted},
+		"bad request":          {status: http.StatusBadRequest},
+		"entity too large":     {status: http.StatusRequestEntityTooLarge},
+		"unprocessable entity": {status: http.StatusUnprocessableEntity},
+		"unauthorized":         {status: http.StatusUnauthorized, retry: true},
+		"forbidden":            {status: http.StatusForbidden, retry: true},
+		"not found":            {status: http.StatusNotFound, retry: true},
+		"request timeout":      {status: http.StatusRequestTimeout, retry: true},
+		"too many requests":    {status: http.StatusTooManyRequests, retry: true},
+		"service unavailable":  {status: http.StatusServiceUnavailable, retry: true},
+		"internal error":       {status: http.StatusInternalServerError, retry: true},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, url := startServer(t, test.status)
+			client := newTestClient(t, clientSettings{URL: url})
+
+			batch := outest.NewBatch(testEvent(1), testEvent(2))
+			err := client.Publish(context.Background(), batch)
+			if !test.retry {
+				assert.NoError(t, err)
+				assertSignal(t, batch, outest.BatchACK)
+				return
+			}
+
+			assert.Error(t, err)
+			assertSignal(t, batch, outest.BatchRetryEvents)
+			assert.Equal(t, 2, len(batch.Signals[0].Events))
+		})
+	}
+}
+
+func TestPublishDropsOnlyRejectedEvents(t *testing.T) {
+	// The endpoint rejects any request containing a negative number.
+	requests, url := startServerFunc(t, func(body string) int {
+		if strings.Contains(body, `"n":-`) {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	client := newTestClient(t, clientSettings{URL: url})
+
+	batch := outest.NewBatch(testEvent(1), testEvent(-2), testEvent(3), testEvent(4))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchACK)
+
+	var delivered []string
+	for len(requests) > 0 {
+		req := <-requests
+		if !strings.Contains(req.body, `"n":-`) {
+			delivered = append(delivered, strings.Split(strings.TrimSpace(req.body), "\n")...)
+		}
+	}
+	require.Equal(t, 3, len(delivered))
+	assertEventField(t, 1, delivered[0])
+	assertEventField(t, 3, delivered[1])
+	assertEventField(t, 4, delivered[2])
+}
+
+func TestPublishRetriesRemainingEventsAfterSplit(t *testing.T) {
+	// The endpoint rejects the full batch, then becomes unavailable.
+	calls := 0
+	_, url := startServerFunc(t, func(body string) int {
+		calls++
+		if calls == 1 {
+			return http.StatusRequestEntityTooLarge
+		}
+		return http.StatusServiceUnavailable
+	})
+	client := newTestClient(t, clientSettings{URL: url})
+
+	batch := outest.NewBatch(testEvent(1), testEvent(2), testEvent(3))
+	assert.Error(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchRetryEvents)
+	assert.Equal(t, 3, len(batch.Signals[0].Events))
+}
+
+func TestPublishDropsUnencodableEvents(t *testing.T) {
+	requests, url := startServer(t, http.StatusOK)
+	client := newTestClient(t, clientSettings{URL: url, Codec: failingCodec{}})
+
+	batch := outest.NewBatch(testEvent(1), testEvent(-1), testEvent(3))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchACK)
+
+	req := <-requests
+	lines := strings.Split(strings.TrimSpace(req.body), "\n")
+	require.Equal(t, 2, len(lines))
+	assertEventField(t, 1, lines[0])
+	assertEventField(t, 3, lines[1])
+}
+
+func TestPublishDropsBatchIfNothingEncodes(t *testing.T) {
+	requests, url := startServer(t, http.StatusOK)
+	client := newTestClient(t, clientSettings{URL: url, Codec: failingCodec{}})
+
+	batch := outest.NewBatch(testEvent(-1))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assertSignal(t, batch, outest.BatchACK)
+	assert.Equal(t, 0, len(requests))
+}
+
+func startServer(t *testing.T, status int) (chan request, string) {
+	return startServerFunc(t, func(string) int { return status })
+}
+
+// startServerFunc starts a server that answers each request with the status
+// code returned by status for the request body.
+func startServerFunc(t *testing.T, status func(body string) int) (chan request, string) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+
+		contents, err := ioutil.ReadAll(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- request{header: r.Header, body: string(contents)}
+		w.WriteHeader(status(string(contents)))
+	}))
+	t.Cleanup(server.Close)
+	return requests, server.URL
+}
+
+func newTestClient(t *testing.T, s clientSettings) *client {
+	if s.Method == "" {
+		s.Method = http.MethodPost
+	}
+	if s.BatchFormat == "" {
+		s.BatchFormat = formatNDJSON
+	}
+	if s.Timeout == 0 {
+		s.Timeout = 10 * time.Second
+	}
+	if s.Codec == nil {
+		s.Codec = json.New("1.2.3", json.Config{})
+	}
+	s.Index = "test"
+
+	client, err := newClient(s)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEvent(n int) beat.Event {
+	return beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"n": n},
+	}
+}
+
+func assertSignal(t *testing.T, batch *outest.Batch, tag outest.BatchSignalTag) {
+	t.Helper()
+	require.Equal(t, 1, len(batch.Signals))
+	assert.Equal(t, tag, batch.Signals[0].Tag)
+}
+
+func assertEventField(t *testing.T, n int, line string) {
+	t.Helper()
+	var doc common.MapStr
+	require.NoError(t, stdjson.Unmarshal([]byte(line), &doc))
+	assert.Equal(t, float64(n), doc["n"])
+}
+
+func (failingCodec) Encode(index string, event *beat.Event) ([]byte, error) {
+	if n, _ := event.Fields["n"].(int); n < 0 {
+		return nil, errors.New("cannot encode negative numbers")
+	}
+	return json.New("1.2.3", json.Config{}).Encode(index, event)
+}
@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+type httpConfig struct {
+	Protocol         string            `config:"protocol"`
+	Path             string            `config:"path"`
+	Method           string            `config:"method"`
+	Headers          map[string]string `config:"headers"`
+	Username         string            `config:"username"`
+	Password         string            `config:"password"`
+	BearerToken      string            `config:"bearer_token"`
+	BatchFormat      string            `config:"batch_format"`
+	Codec            codec.Config      `config:"codec"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+	LoadBalance      bool              `config:"loadbalance"`
+	TLS              *tlscommon.Config `config:"ssl"`
+	BulkMaxSize      int               `config:"bulk_max_size"`
+	MaxRetries       int               `config:"max_retries"`
+	Timeout          time.Duration     `config:"timeout"`
+	Backoff          backoff           `config:"backoff"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+const (
+	// formatNDJSON sends one encoded event per line.
+	formatNDJSON = "ndjson"
+
+	// formatJSONArray sends all events of a batch as a JSON array.
+	formatJSONArray = "json_array"
+)
+
+var (
+	defaultConfig = httpConfig{
+		Protocol:         "",
+		Path:             "",
+		Method:           http.MethodPost,
+		BatchFormat:      formatNDJSON,
+		CompressionLevel: 0,
+		LoadBalance:      true,
+		TLS:              nil,
+		BulkMaxSize:      50,
+		MaxRetries:       3,
+		Timeout:          90 * time.Second,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+)
+
+func (c *httpConfig) Validate() error {
+	switch c.Method {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("unsupported HTTP method '%v'", c.Method)
+	}
+
+	switch c.BatchFormat {
+	case formatNDJSON:
+	case formatJSONArray:
+		if name := c.Codec.Namespace.Name(); name != "" && name != "json" {
+			return fmt.Errorf("batch_format %v requires the json codec", formatJSONArray)
+		}
+	default:
+		return fmt.Errorf("unsupported batch_format '%v'", c.BatchFormat)
+	}
+
+	if c.BearerToken != "" && (c.Username != "" || c.Password != "") {
+		return errors.New("cannot set both bearer_token and username/password")
+	}
+
+	return nil
+}
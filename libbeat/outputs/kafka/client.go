@@ -27,6 +27,7 @@ import (
 
 	"github.com/Shopify/sarama"
 
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/common/transport"
 	"github.com/elastic/beats/v7/libbeat/logp"
@@ -48,7 +49,14 @@ type client struct {
 	config   sarama.Config
 	mux      sync.Mutex
 
-	producer sarama.AsyncProducer
+	producer    sarama.AsyncProducer
+	newProducer func([]string, *sarama.Config) (sarama.AsyncProducer, error)
+
+	// backoff delays reconnecting after the producer failed to connect, or
+	// was closed after a failed batch. done is closed on Close, to abort
+	// waiting.
+	backoff backoff.Backoff
+	done    chan struct{}
 
 	wg sync.WaitGroup
 }
@@ -61,6 +69,9 @@ type msgRef struct {
 	batch  publisher.Batch
 
 	err error
+
+	// finished is closed once all events of the batch are ACKed or failed.
+	finished chan struct{}
 }
 
 var (
@@ -75,28 +86,43 @@ func newKafkaClient(
 	topic outil.Selector,
 	writer codec.Codec,
 	cfg *sarama.Config,
+	backoffCfg backoffConfig,
 ) (*client, error) {
+	done := make(chan struct{})
 	c := &client{
-		log:      logp.NewLogger(logSelector),
-		observer: observer,
-		hosts:    hosts,
-		topic:    topic,
-		key:      key,
-		index:    strings.ToLower(index),
-		codec:    writer,
-		config:   *cfg,
+		log:         logp.NewLogger(logSelector),
+		observer:    observer,
+		hosts:       hosts,
+		topic:       topic,
+		key:         key,
+		index:       strings.ToLower(index),
+		codec:       writer,
+		config:      *cfg,
+		newProducer: sarama.NewAsyncProducer,
+		backoff:     backoff.NewEqualJitterBackoff(done, backoffCfg.Init, backoffCfg.Max),
+		done:        done,
 	}
 	return c, nil
 }
 
 func (c *client) Connect() error {
+	err := c.connect()
+	backoff.WaitOnError(c.backoff, err)
+	return err
+}
+
+func (c *client) connect() error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
 	c.log.Debugf("connect: %v", c.hosts)
 
+	// A producer left from an earlier connection must be closed first,
+	// otherwise its workers are never stopped.
+	c.closeProducer()
+
 	// try to connect
-	producer, err := sarama.NewAsyncProducer(c.hosts, &c.config)
+	producer, err := c.newProducer(c.hosts, &c.config)
 	if err != nil {
 		c.log.Errorf("Kafka connect fails with: %+v", err)
 		return err
@@ -116,15 +142,25 @@ func (c *client) Close() error {
 	defer c.mux.Unlock()
 	c.log.Debug("closed kafka client")
 
-	// producer was not created before the close() was called.
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	c.closeProducer()
+	return nil
+}
+
+// closeProducer closes the producer, if any, and waits for its workers to
+// finish. The caller must hold c.mux.
+func (c *client) closeProducer() {
 	if c.producer == nil {
-		return nil
+		return
 	}
 
 	c.producer.AsyncClose()
 	c.wg.Wait()
 	c.producer = nil
-	return nil
 }
 
 func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
@@ -132,11 +168,12 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 	c.observer.NewBatch(len(events))
 
 	ref := &msgRef{
-		client: c,
-		count:  int32(len(events)),
-		total:  len(events),
-		failed: nil,
-		batch:  batch,
+		client:   c,
+		count:    int32(len(events)),
+		total:    len(events),
+		failed:   nil,
+		batch:    batch,
+		finished: make(chan struct{}),
 	}
 
 	ch := c.producer.Input()
@@ -155,6 +192,26 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 		ch <- &msg.msg
 	}
 
+	// The idempotent producer publishes one batch at a time. Events returned
+	// to the pipeline for retry are published before any newer events this
+	// way, such that the order of events is kept.
+	if c.config.Producer.Idempotent && ref.total > 0 {
+		<-ref.finished
+
+		// Sequence numbers of failed messages can not be reused by the
+		// producer. Close it and return the error, such that a new producer
+		// with a new producer ID is created when the pipeline reconnects.
+		var err error
+		if ref.err != nil {
+			c.mux.Lock()
+			c.closeProducer()
+			c.mux.Unlock()
+			err = fmt.Errorf("idempotent producer failed to publish events: %w", ref.err)
+		}
+		backoff.WaitOnError(c.backoff, err)
+		return err
+	}
+
 	return nil
 }
 
@@ -256,6 +313,12 @@ func (r *msgRef) fail(msg *message, err error) {
 		r.client.log.Errorf("Kafka (topic=%v): dropping invalid message", msg.topic)
 		r.client.observer.Dropped(1)
 
+	case sarama.ErrDuplicateSequenceNumber:
+		// The broker already received the message on an earlier attempt.
+		r.client.log.Debugf("Kafka (topic=%v): duplicate message discarded by broker", msg.topic)
+		r.dec()
+		return
+
 	case sarama.ErrMessageSizeTooLarge, sarama.ErrInvalidMessageSize:
 		r.client.log.Errorf("Kafka (topic=%v): dropping too large message of size %v.",
 			msg.topic,
@@ -294,6 +357,7 @@ func (r *msgRef) dec() {
 		r.batch.ACK()
 		stats.Acked(r.total)
 	}
+	close(r.finished)
 }
 
 func (c *client) Test(d testing.Driver) {
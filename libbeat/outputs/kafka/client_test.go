@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+)
+
+func TestIdempotentProducerIsRecreatedAfterFailure(t *testing.T) {
+	client, producers := newMockClient(t, true)
+
+	require.NoError(t, client.Connect())
+	(*producers)[0].ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	batch := outest.NewBatch(testEvent("a"))
+	assert.Error(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Nil(t, client.producer, "failed producer must be closed")
+
+	require.NoError(t, client.Connect())
+	require.Len(t, *producers, 2)
+	(*producers)[1].ExpectInputAndSucceed()
+	batch = outest.NewBatch(testEvent("a"))
+	assert.NoError(t, client.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	assertCloses(t, client)
+}
+
+func TestConnectClosesPreviousProducer(t *testing.T) {
+	client, producers := newMockClient(t, false)
+
+	require.NoError(t, client.Connect())
+	require.NoError(t, client.Connect())
+	require.Len(t, *producers, 2)
+
+	// Close only waits for the workers of the current producer, so it
+	// blocks if the workers of the first producer were never stopped.
+	assertCloses(t, client)
+}
+
+func newMockClient(t *testing.T, idempotent bool) (*client, *[]*mocks.AsyncProducer) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Idempotent = idempotent
+	cfg.Producer.Return.Successes = true
+
+	client, err := newKafkaClient(
+		outputs.NewNilObserver(),
+		[]string{"localhost:9092"},
+		"testbeat",
+		nil,
+		outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+		json.New("1.2.3", json.Config{}),
+		cfg,
+		backoffConfig{Init: time.Millisecond, Max: 10 * time.Millisecond},
+	)
+	require.NoError(t, err)
+
+	producers := &[]*mocks.AsyncProducer{}
+	client.newProducer = func(_ []string, cfg *sarama.Config) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(t, cfg)
+		*producers = append(*producers, producer)
+		return producer, nil
+	}
+	return client, producers
+}
+
+func assertCloses(t *testing.T, client *client) {
+	t.Helper()
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func testEvent(message string) beat.Event {
+	return beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"message": message},
+	}
+}
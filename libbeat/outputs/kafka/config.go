@@ -69,6 +69,7 @@ type kafkaConfig struct {
 	Password           string                    `config:"password"`
 	Codec              codec.Config              `config:"codec"`
 	Sasl               saslConfig                `config:"sasl"`
+	Idempotent         bool                      `config:"idempotent"`
 }
 
 type saslConfig struct {
@@ -198,6 +199,15 @@ func (c *kafkaConfig) Validate() error {
 			return fmt.Errorf("compression_level must be between 0 and 9")
 		}
 	}
+
+	if c.Idempotent {
+		if version, ok := c.Version.Get(); ok && !version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("idempotent producer requires version 0.11.0 or newer, but version %v is configured", c.Version)
+		}
+		if c.RequiredACKs != nil && sarama.RequiredAcks(*c.RequiredACKs) != sarama.WaitForAll {
+			return errors.New("idempotent producer requires required_acks to be -1")
+		}
+	}
 	return nil
 }
 
@@ -286,6 +296,16 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	k.Producer.Retry.Max = retryMax
 	k.Producer.Retry.BackoffFunc = makeBackoffFunc(config.Backoff)
 
+	// The idempotent producer assigns sequence numbers to the messages per
+	// partition, such that the brokers can discard duplicates when sarama
+	// retries a request. Allowing only one in-flight request per broker keeps
+	// the order of retried messages.
+	if config.Idempotent {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+
 	// configure per broker go channel buffering
 	k.ChannelBufferSize = config.ChanBufferSize
 
@@ -23,6 +23,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
+
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/internal/testutil"
@@ -40,6 +42,13 @@ func TestConfigAcceptValid(t *testing.T) {
 			"compression": "lz4",
 			"version":     "1.0.0",
 		},
+		"idempotent producer": common.MapStr{
+			"idempotent": true,
+		},
+		"idempotent producer with required_acks -1": common.MapStr{
+			"idempotent":    true,
+			"required_acks": -1,
+		},
 		"Kerberos with keytab": common.MapStr{
 			"kerberos": common.MapStr{
 				"auth_type":    "keytab",
@@ -88,6 +97,14 @@ func TestConfigInvalid(t *testing.T) {
 				"realm":        "ELASTIC",
 			},
 		},
+		"idempotent producer with old version": common.MapStr{
+			"idempotent": true,
+			"version":    "0.10.2",
+		},
+		"idempotent producer without acks from all replicas": common.MapStr{
+			"idempotent":    true,
+			"required_acks": 1,
+		},
 	}
 
 	for name, test := range tests {
@@ -103,6 +120,32 @@ func TestConfigInvalid(t *testing.T) {
 	}
 }
 
+func TestIdempotentSaramaConfig(t *testing.T) {
+	c := common.MustNewConfigFrom(common.MapStr{
+		"hosts":      []string{"localhost"},
+		"idempotent": true,
+	})
+	cfg, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can not create test configuration: %v", err)
+	}
+
+	libCfg, err := newSaramaConfig(logp.L(), cfg)
+	if err != nil {
+		t.Fatalf("Failure creating sarama config: %v", err)
+	}
+
+	if !libCfg.Producer.Idempotent {
+		t.Error("Idempotent producer not enabled")
+	}
+	if libCfg.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("Expected required acks from all replicas, got %v", libCfg.Producer.RequiredAcks)
+	}
+	if libCfg.Net.MaxOpenRequests != 1 {
+		t.Errorf("Expected one open request per broker, got %v", libCfg.Net.MaxOpenRequests)
+	}
+}
+
 func TestBackoffFunc(t *testing.T) {
 	testutil.SeedPRNG(t)
 	tests := map[int]backoffConfig{
@@ -53,11 +53,15 @@ func init() {
 }
 
 func makeKafka(
-	_ outputs.IndexManager,
+	im outputs.IndexManager,
 	beat beat.Info,
 	observer outputs.Observer,
 	cfg *common.Config,
 ) (outputs.Group, error) {
+	if cfg.HasField("targets") {
+		return outputs.MakeRoutedOutput(im, beat, observer, cfg, makeKafka)
+	}
+
 	log := logp.NewLogger(logSelector)
 	log.Debug("initialize kafka output")
 
@@ -86,7 +90,7 @@ func makeKafka(
 		return outputs.Fail(err)
 	}
 
-	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, topic, codec, libCfg)
+	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, topic, codec, libCfg, config.Backoff)
 	if err != nil {
 		return outputs.Fail(err)
 	}
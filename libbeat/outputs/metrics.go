@@ -34,6 +34,13 @@ type Stats struct {
 	duplicates *monitoring.Uint // events sent and waiting for ACK/fail from output
 	dropped    *monitoring.Uint // total number of invalid events dropped by the output
 	tooMany    *monitoring.Uint // total number of too many requests replies from output
+	deadLetter *monitoring.Uint // total number of events passed to a dead-letter sink
+
+	//
+	// Output adaptive window stats
+	//
+	windowBulkSize    *monitoring.Uint // current bulk size of adaptive outputs
+	windowConcurrency *monitoring.Uint // current number of concurrent requests allowed by adaptive outputs
 
 	//
 	// Output network connection stats
@@ -58,6 +65,10 @@ func NewStats(reg *monitoring.Registry) *Stats {
 		duplicates: monitoring.NewUint(reg, "events.duplicates"),
 		active:     monitoring.NewUint(reg, "events.active"),
 		tooMany:    monitoring.NewUint(reg, "events.toomany"),
+		deadLetter: monitoring.NewUint(reg, "events.dead_letter"),
+
+		windowBulkSize:    monitoring.NewUint(reg, "window.bulk_size"),
+		windowConcurrency: monitoring.NewUint(reg, "window.concurrency"),
 
 		writeBytes:  monitoring.NewUint(reg, "write.bytes"),
 		writeErrors: monitoring.NewUint(reg, "write.errors"),
@@ -126,6 +137,24 @@ func (s *Stats) ErrTooMany(n int) {
 	}
 }
 
+// DeadLetter updates the number of events the output passed to a dead-letter
+// sink instead of dropping them. Dead-lettered events are additionally
+// reported as acked, failed or dropped, so the active metric is not updated.
+func (s *Stats) DeadLetter(n int) {
+	if s != nil {
+		s.deadLetter.Add(uint64(n))
+	}
+}
+
+// AdaptiveWindow updates the current bulk size and concurrency limit of an
+// output adapting its request sizes to the load of the receiving service.
+func (s *Stats) AdaptiveWindow(bulkSize, concurrency int) {
+	if s != nil {
+		s.windowBulkSize.Set(uint64(bulkSize))
+		s.windowConcurrency.Set(uint64(concurrency))
+	}
+}
+
 // WriteError increases the write I/O error metrics.
 func (s *Stats) WriteError(err error) {
 	if s != nil {
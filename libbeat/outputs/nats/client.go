@@ -0,0 +1,301 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// client publishes events to a single NATS server. Without JetStream a batch
+// is ACKed once the server confirmed that it processed all messages. With
+// JetStream only events acknowledged by a stream are ACKed.
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	address  string
+	dialer   transport.Dialer
+	tls      *tlscommon.TLSConfig
+	timeout  time.Duration
+
+	settings clientSettings
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+}
+
+type clientSettings struct {
+	name      string
+	index     string
+	subject   *fmtstr.EventFormatString
+	codec     codec.Codec
+	token     string
+	username  string
+	password  string
+	nkey      *nkeyUser
+	jetStream bool
+}
+
+func newClient(
+	observer outputs.Observer,
+	address string,
+	dialer transport.Dialer,
+	tls *tlscommon.TLSConfig,
+	timeout time.Duration,
+	settings clientSettings,
+) *client {
+	if observer == nil {
+		observer = outputs.NewNilObserver()
+	}
+	return &client{
+		log:      logp.NewLogger("nats"),
+		observer: observer,
+		address:  address,
+		dialer:   dialer,
+		tls:      tls,
+		timeout:  timeout,
+		settings: settings,
+	}
+}
+
+func (c *client) Connect() error {
+	c.Close()
+
+	// Reconnects are handled by the output's backoff, so the connection is
+	// closed on the first error.
+	opts := []nats.Option{
+		nats.Name(c.settings.name),
+		nats.Timeout(c.timeout),
+		nats.SetCustomDialer(c.dialer),
+		nats.NoReconnect(),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			c.log.Errorf("NATS connection error: %v", err)
+		}),
+	}
+	if c.tls != nil {
+		host, _, err := net.SplitHostPort(c.address)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nats.Secure(c.tls.BuildModuleConfig(host)))
+	}
+	switch {
+	case c.settings.token != "":
+		opts = append(opts, nats.Token(c.settings.token))
+	case c.settings.username != "" || c.settings.password != "":
+		opts = append(opts, nats.UserInfo(c.settings.username, c.settings.password))
+	case c.settings.nkey != nil:
+		opts = append(opts, nats.Nkey(c.settings.nkey.public, c.settings.nkey.sign))
+	}
+
+	conn, err := nats.Connect("nats://"+c.address, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %v: %w", c.address, err)
+	}
+
+	if c.settings.jetStream {
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to initialize JetStream on %v: %w", c.address, err)
+		}
+		c.js = js
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.Close()
+	c.conn = nil
+	c.js = nil
+	return nil
+}
+
+func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	rest, err := c.publishEvents(events)
+	if len(rest) == 0 {
+		batch.ACK()
+	} else {
+		batch.RetryEvents(rest)
+	}
+	return err
+}
+
+// publishEvents sends all events to the server. Events that can not be
+// encoded are dropped. On error the events not yet acknowledged are returned.
+func (c *client) publishEvents(data []publisher.Event) ([]publisher.Event, error) {
+	st := c.observer
+	if c.conn == nil {
+		st.Failed(len(data))
+		return data, transport.ErrNotConnected
+	}
+	if c.settings.jetStream {
+		return c.publishJetStream(data)
+	}
+
+	okEvents := data[:0]
+	for i := range data {
+		subject, payload, err := c.encode(&data[i].Content)
+		if err != nil {
+			c.log.Errorf("Dropping event: %+v", err)
+			c.log.Debugf("Failed event: %v", data[i])
+			st.Dropped(1)
+			continue
+		}
+
+		if err := c.conn.Publish(subject, payload); err != nil {
+			c.log.Errorf("Failed to publish events: %v", err)
+			rest := append(okEvents, data[i:]...)
+			st.Failed(len(rest))
+			return rest, err
+		}
+		okEvents = append(okEvents, data[i])
+	}
+	if len(okEvents) == 0 {
+		return nil, nil
+	}
+
+	// The server answers the PING sent by the flush only after processing
+	// all messages published before.
+	if err := c.conn.FlushTimeout(c.timeout); err != nil {
+		c.log.Errorf("Failed to publish events: %v", err)
+		st.Failed(len(okEvents))
+		return okEvents, err
+	}
+	st.Acked(len(okEvents))
+	return nil, nil
+}
+
+// publishJetStream publishes all events to JetStream and waits for their
+// acknowledgements. Events rejected by JetStream or not acknowledged before
+// the timeout are returned for retrying.
+func (c *client) publishJetStream(data []publisher.Event) ([]publisher.Event, error) {
+	st := c.observer
+
+	var publishErr error
+	okEvents := data[:0]
+	futures := make([]nats.PubAckFuture, 0, len(data))
+	for i := range data {
+		subject, payload, err := c.encode(&data[i].Content)
+		if err != nil {
+			c.log.Errorf("Dropping event: %+v", err)
+			c.log.Debugf("Failed event: %v", data[i])
+			st.Dropped(1)
+			continue
+		}
+
+		future, err := c.js.PublishAsync(subject, payload)
+		if err != nil {
+			// Retry this and all remaining events.
+			publishErr = err
+			for _, event := range data[i:] {
+				okEvents = append(okEvents, event)
+				futures = append(futures, nil)
+			}
+			break
+		}
+		okEvents = append(okEvents, data[i])
+		futures = append(futures, future)
+	}
+
+	// The deadline stays expired, so the remaining acknowledgements are
+	// only collected if they already arrived.
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	failed := 0
+	timedOut := false
+	retry := make([]publisher.Event, 0, len(okEvents))
+	for i, future := range futures {
+		if future == nil {
+			retry = append(retry, okEvents[i])
+			continue
+		}
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			c.log.Errorf("Failed to publish event to JetStream: %v", err)
+			failed++
+			retry = append(retry, okEvents[i])
+		case <-ctx.Done():
+			timedOut = true
+			retry = append(retry, okEvents[i])
+		}
+	}
+
+	st.Acked(len(okEvents) - len(retry))
+	if len(retry) == 0 {
+		return nil, nil
+	}
+
+	st.Failed(len(retry))
+	switch {
+	case publishErr != nil:
+		c.log.Errorf("Failed to publish events: %v", publishErr)
+	case timedOut:
+		publishErr = errors.New("timeout waiting for JetStream acknowledgements")
+		c.log.Errorf("Failed to receive JetStream acknowledgements: %v", publishErr)
+	default:
+		publishErr = fmt.Errorf("%v events were rejected by JetStream", failed)
+	}
+	return retry, publishErr
+}
+
+func (c *client) encode(event *beat.Event) (string, []byte, error) {
+	subject, err := c.settings.subject.Run(event)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to compute subject: %w", err)
+	}
+	if err := checkSubject(subject); err != nil {
+		return "", nil, err
+	}
+
+	payload, err := c.settings.codec.Encode(c.settings.index, event)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if limit := c.conn.MaxPayload(); limit > 0 && int64(len(payload)) > limit {
+		return "", nil, fmt.Errorf("event size %v exceeds the max payload size %v of the server", len(payload), limit)
+	}
+	return subject, payload, nil
+}
+
+func (c *client) String() string {
+	return "nats(" + c.address + ")"
+}
@@ -0,0 +1,349 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// serverInfo is the INFO message sent by the test server.
+type serverInfo struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	MaxPayload   int    `json:"max_payload"`
+	TLSRequired  bool   `json:"tls_required"`
+	AuthRequired bool   `json:"auth_required"`
+	Headers      bool   `json:"headers"`
+	Nonce        string `json:"nonce,omitempty"`
+}
+
+// connectInfo is the CONNECT message received by the test server.
+type connectInfo struct {
+	Name         string `json:"name"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	AuthToken    string `json:"auth_token"`
+	NKey         string `json:"nkey"`
+	Sig          string `json:"sig"`
+}
+
+// testServer implements the server side of the NATS protocol required by
+// the client. If ack is set, messages published with a reply subject are
+// answered like JetStream does.
+type testServer struct {
+	net.Listener
+	info      serverInfo
+	token     string
+	ack       func(subject, payload string) string
+	connects  chan connectInfo
+	published chan string
+}
+
+func newTestServer(t *testing.T, info serverInfo) *testServer {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	return &testServer{
+		Listener:  l,
+		info:      info,
+		connects:  make(chan connectInfo, 10),
+		published: make(chan string, 100),
+	}
+}
+
+func (s *testServer) start() {
+	go func() {
+		for {
+			conn, err := s.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	info, _ := json.Marshal(s.info)
+	fmt.Fprintf(w, "INFO %s\r\n", info)
+	w.Flush()
+
+	// The subscription ids of the client, by subject prefix.
+	sids := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			var connect connectInfo
+			json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &connect)
+			s.connects <- connect
+			if s.token != "" && connect.AuthToken != s.token {
+				w.WriteString("-ERR 'Authorization Violation'\r\n")
+				w.Flush()
+				return
+			}
+		case "SUB":
+			sids[strings.TrimSuffix(fields[1], "*")] = fields[len(fields)-1]
+		case "PING":
+			w.WriteString("PONG\r\n")
+			w.Flush()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			msg := string(payload[:size])
+			s.published <- fields[1] + " " + msg
+
+			if len(fields) == 4 && s.ack != nil {
+				reply := fields[2]
+				sid := "1"
+				for prefix, id := range sids {
+					if strings.HasPrefix(reply, prefix) {
+						sid = id
+					}
+				}
+				switch ack := s.ack(fields[1], msg); ack {
+				case "":
+				case "503":
+					fmt.Fprintf(w, "HMSG %v %v 16 16\r\nNATS/1.0 503\r\n\r\n\r\n", reply, sid)
+				default:
+					fmt.Fprintf(w, "MSG %v %v %v\r\n%v\r\n", reply, sid, len(ack), ack)
+				}
+				w.Flush()
+			}
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	server := newTestServer(t, serverInfo{ServerID: "test", MaxPayload: 20})
+	server.start()
+
+	client := newTestClient(t, server.Addr().String(), clientSettings{})
+	batch := outest.NewBatch(
+		testEvent("logs", "first"),
+		testEvent("", "missing dataset"),
+		testEvent("metrics", "second"),
+		testEvent("logs", "exceeding the max payload size"),
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Equal(t, 1, len(batch.Signals))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	connect := receiveConnect(t, server.connects)
+	assert.Equal(t, "testbeat", connect.Name)
+	assert.Empty(t, connect.AuthToken)
+
+	assert.Equal(t, "events.logs first", receive(t, server.published))
+	assert.Equal(t, "events.metrics second", receive(t, server.published))
+}
+
+func TestPublishJetStream(t *testing.T) {
+	server := newTestServer(t, serverInfo{ServerID: "test", Headers: true})
+	server.ack = func(subject, payload string) string {
+		switch payload {
+		case "rejected":
+			return `{"error":{"code":503,"description":"maximum messages exceeded"}}`
+		case "lost":
+			return ""
+		}
+		if subject == "events.unknown" {
+			return "503"
+		}
+		return `{"stream":"EVENTS","seq":1}`
+	}
+	server.start()
+
+	client := newTestClient(t, server.Addr().String(), clientSettings{jetStream: true})
+	client.timeout = 500 * time.Millisecond
+
+	connect := receiveConnect(t, server.connects)
+	assert.True(t, connect.Headers)
+	assert.True(t, connect.NoResponders)
+
+	batch := outest.NewBatch(testEvent("logs", "first"), testEvent("logs", "second"))
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Equal(t, 1, len(batch.Signals))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	batch = outest.NewBatch(
+		testEvent("logs", "acked"),
+		testEvent("logs", "rejected"),
+		testEvent("unknown", "no stream"),
+	)
+	assert.Error(t, client.Publish(context.Background(), batch))
+	require.Equal(t, 1, len(batch.Signals))
+	require.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Equal(t, []string{"rejected", "no stream"}, eventMessages(batch.Signals[0].Events))
+
+	// events without acknowledgement are retried after the timeout
+	require.NoError(t, client.Connect())
+	batch = outest.NewBatch(testEvent("logs", "lost"), testEvent("logs", "acked"))
+	assert.Error(t, client.Publish(context.Background(), batch))
+	require.Equal(t, 1, len(batch.Signals))
+	require.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Equal(t, []string{"lost"}, eventMessages(batch.Signals[0].Events))
+}
+
+func TestConnectAuthentication(t *testing.T) {
+	server := newTestServer(t, serverInfo{ServerID: "test"})
+	server.token = "secret"
+	server.start()
+
+	dialer := transport.NetDialer(5 * time.Second)
+	client := newClient(nil, server.Addr().String(), dialer, nil, 5*time.Second, clientSettings{token: "invalid"})
+	err := client.Connect()
+	require.Error(t, err)
+	assert.Contains(t, strings.ToLower(err.Error()), "authorization violation")
+
+	client = newClient(nil, server.Addr().String(), dialer, nil, 5*time.Second, clientSettings{token: "secret"})
+	require.NoError(t, client.Connect())
+	client.Close()
+}
+
+func TestConnectNKey(t *testing.T) {
+	server := newTestServer(t, serverInfo{ServerID: "test", AuthRequired: true, Nonce: "nonce"})
+	server.start()
+
+	nkey, err := parseNKeySeed(testSeed())
+	require.NoError(t, err)
+
+	client := newClient(nil, server.Addr().String(), transport.NetDialer(5*time.Second), nil, 5*time.Second, clientSettings{nkey: nkey})
+	require.NoError(t, client.Connect())
+	defer client.Close()
+
+	connect := receiveConnect(t, server.connects)
+	assert.Equal(t, nkey.public, connect.NKey)
+	sig, err := base64.RawURLEncoding.DecodeString(connect.Sig)
+	require.NoError(t, err)
+	public, err := nkeys.FromPublicKey(nkey.public)
+	require.NoError(t, err)
+	assert.NoError(t, public.Verify([]byte("nonce"), sig))
+}
+
+func TestConnectRequiresTLS(t *testing.T) {
+	server := newTestServer(t, serverInfo{ServerID: "test", TLSRequired: true})
+	server.start()
+
+	client := newClient(nil, server.Addr().String(), transport.NetDialer(5*time.Second), nil, 5*time.Second, clientSettings{})
+	err := client.Connect()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "secure connection required")
+}
+
+func TestCheckSubject(t *testing.T) {
+	for _, subject := range []string{"events", "events.logs", "events.logs-2020"} {
+		assert.NoError(t, checkSubject(subject), subject)
+	}
+	for _, subject := range []string{"", "events.", ".events", "events..logs", "events.*", "events.>", "my events"} {
+		assert.Error(t, checkSubject(subject), subject)
+	}
+}
+
+func newTestClient(t *testing.T, address string, settings clientSettings) *client {
+	settings.name = "testbeat"
+	settings.index = "testbeat"
+	settings.subject = fmtstr.MustCompileEvent("events.%{[dataset]}")
+	settings.codec = format.New(fmtstr.MustCompileEvent("%{[message]}"))
+
+	client := newClient(nil, address, transport.NetDialer(5*time.Second), nil, 5*time.Second, settings)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEvent(dataset, msg string) beat.Event {
+	fields := common.MapStr{"message": msg}
+	if dataset != "" {
+		fields["dataset"] = dataset
+	}
+	return beat.Event{
+		Timestamp: time.Date(2020, 8, 10, 12, 30, 5, 0, time.UTC),
+		Fields:    fields,
+	}
+}
+
+func eventMessages(events []publisher.Event) []string {
+	var msgs []string
+	for _, event := range events {
+		msg, _ := event.Content.Fields.GetValue("message")
+		msgs = append(msgs, msg.(string))
+	}
+	return msgs
+}
+
+func receiveConnect(t *testing.T, ch chan connectInfo) connectInfo {
+	t.Helper()
+	select {
+	case connect := <-ch:
+		return connect
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for CONNECT")
+		return connectInfo{}
+	}
+}
+
+func receive(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for published message")
+		return ""
+	}
+}
@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+type natsConfig struct {
+	Subject     *fmtstr.EventFormatString `config:"subject" validate:"required"`
+	Name        string                    `config:"name"`
+	Token       string                    `config:"token"`
+	Username    string                    `config:"username"`
+	Password    string                    `config:"password"`
+	NKeySeed    string                    `config:"nkey_seed"`
+	JetStream   bool                      `config:"jetstream"`
+	Codec       codec.Config              `config:"codec"`
+	LoadBalance bool                      `config:"loadbalance"`
+	Timeout     time.Duration             `config:"timeout" validate:"min=1"`
+	BulkMaxSize int                       `config:"bulk_max_size"`
+	MaxRetries  int                       `config:"max_retries"`
+	TLS         *tlscommon.Config         `config:"ssl"`
+	Backoff     backoff                   `config:"backoff"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+var (
+	defaultConfig = natsConfig{
+		LoadBalance: true,
+		Timeout:     30 * time.Second,
+		BulkMaxSize: 2048,
+		MaxRetries:  3,
+		TLS:         nil,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+)
+
+func (c *natsConfig) Validate() error {
+	methods := 0
+	if c.Token != "" {
+		methods++
+	}
+	if c.Username != "" || c.Password != "" {
+		methods++
+	}
+	if c.NKeySeed != "" {
+		methods++
+		if _, err := parseNKeySeed(c.NKeySeed); err != nil {
+			return err
+		}
+	}
+	if methods > 1 {
+		return errors.New("only one of token, username/password or nkey_seed can be configured")
+	}
+
+	if c.Subject.IsConst() {
+		subject, err := c.Subject.Run(nil)
+		if err != nil {
+			return err
+		}
+		if err := checkSubject(subject); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkSubject validates a subject events are published to. Wildcards are not
+// allowed when publishing.
+func checkSubject(subject string) error {
+	if subject == "" {
+		return errors.New("empty subject")
+	}
+	if strings.ContainsAny(subject, " \t\r\n*>") {
+		return fmt.Errorf("invalid subject '%v': subjects must not contain whitespace or wildcards", subject)
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return fmt.Errorf("invalid subject '%v': subjects must not contain empty tokens", subject)
+		}
+	}
+	return nil
+}
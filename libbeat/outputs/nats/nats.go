@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nats
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+)
+
+const defaultPort = 4222
+
+func init() {
+	outputs.RegisterType("nats", makeNATS)
+}
+
+func makeNATS(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *common.Config,
+) (outputs.Group, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	// TLS is negotiated by the client after reading the server INFO message,
+	// so the dialer only creates plain TCP connections.
+	dialer, err := transport.MakeDialer(transport.Config{
+		Timeout: config.Timeout,
+		Stats:   observer,
+	})
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	var nkey *nkeyUser
+	if config.NKeySeed != "" {
+		if nkey, err = parseNKeySeed(config.NKeySeed); err != nil {
+			return outputs.Fail(err)
+		}
+	}
+
+	name := config.Name
+	if name == "" {
+		name = beat.Beat
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		address := host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			address = net.JoinHostPort(host, strconv.Itoa(defaultPort))
+		}
+
+		var enc codec.Codec
+		if config.Codec.Namespace.IsSet() {
+			enc, err = codec.CreateEncoder(beat, config.Codec)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+		} else {
+			enc = json.New(beat.Version, json.Config{})
+		}
+
+		client := newClient(observer, address, dialer, tls, config.Timeout, clientSettings{
+			name:      name,
+			index:     beat.Beat,
+			subject:   config.Subject,
+			codec:     enc,
+			token:     config.Token,
+			username:  config.Username,
+			password:  config.Password,
+			nkey:      nkey,
+			jetStream: config.JetStream,
+		})
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
+}
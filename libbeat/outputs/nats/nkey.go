@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+)
+
+// nkeyUser is the key pair used to authenticate with a user nkey. The server
+// sends a nonce that must be signed with the private key.
+type nkeyUser struct {
+	keys   nkeys.KeyPair
+	public string
+}
+
+// parseNKeySeed decodes a user seed ("SU...") as generated by nk or nsc.
+func parseNKeySeed(seed string) (*nkeyUser, error) {
+	keys, err := nkeys.FromSeed([]byte(strings.TrimSpace(seed)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid nkey seed: %w", err)
+	}
+	public, err := keys.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("invalid nkey seed: %w", err)
+	}
+	if !nkeys.IsValidPublicUserKey(public) {
+		return nil, errors.New("invalid nkey seed: not a user seed")
+	}
+	return &nkeyUser{keys: keys, public: public}, nil
+}
+
+// sign signs the nonce sent by the server in its INFO message.
+func (k *nkeyUser) sign(nonce []byte) ([]byte, error) {
+	return k.keys.Sign(nonce)
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package nats
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNKeySeed(t *testing.T) {
+	nkey, err := parseNKeySeed(testSeed())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(nkey.public, "U"))
+
+	sig, err := nkey.sign([]byte("nonce"))
+	require.NoError(t, err)
+	public, err := nkeys.FromPublicKey(nkey.public)
+	require.NoError(t, err)
+	assert.NoError(t, public.Verify([]byte("nonce"), sig))
+}
+
+func TestParseNKeySeedErrors(t *testing.T) {
+	seed := testSeed()
+	corrupted := []byte(seed)
+	corrupted[10] = 'A' + (corrupted[10]-'A'+1)%26
+
+	accountSeed, err := nkeys.EncodeSeed(nkeys.PrefixByteAccount, make([]byte, ed25519.SeedSize))
+	require.NoError(t, err)
+	public, err := nkeys.Encode(nkeys.PrefixByteUser, make([]byte, ed25519.PublicKeySize))
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"empty":          "",
+		"not base32":     "SU!!",
+		"checksum":       string(corrupted),
+		"public key":     string(public),
+		"not user seeds": string(accountSeed),
+	}
+
+	for name, seed := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseNKeySeed(seed)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func testSeed() string {
+	raw := make([]byte, ed25519.SeedSize)
+	for i := range raw {
+		raw[i] = byte(i)
+	}
+	seed, err := nkeys.EncodeSeed(nkeys.PrefixByteUser, raw)
+	if err != nil {
+		panic(err)
+	}
+	return string(seed)
+}
@@ -31,6 +31,9 @@ type Observer interface {
 	ReadError(error)  // report an I/O error on read
 	ReadBytes(int)    // report number of bytes being read
 	ErrTooMany(int)   // report too many requests response
+	DeadLetter(int)   // report number of events passed to a dead-letter sink
+
+	AdaptiveWindow(bulkSize, concurrency int) // report current adaptive bulk size and concurrency limit
 }
 
 type emptyObserver struct{}
@@ -53,3 +56,6 @@ func (*emptyObserver) WriteBytes(int)   {}
 func (*emptyObserver) ReadError(error)  {}
 func (*emptyObserver) ReadBytes(int)    {}
 func (*emptyObserver) ErrTooMany(int)   {}
+func (*emptyObserver) DeadLetter(int)   {}
+
+func (*emptyObserver) AdaptiveWindow(bulkSize, concurrency int) {}
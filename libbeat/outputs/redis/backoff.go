@@ -75,7 +75,11 @@ func (b *backoffClient) Connect() error {
 
 func (b *backoffClient) Close() error {
 	err := b.client.Close()
-	close(b.done)
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
 	return err
 }
 
@@ -51,11 +51,14 @@ func init() {
 }
 
 func makeRedis(
-	_ outputs.IndexManager,
+	im outputs.IndexManager,
 	beat beat.Info,
 	observer outputs.Observer,
 	cfg *common.Config,
 ) (outputs.Group, error) {
+	if cfg.HasField("targets") {
+		return outputs.MakeRoutedOutput(im, beat, observer, cfg, makeRedis)
+	}
 
 	if !cfg.HasField("index") {
 		cfg.SetString("index", -1, beat.Beat)
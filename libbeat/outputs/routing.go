@@ -0,0 +1,533 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package outputs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ucfg "github.com/elastic/go-ucfg"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/testing"
+)
+
+// routingClient publishes events to one of multiple targets, each using its
+// own set of connections. The target of an event is selected by the first
+// target whose condition matches the event.
+type routingClient struct {
+	log      *logp.Logger
+	observer Observer
+	targets  []*routingTarget
+
+	// fallback receives events not matching any target. Events are dropped
+	// if fallback is nil.
+	fallback *routingTarget
+
+	// done is closed by Close, stopping all reconnect attempts. ctx is
+	// cancelled by Close as well, aborting the publishing of held events.
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// reconnected is signaled whenever a target has been reconnected.
+	reconnected chan struct{}
+}
+
+// routingTarget is a connection target of the routing client. A target
+// failing to connect or publish is reconnected in the background, while the
+// other targets keep publishing. Events routed to the target meanwhile are
+// held and published once the target is reconnected.
+type routingTarget struct {
+	name      string
+	condition conditions.Condition
+	client    NetworkClient
+	backoff   backoff.Backoff
+
+	mu           sync.Mutex
+	connected    bool
+	reconnecting bool
+	held         []*routedBatch
+}
+
+type routingTargetConfig struct {
+	Name      string             `config:"name" validate:"required"`
+	Condition *conditions.Config `config:"when"`
+}
+
+// routedBatch is the part of a batch published to a single target.
+type routedBatch struct {
+	parent *routedParent
+	events []publisher.Event
+}
+
+// routedParent collects the signals of all routed batches and signals the
+// original batch once every target has processed its events.
+type routedParent struct {
+	batch publisher.Batch
+
+	mu        sync.Mutex
+	pending   int
+	retry     []publisher.Event
+	cancelled []publisher.Event
+}
+
+// MakeRoutedOutput creates an output publishing to the connection targets
+// configured in the `targets` setting of cfg. Each target is created by
+// factory, using the output settings overwritten by the target's settings.
+// The `name` and `when` target settings configure the target name and the
+// condition selecting the events published to the target. If the output
+// settings configure `hosts`, events not matching any target are published
+// using the output settings.
+//
+// All targets share the batches and retry settings of the output, and use a
+// single connection at a time, failing over between the target's hosts.
+func MakeRoutedOutput(
+	im IndexManager,
+	beat beat.Info,
+	observer Observer,
+	cfg *common.Config,
+	factory Factory,
+) (Group, error) {
+	var settings struct {
+		Targets []*common.Config `config:"targets" validate:"required"`
+	}
+	if err := cfg.Unpack(&settings); err != nil {
+		return Fail(err)
+	}
+
+	base, err := common.MergeConfigs(cfg)
+	if err != nil {
+		return Fail(err)
+	}
+	if _, err := base.Remove("targets", -1); err != nil {
+		return Fail(err)
+	}
+
+	if observer == nil {
+		observer = NewNilObserver()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	router := &routingClient{
+		log:         logp.NewLogger("routing"),
+		observer:    observer,
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		reconnected: make(chan struct{}, 1),
+	}
+
+	var group Group
+	names := map[string]bool{}
+	for i, targetCfg := range settings.Targets {
+		var config routingTargetConfig
+		if err := targetCfg.Unpack(&config); err != nil {
+			return Fail(fmt.Errorf("invalid target %d: %w", i, err))
+		}
+		if names[config.Name] {
+			return Fail(fmt.Errorf("duplicate target name '%v'", config.Name))
+		}
+		names[config.Name] = true
+
+		overwrites, err := common.MergeConfigs(targetCfg)
+		if err != nil {
+			return Fail(err)
+		}
+		overwrites.Remove("name", -1)
+		overwrites.Remove("when", -1)
+
+		merged, err := common.MergeConfigsWithOptions([]*common.Config{base, overwrites}, ucfg.ReplaceValues)
+		if err != nil {
+			return Fail(err)
+		}
+
+		target, targetGroup, err := newRoutingTarget(router.done, im, beat, observer, merged, factory, &config)
+		if err != nil {
+			router.Close()
+			return Fail(fmt.Errorf("failed to initialize target '%v': %w", config.Name, err))
+		}
+		router.targets = append(router.targets, target)
+		if i == 0 {
+			group = targetGroup
+		}
+	}
+
+	if base.HasField("hosts") {
+		target, baseGroup, err := newRoutingTarget(router.done, im, beat, observer, base, factory, nil)
+		if err != nil {
+			router.Close()
+			return Fail(err)
+		}
+		router.fallback = target
+		group = baseGroup
+	}
+
+	return Success(group.BatchSize, group.Retry, router)
+}
+
+func newRoutingTarget(
+	done <-chan struct{},
+	im IndexManager,
+	beat beat.Info,
+	observer Observer,
+	cfg *common.Config,
+	factory Factory,
+	config *routingTargetConfig,
+) (*routingTarget, Group, error) {
+	if cfg.HasField("targets") {
+		return nil, Group{}, errors.New("targets can not be nested")
+	}
+
+	target := &routingTarget{name: "default"}
+	if config != nil {
+		target.name = config.Name
+		if config.Condition != nil {
+			var err error
+			target.condition, err = conditions.NewCondition(config.Condition)
+			if err != nil {
+				return nil, Group{}, err
+			}
+		}
+	}
+
+	settings := struct {
+		Backoff struct {
+			Init time.Duration `config:"init"`
+			Max  time.Duration `config:"max"`
+		} `config:"backoff"`
+	}{}
+	settings.Backoff.Init = 1 * time.Second
+	settings.Backoff.Max = 60 * time.Second
+	if err := cfg.Unpack(&settings); err != nil {
+		return nil, Group{}, err
+	}
+	target.backoff = backoff.NewEqualJitterBackoff(done, settings.Backoff.Init, settings.Backoff.Max)
+
+	group, err := factory(im, beat, observer, cfg)
+	if err != nil {
+		return nil, Group{}, err
+	}
+
+	clients := make([]NetworkClient, len(group.Clients))
+	for i, client := range group.Clients {
+		netClient, ok := client.(NetworkClient)
+		if !ok {
+			for _, c := range group.Clients {
+				c.Close()
+			}
+			return nil, Group{}, fmt.Errorf("output client %v does not support targets", client)
+		}
+		clients[i] = netClient
+	}
+	target.client = NewFailoverClient(clients)
+
+	return target, group, nil
+}
+
+// Connect connects all targets neither connected nor being reconnected.
+// Targets failing to connect are reconnected in the background, such that
+// events are published to the other targets meanwhile. Connect only fails if
+// no target is connected. If all targets are being reconnected, Connect waits
+// for the first target to become available.
+func (r *routingClient) Connect() error {
+	var errs []string
+	for _, target := range r.allTargets() {
+		target.mu.Lock()
+		idle := !target.connected && !target.reconnecting
+		target.mu.Unlock()
+		if !idle {
+			continue
+		}
+
+		if err := target.client.Connect(); err != nil {
+			r.log.Warnf("Failed to connect to target %v: %v", target.name, err)
+			errs = append(errs, fmt.Sprintf("%v: %v", target.name, err))
+			r.reconnect(target)
+			continue
+		}
+		target.mu.Lock()
+		target.connected = true
+		target.mu.Unlock()
+	}
+
+	for !r.anyConnected() {
+		if len(errs) > 0 {
+			return fmt.Errorf("failed to connect to targets: %v", strings.Join(errs, "; "))
+		}
+		select {
+		case <-r.reconnected:
+		case <-r.done:
+			return errors.New("routing client closed")
+		}
+	}
+	return nil
+}
+
+// Close stops all reconnect attempts and closes all targets. Events held
+// for targets not connected are returned to the queue.
+func (r *routingClient) Close() error {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	r.cancel()
+	r.wg.Wait()
+
+	var errs []string
+	for _, target := range r.allTargets() {
+		target.mu.Lock()
+		held := target.held
+		target.held = nil
+		target.connected = false
+		target.reconnecting = false
+		target.mu.Unlock()
+
+		for _, sub := range held {
+			sub.Cancelled()
+		}
+		if err := target.client.Close(); err != nil && err != errNoActiveConnection {
+			errs = append(errs, fmt.Sprintf("%v: %v", target.name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close targets: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Publish splits the batch by target and publishes the events of each target
+// using the target's client. The batch is signaled once all targets have
+// processed their events. If a target fails, the target is reconnected in the
+// background and its events are held until it is connected again, without
+// affecting the other targets.
+func (r *routingClient) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+
+	routed := make(map[*routingTarget][]publisher.Event, len(r.targets)+1)
+	var order []*routingTarget
+	dropped := 0
+	for _, event := range events {
+		target := r.route(&event.Content)
+		if target == nil {
+			dropped++
+			continue
+		}
+		if _, exists := routed[target]; !exists {
+			order = append(order, target)
+		}
+		routed[target] = append(routed[target], event)
+	}
+
+	if dropped > 0 {
+		r.log.Debugf("Dropping %v events not matching any target", dropped)
+		r.observer.NewBatch(dropped)
+		r.observer.Dropped(dropped)
+	}
+
+	parent := &routedParent{batch: batch, pending: len(order)}
+	if len(order) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	for _, target := range order {
+		sub := &routedBatch{parent: parent, events: routed[target]}
+		if target.hold(sub) {
+			continue
+		}
+		if err := target.client.Publish(ctx, sub); err != nil {
+			r.log.Warnf("Failed to publish to target %v: %v", target.name, err)
+			r.reconnect(target)
+		}
+	}
+	return nil
+}
+
+// reconnect marks target as disconnected and reconnects it in the
+// background. The client is not closed before reconnecting, like the
+// pipeline does for outputs without targets, such that the client's own
+// backoff keeps working. Once connected, the events held for the target are
+// published, before new events are published to the target again.
+func (r *routingClient) reconnect(target *routingTarget) {
+	target.mu.Lock()
+	target.connected = false
+	target.reconnecting = true
+	target.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		for {
+			if !target.backoff.Wait() {
+				return
+			}
+			if err := target.client.Connect(); err != nil {
+				r.log.Warnf("Failed to reconnect to target %v: %v", target.name, err)
+				continue
+			}
+			target.backoff.Reset()
+			r.log.Infof("Connection to target %v established", target.name)
+
+			if r.publishHeld(target) {
+				break
+			}
+		}
+
+		select {
+		case r.reconnected <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// publishHeld publishes the events held for target, until no events are held
+// anymore and the target is marked as connected. publishHeld reports false if
+// publishing failed, with the events not published yet held again.
+func (r *routingClient) publishHeld(target *routingTarget) bool {
+	for {
+		target.mu.Lock()
+		held := target.held
+		target.held = nil
+		if len(held) == 0 {
+			target.connected = true
+			target.reconnecting = false
+			target.mu.Unlock()
+			return true
+		}
+		target.mu.Unlock()
+
+		for i, sub := range held {
+			if err := target.client.Publish(r.ctx, sub); err != nil {
+				r.log.Warnf("Failed to publish to target %v: %v", target.name, err)
+
+				target.mu.Lock()
+				target.held = append(held[i+1:len(held):len(held)], target.held...)
+				target.mu.Unlock()
+				return false
+			}
+		}
+	}
+}
+
+func (r *routingClient) anyConnected() bool {
+	for _, target := range r.allTargets() {
+		target.mu.Lock()
+		connected := target.connected
+		target.mu.Unlock()
+		if connected {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *routingClient) route(event *beat.Event) *routingTarget {
+	for _, target := range r.targets {
+		if target.condition == nil || target.condition.Check(event) {
+			return target
+		}
+	}
+	return r.fallback
+}
+
+func (r *routingClient) allTargets() []*routingTarget {
+	if r.fallback == nil {
+		return r.targets
+	}
+	return append(r.targets[:len(r.targets):len(r.targets)], r.fallback)
+}
+
+func (r *routingClient) Test(d testing.Driver) {
+	for _, target := range r.allTargets() {
+		c, ok := target.client.(testing.Testable)
+		d.Run("Target "+target.name, func(d testing.Driver) {
+			if !ok {
+				d.Fatal("output", errors.New("client doesn't support testing"))
+			}
+			c.Test(d)
+		})
+	}
+}
+
+func (r *routingClient) String() string {
+	names := make([]string, 0, len(r.targets)+1)
+	for _, target := range r.allTargets() {
+		names = append(names, target.name+"="+target.client.String())
+	}
+	return "routing(" + strings.Join(names, ",") + ")"
+}
+
+// hold keeps sub until the target is reconnected. hold reports false if the
+// target is connected, and sub must be published.
+func (t *routingTarget) hold(sub *routedBatch) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.connected {
+		return false
+	}
+	t.held = append(t.held, sub)
+	return true
+}
+
+func (b *routedBatch) Events() []publisher.Event { return b.events }
+
+func (b *routedBatch) ACK()                                     { b.parent.done(nil, nil) }
+func (b *routedBatch) Drop()                                    { b.parent.done(nil, nil) }
+func (b *routedBatch) Retry()                                   { b.parent.done(b.events, nil) }
+func (b *routedBatch) RetryEvents(events []publisher.Event)     { b.parent.done(events, nil) }
+func (b *routedBatch) Cancelled()                               { b.parent.done(nil, b.events) }
+func (b *routedBatch) CancelledEvents(events []publisher.Event) { b.parent.done(nil, events) }
+
+func (p *routedParent) done(retry, cancelled []publisher.Event) {
+	p.mu.Lock()
+	p.retry = append(p.retry, retry...)
+	p.cancelled = append(p.cancelled, cancelled...)
+	p.pending--
+	finished := p.pending == 0
+	p.mu.Unlock()
+
+	if !finished {
+		return
+	}
+
+	switch {
+	case len(p.cancelled) > 0:
+		// Events are only cancelled if the output is closed. The events to
+		// be retried are returned as cancelled as well, as a batch can only
+		// be signaled once, and the cancelled events must not consume the
+		// batch's TTL.
+		p.batch.CancelledEvents(append(p.cancelled, p.retry...))
+	case len(p.retry) > 0:
+		p.batch.RetryEvents(p.retry)
+	default:
+		p.batch.ACK()
+	}
+}
@@ -0,0 +1,386 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package outputs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+type fakeTargetClient struct {
+	hosts     []string
+	topic     string
+	published []publisher.Event
+	onPublish func(publisher.Batch)
+
+	mu         sync.Mutex
+	connectErr error
+	publishErr error
+	closed     int
+}
+
+type fakeTargetFactory struct {
+	clients map[string]*fakeTargetClient
+
+	// connectErr is returned by Connect of the clients created for the
+	// configured host.
+	connectErr map[string]error
+}
+
+func newFakeTargetFactory() *fakeTargetFactory {
+	return &fakeTargetFactory{
+		clients:    map[string]*fakeTargetClient{},
+		connectErr: map[string]error{},
+	}
+}
+
+func (f *fakeTargetFactory) make(_ IndexManager, _ beat.Info, _ Observer, cfg *common.Config) (Group, error) {
+	var config struct {
+		Hosts []string `config:"hosts"`
+		Topic string   `config:"topic"`
+	}
+	if err := cfg.Unpack(&config); err != nil {
+		return Fail(err)
+	}
+	client := &fakeTargetClient{
+		hosts:      config.Hosts,
+		topic:      config.Topic,
+		connectErr: f.connectErr[config.Hosts[0]],
+	}
+	f.clients[config.Hosts[0]] = client
+	return Success(100, 3, client)
+}
+
+func (c *fakeTargetClient) String() string { return "fake" }
+
+func (c *fakeTargetClient) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connectErr
+}
+
+func (c *fakeTargetClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed++
+	return nil
+}
+
+func (c *fakeTargetClient) setErrors(connectErr, publishErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connectErr, c.publishErr = connectErr, publishErr
+}
+
+func (c *fakeTargetClient) closeCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeTargetClient) Publish(_ context.Context, batch publisher.Batch) error {
+	c.mu.Lock()
+	err := c.publishErr
+	c.mu.Unlock()
+	if err != nil {
+		batch.Retry()
+		return err
+	}
+
+	c.published = append(c.published, batch.Events()...)
+	if c.onPublish != nil {
+		c.onPublish(batch)
+	} else {
+		batch.ACK()
+	}
+	return nil
+}
+
+func (c *fakeTargetClient) tenants() []string {
+	var tenants []string
+	for _, event := range c.published {
+		tenant, _ := event.Content.Fields.GetValue("tenant")
+		tenants = append(tenants, tenant.(string))
+	}
+	return tenants
+}
+
+func makeTestRoutedOutput(t *testing.T, settings map[string]interface{}) (*routingClient, *fakeTargetFactory) {
+	factory := newFakeTargetFactory()
+	router := makeTestRouter(t, factory, settings)
+	require.NoError(t, router.Connect())
+	return router, factory
+}
+
+func makeTestRouter(t *testing.T, factory *fakeTargetFactory, settings map[string]interface{}) *routingClient {
+	group, err := MakeRoutedOutput(nil, beat.Info{}, nil, common.MustNewConfigFrom(settings), factory.make)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+	assert.Equal(t, 100, group.BatchSize)
+	return group.Clients[0].(*routingClient)
+}
+
+// signals returns a channel receiving the signals of batch.
+func signals(batch *outest.Batch) <-chan outest.BatchSignal {
+	ch := make(chan outest.BatchSignal, 1)
+	batch.OnSignal = func(sig outest.BatchSignal) { ch <- sig }
+	return ch
+}
+
+func receiveSignal(t *testing.T, ch <-chan outest.BatchSignal) outest.BatchSignal {
+	t.Helper()
+	select {
+	case sig := <-ch:
+		return sig
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for batch signal")
+		return outest.BatchSignal{}
+	}
+}
+
+func tenantBatch(tenants ...string) *outest.Batch {
+	events := make([]beat.Event, len(tenants))
+	for i, tenant := range tenants {
+		events[i] = beat.Event{Fields: common.MapStr{"tenant": tenant}}
+	}
+	return outest.NewBatch(events...)
+}
+
+func TestRoutingClientTargets(t *testing.T) {
+	router, factory := makeTestRoutedOutput(t, map[string]interface{}{
+		"hosts": []string{"default:9092"},
+		"topic": "events",
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+			{"name": "b", "hosts": []string{"b1:9092", "b2:9092"}, "topic": "b-events", "when.equals.tenant": "b"},
+		},
+	})
+
+	require.Len(t, factory.clients, 3)
+	a, b, fallback := factory.clients["a1:9092"], factory.clients["b1:9092"], factory.clients["default:9092"]
+	assert.Equal(t, "events", a.topic, "target must inherit output settings")
+	assert.Equal(t, []string{"b1:9092", "b2:9092"}, b.hosts, "target hosts must replace output hosts")
+	assert.Equal(t, "b-events", b.topic)
+
+	batch := tenantBatch("a", "b", "c", "a")
+	require.NoError(t, router.Publish(context.Background(), batch))
+
+	assert.Equal(t, []string{"a", "a"}, a.tenants())
+	assert.Equal(t, []string{"b"}, b.tenants())
+	assert.Equal(t, []string{"c"}, fallback.tenants())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func TestRoutingClientDropsUnmatched(t *testing.T) {
+	router, factory := makeTestRoutedOutput(t, map[string]interface{}{
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+		},
+	})
+	require.Len(t, factory.clients, 1)
+
+	batch := tenantBatch("a", "c")
+	require.NoError(t, router.Publish(context.Background(), batch))
+
+	assert.Equal(t, []string{"a"}, factory.clients["a1:9092"].tenants())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func TestRoutingClientRetry(t *testing.T) {
+	router, factory := makeTestRoutedOutput(t, map[string]interface{}{
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+			{"name": "b", "hosts": []string{"b1:9092"}},
+		},
+	})
+
+	// target b signals asynchronously, after target a retried its events
+	var pending publisher.Batch
+	factory.clients["a1:9092"].onPublish = func(batch publisher.Batch) {
+		batch.RetryEvents(batch.Events())
+	}
+	factory.clients["b1:9092"].onPublish = func(batch publisher.Batch) {
+		pending = batch
+	}
+
+	batch := tenantBatch("a", "b", "c")
+	require.NoError(t, router.Publish(context.Background(), batch))
+	assert.Empty(t, batch.Signals, "batch must not be signaled before all targets are done")
+
+	assert.Equal(t, []string{"b", "c"}, factory.clients["b1:9092"].tenants())
+	pending.ACK()
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "a", batch.Signals[0].Events[0].Content.Fields["tenant"])
+}
+
+func TestRoutingClientConnectsAvailableTargets(t *testing.T) {
+	factory := newFakeTargetFactory()
+	factory.connectErr["a1:9092"] = errors.New("unreachable")
+	router := makeTestRouter(t, factory, map[string]interface{}{
+		"backoff.init": "1ms",
+		"backoff.max":  "1ms",
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+			{"name": "b", "hosts": []string{"b1:9092"}},
+		},
+	})
+	defer router.Close()
+	a, b := factory.clients["a1:9092"], factory.clients["b1:9092"]
+
+	require.NoError(t, router.Connect(), "connect must succeed while one target is up")
+
+	batch := tenantBatch("a", "b")
+	sigs := signals(batch)
+	require.NoError(t, router.Publish(context.Background(), batch))
+	assert.Equal(t, []string{"b"}, b.tenants())
+	assert.Empty(t, a.published)
+	assert.Empty(t, batch.Signals, "events of the unreachable target must be held")
+
+	a.setErrors(nil, nil)
+	sig := receiveSignal(t, sigs)
+	assert.Equal(t, outest.BatchACK, sig.Tag, "held events must be published once the target is connected")
+	assert.Equal(t, []string{"a"}, a.tenants())
+	assert.Equal(t, 0, a.closeCount(), "target must not be closed before reconnecting")
+
+	batch = tenantBatch("a")
+	require.NoError(t, router.Publish(context.Background(), batch))
+	assert.Equal(t, []string{"a", "a"}, a.tenants())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func TestRoutingClientReconnectsFailedTarget(t *testing.T) {
+	router, factory := makeTestRoutedOutput(t, map[string]interface{}{
+		"backoff.init": "1ms",
+		"backoff.max":  "1ms",
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+			{"name": "b", "hosts": []string{"b1:9092"}},
+		},
+	})
+	defer router.Close()
+	a, b := factory.clients["a1:9092"], factory.clients["b1:9092"]
+
+	// a fails to publish and stays down until its errors are cleared
+	a.setErrors(errors.New("unreachable"), errors.New("broken pipe"))
+	batch := tenantBatch("a", "b")
+	require.NoError(t, router.Publish(context.Background(), batch), "a failed target must not fail the other targets")
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag, "only the failed target's events must be retried")
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "a", batch.Signals[0].Events[0].Content.Fields["tenant"])
+
+	batch = tenantBatch("a", "b")
+	sigs := signals(batch)
+	require.NoError(t, router.Publish(context.Background(), batch))
+	assert.Equal(t, []string{"b", "b"}, b.tenants())
+
+	a.setErrors(nil, nil)
+	sig := receiveSignal(t, sigs)
+	assert.Equal(t, outest.BatchACK, sig.Tag)
+	assert.Equal(t, []string{"a"}, a.tenants())
+	assert.Equal(t, 0, a.closeCount(), "failed target must not be closed before reconnecting")
+}
+
+func TestRoutingClientCloseCancelsHeldEvents(t *testing.T) {
+	factory := newFakeTargetFactory()
+	factory.connectErr["a1:9092"] = errors.New("unreachable")
+	router := makeTestRouter(t, factory, map[string]interface{}{
+		"backoff.init": "1ms",
+		"backoff.max":  "1ms",
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}, "when.equals.tenant": "a"},
+			{"name": "b", "hosts": []string{"b1:9092"}},
+		},
+	})
+	require.NoError(t, router.Connect())
+	factory.clients["b1:9092"].onPublish = func(batch publisher.Batch) {
+		batch.RetryEvents(batch.Events())
+	}
+
+	batch := tenantBatch("a", "b")
+	require.NoError(t, router.Publish(context.Background(), batch))
+	assert.Empty(t, batch.Signals, "events of the unreachable target must be held")
+
+	require.NoError(t, router.Close())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchCancelledEvents, batch.Signals[0].Tag, "held events must not consume the batch's TTL")
+	assert.Len(t, batch.Signals[0].Events, 2)
+}
+
+func TestRoutingClientConnectFailsWithoutTargets(t *testing.T) {
+	factory := newFakeTargetFactory()
+	factory.connectErr["a1:9092"] = errors.New("unreachable")
+	router := makeTestRouter(t, factory, map[string]interface{}{
+		"backoff.init": "1ms",
+		"backoff.max":  "1ms",
+		"targets": []map[string]interface{}{
+			{"name": "a", "hosts": []string{"a1:9092"}},
+		},
+	})
+	defer router.Close()
+
+	assert.Error(t, router.Connect())
+
+	// the next attempt waits for the target being reconnected
+	factory.clients["a1:9092"].setErrors(nil, nil)
+	assert.NoError(t, router.Connect())
+}
+
+func TestRoutedOutputInvalidTargets(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"missing name": {
+			"targets": []map[string]interface{}{{"hosts": []string{"a:9092"}}},
+		},
+		"duplicate name": {
+			"targets": []map[string]interface{}{
+				{"name": "a", "hosts": []string{"a:9092"}},
+				{"name": "a", "hosts": []string{"b:9092"}},
+			},
+		},
+		"nested targets": {
+			"targets": []map[string]interface{}{
+				{"name": "a", "targets": []map[string]interface{}{{"name": "b"}}},
+			},
+		},
+	}
+
+	for name, settings := range cases {
+		t.Run(name, func(t *testing.T) {
+			factory := newFakeTargetFactory()
+			_, err := MakeRoutedOutput(nil, beat.Info{}, nil, common.MustNewConfigFrom(settings), factory.make)
+			assert.Error(t, err)
+		})
+	}
+}
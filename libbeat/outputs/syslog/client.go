@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/testing"
+)
+
+// client sends events as syslog messages to a single host. With TCP all
+// messages of a batch are framed and written at once, with UDP each message
+// is sent in a datagram of its own.
+type client struct {
+	*transport.Client
+	log       *logp.Logger
+	observer  outputs.Observer
+	network   string
+	framing   string
+	timeout   time.Duration
+	formatter *formatter
+}
+
+func newClient(
+	conn *transport.Client,
+	observer outputs.Observer,
+	network string,
+	framing string,
+	timeout time.Duration,
+	formatter *formatter,
+) *client {
+	if observer == nil {
+		observer = outputs.NewNilObserver()
+	}
+	return &client{
+		Client:    conn,
+		log:       logp.NewLogger("syslog"),
+		observer:  observer,
+		network:   network,
+		framing:   framing,
+		timeout:   timeout,
+		formatter: formatter,
+	}
+}
+
+func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	rest, err := c.publishEvents(events)
+	if len(rest) == 0 {
+		batch.ACK()
+	} else {
+		batch.RetryEvents(rest)
+	}
+	return err
+}
+
+// publishEvents sends all events to the syslog server. Events that can not be
+// formatted are dropped. On error the events not yet sent are returned.
+func (c *client) publishEvents(data []publisher.Event) ([]publisher.Event, error) {
+	st := c.observer
+
+	okEvents := data[:0]
+	msgs := make([][]byte, 0, len(data))
+	for i := range data {
+		msg, err := c.formatter.Format(&data[i].Content)
+		if err != nil {
+			c.log.Errorf("Dropping event: failed to format syslog message: %+v", err)
+			c.log.Debugf("Failed event: %v", data[i])
+			continue
+		}
+		okEvents = append(okEvents, data[i])
+		msgs = append(msgs, msg)
+	}
+
+	if dropped := len(data) - len(okEvents); dropped > 0 {
+		st.Dropped(dropped)
+	}
+	if len(okEvents) == 0 {
+		return nil, nil
+	}
+
+	if c.timeout > 0 {
+		if err := c.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+			st.Failed(len(okEvents))
+			return okEvents, err
+		}
+	}
+
+	if c.network == "udp" {
+		for i, msg := range msgs {
+			if _, err := c.Write(msg); err != nil {
+				c.log.Errorf("Failed to send syslog message: %v", err)
+				st.Acked(i)
+				st.Failed(len(okEvents) - i)
+				return okEvents[i:], err
+			}
+		}
+		st.Acked(len(okEvents))
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		c.frame(&buf, msg)
+	}
+	if _, err := c.Write(buf.Bytes()); err != nil {
+		// It is unknown how many messages were received, so all events are
+		// resend.
+		c.log.Errorf("Failed to send syslog messages: %v", err)
+		st.Failed(len(okEvents))
+		return okEvents, err
+	}
+
+	st.Acked(len(okEvents))
+	return nil, nil
+}
+
+// frame adds the message to the stream, using the configured framing method
+// (RFC 6587). With non-transparent framing newlines within the message are
+// replaced by spaces, so the message is not split by the receiver.
+func (c *client) frame(buf *bytes.Buffer, msg []byte) {
+	if c.framing == framingNonTransparent {
+		for _, b := range msg {
+			if b == '\n' {
+				b = ' '
+			}
+			buf.WriteByte(b)
+		}
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteString(strconv.Itoa(len(msg)))
+	buf.WriteByte(' ')
+	buf.Write(msg)
+}
+
+func (c *client) Test(d testing.Driver) {
+	c.Client.Test(d)
+}
+
+func (c *client) String() string {
+	return "syslog(" + c.Client.String() + ")"
+}
@@ -0,0 +1,194 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+func TestPublishTCP(t *testing.T) {
+	cases := map[string]struct {
+		framing string
+		read    func(r *bufio.Reader) (string, error)
+	}{
+		"octet counting": {
+			framing: framingOctetCounting,
+			read:    readOctetCounted,
+		},
+		"non transparent": {
+			framing: framingNonTransparent,
+			read: func(r *bufio.Reader) (string, error) {
+				line, err := r.ReadString('\n')
+				return strings.TrimSuffix(line, "\n"), err
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "localhost:0")
+			require.NoError(t, err)
+			defer l.Close()
+
+			received := make(chan string, 10)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := test.read(r)
+					if err != nil {
+						return
+					}
+					received <- msg
+				}
+			}()
+
+			client := newTestClient(t, "tcp", l.Addr().String(), test.framing)
+			batch := outest.NewBatch(testEvent("first"), testEvent("second line\nwith newline"), testEvent("third"))
+			require.NoError(t, client.Publish(context.Background(), batch))
+			require.Equal(t, 1, len(batch.Signals))
+			assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+			expected := []string{"first", "second line with newline", "third"}
+			if test.framing == framingOctetCounting {
+				expected[1] = "second line\nwith newline"
+			}
+			for _, msg := range expected {
+				assert.Equal(t, "<14>1 2020-08-10T12:30:05.000000Z myhost testbeat - - - "+msg, receive(t, received))
+			}
+		})
+	}
+}
+
+func TestPublishUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := newTestClient(t, "udp", conn.LocalAddr().String(), framingOctetCounting)
+	batch := outest.NewBatch(testEvent("first"), testEvent("second"))
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	buf := make([]byte, 1024)
+	for _, msg := range []string{"first", "second"} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "<14>1 2020-08-10T12:30:05.000000Z myhost testbeat - - - "+msg, string(buf[:n]))
+	}
+}
+
+func TestPublishDropsUnformattableEvents(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := newTestClient(t, "udp", conn.LocalAddr().String(), framingOctetCounting)
+	client.formatter.severity = fmtstr.MustCompileEvent("%{[severity]}")
+
+	valid := testEvent("valid")
+	valid.Fields["severity"] = "debug"
+	batch := outest.NewBatch(testEvent("missing severity"), valid)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	require.Equal(t, 1, len(batch.Signals))
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "<15>1 2020-08-10T12:30:05.000000Z myhost testbeat - - - valid", string(buf[:n]))
+}
+
+func newTestClient(t *testing.T, network, host, framing string) *client {
+	conn, err := transport.NewClient(transport.Config{Timeout: 5 * time.Second}, network, host, defaultPort)
+	require.NoError(t, err)
+
+	f := &formatter{
+		format:          formatRFC5424,
+		facility:        fmtstr.MustCompileEvent("user"),
+		severity:        fmtstr.MustCompileEvent("info"),
+		defaultHostname: "myhost",
+		defaultAppName:  "testbeat",
+		codec:           format.New(fmtstr.MustCompileEvent("%{[message]}")),
+	}
+
+	client := newClient(conn, nil, network, framing, 5*time.Second, f)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testEvent(msg string) beat.Event {
+	return beat.Event{
+		Timestamp: time.Date(2020, 8, 10, 12, 30, 5, 0, time.UTC),
+		Fields:    common.MapStr{"message": msg},
+	}
+}
+
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func receive(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for syslog message")
+		return ""
+	}
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+type syslogConfig struct {
+	Network     string                    `config:"network"`
+	Format      string                    `config:"format"`
+	Framing     string                    `config:"framing"`
+	Facility    fmtstr.EventFormatString  `config:"facility"`
+	Severity    fmtstr.EventFormatString  `config:"severity"`
+	Hostname    *fmtstr.EventFormatString `config:"hostname"`
+	AppName     *fmtstr.EventFormatString `config:"appname"`
+	MsgID       *fmtstr.EventFormatString `config:"msgid"`
+	Codec       codec.Config              `config:"codec"`
+	LoadBalance bool                      `config:"loadbalance"`
+	Timeout     time.Duration             `config:"timeout"`
+	BulkMaxSize int                       `config:"bulk_max_size"`
+	MaxRetries  int                       `config:"max_retries"`
+	TLS         *tlscommon.Config         `config:"ssl"`
+	Proxy       transport.ProxyConfig     `config:",inline"`
+	Backoff     backoff                   `config:"backoff"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+const (
+	formatRFC5424 = "rfc5424"
+	formatRFC3164 = "rfc3164"
+
+	// framingOctetCounting prefixes each message with its length (RFC 6587).
+	framingOctetCounting = "octet_counting"
+
+	// framingNonTransparent terminates each message with a newline (RFC 6587).
+	framingNonTransparent = "non_transparent"
+)
+
+var (
+	defaultConfig = syslogConfig{
+		Network:     "tcp",
+		Format:      formatRFC5424,
+		Framing:     framingOctetCounting,
+		Facility:    *fmtstr.MustCompileEvent("user"),
+		Severity:    *fmtstr.MustCompileEvent("informational"),
+		LoadBalance: true,
+		Timeout:     30 * time.Second,
+		BulkMaxSize: 2048,
+		MaxRetries:  3,
+		TLS:         nil,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+)
+
+func (c *syslogConfig) Validate() error {
+	switch c.Network {
+	case "tcp":
+	case "udp":
+		if c.TLS.IsEnabled() {
+			return fmt.Errorf("TLS is not supported with network udp")
+		}
+		if c.Proxy.URL != "" {
+			return fmt.Errorf("proxies are not supported with network udp")
+		}
+	default:
+		return fmt.Errorf("unsupported network '%v'", c.Network)
+	}
+
+	switch c.Format {
+	case formatRFC5424, formatRFC3164:
+	default:
+		return fmt.Errorf("unsupported syslog format '%v'", c.Format)
+	}
+
+	switch c.Framing {
+	case framingOctetCounting, framingNonTransparent:
+	default:
+		return fmt.Errorf("unsupported framing '%v'", c.Framing)
+	}
+
+	for name, fs := range map[string]*fmtstr.EventFormatString{"facility": &c.Facility, "severity": &c.Severity} {
+		if !fs.IsConst() {
+			continue
+		}
+		value, err := fs.Run(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := parseCode(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
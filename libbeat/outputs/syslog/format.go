@@ -0,0 +1,225 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// formatter renders events as syslog messages. The message header is build
+// from the configured format strings, the message body is created by the
+// codec.
+type formatter struct {
+	format   string
+	facility *fmtstr.EventFormatString
+	severity *fmtstr.EventFormatString
+	hostname *fmtstr.EventFormatString
+	appName  *fmtstr.EventFormatString
+	msgID    *fmtstr.EventFormatString
+
+	defaultHostname string
+	defaultAppName  string
+
+	index string
+	codec codec.Codec
+}
+
+const (
+	// maximum header field lengths as defined by RFC 5424
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxMsgIDLen    = 32
+
+	// maximum TAG length as defined by RFC 3164
+	maxTagLen = 32
+
+	nilValue = "-"
+
+	rfc5424TimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"ntp":      12,
+	"security": 13,
+	"console":  14,
+	"solaris":  15,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+var severities = map[string]int{
+	"emerg":         0,
+	"emergency":     0,
+	"alert":         1,
+	"crit":          2,
+	"critical":      2,
+	"err":           3,
+	"error":         3,
+	"warn":          4,
+	"warning":       4,
+	"notice":        5,
+	"info":          6,
+	"informational": 6,
+	"debug":         7,
+}
+
+// parseCode parses a facility or severity given either as number or name.
+func parseCode(kind, value string) (int, error) {
+	table, max := facilities, 23
+	if kind == "severity" {
+		table, max = severities, 7
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	if code, ok := table[value]; ok {
+		return code, nil
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 0 || code > max {
+		return 0, fmt.Errorf("invalid syslog %v '%v'", kind, value)
+	}
+	return code, nil
+}
+
+// Format creates the syslog message for the event. Framing is not applied.
+func (f *formatter) Format(event *beat.Event) ([]byte, error) {
+	pri, err := f.priority(event)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := f.headerField(f.hostname, event, f.defaultHostname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format hostname: %w", err)
+	}
+	appName, err := f.headerField(f.appName, event, f.defaultAppName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format appname: %w", err)
+	}
+	msgID, err := f.headerField(f.msgID, event, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to format msgid: %w", err)
+	}
+
+	msg, err := f.codec.Encode(f.index, event)
+	if err != nil {
+		return nil, err
+	}
+	msg = bytes.TrimRight(msg, "\n")
+
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(pri))
+	buf.WriteByte('>')
+
+	if f.format == formatRFC3164 {
+		buf.WriteString(event.Timestamp.Local().Format(time.Stamp))
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(hostname, maxHostnameLen, "localhost"))
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(appName, maxTagLen, "beat"))
+		buf.WriteString(": ")
+	} else {
+		buf.WriteString("1 ")
+		buf.WriteString(event.Timestamp.UTC().Format(rfc5424TimeFormat))
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(hostname, maxHostnameLen, nilValue))
+		buf.WriteByte(' ')
+		buf.WriteString(headerValue(appName, maxAppNameLen, nilValue))
+		buf.WriteString(" - ") // PROCID
+		buf.WriteString(headerValue(msgID, maxMsgIDLen, nilValue))
+		buf.WriteString(" - ") // STRUCTURED-DATA
+	}
+
+	buf.Write(msg)
+	return buf.Bytes(), nil
+}
+
+func (f *formatter) priority(event *beat.Event) (int, error) {
+	value, err := f.facility.Run(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to format facility: %w", err)
+	}
+	facility, err := parseCode("facility", value)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err = f.severity.Run(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to format severity: %w", err)
+	}
+	severity, err := parseCode("severity", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return facility*8 + severity, nil
+}
+
+func (f *formatter) headerField(fs *fmtstr.EventFormatString, event *beat.Event, def string) (string, error) {
+	if fs == nil {
+		return def, nil
+	}
+	return fs.Run(event)
+}
+
+// headerValue converts a header field into printable US-ASCII without spaces,
+// as required for syslog header fields, truncating it to max characters.
+func headerValue(s string, max int, empty string) string {
+	if s == "" {
+		return empty
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2020, 8, 10, 12, 30, 5, 123456000, time.UTC)
+	event := beat.Event{
+		Timestamp: ts,
+		Fields: common.MapStr{
+			"message": "hello world",
+			"log": common.MapStr{
+				"level": "Error",
+			},
+			"host": common.MapStr{
+				"name": "web 01",
+			},
+			"event": common.MapStr{
+				"action": "login",
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		formatter formatter
+		want      string
+	}{
+		"rfc5424 defaults": {
+			formatter: formatter{
+				format:          formatRFC5424,
+				facility:        fmtstr.MustCompileEvent("user"),
+				severity:        fmtstr.MustCompileEvent("informational"),
+				defaultHostname: "myhost",
+				defaultAppName:  "testbeat",
+			},
+			want: "<14>1 2020-08-10T12:30:05.123456Z myhost testbeat - - - hello world",
+		},
+		"rfc5424 from event fields": {
+			formatter: formatter{
+				format:   formatRFC5424,
+				facility: fmtstr.MustCompileEvent("local3"),
+				severity: fmtstr.MustCompileEvent("%{[log.level]}"),
+				hostname: fmtstr.MustCompileEvent("%{[host.name]}"),
+				appName:  fmtstr.MustCompileEvent("app"),
+				msgID:    fmtstr.MustCompileEvent("%{[event.action]}"),
+			},
+			want: "<155>1 2020-08-10T12:30:05.123456Z web_01 app - login - hello world",
+		},
+		"rfc5424 numeric codes": {
+			formatter: formatter{
+				format:   formatRFC5424,
+				facility: fmtstr.MustCompileEvent("4"),
+				severity: fmtstr.MustCompileEvent("%{[log.severity]:2}"),
+			},
+			want: "<34>1 2020-08-10T12:30:05.123456Z - - - - - hello world",
+		},
+		"rfc3164": {
+			formatter: formatter{
+				format:          formatRFC3164,
+				facility:        fmtstr.MustCompileEvent("daemon"),
+				severity:        fmtstr.MustCompileEvent("warning"),
+				defaultHostname: "myhost",
+				defaultAppName:  "testbeat",
+			},
+			want: "<28>" + ts.Local().Format(time.Stamp) + " myhost testbeat: hello world",
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := test.formatter
+			f.codec = format.New(fmtstr.MustCompileEvent("%{[message]}"))
+
+			msg, err := f.Format(&event)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, string(msg))
+		})
+	}
+}
+
+func TestFormatFailsOnInvalidSeverity(t *testing.T) {
+	f := formatter{
+		format:   formatRFC5424,
+		facility: fmtstr.MustCompileEvent("user"),
+		severity: fmtstr.MustCompileEvent("%{[log.level]}"),
+		codec:    format.New(fmtstr.MustCompileEvent("%{[message]}")),
+	}
+
+	event := beat.Event{Fields: common.MapStr{
+		"message": "test",
+		"log":     common.MapStr{"level": "verbose"},
+	}}
+	_, err := f.Format(&event)
+	assert.Error(t, err)
+
+	event = beat.Event{Fields: common.MapStr{"message": "test"}}
+	_, err = f.Format(&event)
+	assert.Error(t, err)
+}
+
+func TestParseCode(t *testing.T) {
+	cases := []struct {
+		kind, value string
+		want        int
+		invalid     bool
+	}{
+		{kind: "facility", value: "kern", want: 0},
+		{kind: "facility", value: "LOCAL7", want: 23},
+		{kind: "facility", value: "17", want: 17},
+		{kind: "facility", value: "24", invalid: true},
+		{kind: "facility", value: "info", invalid: true},
+		{kind: "severity", value: "emerg", want: 0},
+		{kind: "severity", value: " Debug ", want: 7},
+		{kind: "severity", value: "3", want: 3},
+		{kind: "severity", value: "8", invalid: true},
+		{kind: "severity", value: "local0", invalid: true},
+	}
+
+	for _, test := range cases {
+		code, err := parseCode(test.kind, test.value)
+		if test.invalid {
+			assert.Error(t, err, "%v %q", test.kind, test.value)
+			continue
+		}
+		if assert.NoError(t, err, "%v %q", test.kind, test.value) {
+			assert.Equal(t, test.want, code, "%v %q", test.kind, test.value)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+)
+
+const (
+	defaultPort    = 514
+	defaultTLSPort = 6514
+)
+
+func init() {
+	outputs.RegisterType("syslog", makeSyslog)
+}
+
+func makeSyslog(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *common.Config,
+) (outputs.Group, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	transp := transport.Config{
+		Timeout: config.Timeout,
+		TLS:     tls,
+		Stats:   observer,
+	}
+	if config.Proxy.URL != "" {
+		transp.Proxy = &config.Proxy
+	}
+
+	port := defaultPort
+	if tls != nil {
+		port = defaultTLSPort
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		conn, err := transport.NewClient(transp, config.Network, host, port)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		var enc codec.Codec
+		if config.Codec.Namespace.IsSet() {
+			enc, err = codec.CreateEncoder(beat, config.Codec)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+		} else {
+			enc = json.New(beat.Version, json.Config{})
+		}
+
+		f := &formatter{
+			format:          config.Format,
+			facility:        &config.Facility,
+			severity:        &config.Severity,
+			hostname:        config.Hostname,
+			appName:         config.AppName,
+			msgID:           config.MsgID,
+			defaultHostname: beat.Hostname,
+			defaultAppName:  beat.Beat,
+			index:           beat.Beat,
+			codec:           enc,
+		}
+
+		client := newClient(conn, observer, config.Network, config.Framing, config.Timeout, f)
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
+}
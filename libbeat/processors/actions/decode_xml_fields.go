@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package actions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/encoding/xml"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+)
+
+type decodeXMLFields struct {
+	config  decodeXMLFieldsConfig
+	decoder *xml.Decoder
+	logger  *logp.Logger
+}
+
+type decodeXMLFieldsConfig struct {
+	Fields        []string `config:"fields"`
+	OverwriteKeys bool     `config:"overwrite_keys"`
+	AddErrorKey   bool     `config:"add_error_key"`
+	Target        *string  `config:"target"`
+	DocumentID    string   `config:"document_id"`
+
+	xml.Config `config:",inline"`
+}
+
+func init() {
+	processors.RegisterPlugin("decode_xml_fields",
+		checks.ConfigChecked(NewDecodeXMLFields,
+			checks.RequireFields("fields"),
+			checks.AllowedFields("fields", "overwrite_keys", "add_error_key", "target", "document_id",
+				"attribute_prefix", "to_lower", "force_array", "when")))
+}
+
+// NewDecodeXMLFields construct a new decode_xml_fields processor.
+func NewDecodeXMLFields(c *common.Config) (processors.Processor, error) {
+	var config decodeXMLFieldsConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the decode_xml_fields configuration: %s", err)
+	}
+
+	return &decodeXMLFields{
+		config:  config,
+		decoder: xml.NewDecoder(config.Config),
+		logger:  logp.NewLogger("decode_xml_fields"),
+	}, nil
+}
+
+func (f *decodeXMLFields) Run(event *beat.Event) (*beat.Event, error) {
+	var errs []string
+
+	for _, field := range f.config.Fields {
+		data, err := event.GetValue(field)
+		if err != nil && errors.Cause(err) != common.ErrKeyNotFound {
+			f.logger.Debugf("Error trying to GetValue for field : %s in event : %v", field, event)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		text, ok := data.(string)
+		if !ok {
+			// ignore non string fields when decoding
+			continue
+		}
+
+		output, err := f.decoder.Decode(strings.NewReader(text))
+		if err != nil {
+			f.logger.Debugf("Error trying to decode XML %s", text)
+			event.SetErrorWithOption(createXMLError(fmt.Sprintf("failed to decode XML in field %s: %v", field, err)), f.config.AddErrorKey)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		var id string
+		if key := f.config.DocumentID; key != "" {
+			if tmp, err := output.GetValue(key); err == nil {
+				if v, ok := tmp.(string); ok {
+					id = v
+					output.Delete(key)
+				}
+			}
+		}
+
+		target := field
+		if f.config.Target != nil {
+			target = *f.config.Target
+		}
+
+		if target != "" {
+			_, err = event.PutValue(target, output)
+		} else {
+			jsontransform.WriteJSONKeys(event, output, f.config.OverwriteKeys, f.config.AddErrorKey)
+		}
+
+		if err != nil {
+			f.logger.Debugf("Error trying to Put value %v for field : %s", output, field)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		if id != "" {
+			if event.Meta == nil {
+				event.Meta = common.MapStr{}
+			}
+			event.Meta[events.FieldMetaID] = id
+		}
+	}
+
+	if len(errs) > 0 {
+		return event, fmt.Errorf(strings.Join(errs, ", "))
+	}
+	return event, nil
+}
+
+func (f *decodeXMLFields) String() string {
+	return "decode_xml_fields=" + strings.Join(f.config.Fields, ", ")
+}
+
+func createXMLError(message string) common.MapStr {
+	return common.MapStr{"message": message, "type": "xml"}
+}
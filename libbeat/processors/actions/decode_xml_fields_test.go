@@ -0,0 +1,143 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package actions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestDecodeXMLFields(t *testing.T) {
+	const record = `<event id="42"><Level>error</Level><tag>a</tag><tag>b</tag></event>`
+
+	tests := map[string]struct {
+		config   common.MapStr
+		input    common.MapStr
+		expected common.MapStr
+		meta     common.MapStr
+		err      bool
+	}{
+		"replace field": {
+			config: common.MapStr{"fields": []string{"msg"}},
+			input:  common.MapStr{"msg": record},
+			expected: common.MapStr{
+				"msg": common.MapStr{
+					"event": common.MapStr{
+						"id":    "42",
+						"Level": "error",
+						"tag":   []interface{}{"a", "b"},
+					},
+				},
+			},
+		},
+		"target field with options": {
+			config: common.MapStr{
+				"fields":           []string{"msg"},
+				"target":           "xml",
+				"attribute_prefix": "_",
+				"to_lower":         true,
+			},
+			input: common.MapStr{"msg": record},
+			expected: common.MapStr{
+				"msg": record,
+				"xml": common.MapStr{
+					"event": common.MapStr{
+						"_id":   "42",
+						"level": "error",
+						"tag":   []interface{}{"a", "b"},
+					},
+				},
+			},
+		},
+		"root target": {
+			config: common.MapStr{
+				"fields":         []string{"msg"},
+				"target":         "",
+				"overwrite_keys": true,
+			},
+			input: common.MapStr{
+				"msg":   `<event><Level>error</Level></event>`,
+				"event": "old",
+			},
+			expected: common.MapStr{
+				"msg":   `<event><Level>error</Level></event>`,
+				"event": common.MapStr{"Level": "error"},
+			},
+		},
+		"document id": {
+			config: common.MapStr{
+				"fields":      []string{"msg"},
+				"target":      "xml",
+				"document_id": "event.id",
+			},
+			input: common.MapStr{"msg": `<event id="42"><Level>error</Level></event>`},
+			expected: common.MapStr{
+				"msg": `<event id="42"><Level>error</Level></event>`,
+				"xml": common.MapStr{
+					"event": common.MapStr{"Level": "error"},
+				},
+			},
+			meta: common.MapStr{"_id": "42"},
+		},
+		"missing and non string fields": {
+			config:   common.MapStr{"fields": []string{"msg", "missing"}},
+			input:    common.MapStr{"msg": 123},
+			expected: common.MapStr{"msg": 123},
+		},
+		"invalid XML": {
+			config:   common.MapStr{"fields": []string{"msg"}},
+			input:    common.MapStr{"msg": `<event>`},
+			expected: common.MapStr{"msg": `<event>`},
+			err:      true,
+		},
+		"invalid XML with error key": {
+			config: common.MapStr{"fields": []string{"msg"}, "add_error_key": true},
+			input:  common.MapStr{"msg": `<event>`},
+			expected: common.MapStr{
+				"msg": `<event>`,
+				"error": common.MapStr{
+					"message": "failed to decode XML in field msg: XML syntax error on line 1: unexpected EOF",
+					"type":    "xml",
+				},
+			},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			p, err := NewDecodeXMLFields(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			actual, err := p.Run(&beat.Event{Fields: test.input})
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, actual.Fields)
+			assert.Equal(t, test.meta, actual.Meta)
+		})
+	}
+}
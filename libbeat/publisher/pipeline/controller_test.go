@@ -18,6 +18,8 @@
 package pipeline
 
 import (
+	"io/ioutil"
+	"os"
 	"sync"
 	"testing"
 	"testing/quick"
@@ -30,6 +32,8 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	"github.com/elastic/beats/v7/libbeat/tests/resources"
 
@@ -113,3 +117,63 @@ func TestOutputReload(t *testing.T) {
 		})
 	}
 }
+
+func TestCloseWithEmptyHybridQueue(t *testing.T) {
+	goroutines := resources.NewGoroutinesChecker()
+	defer goroutines.Check(t)
+
+	dir, err := ioutil.TempDir("", "pipeline_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	queueFactory := func(ackListener queue.ACKListener) (queue.Queue, error) {
+		logger := logp.L()
+		mem := memqueue.NewQueue(logger, memqueue.Settings{
+			ACKListener: ackListener,
+			Events:      16,
+		})
+		settings := diskqueue.DefaultSettings()
+		settings.Path = dir
+		disk, err := diskqueue.NewQueue(logger, settings)
+		if err != nil {
+			return nil, err
+		}
+		return hybridqueue.NewQueue(logger, mem, disk, hybridqueue.Settings{
+			HighWater: 16,
+		}), nil
+	}
+
+	pipeline, err := New(
+		beat.Info{},
+		Monitors{},
+		queueFactory,
+		outputs.Group{},
+		Settings{},
+	)
+	require.NoError(t, err)
+
+	publishFn := func(batch publisher.Batch) error {
+		batch.ACK()
+		return nil
+	}
+
+	// Reloading and closing the output must wake the consumer waiting for
+	// events from the empty queue.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for i := 0; i < 3; i++ {
+			pipeline.output.Set(outputs.Group{
+				Clients: []outputs.Client{newMockClient(publishFn)},
+			})
+			time.Sleep(50 * time.Millisecond)
+		}
+		pipeline.Close()
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("pipeline didn't shut down with an empty hybrid queue")
+	}
+}
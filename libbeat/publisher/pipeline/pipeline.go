@@ -297,7 +297,9 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 
 	ackHandler := cfg.ACKHandler
 
-	producerCfg := queue.ProducerConfig{}
+	producerCfg := queue.ProducerConfig{
+		Priority: cfg.Priority,
+	}
 
 	if reportEvents || cfg.Events != nil {
 		producerCfg.OnDrop = func(event beat.Event) {
@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// CompressionType selects the algorithm used to compress data frames
+// on disk.
+type CompressionType int
+
+const (
+	// CompressionNone writes frames uncompressed.
+	CompressionNone CompressionType = iota
+
+	// CompressionGzip compresses each frame with gzip. This gives the best
+	// compression ratio at a noticeably higher CPU cost.
+	CompressionGzip
+
+	// CompressionSnappy compresses each frame with snappy, which is much
+	// faster than gzip but compresses less.
+	CompressionSnappy
+)
+
+var compressionTypeNames = map[string]CompressionType{
+	"":       CompressionNone,
+	"none":   CompressionNone,
+	"gzip":   CompressionGzip,
+	"snappy": CompressionSnappy,
+}
+
+func compressionTypeForName(name string) (CompressionType, error) {
+	compression, ok := compressionTypeNames[strings.ToLower(name)]
+	if !ok {
+		return CompressionNone, fmt.Errorf(
+			"Unknown disk queue compression type '%v'", name)
+	}
+	return compression, nil
+}
+
+func (c CompressionType) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	}
+	return fmt.Sprintf("CompressionType(%d)", int(c))
+}
+
+// segmentFlag returns the segment header flag that marks a segment as
+// compressed with this algorithm.
+func (c CompressionType) segmentFlag() segmentFlags {
+	switch c {
+	case CompressionGzip:
+		return segmentFlagGzip
+	case CompressionSnappy:
+		return segmentFlagSnappy
+	}
+	return 0
+}
+
+// compressionType returns the algorithm used to compress the frames in a
+// segment with these flags.
+func (flags segmentFlags) compressionType() CompressionType {
+	switch flags & segmentFlagCompressionMask {
+	case segmentFlagGzip:
+		return CompressionGzip
+	case segmentFlagSnappy:
+		return CompressionSnappy
+	}
+	return CompressionNone
+}
+
+// frameCompressor compresses serialized events before they are wrapped
+// in a data frame. Each producer owns its own compressor, so it doesn't
+// need to be safe for concurrent use.
+type frameCompressor struct {
+	compression CompressionType
+
+	buf        bytes.Buffer
+	gzipWriter *gzip.Writer
+}
+
+func newFrameCompressor(
+	compression CompressionType, level int,
+) (*frameCompressor, error) {
+	c := &frameCompressor{compression: compression}
+	if compression == CompressionGzip {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		writer, err := gzip.NewWriterLevel(&c.buf, level)
+		if err != nil {
+			return nil, err
+		}
+		c.gzipWriter = writer
+	}
+	return c, nil
+}
+
+// compress returns the compressed form of data. The result may share
+// memory with data if no compression is configured, otherwise it is a
+// new array owned by the caller.
+func (c *frameCompressor) compress(data []byte) ([]byte, error) {
+	switch c.compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionGzip:
+		c.buf.Reset()
+		c.gzipWriter.Reset(&c.buf)
+		if _, err := c.gzipWriter.Write(data); err != nil {
+			return nil, err
+		}
+		if err := c.gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+		result := make([]byte, c.buf.Len())
+		copy(result, c.buf.Bytes())
+		return result, nil
+	}
+	return nil, fmt.Errorf("Unknown compression type %v", c.compression)
+}
+
+// frameDecompressor reverses frameCompressor based on the flags in the
+// header of the segment being read. It is owned by the reader loop.
+type frameDecompressor struct {
+	buf        bytes.Buffer
+	snappyBuf  []byte
+	gzipReader *gzip.Reader
+}
+
+// decompress returns the uncompressed form of data, as specified by the
+// given segment flags. The result is only valid until the next call.
+func (d *frameDecompressor) decompress(
+	flags segmentFlags, data []byte,
+) ([]byte, error) {
+	switch flags & segmentFlagCompressionMask {
+	case 0:
+		return data, nil
+	case segmentFlagSnappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if cap(d.snappyBuf) < n {
+			d.snappyBuf = make([]byte, n)
+		}
+		return snappy.Decode(d.snappyBuf[:n], data)
+	case segmentFlagGzip:
+		var err error
+		if d.gzipReader == nil {
+			d.gzipReader, err = gzip.NewReader(bytes.NewReader(data))
+		} else {
+			err = d.gzipReader.Reset(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.buf.Reset()
+		if _, err := io.Copy(&d.buf, d.gzipReader); err != nil {
+			return nil, err
+		}
+		return d.buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("Unrecognized compression flags %x", flags)
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"message":"a very repetitive log line"}`), 50)
+	for _, compression := range []CompressionType{
+		CompressionNone, CompressionGzip, CompressionSnappy,
+	} {
+		compressor, err := newFrameCompressor(compression, 0)
+		if err != nil {
+			t.Fatalf("%v: couldn't create compressor: %v", compression, err)
+		}
+		compressed, err := compressor.compress(data)
+		if err != nil {
+			t.Fatalf("%v: couldn't compress frame: %v", compression, err)
+		}
+		if compression != CompressionNone && len(compressed) >= len(data) {
+			t.Errorf("%v: expected compressed size %d to be less than %d",
+				compression, len(compressed), len(data))
+		}
+
+		decompressor := &frameDecompressor{}
+		// Decompress twice to make sure the reused buffers are reset correctly.
+		for i := 0; i < 2; i++ {
+			result, err := decompressor.decompress(
+				compression.segmentFlag(), compressed)
+			if err != nil {
+				t.Fatalf("%v: couldn't decompress frame: %v", compression, err)
+			}
+			if !bytes.Equal(result, data) {
+				t.Errorf("%v: decompressed frame doesn't match the original",
+					compression)
+			}
+		}
+	}
+}
+
+func TestSegmentHeaderVersions(t *testing.T) {
+	// Version 0 headers have no flags and must still be readable.
+	var buf bytes.Buffer
+	err := writeSegmentHeader(&buf, &segmentHeader{version: 0})
+	if err != nil {
+		t.Fatalf("Couldn't write segment header: %v", err)
+	}
+	if buf.Len() != segmentHeaderSizeV0 {
+		t.Errorf("Expected version 0 header size %d, got %d",
+			segmentHeaderSizeV0, buf.Len())
+	}
+	header, err := readSegmentHeader(&buf)
+	if err != nil {
+		t.Fatalf("Couldn't read version 0 segment header: %v", err)
+	}
+	if header.flags != 0 || header.sizeOnDisk() != segmentHeaderSizeV0 {
+		t.Errorf("Unexpected version 0 header %+v", header)
+	}
+
+	buf.Reset()
+	err = writeSegmentHeader(&buf, &segmentHeader{
+		version: currentSegmentVersion,
+		flags:   segmentFlagSnappy,
+	})
+	if err != nil {
+		t.Fatalf("Couldn't write segment header: %v", err)
+	}
+	if buf.Len() != segmentHeaderSize {
+		t.Errorf("Expected header size %d, got %d", segmentHeaderSize, buf.Len())
+	}
+	header, err = readSegmentHeader(&buf)
+	if err != nil {
+		t.Fatalf("Couldn't read segment header: %v", err)
+	}
+	if header.flags != segmentFlagSnappy {
+		t.Errorf("Expected flags %x, got %x", segmentFlagSnappy, header.flags)
+	}
+
+	// Selecting two compression algorithms at once is an error.
+	buf.Reset()
+	writeSegmentHeader(&buf, &segmentHeader{
+		version: currentSegmentVersion,
+		flags:   segmentFlagGzip | segmentFlagSnappy,
+	})
+	if _, err := readSegmentHeader(&buf); err == nil {
+		t.Error("Expected an error reading a header with conflicting flags")
+	}
+}
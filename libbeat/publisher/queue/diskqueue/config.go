@@ -18,12 +18,16 @@
 package diskqueue
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
 	"github.com/elastic/beats/v7/libbeat/paths"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 )
@@ -58,6 +62,38 @@ type Settings struct {
 	// this limit can keep it from overflowing memory.
 	WriteAheadLimit int
 
+	// The format used to serialize events on disk. Like compression, the
+	// format is recorded in each segment's header.
+	Serialization SerializationFormat
+
+	// The algorithm used to compress each data frame before writing it to
+	// disk. The choice is recorded in each segment's header, so changing it
+	// doesn't affect the readability of existing segments.
+	Compression CompressionType
+
+	// The compression level passed to the compression algorithm, if it
+	// supports one. Zero selects the algorithm's default.
+	CompressionLevel int
+
+	// The AES key used to encrypt data frames on disk, which must be 16, 24
+	// or 32 bytes long. If empty, frames are written unencrypted. Segments
+	// record whether they are encrypted in their header, so existing
+	// unencrypted segments remain readable after encryption is enabled;
+	// reading encrypted segments requires the same key they were written with.
+	EncryptionKey []byte
+
+	// What the reader should do when it finds corrupted data in a segment.
+	CorruptionPolicy CorruptionPolicy
+
+	// If set, segments that contained corrupted data are moved to this
+	// directory instead of being deleted once they have been processed, so
+	// they can be analyzed later.
+	QuarantinePath string
+
+	// The registry where the queue reports its metrics. If nil, metrics
+	// are not reported.
+	Metrics *monitoring.Registry
+
 	// A listener that should be sent ACKs when an event is successfully
 	// written to disk.
 	WriteToDiskListener queue.ACKListener
@@ -71,6 +107,47 @@ type userConfig struct {
 	SegmentSize     *cfgtype.ByteSize `config:"segment_size"`
 	ReadAheadLimit  *int              `config:"read_ahead"`
 	WriteAheadLimit *int              `config:"write_ahead"`
+
+	Codec            string `config:"codec"`
+	Compression      string `config:"compression"`
+	CompressionLevel int    `config:"compression_level"`
+
+	// The secret used to derive the segment encryption key. This should be
+	// a reference to the keystore (e.g. "${DISKQUEUE_KEY}") rather than a
+	// literal value.
+	EncryptionKey string `config:"encryption_key"`
+
+	CorruptionPolicy string `config:"corruption_policy"`
+	QuarantinePath   string `config:"quarantine_path"`
+}
+
+// CorruptionPolicy selects how the queue handles segment data that fails
+// validation, such as a checksum mismatch.
+type CorruptionPolicy int
+
+const (
+	// CorruptionFail stops reading a segment at the first invalid frame.
+	// Everything after that frame in the segment is discarded.
+	CorruptionFail CorruptionPolicy = iota
+
+	// CorruptionSkip scans forward from an invalid frame to the next valid
+	// one and resumes reading there, so only the damaged data is lost.
+	CorruptionSkip
+)
+
+var corruptionPolicyNames = map[string]CorruptionPolicy{
+	"":     CorruptionFail,
+	"fail": CorruptionFail,
+	"skip": CorruptionSkip,
+}
+
+func corruptionPolicyForName(name string) (CorruptionPolicy, error) {
+	policy, ok := corruptionPolicyNames[strings.ToLower(name)]
+	if !ok {
+		return CorruptionFail, fmt.Errorf(
+			"Unknown disk queue corruption_policy '%v'", name)
+	}
+	return policy, nil
 }
 
 func (c *userConfig) Validate() error {
@@ -96,6 +173,24 @@ func (c *userConfig) Validate() error {
 			"Disk queue segment_size (%d) cannot be less than 1MB", *c.SegmentSize)
 	}
 
+	if _, err := serializationFormatForName(c.Codec); err != nil {
+		return err
+	}
+	if _, err := corruptionPolicyForName(c.CorruptionPolicy); err != nil {
+		return err
+	}
+
+	compression, err := compressionTypeForName(c.Compression)
+	if err != nil {
+		return err
+	}
+	if compression == CompressionGzip && c.CompressionLevel != 0 &&
+		(c.CompressionLevel < gzip.BestSpeed || c.CompressionLevel > gzip.BestCompression) {
+		return fmt.Errorf(
+			"Disk queue compression_level (%d) must be between %d and %d for gzip",
+			c.CompressionLevel, gzip.BestSpeed, gzip.BestCompression)
+	}
+
 	return nil
 }
 
@@ -129,6 +224,16 @@ func SettingsForUserConfig(config *common.Config) (Settings, error) {
 		// divided by 10.
 		settings.MaxSegmentSize = uint64(userConfig.MaxSize) / 10
 	}
+
+	// The names were already checked in Validate, so these can't fail.
+	settings.Serialization, _ = serializationFormatForName(userConfig.Codec)
+	settings.Compression, _ = compressionTypeForName(userConfig.Compression)
+	settings.CorruptionPolicy, _ = corruptionPolicyForName(userConfig.CorruptionPolicy)
+	settings.QuarantinePath = userConfig.QuarantinePath
+	settings.CompressionLevel = userConfig.CompressionLevel
+	if userConfig.EncryptionKey != "" {
+		settings.EncryptionKey = encryptionKeyFromSecret(userConfig.EncryptionKey)
+	}
 	return settings, nil
 }
 
@@ -143,6 +248,15 @@ func (settings Settings) directoryPath() string {
 	return settings.Path
 }
 
+// quarantinePath returns the path a damaged segment is moved to. Segment
+// IDs can be reused once a queue is empty, so the name includes the time
+// the segment was quarantined.
+func (settings Settings) quarantinePath(segmentID segmentID, t time.Time) string {
+	return filepath.Join(
+		settings.QuarantinePath,
+		fmt.Sprintf("%v-%v.seg", segmentID, t.UTC().Format("20060102T150405")))
+}
+
 func (settings Settings) stateFilePath() string {
 	return filepath.Join(settings.directoryPath(), "state.dat")
 }
@@ -153,6 +267,17 @@ func (settings Settings) segmentPath(segmentID segmentID) string {
 		fmt.Sprintf("%v.seg", segmentID))
 }
 
+// segmentFlags returns the flags that should be recorded in the header of
+// segments created with these settings.
+func (settings Settings) segmentFlags() segmentFlags {
+	flags := settings.Serialization.segmentFlag() |
+		settings.Compression.segmentFlag()
+	if len(settings.EncryptionKey) > 0 {
+		flags |= segmentFlagEncrypted
+	}
+	return flags
+}
+
 func (settings Settings) maxSegmentOffset() segmentOffset {
 	return segmentOffset(settings.MaxSegmentSize - segmentHeaderSize)
 }
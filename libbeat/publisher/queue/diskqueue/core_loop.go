@@ -166,6 +166,9 @@ func (dq *diskQueue) handleReaderLoopResponse(response readerLoopResponse) {
 		segment = dq.segments.writing[0]
 	}
 	segment.framesRead = uint64(dq.segments.nextReadFrameID - segment.firstFrameID)
+	if response.corrupted {
+		segment.corrupted = true
+	}
 
 	// If there was an error, report it.
 	if response.err != nil {
@@ -19,6 +19,7 @@ package diskqueue
 
 import (
 	"errors"
+	"io"
 	"os"
 	"time"
 )
@@ -27,6 +28,9 @@ type deleterLoop struct {
 	// The settings for the queue that created this loop.
 	settings Settings
 
+	// The queue's metrics, used to count quarantined segments.
+	metrics *queueMetrics
+
 	// When one or more segments are ready to delete, they are sent to
 	// requestChan. At most one deleteRequest may be outstanding at any time.
 	requestChan chan deleterLoopRequest
@@ -47,9 +51,10 @@ type deleterLoopResponse struct {
 	results []error
 }
 
-func newDeleterLoop(settings Settings) *deleterLoop {
+func newDeleterLoop(settings Settings, metrics *queueMetrics) *deleterLoop {
 	return &deleterLoop{
 		settings: settings,
+		metrics:  metrics,
 
 		requestChan:  make(chan deleterLoopRequest, 1),
 		responseChan: make(chan deleterLoopResponse),
@@ -66,8 +71,12 @@ func (dl *deleterLoop) run() {
 		results := []error{}
 		deletedCount := 0
 		for _, segment := range request.segments {
-			path := dl.settings.segmentPath(segment.id)
-			err := os.Remove(path)
+			var err error
+			if segment.corrupted && dl.settings.QuarantinePath != "" {
+				err = dl.quarantine(segment)
+			} else {
+				err = os.Remove(dl.settings.segmentPath(segment.id))
+			}
 			// We ignore errors caused by the file not existing: this shouldn't
 			// happen, but it is still safe to report it as successfully removed.
 			if err == nil || errors.Is(err, os.ErrNotExist) {
@@ -97,3 +106,43 @@ func (dl *deleterLoop) run() {
 		}
 	}
 }
+
+// quarantine moves a corrupted segment to the quarantine directory.
+func (dl *deleterLoop) quarantine(segment *queueSegment) error {
+	err := os.MkdirAll(dl.settings.QuarantinePath, 0700)
+	if err != nil {
+		return err
+	}
+	path := dl.settings.segmentPath(segment.id)
+	target := dl.settings.quarantinePath(segment.id, time.Now())
+	err = os.Rename(path, target)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Renaming fails if the quarantine directory is on another device, so
+		// fall back on copying the file.
+		err = copyFile(path, target)
+		if err == nil {
+			err = os.Remove(path)
+		}
+	}
+	if err == nil {
+		dl.metrics.quarantinedSegments.Inc()
+	}
+	return err
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameEncryptor seals and opens data frame payloads with AES-GCM, so
+// events at rest can neither be read nor modified without the key.
+// Each frame is stored as a random nonce followed by the sealed payload.
+type frameEncryptor struct {
+	aead cipher.AEAD
+}
+
+// encryptionKeyFromSecret derives the AES-256 key used for segment
+// encryption from the user-provided secret (usually a reference to a
+// value in the beats keystore).
+func encryptionKeyFromSecret(secret string) []byte {
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+// newFrameEncryptor returns an encryptor for the given AES key, or nil
+// if the key is empty.
+func newFrameEncryptor(key []byte) (*frameEncryptor, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &frameEncryptor{aead: aead}, nil
+}
+
+// encrypt returns the sealed form of data, prefixed with its nonce.
+func (e *frameEncryptor) encrypt(data []byte) ([]byte, error) {
+	nonceSize := e.aead.NonceSize()
+	result := make([]byte, nonceSize, nonceSize+len(data)+e.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, result); err != nil {
+		return nil, fmt.Errorf("couldn't generate nonce: %w", err)
+	}
+	return e.aead.Seal(result, result, data, nil), nil
+}
+
+// decrypt verifies and opens a payload created by encrypt.
+func (e *frameEncryptor) decrypt(data []byte) ([]byte, error) {
+	nonceSize := e.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("encrypted frame is shorter than its nonce")
+	}
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	result, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		// Authentication failures are almost always caused by a changed
+		// encryption key, so mention that in the error.
+		return nil, fmt.Errorf(
+			"frame authentication failed (wrong encryption key?): %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameEncryptionRoundTrip(t *testing.T) {
+	data := []byte(`{"message":"password=hunter2"}`)
+	encryptor, err := newFrameEncryptor(encryptionKeyFromSecret("secret"))
+	if err != nil {
+		t.Fatalf("Couldn't create encryptor: %v", err)
+	}
+	sealed, err := encryptor.encrypt(data)
+	if err != nil {
+		t.Fatalf("Couldn't encrypt frame: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("hunter2")) {
+		t.Error("Encrypted frame contains the plaintext")
+	}
+	result, err := encryptor.decrypt(sealed)
+	if err != nil {
+		t.Fatalf("Couldn't decrypt frame: %v", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Error("Decrypted frame doesn't match the original")
+	}
+
+	// A different key must fail authentication rather than return garbage.
+	other, _ := newFrameEncryptor(encryptionKeyFromSecret("other secret"))
+	if _, err := other.decrypt(sealed); err == nil {
+		t.Error("Expected decryption with the wrong key to fail")
+	}
+
+	// So must a modified payload.
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := encryptor.decrypt(sealed); err == nil {
+		t.Error("Expected decryption of a modified frame to fail")
+	}
+}
+
+func TestFrameEncryptorDisabled(t *testing.T) {
+	encryptor, err := newFrameEncryptor(nil)
+	if err != nil || encryptor != nil {
+		t.Errorf("Expected no encryptor for an empty key, got %v, %v",
+			encryptor, err)
+	}
+	settings := DefaultSettings()
+	if settings.segmentFlags()&segmentFlagEncrypted != 0 {
+		t.Error("Expected default settings to write unencrypted segments")
+	}
+	settings.EncryptionKey = encryptionKeyFromSecret("secret")
+	if settings.segmentFlags()&segmentFlagEncrypted == 0 {
+		t.Error("Expected settings with a key to write encrypted segments")
+	}
+}
@@ -0,0 +1,268 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// This file contains helpers to inspect and repair the files of a disk
+// queue that is not currently running, e.g. from the command line. None of
+// them may be used on a directory that is in use by a live queue.
+
+// SegmentInfo describes a segment file found in a queue directory.
+type SegmentInfo struct {
+	ID   uint64
+	Path string
+
+	// The size of the segment file, including its header.
+	Size uint64
+
+	// The schema version and encoding options from the segment header.
+	Version       uint32
+	Serialization SerializationFormat
+	Compression   CompressionType
+	Encrypted     bool
+}
+
+// QueuePosition is the position of the oldest frame that has not yet been
+// acknowledged, as recorded in the queue's state file.
+type QueuePosition struct {
+	SegmentID uint64
+
+	// The byte offset of the frame within the segment's data region.
+	Offset uint64
+}
+
+// FrameInfo describes a single frame visited by ScanSegment.
+type FrameInfo struct {
+	// The byte offset of the frame within the segment's data region.
+	Offset uint64
+
+	// The size of the frame on disk, including its header and footer.
+	Size uint64
+
+	// The decoded event.
+	Event publisher.Event
+}
+
+// ReadQueuePosition returns the read position stored in the state file
+// of the queue with the given settings.
+func ReadQueuePosition(settings Settings) (QueuePosition, error) {
+	position, err := queuePositionFromPath(settings.stateFilePath())
+	if err != nil {
+		return QueuePosition{}, err
+	}
+	return QueuePosition{
+		SegmentID: uint64(position.segmentID),
+		Offset:    uint64(position.offset),
+	}, nil
+}
+
+// ListSegments returns the segments in the queue directory of the given
+// settings, ordered by ID.
+func ListSegments(settings Settings) ([]SegmentInfo, error) {
+	segments, err := scanExistingSegments(settings.directoryPath())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SegmentInfo, 0, len(segments))
+	for _, segment := range segments {
+		result = append(result, segment.info(settings))
+	}
+	return result, nil
+}
+
+// CountPendingFrames returns the number of frames in the queue directory of
+// the given settings that have not been acknowledged, which is the number of
+// events a queue opened with these settings reads before any new ones. Only
+// the frame headers are read. Counting stops at the first frame with an
+// invalid length in each segment, so the result can be lower than the
+// number of events the queue recovers from a damaged segment.
+func CountPendingFrames(settings Settings) (uint64, error) {
+	segments, err := scanExistingSegments(settings.directoryPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	// Like NewQueue, fall back on the oldest segment if the position
+	// can't be read.
+	position, _ := queuePositionFromPath(settings.stateFilePath())
+
+	var count uint64
+	for _, segment := range segments {
+		if segment.id < position.segmentID {
+			continue
+		}
+		offset := segmentOffset(0)
+		if segment.id == position.segmentID {
+			offset = position.offset
+		}
+		n, err := countFrames(settings, segment, offset)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// countFrames counts the frames in the segment's data region after the
+// given offset.
+func countFrames(
+	settings Settings, segment *queueSegment, offset segmentOffset,
+) (uint64, error) {
+	handle, header, err := segment.getReader(settings)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+	dataStart := int64(header.sizeOnDisk())
+
+	var count uint64
+	var buf [frameHeaderSize]byte
+	for offset+frameHeaderSize <= segment.endOffset {
+		if _, err := handle.ReadAt(buf[:], dataStart+int64(offset)); err != nil {
+			break
+		}
+		frameLength := binary.LittleEndian.Uint32(buf[:])
+		if frameLength <= frameMetadataSize ||
+			uint64(offset)+uint64(frameLength) > uint64(segment.endOffset) {
+			break
+		}
+		count++
+		offset += segmentOffset(frameLength)
+	}
+	return count, nil
+}
+
+// ScanSegment reads every frame in the given segment in order, verifying
+// its checksum and decoding its event, and calls fn on each one. It stops
+// at the first invalid frame or when fn returns an error.
+//
+// The returned offset is the end of the last valid frame, which is where
+// the segment can be truncated to remove a corrupt tail. The returned
+// error is nil if the whole segment was valid.
+func ScanSegment(
+	settings Settings, id uint64, fn func(FrameInfo) error,
+) (uint64, error) {
+	segment := &queueSegment{id: segmentID(id)}
+	handle, header, err := segment.getReader(settings)
+	if err != nil {
+		return 0, err
+	}
+	defer handle.Close()
+
+	stat, err := handle.Stat()
+	if err != nil {
+		return 0, err
+	}
+	dataSize := uint64(stat.Size()) - header.sizeOnDisk()
+
+	// Reuse the reader loop's frame parsing, which handles checksums,
+	// decryption, decompression and decoding.
+	rl := newReaderLoop(logp.NewLogger("diskqueue"), settings, newQueueMetrics(nil))
+	if header.flags&segmentFlagEncrypted != 0 && rl.decryptor == nil {
+		return 0, fmt.Errorf(
+			"Segment %d is encrypted but no encryption key is configured", id)
+	}
+	offset := uint64(0)
+	for offset < dataSize {
+		frame, err := rl.nextFrame(handle, header.flags, dataSize-offset)
+		if err != nil {
+			return offset, fmt.Errorf("frame at offset %d: %w", offset, err)
+		}
+		err = fn(FrameInfo{
+			Offset: offset,
+			Size:   frame.bytesOnDisk,
+			Event:  frame.event,
+		})
+		if err != nil {
+			return offset, err
+		}
+		offset += frame.bytesOnDisk
+	}
+	return offset, nil
+}
+
+// TruncateSegment discards everything in the given segment after the given
+// offset of its data region. Combined with the offset returned by
+// ScanSegment this removes a corrupt tail from a segment, so the queue can
+// read the valid frames before it. If the read position in the state file
+// points past the new end of the segment, it is moved to the new end.
+func TruncateSegment(settings Settings, id uint64, offset uint64) error {
+	segment := &queueSegment{id: segmentID(id)}
+	path := settings.segmentPath(segment.id)
+	header, err := readSegmentHeaderFromPath(path)
+	if err != nil {
+		return fmt.Errorf("Couldn't read segment header: %w", err)
+	}
+	if err := os.Truncate(path, int64(header.sizeOnDisk()+offset)); err != nil {
+		return err
+	}
+	return clampQueuePosition(settings, segment.id, segmentOffset(offset))
+}
+
+// clampQueuePosition moves the read position in the state file to the given
+// end of a truncated segment, if it points past it.
+func clampQueuePosition(settings Settings, id segmentID, end segmentOffset) error {
+	file, err := os.OpenFile(settings.stateFilePath(), os.O_RDWR, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	position, err := queuePositionFromHandle(file)
+	if err != nil {
+		return fmt.Errorf("Couldn't read queue state: %w", err)
+	}
+	if position.segmentID != id || position.offset <= end {
+		return nil
+	}
+	position.offset = end
+	if err := writeQueuePositionToHandle(file, position); err != nil {
+		return fmt.Errorf("Couldn't update queue state: %w", err)
+	}
+	return file.Sync()
+}
+
+func (segment *queueSegment) info(settings Settings) SegmentInfo {
+	info := SegmentInfo{
+		ID:   uint64(segment.id),
+		Path: settings.segmentPath(segment.id),
+		Size: segment.sizeOnDisk(),
+	}
+	if header := segment.header; header != nil {
+		info.Version = header.version
+		info.Serialization = header.flags.serializationFormat()
+		info.Compression = header.flags.compressionType()
+		info.Encrypted = header.flags&segmentFlagEncrypted != 0
+	}
+	return info
+}
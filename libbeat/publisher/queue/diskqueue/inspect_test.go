@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTestQueuePosition(t *testing.T, settings Settings, position queuePosition) {
+	file, err := os.Create(settings.stateFilePath())
+	if err != nil {
+		t.Fatalf("Couldn't create state file: %v", err)
+	}
+	defer file.Close()
+	if err := writeQueuePositionToHandle(file, position); err != nil {
+		t.Fatalf("Couldn't write state file: %v", err)
+	}
+}
+
+func TestListAndScanSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := DefaultSettings()
+	settings.Path = dir
+	messages := []string{"first", "second", "third"}
+	segment, offsets := writeTestSegment(t, settings, messages)
+
+	segments, err := ListSegments(settings)
+	if err != nil {
+		t.Fatalf("Couldn't list segments: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("Expected one segment, got %+v", segments)
+	}
+	info := segments[0]
+	if info.ID != 0 || info.Version != currentSegmentVersion ||
+		info.Serialization != SerializationJSON ||
+		info.Size != uint64(segmentHeaderSize)+uint64(segment.endOffset) {
+		t.Errorf("Unexpected segment info %+v", info)
+	}
+
+	var read []interface{}
+	var readOffsets []uint64
+	end, err := ScanSegment(settings, 0, func(frame FrameInfo) error {
+		message, _ := frame.Event.Content.Fields.GetValue("message")
+		read = append(read, message)
+		readOffsets = append(readOffsets, frame.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected a valid segment, got %v", err)
+	}
+	if end != uint64(segment.endOffset) {
+		t.Errorf("Expected to scan %d bytes, got %d", segment.endOffset, end)
+	}
+	if len(read) != len(messages) {
+		t.Fatalf("Expected %d messages, got %v", len(messages), read)
+	}
+	for i, message := range messages {
+		if read[i] != message || readOffsets[i] != uint64(offsets[i]) {
+			t.Errorf("Expected message %q at offset %d, got %v at %d",
+				message, offsets[i], read[i], readOffsets[i])
+		}
+	}
+}
+
+func TestTruncateSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := DefaultSettings()
+	settings.Path = dir
+	segment, offsets := writeTestSegment(t, settings, []string{"first", "second", "third"})
+	corruptSegment(t, settings, offsets[2]+frameHeaderSize)
+
+	// The state file points past the frames that remain after truncating.
+	writeTestQueuePosition(t, settings,
+		queuePosition{segmentID: 0, offset: segment.endOffset})
+
+	frames := 0
+	end, err := ScanSegment(settings, 0, func(FrameInfo) error {
+		frames++
+		return nil
+	})
+	if err == nil || frames != 2 || end != uint64(offsets[2]) {
+		t.Fatalf("Expected an error after two frames at offset %d, got %d frames, offset %d, error %v",
+			offsets[2], frames, end, err)
+	}
+
+	if err := TruncateSegment(settings, 0, end); err != nil {
+		t.Fatalf("Couldn't truncate segment: %v", err)
+	}
+
+	frames = 0
+	end, err = ScanSegment(settings, 0, func(FrameInfo) error {
+		frames++
+		return nil
+	})
+	if err != nil || frames != 2 || end != uint64(offsets[2]) {
+		t.Errorf("Expected two valid frames after truncating, got %d frames, offset %d, error %v",
+			frames, end, err)
+	}
+
+	position, err := ReadQueuePosition(settings)
+	if err != nil {
+		t.Fatalf("Couldn't read queue position: %v", err)
+	}
+	if position.SegmentID != 0 || position.Offset != uint64(offsets[2]) {
+		t.Errorf("Expected the read position to move to the new end %d, got %+v",
+			offsets[2], position)
+	}
+}
+
+func TestTruncateSegmentKeepsEarlierPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := DefaultSettings()
+	settings.Path = dir
+	_, offsets := writeTestSegment(t, settings, []string{"first", "second", "third"})
+	writeTestQueuePosition(t, settings, queuePosition{segmentID: 0, offset: offsets[1]})
+
+	if err := TruncateSegment(settings, 0, uint64(offsets[2])); err != nil {
+		t.Fatalf("Couldn't truncate segment: %v", err)
+	}
+	position, err := ReadQueuePosition(settings)
+	if err != nil {
+		t.Fatalf("Couldn't read queue position: %v", err)
+	}
+	if position.Offset != uint64(offsets[1]) {
+		t.Errorf("Expected the read position %d to be kept, got %+v", offsets[1], position)
+	}
+}
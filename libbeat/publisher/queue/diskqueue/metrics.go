@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+// queueMetrics holds the monitoring counters reported by the disk queue.
+type queueMetrics struct {
+	// The number of invalid frames the reader loop skipped over while
+	// recovering from corrupted segment data, and the total bytes skipped.
+	skippedFrames *monitoring.Uint
+	skippedBytes  *monitoring.Uint
+
+	// The number of damaged segments moved to the quarantine directory.
+	quarantinedSegments *monitoring.Uint
+}
+
+// defaultMetricsRegistry returns the libbeat.queue.disk registry in the
+// global monitoring namespace, creating it if needed.
+func defaultMetricsRegistry() *monitoring.Registry {
+	return getOrCreateRegistry(
+		getOrCreateRegistry(
+			getOrCreateRegistry(monitoring.Default, "libbeat"),
+			"queue"),
+		"disk")
+}
+
+// newQueueMetrics creates the queue's counters in the given registry. If
+// the registry is nil, the counters are still tracked but not reported.
+// Counters that already exist (e.g. from a previous queue instance) are
+// reused.
+func newQueueMetrics(reg *monitoring.Registry) *queueMetrics {
+	if reg == nil {
+		reg = monitoring.NewRegistry()
+	}
+	return &queueMetrics{
+		skippedFrames:       getOrCreateUint(reg, "skipped.frames"),
+		skippedBytes:        getOrCreateUint(reg, "skipped.bytes"),
+		quarantinedSegments: getOrCreateUint(reg, "quarantined.segments"),
+	}
+}
+
+func getOrCreateRegistry(parent *monitoring.Registry, name string) *monitoring.Registry {
+	if reg := parent.GetRegistry(name); reg != nil {
+		return reg
+	}
+	return parent.NewRegistry(name)
+}
+
+func getOrCreateUint(reg *monitoring.Registry, name string) *monitoring.Uint {
+	if v, ok := reg.Get(name).(*monitoring.Uint); ok {
+		return v
+	}
+	return monitoring.NewUint(reg, name)
+}
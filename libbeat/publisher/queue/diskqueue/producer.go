@@ -31,6 +31,12 @@ type diskQueueProducer struct {
 
 	encoder *eventEncoder
 
+	// Compresses the serialized events according to the queue settings.
+	compressor *frameCompressor
+
+	// Encrypts the compressed events, or nil if encryption is disabled.
+	encryptor *frameEncryptor
+
 	// When a producer is cancelled, cancelled is set to true and the done
 	// channel is closed. (We could get by with just a done channel, but we
 	// need to make sure that calling Cancel repeatedly doesn't close an
@@ -70,6 +76,20 @@ func (producer *diskQueueProducer) publish(
 			"Couldn't serialize incoming event: %v", err)
 		return false
 	}
+	serialized, err = producer.compressor.compress(serialized)
+	if err != nil {
+		producer.queue.logger.Errorf(
+			"Couldn't compress incoming event: %v", err)
+		return false
+	}
+	if producer.encryptor != nil {
+		serialized, err = producer.encryptor.encrypt(serialized)
+		if err != nil {
+			producer.queue.logger.Errorf(
+				"Couldn't encrypt incoming event: %v", err)
+			return false
+		}
+	}
 	request := producerWriteRequest{
 		frame: &writeFrame{
 			serialized: serialized,
@@ -42,6 +42,9 @@ type diskQueue struct {
 	// frame.
 	acks *diskQueueACKs
 
+	// The counters reported to the monitoring registry.
+	metrics *queueMetrics
+
 	// The queue's helper loops, each of which is run in its own goroutine.
 	readerLoop  *readerLoop
 	writerLoop  *writerLoop
@@ -101,6 +104,7 @@ func queueFactory(
 		return nil, fmt.Errorf("disk queue couldn't load user config: %w", err)
 	}
 	settings.WriteToDiskListener = ackListener
+	settings.Metrics = defaultMetricsRegistry()
 	return NewQueue(logger, settings)
 }
 
@@ -119,6 +123,16 @@ func NewQueue(logger *logp.Logger, settings Settings) (queue.Queue, error) {
 			settings.MaxBufferSize, settings.MaxSegmentSize)
 	}
 
+	// Make sure the compression and encryption settings are usable before we
+	// create any producers or helper loops, since they can't report an error.
+	if _, err := newFrameCompressor(
+		settings.Compression, settings.CompressionLevel); err != nil {
+		return nil, fmt.Errorf("invalid disk queue compression settings: %w", err)
+	}
+	if _, err := newFrameEncryptor(settings.EncryptionKey); err != nil {
+		return nil, fmt.Errorf("invalid disk queue encryption key: %w", err)
+	}
+
 	// Create the given directory path if it doesn't exist.
 	err := os.MkdirAll(settings.directoryPath(), os.ModePerm)
 	if err != nil {
@@ -172,9 +186,11 @@ func NewQueue(logger *logp.Logger, settings Settings) (queue.Queue, error) {
 		nextReadPosition = queuePosition{segmentID: initialSegments[0].id}
 	}
 
+	metrics := newQueueMetrics(settings.Metrics)
 	queue := &diskQueue{
 		logger:   logger,
 		settings: settings,
+		metrics:  metrics,
 
 		segments: diskQueueSegments{
 			reading:        initialSegments,
@@ -184,9 +200,9 @@ func NewQueue(logger *logp.Logger, settings Settings) (queue.Queue, error) {
 
 		acks: newDiskQueueACKs(logger, nextReadPosition, positionFile),
 
-		readerLoop:  newReaderLoop(settings),
+		readerLoop:  newReaderLoop(logger, settings, metrics),
 		writerLoop:  newWriterLoop(logger, settings),
-		deleterLoop: newDeleterLoop(settings),
+		deleterLoop: newDeleterLoop(settings, metrics),
 
 		producerWriteRequestChan: make(chan producerWriteRequest),
 
@@ -236,11 +252,17 @@ func (dq *diskQueue) BufferConfig() queue.BufferConfig {
 }
 
 func (dq *diskQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	// These settings were checked in NewQueue, so this can't fail.
+	compressor, _ := newFrameCompressor(
+		dq.settings.Compression, dq.settings.CompressionLevel)
+	encryptor, _ := newFrameEncryptor(dq.settings.EncryptionKey)
 	return &diskQueueProducer{
-		queue:   dq,
-		config:  cfg,
-		encoder: newEventEncoder(),
-		done:    make(chan struct{}),
+		queue:      dq,
+		config:     cfg,
+		encoder:    newEventEncoder(dq.settings.Serialization),
+		compressor: compressor,
+		encryptor:  encryptor,
+		done:       make(chan struct{}),
 	}
 }
 
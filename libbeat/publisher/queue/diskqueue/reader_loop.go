@@ -20,7 +20,10 @@ package diskqueue
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
 )
 
 type readerLoopRequest struct {
@@ -35,8 +38,13 @@ type readerLoopResponse struct {
 	frameCount uint64
 
 	// The number of bytes successfully read from the requested segment file.
+	// This includes any corrupted data that was skipped.
 	byteCount uint64
 
+	// corrupted is true if corrupted data was found and skipped while
+	// processing the request.
+	corrupted bool
+
 	// If there was an error in the segment file (i.e. inconsistent data), the
 	// err field is set.
 	err error
@@ -46,6 +54,12 @@ type readerLoop struct {
 	// The settings for the queue that created this loop.
 	settings Settings
 
+	// The logger for the reader loop, assigned when the queue creates it.
+	logger *logp.Logger
+
+	// The queue's metrics, used to report corrupted data.
+	metrics *queueMetrics
+
 	// When there is a block available for reading, it will be sent to
 	// requestChan. When the reader loop has finished processing it, it
 	// sends the result to finishedReading. If there is more than one block
@@ -63,16 +77,32 @@ type readerLoop struct {
 	// The helper object to deserialize binary blobs from the queue into
 	// publisher.Event objects that can be returned in a readFrame.
 	decoder *eventDecoder
+
+	// The helper object to decompress frames from segments whose header
+	// specifies a compression algorithm.
+	decompressor *frameDecompressor
+
+	// The helper object to decrypt frames from encrypted segments, or nil
+	// if no encryption key is configured.
+	decryptor *frameEncryptor
 }
 
-func newReaderLoop(settings Settings) *readerLoop {
+func newReaderLoop(
+	logger *logp.Logger, settings Settings, metrics *queueMetrics,
+) *readerLoop {
+	// The key was checked in NewQueue, so this can't fail.
+	decryptor, _ := newFrameEncryptor(settings.EncryptionKey)
 	return &readerLoop{
 		settings: settings,
+		logger:   logger,
+		metrics:  metrics,
 
 		requestChan:  make(chan readerLoopRequest, 1),
 		responseChan: make(chan readerLoopResponse),
 		output:       make(chan *readFrame, settings.ReadAheadLimit),
 		decoder:      newEventDecoder(),
+		decompressor: &frameDecompressor{},
+		decryptor:    decryptor,
 	}
 }
 
@@ -95,28 +125,68 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 	nextFrameID := request.startFrameID
 
 	// Open the file and seek to the starting position.
-	handle, err := request.segment.getReader(rl.settings)
+	handle, header, err := request.segment.getReader(rl.settings)
 	if err != nil {
 		return readerLoopResponse{err: err}
 	}
 	defer handle.Close()
-	_, err = handle.Seek(segmentHeaderSize+int64(request.startOffset), 0)
+	if header.flags&segmentFlagEncrypted != 0 && rl.decryptor == nil {
+		return readerLoopResponse{err: fmt.Errorf(
+			"Segment %d is encrypted but no encryption key is configured",
+			request.segment.id)}
+	}
+	_, err = handle.Seek(
+		int64(header.sizeOnDisk())+int64(request.startOffset), 0)
 	if err != nil {
 		return readerLoopResponse{err: err}
 	}
 
 	targetLength := uint64(request.endOffset - request.startOffset)
+	// Corrupted data that was skipped since the last frame we read. Its size
+	// is added to the next valid frame's size on disk, so that consumer ACKs
+	// still advance the queue position past it.
+	skippedLength := uint64(0)
+	corrupted := false
 	for {
-		remainingLength := targetLength - byteCount
+		remainingLength := targetLength - byteCount - skippedLength
 
 		// Try to read the next frame, clipping to the given bound.
 		// If the next frame extends past this boundary, nextFrame will return
 		// an error.
-		frame, err := rl.nextFrame(handle, remainingLength)
+		frame, err := rl.nextFrame(handle, header.flags, remainingLength)
+		if err != nil && rl.settings.CorruptionPolicy == CorruptionSkip {
+			// Resume at the next valid frame, if there is one, otherwise skip
+			// to the end of the requested region.
+			frameStart := request.startOffset +
+				segmentOffset(byteCount+skippedLength)
+			nextOffset := findNextFrame(
+				handle, header, frameStart+1, request.endOffset)
+			rl.logger.Warnf(
+				"Skipping %d bytes of corrupted data in segment %d at offset %d: %v",
+				nextOffset-frameStart, request.segment.id, frameStart, err)
+			rl.metrics.skippedFrames.Inc()
+			rl.metrics.skippedBytes.Add(uint64(nextOffset - frameStart))
+			skippedLength += uint64(nextOffset - frameStart)
+			corrupted = true
+
+			if byteCount+skippedLength >= targetLength {
+				return readerLoopResponse{
+					frameCount: frameCount,
+					byteCount:  byteCount + skippedLength,
+					corrupted:  corrupted,
+				}
+			}
+			_, err = handle.Seek(
+				int64(header.sizeOnDisk())+int64(nextOffset), io.SeekStart)
+			if err == nil {
+				continue
+			}
+		}
 		if frame != nil {
 			// Add the segment / frame ID, which nextFrame leaves blank.
 			frame.segment = request.segment
 			frame.id = nextFrameID
+			frame.bytesOnDisk += skippedLength
 			nextFrameID++
 			// We've read the frame, try sending it to the output channel.
 			select {
@@ -124,6 +194,7 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 				// Successfully sent! Increment the total for this request.
 				frameCount++
 				byteCount += frame.bytesOnDisk
+				skippedLength = 0
 			case <-rl.requestChan:
 				// Since we haven't sent a finishedReading message yet, we can only
 				// reach this case when the nextReadBlock channel is closed, indicating
@@ -131,6 +202,7 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 				return readerLoopResponse{
 					frameCount: frameCount,
 					byteCount:  byteCount,
+					corrupted:  corrupted,
 					err:        nil,
 				}
 			}
@@ -144,6 +216,7 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 			return readerLoopResponse{
 				frameCount: frameCount,
 				byteCount:  byteCount,
+				corrupted:  corrupted || err != nil,
 				err:        err,
 			}
 		}
@@ -156,6 +229,7 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 			return readerLoopResponse{
 				frameCount: frameCount,
 				byteCount:  byteCount,
+				corrupted:  corrupted,
 				err:        nil,
 			}
 		default:
@@ -163,11 +237,78 @@ func (rl *readerLoop) processRequest(request readerLoopRequest) readerLoopRespon
 	}
 }
 
+// findNextFrame scans the data region of a segment, from offset start up
+// to end, for the beginning of a frame whose header, footer and checksum
+// are consistent. It returns the offset of that frame, or end if there is
+// none. It doesn't change the read position of the file handle.
+func findNextFrame(
+	handle *os.File, header *segmentHeader, start, end segmentOffset,
+) segmentOffset {
+	const windowSize = 64 * 1024
+	window := make([]byte, windowSize)
+	dataStart := int64(header.sizeOnDisk())
+
+	for windowStart := start; windowStart+frameHeaderSize <= end; {
+		length := uint64(end - windowStart)
+		if length > windowSize {
+			length = windowSize
+		}
+		n, _ := handle.ReadAt(window[:length], dataStart+int64(windowStart))
+		if n < frameHeaderSize {
+			// We can't read any further, give up on this segment.
+			return end
+		}
+		// Every offset in the window is a candidate for a frame header.
+		for i := 0; i+frameHeaderSize <= n; i++ {
+			offset := windowStart + segmentOffset(i)
+			frameLength := binary.LittleEndian.Uint32(window[i:])
+			if validFrameAt(handle, dataStart, offset, frameLength, end) {
+				return offset
+			}
+		}
+		// Advance to the first candidate we haven't checked yet.
+		windowStart += segmentOffset(n - frameHeaderSize + 1)
+	}
+	return end
+}
+
+// validFrameAt returns true if there is a complete, valid data frame of the
+// given length at the given offset.
+func validFrameAt(
+	handle *os.File,
+	dataStart int64,
+	offset segmentOffset,
+	frameLength uint32,
+	end segmentOffset,
+) bool {
+	if frameLength <= frameMetadataSize ||
+		uint64(offset)+uint64(frameLength) > uint64(end) {
+		return false
+	}
+	frameStart := dataStart + int64(offset)
+
+	// Check the duplicate length in the footer before the checksum, since
+	// it's much cheaper and rules out almost every false candidate.
+	var footer [frameFooterSize]byte
+	_, err := handle.ReadAt(
+		footer[:], frameStart+int64(frameLength)-frameFooterSize)
+	if err != nil || binary.LittleEndian.Uint32(footer[4:]) != frameLength {
+		return false
+	}
+	data := make([]byte, frameLength-frameMetadataSize)
+	_, err = handle.ReadAt(data, frameStart+frameHeaderSize)
+	if err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(footer[:4]) == computeChecksum(data)
+}
+
 // nextFrame reads and decodes one frame from the given file handle, as long
-// it does not exceed the given length bound. The returned frame leaves the
+// it does not exceed the given length bound. The segment flags determine
+// how the frame contents are decrypted, decompressed and decoded. The returned frame leaves the
 // segment and frame IDs unset.
 func (rl *readerLoop) nextFrame(
-	handle *os.File, maxLength uint64,
+	handle *os.File, flags segmentFlags, maxLength uint64,
 ) (*readFrame, error) {
 	// Ensure we are allowed to read the frame header.
 	if maxLength < frameHeaderSize {
@@ -227,7 +368,21 @@ func (rl *readerLoop) nextFrame(
 			frameLength, duplicateLength)
 	}
 
-	event, err := rl.decoder.Decode()
+	// The checksum covers the data as it was written to disk, so we only
+	// decrypt and decompress it after verifying the frame.
+	data := bytes
+	if flags&segmentFlagEncrypted != 0 {
+		data, err = rl.decryptor.decrypt(data)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't decrypt data frame: %w", err)
+		}
+	}
+	data, err = rl.decompressor.decompress(flags, data)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't decompress data frame: %w", err)
+	}
+
+	event, err := rl.decoder.Decode(flags.serializationFormat(), data)
 	if err != nil {
 		// Unlike errors in the segment or frame metadata, this is entirely
 		// a problem in the event [de]serialization which may be isolated (i.e.
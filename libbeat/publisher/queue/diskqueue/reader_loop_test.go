@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// writeTestSegment writes a segment containing one frame per message and
+// returns the segment and the offset of each frame.
+func writeTestSegment(
+	t *testing.T, settings Settings, messages []string,
+) (*queueSegment, []segmentOffset) {
+	var buf bytes.Buffer
+	writeSegmentHeader(&buf, &segmentHeader{version: currentSegmentVersion})
+	encoder := newEventEncoder(SerializationJSON)
+	offsets := []segmentOffset{}
+	for _, message := range messages {
+		offsets = append(offsets, segmentOffset(buf.Len()-segmentHeaderSize))
+		data, err := encoder.encode(&publisher.Event{Content: beat.Event{
+			Fields: common.MapStr{"message": message},
+		}})
+		if err != nil {
+			t.Fatalf("Couldn't encode event: %v", err)
+		}
+		frameLength := uint32(len(data) + frameMetadataSize)
+		binary.Write(&buf, binary.LittleEndian, frameLength)
+		buf.Write(data)
+		binary.Write(&buf, binary.LittleEndian, computeChecksum(data))
+		binary.Write(&buf, binary.LittleEndian, frameLength)
+	}
+	segment := &queueSegment{
+		id:        0,
+		endOffset: segmentOffset(buf.Len() - segmentHeaderSize),
+	}
+	err := ioutil.WriteFile(settings.segmentPath(segment.id), buf.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("Couldn't write segment: %v", err)
+	}
+	return segment, offsets
+}
+
+// corruptSegment flips a byte in the given segment file at the given
+// offset of its data region.
+func corruptSegment(t *testing.T, settings Settings, offset segmentOffset) {
+	path := settings.segmentPath(0)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Couldn't read segment: %v", err)
+	}
+	data[segmentHeaderSize+int(offset)] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Couldn't write segment: %v", err)
+	}
+}
+
+func readMessages(rl *readerLoop, count uint64) []interface{} {
+	messages := []interface{}{}
+	for i := uint64(0); i < count; i++ {
+		frame := <-rl.output
+		message, _ := frame.event.Content.Fields.GetValue("message")
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func TestReaderLoopCorruptionPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settings := DefaultSettings()
+	settings.Path = dir
+	messages := []string{"first", "second", "third"}
+
+	// With the default policy, reading stops at the corrupted frame.
+	segment, offsets := writeTestSegment(t, settings, messages)
+	corruptSegment(t, settings, offsets[1]+frameHeaderSize)
+	rl := newReaderLoop(logp.NewLogger("test"), settings, newQueueMetrics(nil))
+	response := rl.processRequest(readerLoopRequest{
+		segment: segment, endOffset: segment.endOffset})
+	if response.err == nil || response.frameCount != 1 || !response.corrupted {
+		t.Errorf("Expected an error after one frame, got %+v", response)
+	}
+	readMessages(rl, response.frameCount)
+
+	// With the skip policy, only the corrupted frame is lost, and its size
+	// is included in the size of the frame after it.
+	settings.CorruptionPolicy = CorruptionSkip
+	reg := monitoring.NewRegistry()
+	metrics := newQueueMetrics(reg)
+	rl = newReaderLoop(logp.NewLogger("test"), settings, metrics)
+	response = rl.processRequest(readerLoopRequest{
+		segment: segment, endOffset: segment.endOffset})
+	if response.err != nil {
+		t.Fatalf("Expected no error with the skip policy, got %v", response.err)
+	}
+	if response.frameCount != 2 || !response.corrupted ||
+		response.byteCount != uint64(segment.endOffset) {
+		t.Errorf("Expected to read two frames and the whole segment, got %+v",
+			response)
+	}
+	read := readMessages(rl, response.frameCount)
+	if read[0] != "first" || read[1] != "third" {
+		t.Errorf("Expected the first and third messages, got %v", read)
+	}
+	expectedSkipped := uint64(offsets[2] - offsets[1])
+	if metrics.skippedFrames.Get() != 1 ||
+		metrics.skippedBytes.Get() != expectedSkipped {
+		t.Errorf("Expected 1 skipped frame and %d bytes, got %d and %d",
+			expectedSkipped, metrics.skippedFrames.Get(), metrics.skippedBytes.Get())
+	}
+
+	// A corrupted final frame skips to the end of the segment.
+	segment, offsets = writeTestSegment(t, settings, messages)
+	corruptSegment(t, settings, offsets[2]+frameHeaderSize)
+	response = rl.processRequest(readerLoopRequest{
+		segment: segment, endOffset: segment.endOffset})
+	if response.err != nil || response.frameCount != 2 ||
+		response.byteCount != uint64(segment.endOffset) {
+		t.Errorf("Expected to read two frames and the whole segment, got %+v",
+			response)
+	}
+}
@@ -20,8 +20,10 @@ package diskqueue
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -94,9 +96,14 @@ type queueSegment struct {
 	// The byte offset of the end of the segment's data region. This is
 	// updated when the segment is written to, and should always correspond
 	// to the end of a complete data frame. The total size of a segment file
-	// on disk is segmentHeaderSize + segment.endOffset.
+	// on disk is segment.headerSize() + segment.endOffset.
 	endOffset segmentOffset
 
+	// The header of the segment file, if it was loaded from disk on startup.
+	// Segments created during this session have a nil header, and are always
+	// written with the current schema version and the queue's own settings.
+	header *segmentHeader
+
 	// The ID of the first frame that was / will be read from this segment.
 	// This field is only valid after a read request has been sent for
 	// this segment. (Currently it is only used to handle consumer ACKs,
@@ -110,14 +117,64 @@ type queueSegment struct {
 	//
 	// Used to count how many frames still need to be acknowledged by consumers.
 	framesRead uint64
+
+	// corrupted is set by the core loop when the reader loop finds invalid
+	// data in this segment. Corrupted segments are moved to the quarantine
+	// directory, if there is one, instead of being deleted.
+	corrupted bool
 }
 
 type segmentHeader struct {
+	// The schema version of the segment file.
 	version uint32
+
+	// The options that apply to every frame in the segment. Only present
+	// in schema version 1 and later.
+	flags segmentFlags
 }
 
-// Segment headers are currently just a 32-bit version.
-const segmentHeaderSize = 4
+// segmentFlags is a bitmask recording how the frames in a segment were
+// encoded, so that segments written with different settings (e.g. before
+// and after a configuration change) can still be read.
+type segmentFlags uint32
+
+const (
+	// Frame payloads are compressed with gzip.
+	segmentFlagGzip segmentFlags = 1 << iota
+
+	// Frame payloads are compressed with snappy.
+	segmentFlagSnappy
+
+	// Frame payloads are encrypted with AES-GCM, after compression.
+	segmentFlagEncrypted
+
+	// Events are serialized as CBOR rather than JSON.
+	segmentFlagCBOR
+
+	// Events are serialized as UBJSON rather than JSON.
+	segmentFlagUBJSON
+)
+
+// The mask of all flags that select a compression algorithm. At most
+// one of them may be set.
+const segmentFlagCompressionMask = segmentFlagGzip | segmentFlagSnappy
+
+// The mask of all flags that select a serialization format. At most one
+// of them may be set; if none are, the events are serialized as JSON.
+const segmentFlagSerializationMask = segmentFlagCBOR | segmentFlagUBJSON
+
+// The mask of all flags understood by this version of the queue.
+const segmentFlagKnownMask = segmentFlagCompressionMask |
+	segmentFlagEncrypted | segmentFlagSerializationMask
+
+// The schema version written in the header of new segments.
+const currentSegmentVersion = 1
+
+// Segment headers are a 32-bit version followed by 32 bits of flags.
+const segmentHeaderSize = 8
+
+// Segment headers in schema version 0 are just a 32-bit version.
+const segmentHeaderSizeV0 = 4
 
 // Sort order: we store loaded segments in ascending order by their id.
 type bySegmentID []*queueSegment
@@ -136,7 +193,7 @@ func scanExistingSegments(path string) ([]*queueSegment, error) {
 
 	segments := []*queueSegment{}
 	for _, file := range files {
-		if file.Size() <= segmentHeaderSize {
+		if file.Size() <= segmentHeaderSizeV0 {
 			// Ignore segments that don't have at least some data beyond the
 			// header (this will always be true of segments we write unless there
 			// is an error).
@@ -147,11 +204,19 @@ func scanExistingSegments(path string) ([]*queueSegment, error) {
 			// Parse the id as base-10 64-bit unsigned int. We ignore file names that
 			// don't match the "[uint64].seg" pattern.
 			if id, err := strconv.ParseUint(components[0], 10, 64); err == nil {
-				segments = append(segments,
-					&queueSegment{
-						id:        segmentID(id),
-						endOffset: segmentOffset(file.Size() - segmentHeaderSize),
-					})
+				// The header size depends on the schema version, so we need to
+				// read it before we know where the data region ends. If the header
+				// is invalid we still include the segment, and the error will be
+				// reported when the reader loop tries to open it.
+				header, _ := readSegmentHeaderFromPath(
+					filepath.Join(path, file.Name()))
+				segment := &queueSegment{id: segmentID(id), header: header}
+				if uint64(file.Size()) <= segment.headerSize() {
+					continue
+				}
+				segment.endOffset =
+					segmentOffset(uint64(file.Size()) - segment.headerSize())
+				segments = append(segments, segment)
 			}
 		}
 	}
@@ -160,28 +225,43 @@ func scanExistingSegments(path string) ([]*queueSegment, error) {
 }
 
 func (segment *queueSegment) sizeOnDisk() uint64 {
-	return uint64(segment.endOffset) + segmentHeaderSize
+	return uint64(segment.endOffset) + segment.headerSize()
 }
 
-// Should only be called from the reader loop.
+// headerSize returns the size of the segment's header on disk, which
+// depends on the schema version it was written with.
+func (segment *queueSegment) headerSize() uint64 {
+	if segment.header != nil {
+		return segment.header.sizeOnDisk()
+	}
+	return segmentHeaderSize
+}
+
+func (header *segmentHeader) sizeOnDisk() uint64 {
+	if header.version == 0 {
+		return segmentHeaderSizeV0
+	}
+	return segmentHeaderSize
+}
+
+// Should only be called from the reader loop. The returned file handle
+// is positioned at the start of the segment's data region.
 func (segment *queueSegment) getReader(
 	queueSettings Settings,
-) (*os.File, error) {
+) (*os.File, *segmentHeader, error) {
 	path := queueSettings.segmentPath(segment.id)
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"Couldn't open segment %d: %w", segment.id, err)
 	}
-	// Right now there is only one valid header (indicating schema version
-	// zero) so we don't need the value itself.
-	_, err = readSegmentHeader(file)
+	header, err := readSegmentHeader(file)
 	if err != nil {
 		file.Close()
-		return nil, fmt.Errorf("Couldn't read segment header: %w", err)
+		return nil, nil, fmt.Errorf("Couldn't read segment header: %w", err)
 	}
 
-	return file, nil
+	return file, header, nil
 }
 
 // Should only be called from the writer loop.
@@ -193,7 +273,10 @@ func (segment *queueSegment) getWriter(
 	if err != nil {
 		return nil, err
 	}
-	header := &segmentHeader{version: 0}
+	header := &segmentHeader{
+		version: currentSegmentVersion,
+		flags:   queueSettings.segmentFlags(),
+	}
 	err = writeSegmentHeader(file, header)
 	if err != nil {
 		return nil, fmt.Errorf("Couldn't write segment header: %w", err)
@@ -217,23 +300,63 @@ func (segment *queueSegment) getWriterWithRetry(
 	return file, err
 }
 
-func readSegmentHeader(in *os.File) (*segmentHeader, error) {
+func readSegmentHeaderFromPath(path string) (*segmentHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readSegmentHeader(file)
+}
+
+func readSegmentHeader(in io.Reader) (*segmentHeader, error) {
 	header := &segmentHeader{}
 	err := binary.Read(in, binary.LittleEndian, &header.version)
 	if err != nil {
 		return nil, err
 	}
-	if header.version != 0 {
+	if header.version > currentSegmentVersion {
 		return nil, fmt.Errorf("Unrecognized schema version %d", header.version)
 	}
+	if header.version >= 1 {
+		err = binary.Read(in, binary.LittleEndian, &header.flags)
+		if err != nil {
+			return nil, err
+		}
+		if err := header.flags.validate(); err != nil {
+			return nil, err
+		}
+	}
 	return header, nil
 }
 
-func writeSegmentHeader(out *os.File, header *segmentHeader) error {
+func writeSegmentHeader(out io.Writer, header *segmentHeader) error {
 	err := binary.Write(out, binary.LittleEndian, header.version)
+	if err == nil && header.version >= 1 {
+		err = binary.Write(out, binary.LittleEndian, header.flags)
+	}
 	return err
 }
 
+// validate returns an error if the flags describe an encoding this
+// version of the queue can't read.
+func (flags segmentFlags) validate() error {
+	compression := flags & segmentFlagCompressionMask
+	if compression&(compression-1) != 0 {
+		return fmt.Errorf(
+			"Segment flags (%x) specify more than one compression type", flags)
+	}
+	serialization := flags & segmentFlagSerializationMask
+	if serialization&(serialization-1) != 0 {
+		return fmt.Errorf(
+			"Segment flags (%x) specify more than one serialization format", flags)
+	}
+	if unknown := flags &^ segmentFlagKnownMask; unknown != 0 {
+		return fmt.Errorf("Unrecognized segment flags %x", unknown)
+	}
+	return nil
+}
+
 // The number of bytes occupied by all the queue's segment files. This
 // should only be called from the core loop.
 func (segments *diskQueueSegments) sizeOnDisk() uint64 {
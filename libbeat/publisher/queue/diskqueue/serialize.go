@@ -22,25 +22,57 @@ package diskqueue
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
 	"github.com/elastic/go-structform/gotype"
 	"github.com/elastic/go-structform/json"
+	"github.com/elastic/go-structform/ubjson"
 )
 
+// SerializationFormat selects the encoding used to write events to disk.
+type SerializationFormat int
+
+const (
+	// SerializationJSON encodes events as JSON. This is the default, and
+	// the only format understood by segments with schema version 0.
+	SerializationJSON SerializationFormat = iota
+
+	// SerializationCBOR encodes events as CBOR, which is more compact than
+	// JSON and much faster to decode.
+	SerializationCBOR
+
+	// SerializationUBJSON encodes events as Universal Binary JSON.
+	SerializationUBJSON
+)
+
+var serializationFormatNames = map[string]SerializationFormat{
+	"":       SerializationJSON,
+	"json":   SerializationJSON,
+	"cbor":   SerializationCBOR,
+	"ubjson": SerializationUBJSON,
+}
+
 type eventEncoder struct {
 	buf    bytes.Buffer
 	folder *gotype.Iterator
+	format SerializationFormat
 }
 
 type eventDecoder struct {
 	buf []byte
 
-	parser   *json.Parser
+	json     *json.Parser
+	cborl    *cborl.Parser
+	ubjson   *ubjson.Parser
 	unfolder *gotype.Unfolder
 }
 
@@ -49,6 +81,20 @@ type entry struct {
 	Flags     uint8
 	Meta      common.MapStr
 	Fields    common.MapStr
+
+	// Times lists the time values nested in Meta and Fields. It is only
+	// written by the binary formats, see collectTimes.
+	Times []timeEntry `struct:",omitempty"`
+}
+
+// timeEntry records the position and type of a time value nested in an
+// event. The value itself is encoded as an RFC3339 string in place.
+type timeEntry struct {
+	// Path holds "meta" or "fields", followed by the map keys and array
+	// indices leading to the value.
+	Path     []string
+	Common   bool
+	Location string
 }
 
 const (
@@ -56,8 +102,53 @@ const (
 	flagGuaranteed uint8 = 1 << 0
 )
 
-func newEventEncoder() *eventEncoder {
-	e := &eventEncoder{}
+func serializationFormatForName(name string) (SerializationFormat, error) {
+	format, ok := serializationFormatNames[strings.ToLower(name)]
+	if !ok {
+		return SerializationJSON, fmt.Errorf(
+			"Unknown disk queue codec '%v'", name)
+	}
+	return format, nil
+}
+
+func (f SerializationFormat) String() string {
+	switch f {
+	case SerializationJSON:
+		return "json"
+	case SerializationCBOR:
+		return "cbor"
+	case SerializationUBJSON:
+		return "ubjson"
+	}
+	return fmt.Sprintf("SerializationFormat(%d)", int(f))
+}
+
+// segmentFlag returns the segment header flag that marks a segment as
+// serialized in this format.
+func (f SerializationFormat) segmentFlag() segmentFlags {
+	switch f {
+	case SerializationCBOR:
+		return segmentFlagCBOR
+	case SerializationUBJSON:
+		return segmentFlagUBJSON
+	}
+	return 0
+}
+
+// serializationFormat returns the format of the events in a segment with
+// these flags.
+func (flags segmentFlags) serializationFormat() SerializationFormat {
+	switch flags & segmentFlagSerializationMask {
+	case segmentFlagCBOR:
+		return SerializationCBOR
+	case segmentFlagUBJSON:
+		return SerializationUBJSON
+	}
+	return SerializationJSON
+}
+
+func newEventEncoder(format SerializationFormat) *eventEncoder {
+	e := &eventEncoder{format: format}
 	e.reset()
 	return e
 }
@@ -65,17 +156,30 @@ func newEventEncoder() *eventEncoder {
 func (e *eventEncoder) reset() {
 	e.folder = nil
 
-	visitor := json.NewVisitor(&e.buf)
+	var visitor structform.Visitor
+	switch e.format {
+	case SerializationCBOR:
+		visitor = cborl.NewVisitor(&e.buf)
+	case SerializationUBJSON:
+		visitor = ubjson.NewVisitor(&e.buf)
+	default:
+		visitor = json.NewVisitor(&e.buf)
+	}
+	// JSON keeps the RFC3339 strings used by segments with schema version 0.
+	// The binary formats encode time values natively, see encodeTime.
+	timeFolders := gotype.Folders(
+		codec.MakeTimestampEncoder(),
+		codec.MakeBCTimestampEncoder(),
+	)
+	if e.format != SerializationJSON {
+		timeFolders = gotype.Folders(foldTime, foldCommonTime)
+	}
+
 	// This can't return an error: NewIterator is deterministic based on its
 	// input, and doesn't return an error when called with valid options. In
 	// this case the options are hard-coded to fixed values, so they are
 	// guaranteed to be valid and we can safely proceed.
-	folder, _ := gotype.NewIterator(visitor,
-		gotype.Folders(
-			codec.MakeTimestampEncoder(),
-			codec.MakeBCTimestampEncoder(),
-		),
-	)
+	folder, _ := gotype.NewIterator(visitor, timeFolders)
 
 	e.folder = folder
 }
@@ -83,11 +187,18 @@ func (e *eventEncoder) reset() {
 func (e *eventEncoder) encode(event *publisher.Event) ([]byte, error) {
 	e.buf.Reset()
 
+	var times []timeEntry
+	if e.format != SerializationJSON {
+		times = collectTimes(times, []string{"meta"}, event.Content.Meta)
+		times = collectTimes(times, []string{"fields"}, event.Content.Fields)
+	}
+
 	err := e.folder.Fold(entry{
 		Timestamp: event.Content.Timestamp.UTC().UnixNano(),
 		Flags:     uint8(event.Flags),
 		Meta:      event.Content.Meta,
 		Fields:    event.Content.Fields,
+		Times:     times,
 	})
 	if err != nil {
 		e.reset()
@@ -114,7 +225,9 @@ func (d *eventDecoder) reset() {
 	unfolder, _ := gotype.NewUnfolder(nil)
 
 	d.unfolder = unfolder
-	d.parser = json.NewParser(unfolder)
+	d.json = json.NewParser(unfolder)
+	d.cborl = cborl.NewParser(unfolder)
+	d.ubjson = ubjson.NewParser(unfolder)
 }
 
 // Buffer prepares the read buffer to hold the next event of n bytes.
@@ -127,7 +240,12 @@ func (d *eventDecoder) Buffer(n int) []byte {
 	return d.buf
 }
 
-func (d *eventDecoder) Decode() (publisher.Event, error) {
+// Decode parses the given event, serialized in the given format. The data
+// is usually the buffer returned by the last call to Buffer, unless the
+// frame was compressed or encrypted.
+func (d *eventDecoder) Decode(
+	format SerializationFormat, data []byte,
+) (publisher.Event, error) {
 	var (
 		to  entry
 		err error
@@ -136,13 +254,26 @@ func (d *eventDecoder) Decode() (publisher.Event, error) {
 	d.unfolder.SetTarget(&to)
 	defer d.unfolder.Reset()
 
-	err = d.parser.Parse(d.buf)
+	switch format {
+	case SerializationJSON:
+		err = d.json.Parse(data)
+	case SerializationCBOR:
+		err = d.cborl.Parse(data)
+	case SerializationUBJSON:
+		err = d.ubjson.Parse(data)
+	default:
+		return publisher.Event{}, fmt.Errorf("unknown serialization format %v", format)
+	}
 
 	if err != nil {
 		d.reset() // reset parser just in case
 		return publisher.Event{}, err
 	}
 
+	for _, t := range to.Times {
+		restoreTime(&to, t)
+	}
+
 	return publisher.Event{
 		Flags: publisher.EventFlags(to.Flags),
 		Content: beat.Event{
@@ -152,3 +283,152 @@ func (d *eventDecoder) Decode() (publisher.Event, error) {
 		},
 	}, nil
 }
+
+// The binary formats encode time values nested in the event as RFC3339
+// strings, like JSON, but with full precision. The position of every time
+// value is recorded in the Times list of the entry, so the values can be
+// converted back to their original type after decoding, without mistaking
+// user data for time values.
+
+func foldTime(t *time.Time, v structform.ExtVisitor) error {
+	return v.OnString(t.Format(time.RFC3339Nano))
+}
+
+func foldCommonTime(t *common.Time, v structform.ExtVisitor) error {
+	return v.OnString(time.Time(*t).Format(time.RFC3339Nano))
+}
+
+// collectTimes appends the time values found in v to times. Time values in
+// other types, e.g. structs, are decoded as strings.
+func collectTimes(times []timeEntry, path []string, v interface{}) []timeEntry {
+	switch val := v.(type) {
+	case time.Time:
+		return append(times, newTimeEntry(path, val, false))
+	case *time.Time:
+		if val != nil {
+			return append(times, newTimeEntry(path, *val, false))
+		}
+	case common.Time:
+		return append(times, newTimeEntry(path, time.Time(val), true))
+	case *common.Time:
+		if val != nil {
+			return append(times, newTimeEntry(path, time.Time(*val), true))
+		}
+	case common.MapStr:
+		for k, e := range val {
+			times = collectTimes(times, append(path, k), e)
+		}
+	case map[string]interface{}:
+		for k, e := range val {
+			times = collectTimes(times, append(path, k), e)
+		}
+	case []common.MapStr:
+		for i, e := range val {
+			times = collectTimes(times, append(path, strconv.Itoa(i)), e)
+		}
+	case []map[string]interface{}:
+		for i, e := range val {
+			times = collectTimes(times, append(path, strconv.Itoa(i)), e)
+		}
+	case []interface{}:
+		for i, e := range val {
+			times = collectTimes(times, append(path, strconv.Itoa(i)), e)
+		}
+	}
+	return times
+}
+
+func newTimeEntry(path []string, t time.Time, isCommon bool) timeEntry {
+	return timeEntry{
+		Path:     append([]string(nil), path...),
+		Common:   isCommon,
+		Location: t.Location().String(),
+	}
+}
+
+// restoreTime replaces the string at the position recorded by t with the
+// time value it encodes. Entries not matching the decoded event are ignored.
+func restoreTime(to *entry, t timeEntry) {
+	if len(t.Path) < 2 {
+		return
+	}
+
+	var container interface{}
+	switch t.Path[0] {
+	case "meta":
+		container = map[string]interface{}(to.Meta)
+	case "fields":
+		container = map[string]interface{}(to.Fields)
+	default:
+		return
+	}
+
+	last := len(t.Path) - 1
+	for _, key := range t.Path[1:last] {
+		container = element(container, key)
+	}
+
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if v, ok := parseTime(c[t.Path[last]], t); ok {
+			c[t.Path[last]] = v
+		}
+	case common.MapStr:
+		if v, ok := parseTime(c[t.Path[last]], t); ok {
+			c[t.Path[last]] = v
+		}
+	case []interface{}:
+		i, err := strconv.Atoi(t.Path[last])
+		if err != nil || i < 0 || i >= len(c) {
+			return
+		}
+		if v, ok := parseTime(c[i], t); ok {
+			c[i] = v
+		}
+	}
+}
+
+// element returns the value of key in the map or array container, or nil.
+func element(container interface{}, key string) interface{} {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		return c[key]
+	case common.MapStr:
+		return c[key]
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(c) {
+			return nil
+		}
+		return c[i]
+	}
+	return nil
+}
+
+func parseTime(v interface{}, t timeEntry) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, false
+	}
+
+	switch t.Location {
+	case "", "UTC":
+	case "Local":
+		ts = ts.In(time.Local)
+	default:
+		// Keep the fixed offset parsed from the string if the location is
+		// not known on this host.
+		if loc, err := time.LoadLocation(t.Location); err == nil {
+			ts = ts.In(loc)
+		}
+	}
+
+	if t.Common {
+		return common.Time(ts), true
+	}
+	return ts, true
+}
@@ -0,0 +1,228 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+var serializationFormats = []SerializationFormat{
+	SerializationJSON, SerializationCBOR, SerializationUBJSON,
+}
+
+func testEvent() publisher.Event {
+	return publisher.Event{
+		Content: beat.Event{
+			Timestamp: time.Now().Round(0),
+			Meta:      common.MapStr{"pipeline": "logs"},
+			Fields: common.MapStr{
+				"message": "GET /index.html 200 1024",
+				"http": common.MapStr{
+					"response": common.MapStr{
+						"status_code": int64(200),
+						"bytes":       uint64(1024),
+					},
+				},
+				"duration": 1.5,
+				"tags":     []interface{}{"web", "access"},
+			},
+		},
+	}
+}
+
+func TestSerializationRoundTrip(t *testing.T) {
+	event := testEvent()
+	for _, format := range serializationFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			encoder := newEventEncoder(format)
+			encoded, err := encoder.encode(&event)
+			if err != nil {
+				t.Fatalf("Couldn't encode event: %v", err)
+			}
+
+			// The format must survive a round trip through the segment header.
+			flags := format.segmentFlag()
+			if flags.serializationFormat() != format {
+				t.Errorf("Expected segment flags %x to select %v, got %v",
+					flags, format, flags.serializationFormat())
+			}
+
+			decoder := newEventDecoder()
+			decoded, err := decoder.Decode(flags.serializationFormat(), encoded)
+			if err != nil {
+				t.Fatalf("Couldn't decode event: %v", err)
+			}
+			if !decoded.Content.Timestamp.Equal(event.Content.Timestamp) {
+				t.Errorf("Expected timestamp %v, got %v",
+					event.Content.Timestamp, decoded.Content.Timestamp)
+			}
+			message, _ := decoded.Content.Fields.GetValue("message")
+			if message != "GET /index.html 200 1024" {
+				t.Errorf("Unexpected message %v", message)
+			}
+			status, _ := decoded.Content.Fields.GetValue("http.response.status_code")
+			if reflect.ValueOf(status).Kind() == reflect.Float64 {
+				t.Errorf("Expected status_code to be decoded as an integer, got %T",
+					status)
+			}
+		})
+	}
+}
+
+func TestSerializationPreservesTimes(t *testing.T) {
+	fieldTime := time.Date(2020, 1, 14, 20, 33, 23, 779123456, time.UTC)
+	event := publisher.Event{
+		Content: beat.Event{
+			Timestamp: time.Now().Round(0),
+			Fields: common.MapStr{
+				"time":       fieldTime,
+				"commontime": common.Time(fieldTime),
+				"nested": common.MapStr{
+					"list": []interface{}{fieldTime},
+				},
+			},
+		},
+	}
+
+	// JSON keeps encoding time values as strings for compatibility with
+	// existing segments.
+	expectedJSON := common.MapStr{
+		"time":       "2020-01-14T20:33:23.779Z",
+		"commontime": "2020-01-14T20:33:23.779Z",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"2020-01-14T20:33:23.779Z"},
+		},
+	}
+	expectedBinary := common.MapStr{
+		"time":       fieldTime,
+		"commontime": common.Time(fieldTime),
+		"nested": map[string]interface{}{
+			"list": []interface{}{fieldTime},
+		},
+	}
+
+	for _, format := range serializationFormats {
+		t.Run(format.String(), func(t *testing.T) {
+			encoded, err := newEventEncoder(format).encode(&event)
+			if err != nil {
+				t.Fatalf("Couldn't encode event: %v", err)
+			}
+			decoded, err := newEventDecoder().Decode(format, encoded)
+			if err != nil {
+				t.Fatalf("Couldn't decode event: %v", err)
+			}
+
+			expected := expectedBinary
+			if format == SerializationJSON {
+				expected = expectedJSON
+			}
+			if !reflect.DeepEqual(expected, decoded.Content.Fields) {
+				t.Errorf("Expected fields %#v, got %#v",
+					expected, decoded.Content.Fields)
+			}
+		})
+	}
+}
+
+func TestSerializationKeepsTimeLikeValues(t *testing.T) {
+	zone := time.FixedZone("CET", 3600)
+	fieldTime := time.Date(2020, 1, 14, 20, 33, 23, 779123456, zone)
+	event := publisher.Event{
+		Content: beat.Event{
+			Timestamp: time.Now().Round(0),
+			Fields: common.MapStr{
+				"time":    fieldTime,
+				"string":  "2020-01-14T20:33:23.779123456Z",
+				"markers": common.MapStr{"$time": int64(1), "$nsec": int64(2)},
+			},
+		},
+	}
+
+	for _, format := range []SerializationFormat{SerializationCBOR, SerializationUBJSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			encoded, err := newEventEncoder(format).encode(&event)
+			if err != nil {
+				t.Fatalf("Couldn't encode event: %v", err)
+			}
+			decoded, err := newEventDecoder().Decode(format, encoded)
+			if err != nil {
+				t.Fatalf("Couldn't decode event: %v", err)
+			}
+
+			decodedTime, ok := decoded.Content.Fields["time"].(time.Time)
+			if !ok || !decodedTime.Equal(fieldTime) {
+				t.Errorf("Expected time %v, got %#v", fieldTime, decoded.Content.Fields["time"])
+			}
+			if _, offset := decodedTime.Zone(); offset != 3600 {
+				t.Errorf("Expected the zone offset to be kept, got %v", decodedTime)
+			}
+			if s, ok := decoded.Content.Fields["string"].(string); !ok || s != "2020-01-14T20:33:23.779123456Z" {
+				t.Errorf("Expected strings to be kept, got %#v", decoded.Content.Fields["string"])
+			}
+			if _, ok := decoded.Content.Fields["markers"].(map[string]interface{}); !ok {
+				t.Errorf("Expected maps to be kept, got %#v", decoded.Content.Fields["markers"])
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	event := testEvent()
+	for _, format := range serializationFormats {
+		b.Run(format.String(), func(b *testing.B) {
+			encoder := newEventEncoder(format)
+			encoded, err := encoder.encode(&event)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(encoded)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := encoder.encode(&event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	event := testEvent()
+	for _, format := range serializationFormats {
+		b.Run(format.String(), func(b *testing.B) {
+			encoded, err := newEventEncoder(format).encode(&event)
+			if err != nil {
+				b.Fatal(err)
+			}
+			decoder := newEventDecoder()
+			b.SetBytes(int64(len(encoded)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := decoder.Decode(format, encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
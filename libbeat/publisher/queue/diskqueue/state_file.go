@@ -84,7 +84,7 @@ func writeQueuePositionToHandle(
 	// Want to write: version (0), segment id, segment offset.
 	elems := []interface{}{uint32(0), position.segmentID, position.offset}
 	for _, elem := range elems {
-		err = binary.Write(file, binary.LittleEndian, &elem)
+		err = binary.Write(file, binary.LittleEndian, elem)
 		if err != nil {
 			return err
 		}
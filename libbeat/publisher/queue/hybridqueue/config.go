@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+type config struct {
+	// The configuration of the in-memory buffer, using the same settings as
+	// the "mem" queue.
+	Mem *common.Config `config:"mem"`
+
+	// The configuration of the overflow buffer on disk, using the same
+	// settings as the "disk" queue.
+	Disk *common.Config `config:"disk" validate:"required"`
+
+	// The number of unacknowledged events held in memory before new events
+	// are written to disk. Defaults to the size of the in-memory buffer.
+	HighWater int `config:"high_water" validate:"min=0"`
+
+	// The time after which new events are written to disk if none of the
+	// events held in memory have been acknowledged, e.g. because the output
+	// is down. 0 disables spilling on timeout.
+	SpillTimeout time.Duration `config:"spill_timeout" validate:"min=0"`
+}
+
+func defaultConfig() config {
+	return config{
+		SpillTimeout: 1 * time.Minute,
+	}
+}
@@ -0,0 +1,29 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package hybridqueue provides a queue.Queue implementation that keeps
+// events in memory, and only spills them to disk when the in-memory buffer
+// passes a high-water mark, or when none of the events in memory have been
+// acknowledged for the spill timeout (e.g. because the output is down).
+//
+// Events are always consumed in the order they were published: once any
+// event has been spilled to disk, new events are written to disk as well
+// until the consumer has read everything on disk, at which point the queue
+// returns to buffering events in memory.
+//
+// The queue implementation is registered as queue type "hybrid".
+package hybridqueue
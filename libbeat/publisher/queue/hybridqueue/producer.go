@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// hybridProducer forwards each event to the memory or disk producer
+// according to the queue's current buffering state.
+type hybridProducer struct {
+	queue *hybridQueue
+	mem   queue.Producer
+	disk  queue.Producer
+
+	// acks is nil if the producer config has no ACK callback.
+	acks *producerACKs
+}
+
+// producerACKs merges the ACKs from both lanes so the original producer
+// sees them in the order its events were published. Each lane reports its
+// ACKs in order, but the disk queue ACKs events when they are written,
+// which can happen before older events in memory are ACKed.
+type producerACKs struct {
+	mutex sync.Mutex
+
+	// The lanes of the published events that have not yet been ACKed, in
+	// the order they were published, run-length encoded.
+	pending []laneRun
+
+	// The number of ACKs received from each lane that have not yet been
+	// matched against pending events.
+	laneACKed [2]int
+
+	callback func(count int)
+}
+
+type laneRun struct {
+	lane  lane
+	count int
+}
+
+func newProducer(q *hybridQueue, cfg queue.ProducerConfig) *hybridProducer {
+	p := &hybridProducer{queue: q}
+	if cfg.ACK != nil {
+		p.acks = &producerACKs{callback: cfg.ACK}
+	}
+
+	laneConfig := func(l lane) queue.ProducerConfig {
+		laneCfg := cfg
+		if p.acks != nil {
+			laneCfg.ACK = func(count int) { p.acks.ack(l, count) }
+		}
+		return laneCfg
+	}
+	p.mem = q.mem.Producer(laneConfig(memLane))
+	p.disk = q.disk.Producer(laneConfig(diskLane))
+	return p
+}
+
+func (p *hybridProducer) Publish(event publisher.Event) bool {
+	return p.publish(event, true)
+}
+
+func (p *hybridProducer) TryPublish(event publisher.Event) bool {
+	return p.publish(event, false)
+}
+
+func (p *hybridProducer) publish(event publisher.Event, shouldBlock bool) bool {
+	l := p.queue.reserve()
+	producer := p.mem
+	if l == diskLane {
+		producer = p.disk
+	}
+
+	// The event is added to pending before publishing, since the lane may
+	// ACK it before the publish call returns.
+	if p.acks != nil {
+		p.acks.add(l)
+	}
+	var ok bool
+	if shouldBlock {
+		ok = producer.Publish(event)
+	} else {
+		ok = producer.TryPublish(event)
+	}
+	if !ok {
+		if p.acks != nil {
+			p.acks.remove(l)
+		}
+		p.queue.cancelReserve(l)
+		return false
+	}
+	p.queue.published(l)
+	return true
+}
+
+func (p *hybridProducer) Cancel() int {
+	// Only the memory queue removes events on Cancel, the disk queue keeps
+	// everything that has already been written.
+	memDropped := p.mem.Cancel()
+	diskDropped := p.disk.Cancel()
+	if memDropped > 0 {
+		p.queue.dropped(memLane, memDropped)
+	}
+	if diskDropped > 0 {
+		p.queue.dropped(diskLane, diskDropped)
+	}
+	return memDropped + diskDropped
+}
+
+func (a *producerACKs) add(l lane) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if n := len(a.pending); n > 0 && a.pending[n-1].lane == l {
+		a.pending[n-1].count++
+	} else {
+		a.pending = append(a.pending, laneRun{lane: l, count: 1})
+	}
+}
+
+// remove undoes the most recent call to add after a failed publish.
+func (a *producerACKs) remove(l lane) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	n := len(a.pending)
+	if n == 0 || a.pending[n-1].lane != l {
+		return
+	}
+	a.pending[n-1].count--
+	if a.pending[n-1].count == 0 {
+		a.pending = a.pending[:n-1]
+	}
+}
+
+func (a *producerACKs) ack(l lane, count int) {
+	a.mutex.Lock()
+	a.laneACKed[l] += count
+
+	// Release the longest prefix of pending events whose lanes have ACKed
+	// them.
+	total := 0
+	for len(a.pending) > 0 {
+		run := &a.pending[0]
+		n := run.count
+		if acked := a.laneACKed[run.lane]; acked < n {
+			n = acked
+		}
+		if n == 0 {
+			break
+		}
+		run.count -= n
+		a.laneACKed[run.lane] -= n
+		total += n
+		if run.count > 0 {
+			break
+		}
+		a.pending = a.pending[1:]
+	}
+	a.mutex.Unlock()
+
+	if total > 0 {
+		a.callback(total)
+	}
+}
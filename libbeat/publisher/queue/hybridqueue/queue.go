@@ -0,0 +1,423 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+
+	// The hybrid queue is built from the "mem" and "disk" queue types.
+	_ "github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+)
+
+// lane identifies which of the queue's buffers holds an event.
+type lane int
+
+const (
+	memLane lane = iota
+	diskLane
+)
+
+// hybridQueue implements queue.Queue by delegating to an in-memory queue
+// and a disk queue, and tracking which of them the oldest events are in.
+type hybridQueue struct {
+	logger *logp.Logger
+
+	mem  queue.Queue
+	disk queue.Queue
+
+	// The maximum number of unacknowledged events to hold in memory.
+	highWater int
+
+	// The time without ACKs from memory after which new events are written
+	// to disk, or 0.
+	spillTimeout time.Duration
+
+	// mutex protects the fields below. cond is signaled whenever new events
+	// are published or the queue is closed.
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	// The number of events sent to memory that have not been ACKed.
+	memBuffered int
+
+	// The time of the last ACK of events in memory, or of the first event
+	// sent to an empty memory buffer.
+	lastMemACK time.Time
+
+	// The number of events sent to disk that have not yet been returned by
+	// a consumer, including those whose publish call is still in progress.
+	diskPending int
+
+	// The number of events published to each lane that have not yet been
+	// returned by a consumer.
+	memUnread  int
+	diskUnread int
+
+	closed bool
+}
+
+// Settings contains the configuration of a hybrid queue.
+type Settings struct {
+	// The maximum number of unacknowledged events to hold in memory before
+	// new events are written to disk. It must not be larger than the
+	// capacity of the memory queue.
+	HighWater int
+
+	// If none of the events in memory are acknowledged for this long, new
+	// events are written to disk. 0 disables spilling on timeout.
+	SpillTimeout time.Duration
+
+	// The number of events already stored in the disk queue, which are read
+	// before any new events.
+	DiskBacklog int
+}
+
+func init() {
+	queue.RegisterQueueType(
+		"hybrid",
+		queueFactory,
+		feature.MakeDetails(
+			"Hybrid queue",
+			"Buffer events in memory, overflowing to disk when memory is full.",
+			feature.Beta))
+}
+
+// queueFactory matches the queue.Factory interface, and is used to add the
+// hybrid queue to the registry.
+func queueFactory(
+	ackListener queue.ACKListener, logger *logp.Logger, cfg *common.Config,
+) (queue.Queue, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("hybrid queue couldn't load user config: %w", err)
+	}
+	if config.Mem == nil {
+		config.Mem = common.NewConfig()
+	}
+	if logger == nil {
+		logger = logp.L()
+	}
+	logger = logger.Named("hybridqueue")
+
+	// Events left on disk by a previous run are older than anything
+	// published now, so they have to be counted before the disk queue
+	// starts reading them.
+	diskBacklog := 0
+	settings, err := diskqueue.SettingsForUserConfig(config.Disk)
+	if err != nil {
+		return nil, fmt.Errorf("hybrid queue couldn't load disk config: %w", err)
+	}
+	if count, err := diskqueue.CountPendingFrames(settings); err != nil {
+		logger.Warnf("Couldn't count events remaining in disk buffer: %v", err)
+	} else {
+		diskBacklog = int(count)
+	}
+
+	mem, err := queue.FindFactory("mem")(ackListener, logger, config.Mem)
+	if err != nil {
+		return nil, fmt.Errorf("hybrid queue couldn't create memory buffer: %w", err)
+	}
+	disk, err := queue.FindFactory("disk")(ackListener, logger, config.Disk)
+	if err != nil {
+		mem.Close()
+		return nil, fmt.Errorf("hybrid queue couldn't create disk buffer: %w", err)
+	}
+
+	highWater := config.HighWater
+	memSize := mem.BufferConfig().MaxEvents
+	if highWater == 0 || highWater > memSize {
+		// Above the size of the memory queue, publishing to memory would
+		// block instead of spilling to disk.
+		highWater = memSize
+	}
+	return NewQueue(logger, mem, disk, Settings{
+		HighWater:    highWater,
+		SpillTimeout: config.SpillTimeout,
+		DiskBacklog:  diskBacklog,
+	}), nil
+}
+
+// NewQueue returns a hybrid queue that buffers events in the given memory
+// queue, and writes new events to the given disk queue once the memory
+// buffer reaches its high-water mark or stops being acknowledged. The
+// hybrid queue takes ownership of both queues, and closes them when it is
+// closed.
+func NewQueue(
+	logger *logp.Logger, mem, disk queue.Queue, settings Settings,
+) queue.Queue {
+	q := &hybridQueue{
+		logger:       logger,
+		mem:          mem,
+		disk:         disk,
+		highWater:    settings.HighWater,
+		spillTimeout: settings.SpillTimeout,
+		diskPending:  settings.DiskBacklog,
+		diskUnread:   settings.DiskBacklog,
+	}
+	if settings.DiskBacklog > 0 {
+		logger.Infof(
+			"Disk buffer has %d events from a previous run, reading them first",
+			settings.DiskBacklog)
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+//
+// hybridQueue implementation of the queue.Queue interface
+//
+
+func (q *hybridQueue) Close() error {
+	q.mutex.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	memErr := q.mem.Close()
+	diskErr := q.disk.Close()
+	if memErr != nil {
+		return memErr
+	}
+	return diskErr
+}
+
+func (q *hybridQueue) BufferConfig() queue.BufferConfig {
+	// Like the disk queue, the hybrid queue has no fixed event limit.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *hybridQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(q, cfg)
+}
+
+func (q *hybridQueue) Consumer() queue.Consumer {
+	return &hybridConsumer{
+		queue: q,
+		mem:   q.mem.Consumer(),
+		disk:  q.disk.Consumer(),
+	}
+}
+
+//
+// Lane bookkeeping
+//
+
+// reserve chooses the lane for a new event. Once the publish call
+// returns, the caller must call either published or cancelReserve.
+func (q *hybridQueue) reserve() lane {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// Once we start spilling to disk, every event must go to disk until the
+	// consumer catches up, otherwise newer events in memory would be read
+	// before older events on disk.
+	if q.diskPending > 0 || q.memBuffered >= q.highWater || q.memStalled() {
+		if q.diskPending == 0 {
+			if q.memBuffered >= q.highWater {
+				q.logger.Debugf(
+					"Memory buffer reached %d events, spilling to disk", q.memBuffered)
+			} else {
+				q.logger.Infof(
+					"No events were acknowledged for %v, spilling to disk", q.spillTimeout)
+			}
+		}
+		q.diskPending++
+		return diskLane
+	}
+	if q.memBuffered == 0 {
+		q.lastMemACK = time.Now()
+	}
+	q.memBuffered++
+	return memLane
+}
+
+// memStalled reports whether the events in memory have not been ACKed for
+// longer than the spill timeout. The caller must hold q.mutex.
+func (q *hybridQueue) memStalled() bool {
+	return q.spillTimeout > 0 && q.memBuffered > 0 &&
+		time.Since(q.lastMemACK) >= q.spillTimeout
+}
+
+// published makes an event added to the given lane available to consumers.
+func (q *hybridQueue) published(l lane) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if l == memLane {
+		q.memUnread++
+	} else {
+		q.diskUnread++
+	}
+	q.cond.Broadcast()
+}
+
+// cancelReserve undoes reserve for an event that was not published.
+func (q *hybridQueue) cancelReserve(l lane) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if l == memLane {
+		q.memBuffered--
+	} else {
+		q.diskPending--
+	}
+}
+
+// dropped removes events that a producer cancelled before they were read.
+func (q *hybridQueue) dropped(l lane, count int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if l == memLane {
+		q.memBuffered -= count
+		q.memUnread -= count
+	} else {
+		q.diskPending -= count
+		q.diskUnread -= count
+	}
+}
+
+// nextLane blocks until there are unread events and returns the lane
+// containing the oldest of them, along with the number of unread events
+// in that lane. It returns an error once the queue or consumer c is
+// closed.
+func (q *hybridQueue) nextLane(c *hybridConsumer) (lane, int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for {
+		if q.closed {
+			return memLane, 0, errors.New("tried to read from a closed hybrid queue")
+		}
+		if c.closed {
+			return memLane, 0, errors.New("tried to read from a closed hybrid queue consumer")
+		}
+		// Events in memory are always older than the events on disk.
+		if q.memUnread > 0 {
+			return memLane, q.memUnread, nil
+		}
+		if q.diskUnread > 0 {
+			return diskLane, q.diskUnread, nil
+		}
+		q.cond.Wait()
+	}
+}
+
+// eventsRead records that a consumer received count events from a lane.
+func (q *hybridQueue) eventsRead(l lane, count int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if l == memLane {
+		q.memUnread -= count
+	} else {
+		q.diskUnread -= count
+		q.diskPending -= count
+		if q.diskPending == 0 {
+			q.logger.Debug("Disk buffer drained, returning to memory buffer")
+		}
+	}
+}
+
+// memACKed records that count events read from memory were ACKed, freeing
+// space in the memory buffer.
+func (q *hybridQueue) memACKed(count int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.memBuffered -= count
+	q.lastMemACK = time.Now()
+}
+
+//
+// Consumer
+//
+
+type hybridConsumer struct {
+	queue *hybridQueue
+	mem   queue.Consumer
+	disk  queue.Consumer
+
+	// closed is protected by queue.mutex, so Close can wake a Get waiting
+	// for events.
+	closed bool
+}
+
+type hybridBatch struct {
+	queue.Batch
+
+	queue *hybridQueue
+	lane  lane
+	count int
+}
+
+func (c *hybridConsumer) Get(eventCount int) (queue.Batch, error) {
+	l, unread, err := c.queue.nextLane(c)
+	if err != nil {
+		return nil, err
+	}
+	consumer := c.mem
+	if l == diskLane {
+		consumer = c.disk
+	}
+	// The underlying queues return whatever they have buffered, which can
+	// include events whose publish call hasn't returned yet. Don't take
+	// more than were counted, so the lane counters stay consistent.
+	if eventCount <= 0 || eventCount > unread {
+		eventCount = unread
+	}
+	batch, err := consumer.Get(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	count := len(batch.Events())
+	c.queue.eventsRead(l, count)
+	return &hybridBatch{
+		Batch: batch,
+		queue: c.queue,
+		lane:  l,
+		count: count,
+	}, nil
+}
+
+func (c *hybridConsumer) Close() error {
+	q := c.queue
+	q.mutex.Lock()
+	if c.closed {
+		q.mutex.Unlock()
+		return errors.New("hybrid queue consumer is already closed")
+	}
+	c.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	c.mem.Close()
+	c.disk.Close()
+	return nil
+}
+
+func (b *hybridBatch) ACK() {
+	b.Batch.ACK()
+	if b.lane == memLane {
+		b.queue.memACKed(b.count)
+	}
+}
@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+)
+
+var seed int64
+
+func init() {
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "test random seed")
+}
+
+func TestProduceConsumer(t *testing.T) {
+	maxEvents := 1024
+	minEvents := 32
+
+	rand.Seed(seed)
+	events := rand.Intn(maxEvents-minEvents) + minEvents
+	batchSize := rand.Intn(events-8) + 4
+	bufferSize := rand.Intn(batchSize*2) + 4
+
+	t.Log("seed: ", seed)
+	t.Log("events: ", events)
+	t.Log("batchSize: ", batchSize)
+	t.Log("bufferSize: ", bufferSize)
+
+	testWith := func(factory queuetest.QueueFactory) func(t *testing.T) {
+		return func(t *testing.T) {
+			t.Run("single", func(t *testing.T) {
+				queuetest.TestSingleProducerConsumer(t, events, batchSize, factory)
+			})
+			t.Run("multi", func(t *testing.T) {
+				queuetest.TestMultiProducerConsumer(t, events, batchSize, factory)
+			})
+		}
+	}
+
+	// With a high-water mark of 1 almost every event goes through the disk
+	// queue, otherwise the test switches between memory and disk as the
+	// consumer falls behind.
+	t.Run("spill", testWith(makeTestQueue(bufferSize, 1)))
+	t.Run("mixed", testWith(makeTestQueue(bufferSize, bufferSize)))
+}
+
+func makeTestQueue(memSize, highWater int) queuetest.QueueFactory {
+	return func(t *testing.T) queue.Queue {
+		dir, err := ioutil.TempDir("", "hybridqueue_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		logger := logp.NewLogger("hybridqueue_test")
+		mem := memqueue.NewQueue(nil, memqueue.Settings{
+			Events:      memSize,
+			WaitOnClose: true,
+		})
+		settings := diskqueue.DefaultSettings()
+		settings.Path = dir
+		disk, err := diskqueue.NewQueue(logger, settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewQueue(logger, mem, disk, Settings{HighWater: highWater})
+	}
+}
+
+func TestRestartWithDiskBacklog(t *testing.T) {
+	const backlog = 10
+
+	dir, err := ioutil.TempDir("", "hybridqueue_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logp.NewLogger("hybridqueue_test")
+	settings := diskqueue.DefaultSettings()
+	settings.Path = dir
+
+	// Fill a disk queue as a previous run would have, and wait for the
+	// events to be written before closing it.
+	disk, err := diskqueue.NewQueue(logger, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan int, backlog)
+	producer := disk.Producer(queue.ProducerConfig{
+		ACK: func(count int) { written <- count },
+	})
+	for i := 0; i < backlog; i++ {
+		if !producer.Publish(makeEvent(i)) {
+			t.Fatalf("couldn't publish event %d to the disk queue", i)
+		}
+	}
+	for total := 0; total < backlog; {
+		select {
+		case count := <-written:
+			total += count
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d events were written to disk", total, backlog)
+		}
+	}
+	disk.Close()
+
+	count, err := diskqueue.CountPendingFrames(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != backlog {
+		t.Fatalf("expected %d pending frames, got %d", backlog, count)
+	}
+
+	// Reopen the disk queue behind a hybrid queue with room in memory. The
+	// new event must go to disk behind the old ones instead of overtaking
+	// them in memory.
+	disk, err = diskqueue.NewQueue(logger, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := memqueue.NewQueue(nil, memqueue.Settings{Events: 16})
+	q := NewQueue(logger, mem, disk, Settings{
+		HighWater:   16,
+		DiskBacklog: int(count),
+	}).(*hybridQueue)
+	defer q.Close()
+
+	if !q.Producer(queue.ProducerConfig{}).Publish(makeEvent(backlog)) {
+		t.Fatal("couldn't publish event to the hybrid queue")
+	}
+
+	consumer := q.Consumer()
+	next := 0
+	for next <= backlog {
+		batch, err := consumer.Get(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range batch.Events() {
+			value, _ := event.Content.Fields.GetValue("count")
+			if fmt.Sprint(value) != fmt.Sprint(next) {
+				t.Fatalf("expected event %d, got %v", next, value)
+			}
+			next++
+		}
+		batch.ACK()
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.diskUnread != 0 || q.diskPending != 0 || q.memUnread != 0 {
+		t.Errorf(
+			"expected empty lanes, got diskUnread=%d diskPending=%d memUnread=%d",
+			q.diskUnread, q.diskPending, q.memUnread)
+	}
+}
+
+func TestConsumerCloseWakesGet(t *testing.T) {
+	q := makeTestQueue(16, 16)(t)
+	defer q.Close()
+
+	consumer := q.Consumer()
+	done := make(chan error, 1)
+	go func() {
+		_, err := consumer.Get(0)
+		done <- err
+	}()
+
+	// Give Get time to block on the empty queue.
+	time.Sleep(50 * time.Millisecond)
+	if err := consumer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error from Get on a closed consumer")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get was not woken by closing the consumer")
+	}
+}
+
+func TestSpillWhenNotACKed(t *testing.T) {
+	q := makeTestQueue(16, 16)(t).(*hybridQueue)
+	defer q.Close()
+	q.spillTimeout = 10 * time.Millisecond
+
+	producer := q.Producer(queue.ProducerConfig{})
+	if !producer.Publish(makeEvent(0)) {
+		t.Fatal("couldn't publish event to the hybrid queue")
+	}
+	time.Sleep(2 * q.spillTimeout)
+	if !producer.Publish(makeEvent(1)) {
+		t.Fatal("couldn't publish event to the hybrid queue")
+	}
+
+	q.mutex.Lock()
+	memBuffered, diskPending := q.memBuffered, q.diskPending
+	q.mutex.Unlock()
+	if memBuffered != 1 || diskPending != 1 {
+		t.Fatalf(
+			"expected one event in memory and one on disk, got memBuffered=%d diskPending=%d",
+			memBuffered, diskPending)
+	}
+
+	// Both events are still read in order.
+	consumer := q.Consumer()
+	for next := 0; next < 2; {
+		batch, err := consumer.Get(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range batch.Events() {
+			value, _ := event.Content.Fields.GetValue("count")
+			if fmt.Sprint(value) != fmt.Sprint(next) {
+				t.Fatalf("expected event %d, got %v", next, value)
+			}
+			next++
+		}
+		batch.ACK()
+	}
+}
+
+func makeEvent(i int) publisher.Event {
+	return publisher.Event{
+		Content: beat.Event{
+			Timestamp: time.Now(),
+			Fields:    common.MapStr{"count": i},
+		},
+	}
+}
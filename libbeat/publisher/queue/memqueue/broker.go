@@ -56,6 +56,14 @@ type Settings struct {
 	FlushMinEvents int
 	FlushTimeout   time.Duration
 	WaitOnClose    bool
+
+	// PriorityLevels is the number of priority lanes. Each lane buffers up
+	// to Events events. Values <= 1 disable priorities.
+	PriorityLevels int
+
+	// StarvationLimit is the number of consecutive batches a non-empty
+	// lower priority lane can be passed over before it is served anyway.
+	StarvationLimit int
 }
 
 type ackChan struct {
@@ -98,16 +106,27 @@ func create(
 		Events:         config.Events,
 		FlushMinEvents: config.FlushMinEvents,
 		FlushTimeout:   config.FlushTimeout,
+
+		PriorityLevels:  config.Priority.Levels,
+		StarvationLimit: config.Priority.StarvationLimit,
 	}), nil
 }
 
 // NewQueue creates a new broker based in-memory queue holding up to sz number of events.
 // If waitOnClose is set to true, the broker will block on Close, until all internal
 // workers handling incoming messages and ACKs have been shut down.
+// If settings.PriorityLevels is > 1, one broker is created per priority lane.
 func NewQueue(
 	logger logger,
 	settings Settings,
 ) queue.Queue {
+	if settings.PriorityLevels > 1 {
+		return newPriorityQueue(logger, settings)
+	}
+	return newBroker(logger, settings)
+}
+
+func newBroker(logger logger, settings Settings) *broker {
 	// define internal channel size for producer/client requests
 	// to the broker
 	chanSize := 20
@@ -23,15 +23,25 @@ import (
 )
 
 type config struct {
-	Events         int           `config:"events" validate:"min=32"`
-	FlushMinEvents int           `config:"flush.min_events" validate:"min=0"`
-	FlushTimeout   time.Duration `config:"flush.timeout"`
+	Events         int            `config:"events" validate:"min=32"`
+	FlushMinEvents int            `config:"flush.min_events" validate:"min=0"`
+	FlushTimeout   time.Duration  `config:"flush.timeout"`
+	Priority       priorityConfig `config:"priority"`
+}
+
+type priorityConfig struct {
+	Levels          int `config:"levels" validate:"min=1"`
+	StarvationLimit int `config:"starvation_limit" validate:"min=1"`
 }
 
 var defaultConfig = config{
 	Events:         4 * 1024,
 	FlushMinEvents: 2 * 1024,
 	FlushTimeout:   1 * time.Second,
+	Priority: priorityConfig{
+		Levels:          1,
+		StarvationLimit: 8,
+	},
 }
 
 func (c *config) Validate() error {
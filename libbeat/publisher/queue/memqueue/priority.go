@@ -0,0 +1,206 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package memqueue
+
+import (
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// priorityQueue runs one broker per priority lane. Producers are assigned to
+// a lane by their configured priority, and consumers drain higher lanes
+// first. To guarantee forward progress, a lower lane that has been passed
+// over StarvationLimit times in a row is served before the higher lanes.
+type priorityQueue struct {
+	// lanes[i] holds the events of priority i, the highest priority is last.
+	lanes []*broker
+
+	starvationLimit int
+}
+
+type priorityConsumer struct {
+	queue *priorityQueue
+	resp  chan getResponse
+
+	// skipped[i] counts the batches served from higher lanes since lane i
+	// was last served or found empty.
+	skipped []int
+
+	// selectCases are the cases for a blocking request to any lane. The
+	// last case is the consumer's done channel.
+	selectCases []reflect.SelectCase
+
+	done   chan struct{}
+	closed atomic.Bool
+}
+
+func newPriorityQueue(logger logger, settings Settings) *priorityQueue {
+	laneSettings := settings
+	laneSettings.PriorityLevels = 1
+
+	q := &priorityQueue{
+		lanes:           make([]*broker, settings.PriorityLevels),
+		starvationLimit: settings.StarvationLimit,
+	}
+	if q.starvationLimit < 1 {
+		q.starvationLimit = 1
+	}
+	for i := range q.lanes {
+		q.lanes[i] = newBroker(logger, laneSettings)
+	}
+	return q
+}
+
+func (q *priorityQueue) Close() error {
+	for _, b := range q.lanes {
+		b.Close()
+	}
+	return nil
+}
+
+func (q *priorityQueue) BufferConfig() queue.BufferConfig {
+	total := 0
+	for _, b := range q.lanes {
+		total += b.bufSize
+	}
+	return queue.BufferConfig{
+		MaxEvents: total,
+	}
+}
+
+func (q *priorityQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return q.lanes[q.laneFor(cfg.Priority)].Producer(cfg)
+}
+
+func (q *priorityQueue) Consumer() queue.Consumer {
+	c := &priorityConsumer{
+		queue:   q,
+		resp:    make(chan getResponse),
+		skipped: make([]int, len(q.lanes)),
+		done:    make(chan struct{}),
+	}
+	for _, b := range q.lanes {
+		c.selectCases = append(c.selectCases, reflect.SelectCase{
+			Dir:  reflect.SelectSend,
+			Chan: reflect.ValueOf(b.requests),
+		})
+	}
+	c.selectCases = append(c.selectCases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(c.done),
+	})
+	return c
+}
+
+// laneFor maps a producer priority to a lane index. Priorities outside of
+// the configured range are clamped to the lowest or highest lane.
+func (q *priorityQueue) laneFor(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority >= len(q.lanes) {
+		return len(q.lanes) - 1
+	}
+	return priority
+}
+
+func (c *priorityConsumer) Get(sz int) (queue.Batch, error) {
+	if c.closed.Load() {
+		return nil, io.EOF
+	}
+
+	req := getRequest{sz: sz, resp: c.resp}
+	lane, ok := c.tryRequest(req)
+	if !ok {
+		// No lane has events right now, wait for the first one that does.
+		c.setRequest(req)
+		chosen, _, _ := reflect.Select(c.selectCases)
+		if chosen == len(c.queue.lanes) {
+			return nil, io.EOF
+		}
+		lane = chosen
+	}
+	c.served(lane)
+
+	// if request has been send, we do have to wait for a response
+	resp := <-c.resp
+	return &batch{
+		events: resp.buf,
+		ack:    resp.ack,
+		state:  batchActive,
+	}, nil
+}
+
+// tryRequest sends req to the first lane that has events available without
+// blocking, starting with starved lanes and then in order of priority.
+func (c *priorityConsumer) tryRequest(req getRequest) (int, bool) {
+	lanes := c.queue.lanes
+	for i := range lanes {
+		if c.skipped[i] < c.queue.starvationLimit {
+			continue
+		}
+		if trySendRequest(lanes[i], req) {
+			return i, true
+		}
+		// The lane is empty, so it isn't being starved.
+		c.skipped[i] = 0
+	}
+	for i := len(lanes) - 1; i >= 0; i-- {
+		if trySendRequest(lanes[i], req) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// served updates the starvation counters after a batch was taken from lane.
+func (c *priorityConsumer) served(lane int) {
+	c.skipped[lane] = 0
+	for i := 0; i < lane; i++ {
+		c.skipped[i]++
+	}
+}
+
+func (c *priorityConsumer) setRequest(req getRequest) {
+	v := reflect.ValueOf(req)
+	for i := range c.queue.lanes {
+		c.selectCases[i].Send = v
+	}
+}
+
+func trySendRequest(b *broker, req getRequest) bool {
+	select {
+	case b.requests <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *priorityConsumer) Close() error {
+	if c.closed.Swap(true) {
+		return errors.New("already closed")
+	}
+
+	close(c.done)
+	return nil
+}
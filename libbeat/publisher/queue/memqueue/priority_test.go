@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package memqueue
+
+import (
+	"testing"
+)
+
+func TestPriorityConsumerLaneOrder(t *testing.T) {
+	// A broker only accepts get requests while it has events, so a lane
+	// with a buffered requests channel behaves like a non-empty lane, and
+	// a lane with a nil channel like an empty one.
+	nonEmpty := func() *broker {
+		return &broker{requests: make(chan getRequest, 100)}
+	}
+	empty := func() *broker {
+		return &broker{}
+	}
+
+	cases := map[string]struct {
+		lanes []*broker
+		limit int
+		want  []int
+	}{
+		"highest lane first": {
+			lanes: []*broker{nonEmpty(), nonEmpty(), nonEmpty()},
+			limit: 10,
+			want:  []int{2, 2, 2, 2},
+		},
+		"starved lanes are served": {
+			lanes: []*broker{nonEmpty(), empty(), nonEmpty()},
+			limit: 2,
+			want:  []int{2, 2, 0, 2, 2, 0},
+		},
+		"empty starved lanes are skipped": {
+			lanes: []*broker{empty(), nonEmpty(), nonEmpty()},
+			limit: 2,
+			want:  []int{2, 2, 1, 2, 2, 1},
+		},
+		"only lower lanes": {
+			lanes: []*broker{nonEmpty(), empty()},
+			limit: 2,
+			want:  []int{0, 0, 0},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			q := &priorityQueue{lanes: test.lanes, starvationLimit: test.limit}
+			c := q.Consumer().(*priorityConsumer)
+			for i, want := range test.want {
+				lane, ok := c.tryRequest(getRequest{})
+				if !ok {
+					t.Fatalf("request %d: no lane accepted the request", i)
+				}
+				if lane != want {
+					t.Fatalf("request %d: expected lane %d, got %d", i, want, lane)
+				}
+				c.served(lane)
+			}
+		})
+	}
+
+	t.Run("no lane available", func(t *testing.T) {
+		q := &priorityQueue{lanes: []*broker{empty(), empty()}, starvationLimit: 2}
+		c := q.Consumer().(*priorityConsumer)
+		if _, ok := c.tryRequest(getRequest{}); ok {
+			t.Fatal("expected no lane to accept the request")
+		}
+	})
+}
@@ -66,6 +66,7 @@ func TestProduceConsumer(t *testing.T) {
 
 	t.Run("direct", testWith(makeTestQueue(bufferSize, 0, 0)))
 	t.Run("flush", testWith(makeTestQueue(bufferSize, batchSize/2, 100*time.Millisecond)))
+	t.Run("priority", testWith(makePriorityTestQueue(bufferSize, 3)))
 }
 
 func TestProducerCancelRemovesEvents(t *testing.T) {
@@ -82,3 +83,14 @@ func makeTestQueue(sz, minEvents int, flushTimeout time.Duration) queuetest.Queu
 		})
 	}
 }
+
+func makePriorityTestQueue(sz, levels int) queuetest.QueueFactory {
+	return func(_ *testing.T) queue.Queue {
+		return NewQueue(nil, Settings{
+			Events:          sz,
+			WaitOnClose:     true,
+			PriorityLevels:  levels,
+			StarvationLimit: 2,
+		})
+	}
+}
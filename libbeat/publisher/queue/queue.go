@@ -80,6 +80,11 @@ type ProducerConfig struct {
 	// DropOnCancel is a hint to the queue to drop events if the producer disconnects
 	// via Cancel.
 	DropOnCancel bool
+
+	// Priority selects the priority lane of the producer's events, for queues
+	// supporting priorities. Higher priority events are consumed first.
+	// Queues without priority support ignore this setting.
+	Priority int
 }
 
 // Producer is an interface to be used by the pipelines client to forward
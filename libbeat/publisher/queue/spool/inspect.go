@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spool
+
+import (
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/go-txfile"
+	"github.com/elastic/go-txfile/pq"
+)
+
+// ConfiguredPath returns the path of the spool file for the given spool
+// queue configuration.
+func ConfiguredPath(cfg *common.Config) (string, error) {
+	config := defaultConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return "", err
+		}
+	}
+	if config.File.Path == "" {
+		return paths.Resolve(paths.Data, "spool.dat"), nil
+	}
+	return config.File.Path, nil
+}
+
+// Inspect opens the spool file at path read-only and calls fn on each event
+// that has not yet been ACKed, in order. It returns the number of events
+// visited. Events that fail to decode are passed to onError, if it is set,
+// and skipped.
+// The spool file must not be in use by a running beat.
+func Inspect(
+	path string, fn func(publisher.Event) error, onError func(error),
+) (int, error) {
+	f, err := txfile.Open(path, 0600, txfile.Options{Readonly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	delegate, err := pq.NewStandaloneDelegate(f)
+	if err != nil {
+		return 0, err
+	}
+	queue, err := pq.New(delegate, pq.Settings{})
+	if err != nil {
+		return 0, err
+	}
+	defer queue.Close()
+
+	reader := queue.Reader()
+	if err := reader.Begin(); err != nil {
+		return 0, err
+	}
+	defer reader.Done()
+
+	dec := newDecoder()
+	count := 0
+	for {
+		sz, err := reader.Next()
+		if sz <= 0 || err != nil {
+			return count, err
+		}
+
+		buf := dec.Buffer(sz)
+		if _, err := reader.Read(buf); err != nil {
+			return count, err
+		}
+
+		event, err := dec.Decode()
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+		count++
+		if err := fn(event); err != nil {
+			return count, err
+		}
+	}
+}
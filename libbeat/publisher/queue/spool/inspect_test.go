@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spool
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/go-txfile"
+	"github.com/elastic/go-txfile/pq"
+	"github.com/elastic/go-txfile/txfiletest"
+)
+
+// writeTestSpool writes one event per message to a new spool file at path.
+// A nil message writes an entry that can not be decoded.
+func writeTestSpool(t *testing.T, path string, messages []interface{}) {
+	f, err := txfile.Open(path, os.ModePerm, txfile.Options{
+		MaxSize:  128 * humanize.KiByte,
+		PageSize: 4 * humanize.KiByte,
+		Prealloc: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	delegate, err := pq.NewStandaloneDelegate(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, err := pq.New(delegate, pq.Settings{
+		WriteBuffer: 4 * humanize.KiByte,
+		Flushed:     func(uint) {},
+		ACKed:       func(uint, uint) {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	writer, err := queue.Writer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := newEncoder(codecCBORL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		buf := []byte{0xff}
+		if message != nil {
+			buf, err = enc.encode(&publisher.Event{Content: beat.Event{
+				Timestamp: time.Now(),
+				Fields:    common.MapStr{"message": message},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := writer.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	path, cleanPath := txfiletest.SetupPath(t, "")
+	defer cleanPath()
+	writeTestSpool(t, path, []interface{}{"first", nil, "second"})
+
+	var messages []interface{}
+	var decodeErrors []error
+	count, err := Inspect(path,
+		func(event publisher.Event) error {
+			message, _ := event.Content.Fields.GetValue("message")
+			messages = append(messages, message)
+			return nil
+		},
+		func(err error) { decodeErrors = append(decodeErrors, err) })
+	if err != nil {
+		t.Fatalf("Couldn't inspect spool: %v", err)
+	}
+
+	if count != 2 || len(messages) != 2 || messages[0] != "first" || messages[1] != "second" {
+		t.Errorf("Expected the first and second messages, got %d: %v", count, messages)
+	}
+	if len(decodeErrors) != 1 {
+		t.Errorf("Expected one decoding error, got %v", decodeErrors)
+	}
+}
+
+func TestInspectStopsOnCallbackError(t *testing.T) {
+	path, cleanPath := txfiletest.SetupPath(t, "")
+	defer cleanPath()
+	writeTestSpool(t, path, []interface{}{"first", "second"})
+
+	errStop := errors.New("stop")
+	count, err := Inspect(path,
+		func(publisher.Event) error { return errStop }, nil)
+	if err != errStop || count != 1 {
+		t.Errorf("Expected to stop after the first event, got %d events and error %v", count, err)
+	}
+}
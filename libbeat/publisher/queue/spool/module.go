@@ -22,7 +22,6 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
 	"github.com/elastic/beats/v7/libbeat/feature"
 	"github.com/elastic/beats/v7/libbeat/logp"
-	"github.com/elastic/beats/v7/libbeat/paths"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/go-txfile"
 )
@@ -47,9 +46,9 @@ func create(
 		return nil, err
 	}
 
-	path := config.File.Path
-	if path == "" {
-		path = paths.Resolve(paths.Data, "spool.dat")
+	path, err := ConfiguredPath(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	flushEvents := uint(0)
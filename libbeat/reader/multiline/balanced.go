@@ -0,0 +1,448 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import (
+	"io"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+)
+
+// MultiLine reader combining structured records spanning multiple lines into
+// one multi-line event.
+//
+// A record starts with a line whose first non-whitespace character opens a
+// JSON object or array, a bracketed block or an XML element, that is not
+// closed on the same line. Consecutive lines are added to the record until
+// the first delimiter is closed again. Lines not starting a record are
+// returned as is.
+//
+// The maximum number of lines is used as safeguard against records which are
+// never closed. If the limit is reached, or if the timeout expires, the
+// current record is returned. Errors will force the multiline reader to
+// return the currently active multiline event first and finally return the
+// actual error on next call to Next.
+type balancedReader struct {
+	reader    reader.Reader
+	scanner   delimiterScanner
+	maxLines  int
+	logger    *logp.Logger
+	msgBuffer *messageBuffer
+	state     func(*balancedReader) (reader.Message, error)
+}
+
+func newMultilineBalancedReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+) (reader.Reader, error) {
+	maxLines := defaultMaxLines
+	if config.MaxLines != nil {
+		maxLines = *config.MaxLines
+	}
+
+	tout := defaultMultilineTimeout
+	if config.Timeout != nil {
+		tout = *config.Timeout
+	}
+
+	if tout > 0 {
+		r = readfile.NewTimeoutReader(r, sigMultilineTimeout, tout)
+	}
+
+	br := &balancedReader{
+		reader:    r,
+		maxLines:  maxLines,
+		msgBuffer: newMessageBuffer(maxBytes, maxLines, []byte(separator), config.SkipNewLine),
+		logger:    logp.NewLogger("reader_multiline"),
+		state:     (*balancedReader).readFirst,
+	}
+	return br, nil
+}
+
+// Next returns next multi-line event.
+func (br *balancedReader) Next() (reader.Message, error) {
+	return br.state(br)
+}
+
+func (br *balancedReader) readFirst() (reader.Message, error) {
+	for {
+		message, err := br.reader.Next()
+		if err != nil {
+			// no lines buffered -> ignore timeout
+			if err == sigMultilineTimeout {
+				continue
+			}
+
+			// pass error to caller (next layer) for handling
+			return message, err
+		}
+
+		if message.Bytes == 0 {
+			continue
+		}
+
+		// no record started, return message
+		if !startsRecord(message.Content) {
+			return message, nil
+		}
+
+		br.scanner.reset()
+		br.scanner.scan(message.Content)
+		if !br.scanner.open() {
+			return message, nil
+		}
+
+		// Start new multiline event
+		br.msgBuffer.startNewMessage(message)
+		br.setState((*balancedReader).readNext)
+		return br.readNext()
+	}
+}
+
+func (br *balancedReader) readNext() (reader.Message, error) {
+	for {
+		if br.maxLines > 0 && br.msgBuffer.processedLines >= br.maxLines {
+			br.logger.Debug("Multiline event flushed because max_lines reached.")
+
+			msg := br.msgBuffer.finalize()
+			br.resetState()
+			return msg, nil
+		}
+
+		message, err := br.reader.Next()
+		if err != nil {
+			// handle multiline timeout signal
+			if err == sigMultilineTimeout {
+				// no lines buffered -> ignore timeout
+				if br.msgBuffer.isEmpty() {
+					continue
+				}
+
+				br.logger.Debug("Multiline event flushed because timeout reached.")
+
+				// return collected multiline event and
+				// empty buffer for new multiline event
+				msg := br.msgBuffer.finalize()
+				br.resetState()
+				return msg, nil
+			}
+
+			// handle error without any bytes returned from reader
+			if message.Bytes == 0 {
+				// no lines buffered -> return error
+				if br.msgBuffer.isEmpty() {
+					return reader.Message{}, err
+				}
+
+				// lines buffered, return multiline and error on next read
+				return br.collectMessageAfterError(err)
+			}
+
+			// add partial line and return multiline and error on next read
+			br.msgBuffer.addLine(message)
+			return br.collectMessageAfterError(err)
+		}
+
+		br.msgBuffer.addLine(message)
+		br.scanner.scan(message.Content)
+
+		if br.scanner.complete() {
+			msg := br.msgBuffer.finalize()
+			br.resetState()
+			return msg, nil
+		}
+	}
+}
+
+func (br *balancedReader) collectMessageAfterError(err error) (reader.Message, error) {
+	msg := br.msgBuffer.finalize()
+	br.msgBuffer.setErr(err)
+	br.setState((*balancedReader).readFailed)
+	return msg, nil
+}
+
+// readFailed returns empty message and error and resets line reader
+func (br *balancedReader) readFailed() (reader.Message, error) {
+	err := br.msgBuffer.err
+	br.msgBuffer.setErr(nil)
+	br.resetState()
+	return reader.Message{}, err
+}
+
+// resetState sets state of the reader to readFirst
+func (br *balancedReader) resetState() {
+	br.setState((*balancedReader).readFirst)
+}
+
+// setState sets state to the given function
+func (br *balancedReader) setState(next func(br *balancedReader) (reader.Message, error)) {
+	br.state = next
+}
+
+func (br *balancedReader) Close() error {
+	br.setState((*balancedReader).readClosed)
+	return br.reader.Close()
+}
+
+func (br *balancedReader) readClosed() (reader.Message, error) {
+	return reader.Message{}, io.EOF
+}
+
+// startsRecord checks if the first non-whitespace character of a line opens a
+// JSON object or array, a bracketed block, or an XML element, declaration or
+// comment.
+func startsRecord(line []byte) bool {
+	for i, c := range line {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{', '[':
+			return true
+		case '<':
+			return i+1 < len(line) && (isNameStart(line[i+1]) || line[i+1] == '?' || line[i+1] == '!')
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+type scanMode uint8
+
+const (
+	scanText      scanMode = iota
+	scanString             // JSON string
+	scanTag                // XML start or end tag
+	scanComment            // XML comment
+	scanCDATA              // XML CDATA section
+	scanDirective          // XML declaration, processing instruction or DTD
+)
+
+// delimiterScanner keeps track of the delimiters opened by a record over
+// multiple lines.
+//
+// Inside of brackets JSON strings are skipped, such that quoted delimiters are
+// not counted. Inside of XML elements only tags are tracked, the text content
+// is not interpreted. A closing delimiter which does not match the innermost
+// open delimiter ends the record. Once the first delimiter has been closed,
+// the remaining content is not scanned anymore.
+type delimiterScanner struct {
+	// stack of open delimiters. Brackets are stored as the opening bracket,
+	// XML elements by their name.
+	stack  []string
+	mode   scanMode
+	opened bool // at least one delimiter has been opened
+	broken bool // mismatched closing delimiter found
+
+	escaped bool // last character in JSON string was a backslash
+	quote   byte // quote character of an attribute value in a tag
+
+	tag        []byte // name of the current tag
+	tagDone    bool   // name of the current tag has been read
+	closingTag bool
+	last       byte // last non-whitespace character in the current tag
+}
+
+func (s *delimiterScanner) reset() {
+	*s = delimiterScanner{stack: s.stack[:0], tag: s.tag[:0]}
+}
+
+// complete returns true if all opened delimiters have been closed again or if
+// the record is malformed.
+func (s *delimiterScanner) complete() bool {
+	return s.broken || (s.opened && len(s.stack) == 0 && s.mode == scanText)
+}
+
+// open returns true if a bracket or XML element, including its start tag, is
+// still open. XML declarations and comments alone do not keep a record open.
+func (s *delimiterScanner) open() bool {
+	if s.broken {
+		return false
+	}
+	return len(s.stack) > 0 || (s.mode == scanTag && !s.closingTag)
+}
+
+func (s *delimiterScanner) scan(line []byte) {
+	for i := 0; i < len(line) && !s.complete(); i++ {
+		c := line[i]
+
+		switch s.mode {
+		case scanString:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.mode = scanText
+			}
+
+		case scanComment:
+			if hasPrefixAt(line, i, "-->") {
+				i += 2
+				s.mode = scanText
+			}
+
+		case scanCDATA:
+			if hasPrefixAt(line, i, "]]>") {
+				i += 2
+				s.mode = scanText
+			}
+
+		case scanDirective:
+			if c == '>' {
+				s.mode = scanText
+			}
+
+		case scanTag:
+			s.scanTag(c)
+
+		case scanText:
+			i += s.scanText(line, i)
+		}
+	}
+}
+
+// scanText handles the character at line[i] outside of strings and tags. It
+// returns the number of additional characters consumed.
+func (s *delimiterScanner) scanText(line []byte, i int) int {
+	c := line[i]
+
+	if c == '<' {
+		switch {
+		case hasPrefixAt(line, i, "<!--"):
+			s.mode = scanComment
+			return 3
+		case hasPrefixAt(line, i, "<![CDATA["):
+			s.mode = scanCDATA
+			return 8
+		case hasPrefixAt(line, i, "<?") || hasPrefixAt(line, i, "<!"):
+			s.mode = scanDirective
+			return 1
+		case hasPrefixAt(line, i, "</"):
+			s.startTag(true)
+			return 1
+		case i+1 < len(line) && isNameStart(line[i+1]):
+			s.startTag(false)
+			return 0
+		}
+		return 0
+	}
+
+	// The content of XML elements is not interpreted.
+	if s.inElement() {
+		return 0
+	}
+
+	switch c {
+	case '"':
+		if len(s.stack) > 0 {
+			s.mode = scanString
+		}
+	case '{', '[':
+		s.push(string(c))
+	case '}':
+		s.pop("{")
+	case ']':
+		s.pop("[")
+	}
+	return 0
+}
+
+func (s *delimiterScanner) startTag(closing bool) {
+	s.mode = scanTag
+	s.tag = s.tag[:0]
+	s.tagDone = false
+	s.closingTag = closing
+	s.quote = 0
+	s.last = 0
+}
+
+func (s *delimiterScanner) scanTag(c byte) {
+	if s.quote != 0 {
+		if c == s.quote {
+			s.quote = 0
+		}
+		return
+	}
+
+	switch c {
+	case '"', '\'':
+		s.quote = c
+	case '>':
+		s.mode = scanText
+		switch {
+		case s.closingTag:
+			s.pop(string(s.tag))
+		case s.last != '/':
+			s.push(string(s.tag))
+		default:
+			// self-closing element
+			s.opened = true
+		}
+		return
+	case ' ', '\t', '\r', '\n':
+		s.tagDone = true
+		return
+	case '/':
+		s.tagDone = true
+	default:
+		if !s.tagDone {
+			s.tag = append(s.tag, c)
+		}
+	}
+	s.last = c
+}
+
+// inElement returns true if the innermost open delimiter is an XML element.
+func (s *delimiterScanner) inElement() bool {
+	if len(s.stack) == 0 {
+		return false
+	}
+	switch s.stack[len(s.stack)-1] {
+	case "{", "[":
+		return false
+	}
+	return true
+}
+
+func (s *delimiterScanner) push(delim string) {
+	s.stack = append(s.stack, delim)
+	s.opened = true
+}
+
+func (s *delimiterScanner) pop(delim string) {
+	n := len(s.stack)
+	if n == 0 || s.stack[n-1] != delim {
+		s.broken = true
+		return
+	}
+	s.stack = s.stack[:n-1]
+}
+
+func hasPrefixAt(line []byte, i int, prefix string) bool {
+	return len(line)-i >= len(prefix) && string(line[i:i+len(prefix)]) == prefix
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == ':' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
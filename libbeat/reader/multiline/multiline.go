@@ -38,6 +38,8 @@ func New(
 		return newMultilineCountReader(r, separator, maxBytes, config)
 	case whilePatternMode:
 		return newMultilineWhilePatternReader(r, separator, maxBytes, config)
+	case balancedMode:
+		return newMultilineBalancedReader(r, separator, maxBytes, config)
 	default:
 		return nil, fmt.Errorf("unknown multiline type %d", config.Type)
 	}
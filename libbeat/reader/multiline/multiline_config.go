@@ -30,10 +30,12 @@ const (
 	patternMode multilineType = iota
 	countMode
 	whilePatternMode
+	balancedMode
 
 	patternStr      = "pattern"
 	countStr        = "count"
 	whilePatternStr = "while_pattern"
+	balancedStr     = "balanced"
 )
 
 var (
@@ -41,6 +43,7 @@ var (
 		patternStr:      patternMode,
 		countStr:        countMode,
 		whilePatternStr: whilePatternMode,
+		balancedStr:     balancedMode,
 	}
 )
 
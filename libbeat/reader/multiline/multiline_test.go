@@ -284,6 +284,90 @@ func TestMultilineWhilePattern(t *testing.T) {
 	)
 }
 
+func TestMultilineBalanced(t *testing.T) {
+	testMultilineOK(t,
+		Config{
+			Type: balancedMode,
+		},
+		6,
+		"{\n  \"message\": \"hello }\",\n  \"tags\": [\n    \"a\"\n  ]\n}\n",
+		"Exception in thread \"main\" java.lang.NullPointerException\n",
+		"        at com.example.myproject.Book.getTitle(Book.java:16)\n",
+		"{\"message\": \"single line\"}\n",
+		"<event id=\"1\">\n  <!-- </event> -->\n  <data>a < b</data>\n  <empty/>\n</event>\n",
+		"[\n  1, 2,\n  3\n]\n",
+	)
+	// records are flushed once max_lines is reached
+	maxLines := 2
+	testMultilineOK(t,
+		Config{
+			Type:     balancedMode,
+			MaxLines: &maxLines,
+		},
+		3,
+		"{\n  \"a\": 1,\n",
+		"  \"b\": 2\n",
+		"}\n",
+	)
+	// mismatched closing delimiters end the record
+	testMultilineOK(t,
+		Config{
+			Type: balancedMode,
+		},
+		2,
+		"{\n  \"a\": [1, 2}\n",
+		"not a record\n",
+	)
+	// lines closing their first delimiter are no records
+	testMultilineOK(t,
+		Config{
+			Type: balancedMode,
+		},
+		6,
+		"[INFO] retrying (attempt 2\n",
+		"{\n  \"attempt\": 2,\n  \"hosts\": [\"a\", \"b\"]\n}\n",
+		"[WARN] giving up [x\n",
+		"<?xml version=\"1.0\"?>\n",
+		"<!-- <event> -->\n",
+		"[\n  [1],\n  [2]\n]\n",
+	)
+}
+
+func TestDelimiterScanner(t *testing.T) {
+	tests := map[string]struct {
+		lines    []string
+		complete bool
+	}{
+		"json object":          {[]string{`{`, `"a": {"b": 1}`, `}`}, true},
+		"open json object":     {[]string{`{`, `"a": {"b": 1}`}, false},
+		"quoted delimiters":    {[]string{`{"a": "}]\"}"`}, false},
+		"escaped quote":        {[]string{`{"a": "\\"}`}, true},
+		"nested brackets":      {[]string{`[`, `{}`, `]`}, true},
+		"parentheses ignored":  {[]string{`[(`, `]`}, true},
+		"first record only":    {[]string{`[INFO] retrying [x`}, true},
+		"mismatched brackets":  {[]string{`[`, `}`}, true},
+		"xml element":          {[]string{`<a x="/>">`, `<b/>`, `</a>`}, true},
+		"open xml element":     {[]string{`<a>`, `<b>`, `</b>`}, false},
+		"xml declaration":      {[]string{`<?xml version="1.0"?>`}, false},
+		"xml multi-line tag":   {[]string{`<a`, `  x="1">`, `</a>`}, true},
+		"xml comment":          {[]string{`<a><!--`, `</a>`, `--></a>`}, true},
+		"xml cdata":            {[]string{`<a><![CDATA[</a>]]>`, `</a>`}, true},
+		"xml text not scanned": {[]string{`<a>{[(</a>`}, true},
+		"mismatched xml":       {[]string{`<a>`, `</b>`}, true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var s delimiterScanner
+			for _, line := range test.lines {
+				s.scan([]byte(line))
+			}
+			assert.Equal(t, test.complete, s.complete())
+		})
+	}
+}
+
 func testMultilineOK(t *testing.T, cfg Config, events int, expected ...string) {
 	_, buf := createLineBuffer(expected...)
 	r := createMultilineTestReader(t, buf, cfg)
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readfile
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression formats reported by DetectCompression.
+const (
+	CompressionNone  = ""
+	CompressionGzip  = "gzip"
+	CompressionBzip2 = "bzip2"
+	CompressionZstd  = "zstd"
+)
+
+// ErrUnsupportedCompression is returned by NewDecompressReader for
+// compression formats that are detected, but can not be decompressed.
+var ErrUnsupportedCompression = errors.New("unsupported compression format")
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// bzip2 streams start with "BZh", the block size, and the magic number of
+	// the first block. The block magic is checked as well, to not mistake
+	// plain text starting with "BZh" for a bzip2 stream.
+	magicBzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+)
+
+// DetectCompression checks the magic number at the beginning of r and
+// returns the compression format of the content. CompressionNone is returned
+// for files that are not compressed. r is reset to the beginning afterwards.
+func DetectCompression(r io.ReadSeeker) (string, error) {
+	var header [10]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return CompressionNone, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return CompressionNone, err
+	}
+
+	return compressionOf(header[:n]), nil
+}
+
+func compressionOf(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		return CompressionGzip
+	case bytes.HasPrefix(header, magicZstd):
+		return CompressionZstd
+	case len(header) == 10 && bytes.HasPrefix(header, magicBzip2) &&
+		header[3] >= '1' && header[3] <= '9' &&
+		bytes.Equal(header[4:], magicBzip2Block):
+		return CompressionBzip2
+	default:
+		return CompressionNone
+	}
+}
+
+// NewDecompressReader returns a reader for the decompressed content of r.
+// An error is returned for unsupported compression formats.
+func NewDecompressReader(r io.Reader, compression string) (io.Reader, error) {
+	switch compression {
+	case CompressionNone:
+		return r, nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionBzip2:
+		return bzip2.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w '%v'", ErrUnsupportedCompression, compression)
+	}
+}
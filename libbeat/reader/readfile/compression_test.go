@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package readfile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bzip2 compressed "line 1\nline 2\n"
+var bzip2Sample = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x31, 0x88, 0x21,
+	0x68, 0x00, 0x00, 0x05, 0x59, 0x00, 0x00, 0x10, 0x40, 0x00, 0x30, 0x00, 0x02,
+	0x25, 0x20, 0x00, 0x31, 0x0c, 0x08, 0x12, 0x86, 0x46, 0x89, 0x31, 0x90, 0x87,
+	0x10, 0xf1, 0x77, 0x24, 0x53, 0x85, 0x09, 0x03, 0x18, 0x82, 0x16, 0x80,
+}
+
+func TestDetectCompression(t *testing.T) {
+	cases := map[string]struct {
+		content []byte
+		want    string
+	}{
+		"empty":            {content: nil, want: CompressionNone},
+		"plain text":       {content: []byte("line 1\nline 2\n"), want: CompressionNone},
+		"text with BZh":    {content: []byte("BZh91 is not bzip2\n"), want: CompressionNone},
+		"gzip":             {content: gzipSample(t, "line 1\nline 2\n"), want: CompressionGzip},
+		"bzip2":            {content: bzip2Sample, want: CompressionBzip2},
+		"zstd magic":       {content: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, want: CompressionZstd},
+		"short gzip magic": {content: []byte{0x1f}, want: CompressionNone},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			r := bytes.NewReader(test.content)
+			compression, err := DetectCompression(r)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, compression)
+
+			// the reader must be reset to the start of the file
+			rest, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, len(test.content), len(rest))
+		})
+	}
+}
+
+func TestNewDecompressReader(t *testing.T) {
+	cases := map[string]struct {
+		content     []byte
+		compression string
+	}{
+		"plain": {content: []byte("line 1\nline 2\n"), compression: CompressionNone},
+		"gzip":  {content: gzipSample(t, "line 1\nline 2\n"), compression: CompressionGzip},
+		"bzip2": {content: bzip2Sample, compression: CompressionBzip2},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			r, err := NewDecompressReader(bytes.NewReader(test.content), test.compression)
+			require.NoError(t, err)
+
+			content, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "line 1\nline 2\n", string(content))
+		})
+	}
+
+	t.Run("zstd is not supported", func(t *testing.T) {
+		_, err := NewDecompressReader(bytes.NewReader(nil), CompressionZstd)
+		assert.True(t, errors.Is(err, ErrUnsupportedCompression))
+	})
+}
+
+func gzipSample(t *testing.T, content string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readxml
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/encoding/xml"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+// XMLReader parses XML records. The content of the message is not modified,
+// the decoded fields are added under the "xml" key.
+type XMLReader struct {
+	reader  reader.Reader
+	cfg     *Config
+	decoder *xml.Decoder
+	logger  *logp.Logger
+}
+
+// NewXMLReader creates a new reader that can decode XML.
+func NewXMLReader(r reader.Reader, cfg *Config) *XMLReader {
+	return &XMLReader{
+		reader:  r,
+		cfg:     cfg,
+		decoder: xml.NewDecoder(cfg.Config),
+		logger:  logp.NewLogger("reader_xml"),
+	}
+}
+
+// decode decodes the text parameter into a MapStr.
+func (r *XMLReader) decode(text []byte) common.MapStr {
+	xmlFields, err := r.decoder.Decode(bytes.NewReader(text))
+	if err != nil {
+		if !r.cfg.IgnoreDecodingError {
+			r.logger.Errorf("Error decoding XML: %v", err)
+		}
+		if r.cfg.AddErrorKey {
+			return common.MapStr{"error": createXMLError(fmt.Sprintf("Error decoding XML: %v", err))}
+		}
+		return nil
+	}
+	return xmlFields
+}
+
+// Next decodes XML and returns the filled Line object.
+func (r *XMLReader) Next() (reader.Message, error) {
+	message, err := r.reader.Next()
+	if err != nil {
+		return message, err
+	}
+
+	// empty lines are not decoded
+	if len(bytes.TrimSpace(message.Content)) == 0 {
+		return message, nil
+	}
+
+	if fields := r.decode(message.Content); fields != nil {
+		message.AddFields(common.MapStr{"xml": fields})
+	}
+	return message, nil
+}
+
+func (r *XMLReader) Close() error {
+	return r.reader.Close()
+}
+
+func createXMLError(message string) common.MapStr {
+	return common.MapStr{"message": message, "type": "xml"}
+}
+
+// MergeXMLFields writes the XML fields in the event map,
+// respecting the KeysUnderRoot and OverwriteKeys configuration options.
+// It returns the document ID and the timestamp, if configured and found.
+func MergeXMLFields(data common.MapStr, xmlFields common.MapStr, config Config) (string, time.Time) {
+	var id string
+	if key := config.DocumentID; key != "" {
+		if tmp, err := xmlFields.GetValue(key); err == nil {
+			if v, ok := tmp.(string); ok {
+				id = v
+				xmlFields.Delete(key)
+			}
+		}
+	}
+
+	if config.KeysUnderRoot {
+		// Delete existing xml key
+		delete(data, "xml")
+
+		event := &beat.Event{
+			Fields: data,
+		}
+		jsontransform.WriteJSONKeys(event, xmlFields, config.OverwriteKeys, config.AddErrorKey)
+
+		return id, event.Timestamp
+	}
+	return id, time.Time{}
+}
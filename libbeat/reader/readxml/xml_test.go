@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readxml
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/encoding/xml"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+type sliceReader struct {
+	lines []string
+}
+
+func (r *sliceReader) Next() (reader.Message, error) {
+	if len(r.lines) == 0 {
+		return reader.Message{}, io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return reader.Message{Content: []byte(line), Bytes: len(line)}, nil
+}
+
+func (r *sliceReader) Close() error { return nil }
+
+func TestXMLReader(t *testing.T) {
+	tests := map[string]struct {
+		config   Config
+		input    string
+		expected common.MapStr
+	}{
+		"valid XML": {
+			input: "<event id=\"1\">\n  <level>error</level>\n</event>",
+			expected: common.MapStr{
+				"xml": common.MapStr{
+					"event": common.MapStr{"id": "1", "level": "error"},
+				},
+			},
+		},
+		"decoder options": {
+			config: Config{Config: xml.Config{AttributePrefix: "-", ToLower: true}},
+			input:  `<Event ID="1"/>`,
+			expected: common.MapStr{
+				"xml": common.MapStr{
+					"event": common.MapStr{"-id": "1"},
+				},
+			},
+		},
+		"invalid XML": {
+			input:    `Exception in thread "main"`,
+			expected: nil,
+		},
+		"invalid XML with error key": {
+			config: Config{AddErrorKey: true},
+			input:  `<event>`,
+			expected: common.MapStr{
+				"xml": common.MapStr{
+					"error": common.MapStr{
+						"message": "Error decoding XML: XML syntax error on line 1: unexpected EOF",
+						"type":    "xml",
+					},
+				},
+			},
+		},
+		"empty line": {
+			config:   Config{AddErrorKey: true},
+			input:    "  ",
+			expected: nil,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			r := NewXMLReader(&sliceReader{lines: []string{test.input}}, &test.config)
+
+			message, err := r.Next()
+			require.NoError(t, err)
+			assert.Equal(t, test.input, string(message.Content))
+			assert.Equal(t, test.expected, message.Fields)
+		})
+	}
+}
+
+func TestMergeXMLFields(t *testing.T) {
+	xmlFields := func() common.MapStr {
+		return common.MapStr{
+			"event": common.MapStr{"id": "42", "level": "error"},
+		}
+	}
+
+	tests := map[string]struct {
+		config     Config
+		data       common.MapStr
+		expected   common.MapStr
+		expectedID string
+	}{
+		"keep under xml key": {
+			config: Config{},
+			data:   common.MapStr{"xml": xmlFields(), "message": "text"},
+			expected: common.MapStr{
+				"xml":     xmlFields(),
+				"message": "text",
+			},
+		},
+		"keys under root": {
+			config: Config{KeysUnderRoot: true},
+			data:   common.MapStr{"xml": xmlFields(), "event": common.MapStr{"id": "1"}},
+			expected: common.MapStr{
+				"event": common.MapStr{"id": "1", "level": "error"},
+			},
+		},
+		"overwrite keys": {
+			config: Config{KeysUnderRoot: true, OverwriteKeys: true},
+			data:   common.MapStr{"xml": xmlFields(), "event": common.MapStr{"id": "1"}},
+			expected: common.MapStr{
+				"event": common.MapStr{"id": "42", "level": "error"},
+			},
+		},
+		"document id": {
+			config: Config{DocumentID: "event.id"},
+			data:   common.MapStr{"xml": xmlFields()},
+			expected: common.MapStr{
+				"xml": common.MapStr{
+					"event": common.MapStr{"level": "error"},
+				},
+			},
+			expectedID: "42",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			id, _ := MergeXMLFields(test.data, test.data["xml"].(common.MapStr), test.config)
+			assert.Equal(t, test.expected, test.data)
+			assert.Equal(t, test.expectedID, id)
+		})
+	}
+}
@@ -17,6 +17,8 @@
 
 package backend
 
+import "time"
+
 // Registry provides access to stores managed by the backend storage.
 type Registry interface {
 	// Access opens a store. The store will be closed by the frontend, once all
@@ -59,6 +61,12 @@ type Store interface {
 	// the value given can not be encoded.
 	Set(key string, value interface{}) error
 
+	// SetWithTTL inserts or overwrites a key pair in the store, like Set. The
+	// key expires once ttl has passed. Expired keys must not be reported by
+	// Has, Get, or Each, and should eventually be removed from the store.
+	// Calling Set on the key clears the TTL.
+	SetWithTTL(key string, value interface{}, ttl time.Duration) error
+
 	// Remove removes and entry from the store.
 	Remove(string) error
 
@@ -68,4 +76,9 @@ type Store interface {
 	// is assumed to be invalidated once fn returns
 	// The loop shall return if fn returns an error or false.
 	Each(fn func(string, ValueDecoder) (bool, error)) error
+
+	// EachPrefix loops over all key value pairs with keys starting with
+	// prefix, like Each. Backends keeping the keys ordered should only visit
+	// the matching keys, instead of filtering the full store.
+	EachPrefix(prefix string, fn func(string, ValueDecoder) (bool, error)) error
 }
@@ -0,0 +1,35 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package boltstore implements a statestore backend on top of bbolt.
+// Unlike memlog, the store does not hold all key-value pairs in memory.
+// Every store is a single bbolt database file, and all operations are
+// executed as transactions directly on the file. This keeps memory usage and
+// write amplification low for stores with a very large number of keys, at
+// the cost of slower individual operations.
+//
+// Values are normalized the same way as in memlog: structured data is
+// converted into a map[string]interface{} before being serialized as JSON,
+// so that no references into data structures passed via Set are held and
+// Get can decode into a different type than was passed to Set.
+//
+// The database file of a store is written to `<root>/<store name>/bolt.db`,
+// which is the same directory memlog uses for the store. When opening a
+// store that has no database file yet, but contains memlog files, all
+// key-value pairs are imported from memlog first. The memlog files are then
+// moved into the `memlog.migrated` sub-directory.
+package boltstore
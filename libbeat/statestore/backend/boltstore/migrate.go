@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+)
+
+const (
+	memlogMetaFileName    = "meta.json"
+	memlogMigratedDirName = "memlog.migrated"
+)
+
+// expiryIterator is implemented by the memlog store, to copy the expiration
+// times of keys with TTL.
+type expiryIterator interface {
+	EachWithExpiry(fn func(string, backend.ValueDecoder, time.Time) (bool, error)) error
+}
+
+// hasMemlogState checks if the store directory contains memlog files.
+func hasMemlogState(home string) bool {
+	_, err := os.Stat(filepath.Join(home, memlogMetaFileName))
+	return err == nil
+}
+
+// migrateMemlog imports all key-value pairs from the memlog store in home
+// into a new database file. The database file is written to a temporary
+// file first, and only moved into place once all state has been copied.
+func migrateMemlog(log *logp.Logger, home string, settings Settings) error {
+	log.Infof("Migrating memlog store in '%v' to bbolt", home)
+
+	memlogReg, err := memlog.New(log, memlog.Settings{
+		Root:     filepath.Dir(home),
+		FileMode: settings.FileMode,
+	})
+	if err != nil {
+		return err
+	}
+	defer memlogReg.Close()
+
+	src, err := memlogReg.Access(filepath.Base(home))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dbPath := filepath.Join(home, dbFileName)
+	tmpPath := dbPath + ".tmp"
+	os.Remove(tmpPath)
+
+	db, err := openDB(tmpPath, settings)
+	if err != nil {
+		return err
+	}
+
+	iter, ok := src.(expiryIterator)
+	if !ok {
+		return fmt.Errorf("memlog store in '%v' does not report TTLs", home)
+	}
+
+	count := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		return iter.EachWithExpiry(func(key string, dec backend.ValueDecoder, expires time.Time) (bool, error) {
+			var value map[string]interface{}
+			if err := dec.Decode(&value); err != nil {
+				return false, fmt.Errorf("failed to read key '%v': %w", key, err)
+			}
+			raw, err := encodeValue(value)
+			if err != nil {
+				return false, err
+			}
+			if !expires.IsZero() {
+				if err := setTTL(tx, []byte(key), expires.UnixNano()/int64(time.Millisecond)); err != nil {
+					return false, err
+				}
+			}
+			count++
+			return true, bucket.Put([]byte(key), raw)
+		})
+	})
+	if err == nil {
+		err = db.Sync()
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	log.Infof("Migrated %v entries from memlog store in '%v'", count, home)
+	return nil
+}
+
+// finishMemlogMigration moves the memlog files out of the way once the
+// database file exists, so the old state can not be loaded by accident.
+func finishMemlogMigration(log *logp.Logger, home string) error {
+	if _, err := os.Stat(filepath.Join(home, dbFileName)); err != nil || !hasMemlogState(home) {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(home)
+	if err != nil {
+		return err
+	}
+
+	backupDir := filepath.Join(home, memlogMigratedDirName)
+	if err := os.MkdirAll(backupDir, os.ModeDir|0770); err != nil {
+		return err
+	}
+
+	// The meta file is moved last, so an interrupted move is retried on the
+	// next start.
+	var names []string
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || name == dbFileName || name == memlogMetaFileName {
+			continue
+		}
+		names = append(names, name)
+	}
+	names = append(names, memlogMetaFileName)
+
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(home, name), filepath.Join(backupDir, name)); err != nil {
+			return fmt.Errorf("failed to move migrated memlog file '%v': %w", name, err)
+		}
+	}
+
+	log.Infof("Moved migrated memlog files to '%v'", backupDir)
+	return nil
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// Registry configures access to bbolt based stores.
+type Registry struct {
+	log *logp.Logger
+
+	mu     sync.Mutex
+	active bool
+
+	settings Settings
+}
+
+// Settings configures a new Registry.
+type Settings struct {
+	// Registry root directory. Stores will be single sub-directories.
+	Root string
+
+	// FileMode is used to configure the file mode for new files generated by the
+	// registry.  File mode 0600 will be used if this field is not set.
+	FileMode os.FileMode
+
+	// Timeout configures how long to wait for the lock on a store's database
+	// file when it is in use by another process. Defaults to 1s.
+	Timeout time.Duration
+
+	// NoSync disables fsync after each update. This improves write
+	// throughput, but updates might be lost and the database file might be
+	// corrupted if the machine crashes.
+	NoSync bool
+
+	// MaxBatchDelay is how long an update waits for concurrent updates, so
+	// that they are committed in a single transaction with a single fsync.
+	// Defaults to 1ms.
+	MaxBatchDelay time.Duration
+}
+
+const defaultFileMode os.FileMode = 0600
+
+const defaultTimeout = 1 * time.Second
+
+const defaultMaxBatchDelay = 1 * time.Millisecond
+
+// New configures a bbolt Registry that can be used to open stores.
+func New(log *logp.Logger, settings Settings) (*Registry, error) {
+	if settings.FileMode == 0 {
+		settings.FileMode = defaultFileMode
+	}
+	if settings.Timeout == 0 {
+		settings.Timeout = defaultTimeout
+	}
+	if settings.MaxBatchDelay == 0 {
+		settings.MaxBatchDelay = defaultMaxBatchDelay
+	}
+
+	root, err := filepath.Abs(settings.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Root = root
+	return &Registry{
+		log:      log,
+		active:   true,
+		settings: settings,
+	}, nil
+}
+
+// Access creates or opens a new store. A new sub-directory for the store is
+// created, if the store does not exist. Existing memlog state in the store
+// directory is migrated on first access.
+func (r *Registry) Access(name string) (backend.Store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return nil, errRegClosed
+	}
+
+	logger := r.log.With("store", name)
+	home := filepath.Join(r.settings.Root, name)
+	return openStore(logger, home, r.settings)
+}
+
+// Close closes the registry. No new store can be accessed after close.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = false
+	return nil
+}
@@ -0,0 +1,336 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package boltstore implements a statestore backend on top of bbolt.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// store implements a bbolt based store. All key-value pairs are stored in a
+// single bucket. bbolt serializes write transactions and allows concurrent
+// read transactions, so no additional locking is required. Concurrent
+// updates are batched into a single write transaction, so they share the
+// cost of one fsync.
+//
+// The expiration times of keys with a TTL are stored in two additional
+// buckets: the ttl bucket maps keys to their expiration time, and the
+// expiry bucket indexes keys by expiration time, so expired keys can be
+// found without scanning the store. Expired keys are hidden from readers and
+// deleted by subsequent write transactions.
+type store struct {
+	log *logp.Logger
+	db  *bolt.DB
+}
+
+// entry decodes a value read within a transaction.
+type entry struct {
+	raw []byte
+}
+
+const dbFileName = "bolt.db"
+
+var (
+	bucketName       = []byte("state")
+	ttlBucketName    = []byte("ttl")
+	expiryBucketName = []byte("expiry")
+)
+
+// expiredBatchSize limits the number of expired keys deleted per write
+// transaction, so that a large number of expired keys does not block
+// updates for long.
+const expiredBatchSize = 256
+
+// timeNow is used to check for expired entries. It can be replaced in tests.
+var timeNow = time.Now
+
+// openStore opens the store in the home directory. The directory and
+// intermediate directories will be created if it does not exist.
+func openStore(log *logp.Logger, home string, settings Settings) (*store, error) {
+	fi, err := os.Stat(home)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(home, os.ModeDir|0770); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if !fi.Mode().IsDir() {
+		return nil, fmt.Errorf("'%v' is not a directory", home)
+	}
+
+	dbPath := filepath.Join(home, dbFileName)
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) && hasMemlogState(home) {
+		if err := migrateMemlog(log, home, settings); err != nil {
+			return nil, fmt.Errorf("failed to migrate memlog store in '%v': %w", home, err)
+		}
+	}
+	if err := finishMemlogMigration(log, home); err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(dbPath, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Opened bbolt store '%v'", dbPath)
+	return &store{log: log, db: db}, nil
+}
+
+// openDB opens or creates the database file and ensures the state bucket
+// exists.
+func openDB(path string, settings Settings) (*bolt.DB, error) {
+	db, err := bolt.Open(path, settings.FileMode, &bolt.Options{
+		Timeout: settings.Timeout,
+		NoSync:  settings.NoSync,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%v': %w", path, err)
+	}
+	db.MaxBatchDelay = settings.MaxBatchDelay
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketName, ttlBucketName, expiryBucketName} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the database file. Access to the store after close returns
+// an error.
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// Has checks if the key is known.
+func (s *store) Has(key string) (bool, error) {
+	var exists bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		exists = lookup(tx, []byte(key), nowMillis()) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// Get retrieves and decodes the key-value pair into to.
+func (s *store) Get(key string, to interface{}) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		raw := lookup(tx, []byte(key), nowMillis())
+		if raw == nil {
+			return errKeyUnknown
+		}
+		return entry{raw}.Decode(to)
+	})
+}
+
+// Set inserts or overwrites a key-value pair.
+func (s *store) Set(key string, value interface{}) error {
+	return s.set(key, value, 0)
+}
+
+// SetWithTTL inserts or overwrites a key-value pair that expires after ttl.
+func (s *store) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	return s.set(key, value, nowMillis()+ttl.Milliseconds())
+}
+
+func (s *store) set(key string, value interface{}, expires int64) error {
+	raw, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		k := []byte(key)
+		if err := clearTTL(tx, k); err != nil {
+			return err
+		}
+		if expires != 0 {
+			if err := setTTL(tx, k, expires); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(bucketName).Put(k, raw)
+	})
+}
+
+// Remove removes a key from the store. The operation does not check if the
+// key exists.
+func (s *store) Remove(key string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		k := []byte(key)
+		if err := clearTTL(tx, k); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketName).Delete(k)
+	})
+}
+
+// Each iterates over all key-value pairs in the store, ordered by key.
+// fn must not modify the store, as the iteration runs within a read
+// transaction.
+func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.EachPrefix("", fn)
+}
+
+// EachPrefix iterates over all key-value pairs with keys starting with
+// prefix, ordered by key. Only the matching keys are visited.
+// fn must not modify the store, as the iteration runs within a read
+// transaction.
+func (s *store) EachPrefix(prefix string, fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		now := nowMillis()
+		ttls := tx.Bucket(ttlBucketName)
+		p := []byte(prefix)
+
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if isExpired(ttls.Get(k), now) {
+				continue
+			}
+
+			cont, err := fn(string(k), entry{v})
+			if !cont || err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// update runs fn in a write transaction, deleting expired keys first. The
+// transaction can be shared with concurrent updates, and fn can be run more
+// than once if one of them fails, so fn must be idempotent.
+func (s *store) update(fn func(tx *bolt.Tx) error) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		if err := removeExpired(tx, nowMillis(), expiredBatchSize); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// lookup returns the raw value of key, or nil if the key is unknown or
+// expired.
+func lookup(tx *bolt.Tx, key []byte, now int64) []byte {
+	if isExpired(tx.Bucket(ttlBucketName).Get(key), now) {
+		return nil
+	}
+	return tx.Bucket(bucketName).Get(key)
+}
+
+func setTTL(tx *bolt.Tx, key []byte, expires int64) error {
+	ts := encodeTimestamp(expires)
+	if err := tx.Bucket(ttlBucketName).Put(key, ts); err != nil {
+		return err
+	}
+	return tx.Bucket(expiryBucketName).Put(expiryKey(ts, key), nil)
+}
+
+func clearTTL(tx *bolt.Tx, key []byte) error {
+	ttls := tx.Bucket(ttlBucketName)
+	ts := ttls.Get(key)
+	if ts == nil {
+		return nil
+	}
+	if err := tx.Bucket(expiryBucketName).Delete(expiryKey(ts, key)); err != nil {
+		return err
+	}
+	return ttls.Delete(key)
+}
+
+// removeExpired deletes up to limit keys that have expired at the time now.
+func removeExpired(tx *bolt.Tx, now int64, limit int) error {
+	var expired [][]byte
+	c := tx.Bucket(expiryBucketName).Cursor()
+	for k, _ := c.First(); k != nil && len(expired) < limit; k, _ = c.Next() {
+		if !isExpired(k[:8], now) {
+			break
+		}
+		expired = append(expired, append([]byte(nil), k[8:]...))
+	}
+
+	for _, key := range expired {
+		if err := clearTTL(tx, key); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketName).Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expiryKey builds the key of the expiry index. The big endian timestamp
+// prefix sorts the index by expiration time.
+func expiryKey(ts, key []byte) []byte {
+	k := make([]byte, 0, len(ts)+len(key))
+	return append(append(k, ts...), key...)
+}
+
+func encodeTimestamp(ms int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(ms))
+	return b
+}
+
+func isExpired(ts []byte, now int64) bool {
+	return ts != nil && int64(binary.BigEndian.Uint64(ts)) <= now
+}
+
+func nowMillis() int64 {
+	return timeNow().UnixNano() / int64(time.Millisecond)
+}
+
+// encodeValue normalizes value into a map[string]interface{}, like memlog
+// does, and serializes it as JSON.
+func encodeValue(value interface{}) ([]byte, error) {
+	var tmp common.MapStr
+	if err := typeconv.Convert(&tmp, value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tmp)
+}
+
+func (e entry) Decode(to interface{}) error {
+	var tmp map[string]interface{}
+	if err := json.Unmarshal(e.raw, &tmp); err != nil {
+		return err
+	}
+	return typeconv.Convert(to, tmp)
+}
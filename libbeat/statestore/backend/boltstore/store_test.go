@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/beats/v7/libbeat/statestore/internal/storecompliance"
+)
+
+func init() {
+	logp.DevelopmentSetup()
+}
+
+func TestCompliance_Default(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		return New(logp.NewLogger("test"), Settings{Root: testPath})
+	})
+}
+
+func TestCompliance_NoSync(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		return New(logp.NewLogger("test"), Settings{Root: testPath, NoSync: true})
+	})
+}
+
+func TestMigrateMemlog(t *testing.T) {
+	path, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	type state struct {
+		Offset uint64
+		Source string
+	}
+	states := map[string]state{
+		"a": {Offset: 10, Source: "/var/log/a.log"},
+		"b": {Offset: 20, Source: "/var/log/b.log"},
+	}
+
+	// write the states using memlog
+	func() {
+		reg, err := memlog.New(logp.NewLogger("test"), memlog.Settings{Root: path})
+		require.NoError(t, err)
+		defer reg.Close()
+
+		store, err := reg.Access("test")
+		require.NoError(t, err)
+		defer store.Close()
+
+		for k, v := range states {
+			require.NoError(t, store.Set(k, v))
+		}
+		require.NoError(t, store.SetWithTTL("c", state{Offset: 30}, time.Hour))
+	}()
+
+	reg, err := New(logp.NewLogger("test"), Settings{Root: path})
+	require.NoError(t, err)
+	defer reg.Close()
+
+	store, err := reg.Access("test")
+	require.NoError(t, err)
+	defer store.Close()
+
+	for k, expected := range states {
+		var actual state
+		require.NoError(t, store.Get(k, &actual))
+		assert.Equal(t, expected, actual)
+	}
+
+	var actual state
+	require.NoError(t, store.Get("c", &actual), "key with TTL must be migrated")
+	assert.Equal(t, state{Offset: 30}, actual)
+
+	defer func(old func() time.Time) { timeNow = old }(timeNow)
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	has, err := store.Has("c")
+	require.NoError(t, err)
+	assert.False(t, has, "TTL must be kept by the migration")
+
+	assert.FileExists(t, filepath.Join(path, "test", dbFileName))
+	assert.FileExists(t, filepath.Join(path, "test", memlogMigratedDirName, memlogMetaFileName))
+	assert.False(t, hasMemlogState(filepath.Join(path, "test")))
+}
+
+// BenchmarkSet compares updates of the bbolt store with memlog, for a single
+// writer and for concurrent writers whose updates can be batched.
+func BenchmarkSet(b *testing.B) {
+	registries := map[string]func(root string) (backend.Registry, error){
+		"memlog": func(root string) (backend.Registry, error) {
+			return memlog.New(logp.NewLogger("bench"), memlog.Settings{Root: root})
+		},
+		"bbolt": func(root string) (backend.Registry, error) {
+			return New(logp.NewLogger("bench"), Settings{Root: root})
+		},
+		"bbolt-nosync": func(root string) (backend.Registry, error) {
+			return New(logp.NewLogger("bench"), Settings{Root: root, NoSync: true})
+		},
+	}
+
+	type state struct {
+		Offset uint64
+		Source string
+	}
+
+	for name, newRegistry := range registries {
+		newRegistry := newRegistry
+		b.Run(name, func(b *testing.B) {
+			b.Run("sequential", func(b *testing.B) {
+				store := openBenchStore(b, newRegistry)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					key := fmt.Sprintf("key-%d", i%1000)
+					if err := store.Set(key, state{Offset: uint64(i), Source: key}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("parallel", func(b *testing.B) {
+				store := openBenchStore(b, newRegistry)
+				var n uint64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						i := atomic.AddUint64(&n, 1)
+						key := fmt.Sprintf("key-%d", i%1000)
+						if err := store.Set(key, state{Offset: i, Source: key}); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			})
+		})
+	}
+}
+
+func openBenchStore(
+	b *testing.B, newRegistry func(root string) (backend.Registry, error),
+) backend.Store {
+	path, err := ioutil.TempDir("", "")
+	require.NoError(b, err)
+	b.Cleanup(func() { os.RemoveAll(path) })
+
+	reg, err := newRegistry(path)
+	require.NoError(b, err)
+	b.Cleanup(func() { reg.Close() })
+
+	store, err := reg.Access("bench")
+	require.NoError(b, err)
+	b.Cleanup(func() { store.Close() })
+	return store
+}
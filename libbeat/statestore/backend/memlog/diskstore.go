@@ -77,8 +77,9 @@ type dataFileInfo struct {
 
 // storeEntry is used to write entries to the checkpoint file only.
 type storeEntry struct {
-	Key    string        `struct:"_key"`
-	Fields common.MapStr `struct:",inline"`
+	Key     string        `struct:"_key"`
+	Expires int64         `struct:"_expires,omitempty"`
+	Fields  common.MapStr `struct:",inline"`
 }
 
 // storeMeta is read from the meta file.
@@ -103,7 +104,8 @@ const (
 
 	storeVersion = "1"
 
-	keyField = "_key"
+	keyField     = "_key"
+	expiresField = "_expires"
 )
 
 // newDiskStore initializes the disk store stucture only. The store must have
@@ -363,8 +365,9 @@ func (s *diskstore) checkpointTmpFile(tempfile string, states map[string]entry)
 		}
 
 		err = enc.Encode(storeEntry{
-			Key:    key,
-			Fields: entry.value,
+			Key:     key,
+			Expires: entry.expires,
+			Fields:  entry.value,
 		})
 		if err != nil {
 			return "", err
@@ -518,13 +521,13 @@ func loadDataFile(path string, tbl map[string]entry) error {
 		return nil
 	}
 
-	err := readDataFile(path, func(key string, state common.MapStr) {
-		tbl[key] = entry{value: state}
+	err := readDataFile(path, func(key string, state common.MapStr, expires int64) {
+		tbl[key] = entry{value: state, expires: expires}
 	})
 	return err
 }
 
-func readDataFile(path string, fn func(string, common.MapStr)) error {
+func readDataFile(path string, fn func(string, common.MapStr, int64)) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
@@ -538,14 +541,20 @@ func readDataFile(path string, fn func(string, common.MapStr)) error {
 	}
 
 	for _, state := range states {
-		keyRaw := state["_key"]
+		keyRaw := state[keyField]
 		key, ok := keyRaw.(string)
 		if !ok {
 			continue
 		}
 
-		delete(state, "_key")
-		fn(key, common.MapStr(state))
+		var expires int64
+		if f, ok := state[expiresField].(float64); ok {
+			expires = int64(f)
+		}
+
+		delete(state, keyField)
+		delete(state, expiresField)
+		fn(key, common.MapStr(state), expires)
 	}
 
 	return nil
@@ -576,7 +585,7 @@ func loadLogFile(
 		switch op := rawOp.(type) {
 		case *opSet:
 			entries++
-			store.Set(op.K, op.V)
+			store.Set(op.K, op.V, op.E)
 		case *opRemove:
 			entries++
 			store.Remove(op.K)
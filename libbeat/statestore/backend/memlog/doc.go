@@ -45,6 +45,8 @@
 // that must always be increased by 1.
 // The data entry for the 'set' operation has the format: `{"K": "<key>", "V": { ... }}`.
 // The data entry for the 'remove' operation has the format: `{"K": "<key>"}`.
+// Keys set with a TTL have the expiration time in unix milliseconds added to
+// the 'set' data entry as `"E": <timestamp>`.
 // Updates to the log file are not synced to disk. Having all updates available
 // between restarts/crashes also depends on the capabilities of the operation
 // system and file system. When opening the store we read up until it is
@@ -62,9 +64,11 @@
 // us to sort them by name. The checkpoint operation of memlog, writes the full
 // state into a new data file, that consists of an JSON array with all known
 // key-value pairs.  Each JSON object in the array consists of the value
-// object, with memlog private fields added. Private fields start with `_`. At
-// the moment the only private field is `_key`, which is used to identify the
-// key-value pair.
+// object, with memlog private fields added. Private fields start with `_`.
+// The private field `_key` is used to identify the key-value pair. Keys with
+// a TTL also have the private field `_expires`, holding the expiration time
+// in unix milliseconds. Expired keys are not visible to readers, and are not
+// written to new data files on checkpoint.
 // NOTE: Creating a new file guarantees that Beats can progress when creating a
 //       new checkpoint file.  Some filesystems tend to block the
 //       delete/replace operation when the file is accessed by another process
@@ -25,9 +25,11 @@ type (
 	}
 
 	// opSet encodes the 'Set' operations in the update log.
+	// E holds the expiration time in unix milliseconds, if the key has a TTL.
 	opSet struct {
 		K string
 		V common.MapStr
+		E int64 `struct:"E,omitempty"`
 	}
 
 	// opRemove encodes the 'Remove' operation in the update log.
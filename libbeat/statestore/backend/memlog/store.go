@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
@@ -50,8 +52,15 @@ type memstore struct {
 
 type entry struct {
 	value map[string]interface{}
+
+	// expires holds the expiration time in unix milliseconds. Entries
+	// without TTL have expires set to 0.
+	expires int64
 }
 
+// timeNow is used to check for expired entries. It can be replaced in tests.
+var timeNow = time.Now
+
 // openStore opens a store from the home path.
 // The directory and intermediate directories will be created if it does not exist.
 // The open routine loads the full key-value store into memory by first reading the data file and finally applying all outstanding updates
@@ -155,7 +164,7 @@ func (s *store) Close() error {
 func (s *store) Has(key string) (bool, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-	return s.mem.Has(key), nil
+	return s.mem.Has(key, nowMillis()), nil
 }
 
 // Get retrieves and decodes the key-value pair into to.
@@ -163,7 +172,7 @@ func (s *store) Get(key string, to interface{}) error {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	dec := s.mem.Get(key)
+	dec := s.mem.Get(key, nowMillis())
 	if dec == nil {
 		return errKeyUnknown
 	}
@@ -174,6 +183,17 @@ func (s *store) Get(key string, to interface{}) error {
 // If encoding was successful the in-memory state will be updated and a
 // set-operation is logged to the diskstore.
 func (s *store) Set(key string, value interface{}) error {
+	return s.set(key, value, 0)
+}
+
+// SetWithTTL inserts or overwrites a key-value pair that expires after ttl.
+// Expired entries are hidden from readers, and are removed from disk on the
+// next checkpoint.
+func (s *store) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	return s.set(key, value, nowMillis()+ttl.Milliseconds())
+}
+
+func (s *store) set(key string, value interface{}, expires int64) error {
 	var tmp common.MapStr
 	if err := typeconv.Convert(&tmp, value); err != nil {
 		return err
@@ -182,8 +202,8 @@ func (s *store) Set(key string, value interface{}) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.mem.Set(key, tmp)
-	return s.logOperation(&opSet{K: key, V: tmp})
+	s.mem.Set(key, tmp, expires)
+	return s.logOperation(&opSet{K: key, V: tmp, E: expires})
 }
 
 // Remove removes a key from the in memory store and logs a remove operation to
@@ -203,6 +223,13 @@ func (s *store) Checkpoint() error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
+	return s.checkpoint()
+}
+
+// checkpoint removes expired entries before writing all state to a new data
+// file.
+func (s *store) checkpoint() error {
+	s.mem.RemoveExpired(nowMillis())
 	return s.disk.WriteCheckpoint(s.mem.table)
 }
 
@@ -211,7 +238,7 @@ func (s *store) Checkpoint() error {
 // operation type to the update log file.
 func (s *store) logOperation(op op) error {
 	if s.disk.mustCheckpoint() {
-		err := s.disk.WriteCheckpoint(s.mem.table)
+		err := s.checkpoint()
 		if err != nil {
 			// if writing the new checkpoint file failed we try to fallback to
 			// appending the log operation.
@@ -227,10 +254,22 @@ func (s *store) logOperation(op op) error {
 
 // Each iterates over all key-value pairs in the store.
 func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.EachPrefix("", fn)
+}
+
+// EachPrefix iterates over all key-value pairs with keys starting with prefix.
+// The hashtable has no key order, so all keys are checked, but fn is only
+// called for matching keys.
+func (s *store) EachPrefix(prefix string, fn func(string, backend.ValueDecoder) (bool, error)) error {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
+	now := nowMillis()
 	for k, entry := range s.mem.table {
+		if !strings.HasPrefix(k, prefix) || entry.expired(now) {
+			continue
+		}
+
 		cont, err := fn(k, entry)
 		if !cont || err != nil {
 			return err
@@ -240,21 +279,47 @@ func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error
 	return nil
 }
 
-func (m *memstore) Has(key string) bool {
-	_, exists := m.table[key]
-	return exists
+// EachWithExpiry iterates over all key-value pairs not expired yet, like Each.
+// The expiration time is passed to fn, and is zero for keys without TTL.
+// EachWithExpiry is used to migrate the store, without losing the TTLs.
+func (s *store) EachWithExpiry(fn func(string, backend.ValueDecoder, time.Time) (bool, error)) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	now := nowMillis()
+	for k, entry := range s.mem.table {
+		if entry.expired(now) {
+			continue
+		}
+
+		var expires time.Time
+		if entry.expires != 0 {
+			expires = time.Unix(0, entry.expires*int64(time.Millisecond))
+		}
+		cont, err := fn(k, entry, expires)
+		if !cont || err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (m *memstore) Get(key string) backend.ValueDecoder {
+func (m *memstore) Has(key string, now int64) bool {
 	entry, exists := m.table[key]
-	if !exists {
+	return exists && !entry.expired(now)
+}
+
+func (m *memstore) Get(key string, now int64) backend.ValueDecoder {
+	entry, exists := m.table[key]
+	if !exists || entry.expired(now) {
 		return nil
 	}
 	return entry
 }
 
-func (m *memstore) Set(key string, value common.MapStr) {
-	m.table[key] = entry{value: value}
+func (m *memstore) Set(key string, value common.MapStr, expires int64) {
+	m.table[key] = entry{value: value, expires: expires}
 }
 
 func (m *memstore) Remove(key string) bool {
@@ -266,6 +331,23 @@ func (m *memstore) Remove(key string) bool {
 	return true
 }
 
+// RemoveExpired deletes all entries that have expired at the time now.
+func (m *memstore) RemoveExpired(now int64) {
+	for key, entry := range m.table {
+		if entry.expired(now) {
+			delete(m.table, key)
+		}
+	}
+}
+
+func (e entry) expired(now int64) bool {
+	return e.expires != 0 && e.expires <= now
+}
+
 func (e entry) Decode(to interface{}) error {
 	return typeconv.Convert(to, e.value)
 }
+
+func nowMillis() int64 {
+	return timeNow().UnixNano() / int64(time.Millisecond)
+}
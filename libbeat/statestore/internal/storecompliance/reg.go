@@ -19,6 +19,7 @@ package storecompliance
 
 import (
 	"testing"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/statestore/backend"
 )
@@ -106,6 +107,12 @@ func (s *Store) MustSet(key string, from interface{}) {
 	must(s.Registry.T, err, "unexpected error on store/set call")
 }
 
+// MustSetWithTTL fails the test if an error occured in a call to SetWithTTL.
+func (s *Store) MustSetWithTTL(key string, from interface{}, ttl time.Duration) {
+	err := s.SetWithTTL(key, from, ttl)
+	must(s.Registry.T, err, "unexpected error on store/set-ttl call")
+}
+
 // MustRemove fails the test if an error occured in a call to Remove.
 func (s *Store) MustRemove(key string) {
 	err := s.Store.Remove(key)
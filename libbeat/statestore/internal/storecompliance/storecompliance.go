@@ -32,6 +32,7 @@ import (
 	"errors"
 	"flag"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -76,6 +77,8 @@ func TestBackendCompliance(t *testing.T, factory BackendFactory) {
 	t.Run("set-get", withBackend(factory, testSetGet))
 	t.Run("remove", withBackend(factory, testRemove))
 	t.Run("iteration", withBackend(factory, testIteration))
+	t.Run("prefix iteration", withBackend(factory, testPrefixIteration))
+	t.Run("ttl", withBackend(factory, testTTL))
 }
 
 func testSetGet(t *testing.T, factory BackendFactory) {
@@ -186,3 +189,96 @@ func testIteration(t *testing.T, factory BackendFactory) {
 		}))
 	})
 }
+
+func testPrefixIteration(t *testing.T, factory BackendFactory) {
+	data := map[string]interface{}{
+		"input::a":  map[string]interface{}{"field": "hello"},
+		"input::b":  map[string]interface{}{"field": "world"},
+		"other::a":  map[string]interface{}{"field": "other"},
+		"input":     map[string]interface{}{"field": "no match"},
+		"inputs::a": map[string]interface{}{"field": "no match"},
+	}
+
+	runWithBools(t, "reopen", func(t *testing.T, reopen bool) {
+		t.Run("matching keys only", WithStore(factory, func(t *testing.T, store *Store) {
+			for k, v := range data {
+				store.MustSet(k, v)
+			}
+			store.ReopenIf(reopen)
+
+			got := map[string]interface{}{}
+			err := store.EachPrefix("input::", func(key string, dec backend.ValueDecoder) (bool, error) {
+				var tmp interface{}
+				if err := dec.Decode(&tmp); err != nil {
+					return false, err
+				}
+
+				got[key] = tmp
+				return true, nil
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"input::a": data["input::a"],
+				"input::b": data["input::b"],
+			}, got)
+		}))
+
+		t.Run("no matching keys", WithStore(factory, func(t *testing.T, store *Store) {
+			for k, v := range data {
+				store.MustSet(k, v)
+			}
+			store.ReopenIf(reopen)
+
+			count := 0
+			err := store.EachPrefix("unknown::", func(_ string, _ backend.ValueDecoder) (bool, error) {
+				count++
+				return true, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 0, count)
+		}))
+	})
+}
+
+func testTTL(t *testing.T, factory BackendFactory) {
+	type entry struct{ A int }
+
+	runWithBools(t, "reopen", func(t *testing.T, reopen bool) {
+		t.Run("key is visible before it expires", WithStore(factory, func(t *testing.T, store *Store) {
+			store.MustSetWithTTL("key", entry{A: 1}, time.Hour)
+			store.ReopenIf(reopen)
+
+			var actual entry
+			store.MustGet("key", &actual)
+			assert.Equal(t, entry{A: 1}, actual)
+		}))
+
+		t.Run("expired key is not visible", WithStore(factory, func(t *testing.T, store *Store) {
+			store.MustSet("other", entry{A: 2})
+			store.MustSetWithTTL("key", entry{A: 1}, -time.Second)
+			store.ReopenIf(reopen)
+
+			assert.False(t, store.MustHave("key"))
+			assert.Error(t, store.Get("key", &entry{}))
+
+			var keys []string
+			err := store.Each(func(key string, _ backend.ValueDecoder) (bool, error) {
+				keys = append(keys, key)
+				return true, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"other"}, keys)
+		}))
+
+		t.Run("set removes ttl", WithStore(factory, func(t *testing.T, store *Store) {
+			store.MustSetWithTTL("key", entry{A: 1}, -time.Second)
+			store.MustSet("key", entry{A: 2})
+			store.ReopenIf(reopen)
+
+			var actual entry
+			store.MustGet("key", &actual)
+			assert.Equal(t, entry{A: 2}, actual)
+		}))
+	})
+}
@@ -18,6 +18,8 @@
 package statestore
 
 import (
+	"time"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/elastic/beats/v7/libbeat/statestore/backend"
@@ -83,7 +85,20 @@ func (m *mockStore) Set(key string, from interface{}) error {
 	return args.Error(0)
 }
 
+func (m *mockStore) OnSetWithTTL(key string, ttl time.Duration) *mock.Call {
+	return m.On("SetWithTTL", key, ttl)
+}
+func (m *mockStore) SetWithTTL(key string, from interface{}, ttl time.Duration) error {
+	args := m.Called(key, ttl)
+	return args.Error(0)
+}
+
 func (m *mockStore) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
 	args := m.Called(fn)
 	return args.Error(0)
 }
+
+func (m *mockStore) EachPrefix(prefix string, fn func(string, backend.ValueDecoder) (bool, error)) error {
+	args := m.Called(prefix, fn)
+	return args.Error(0)
+}
@@ -18,6 +18,8 @@
 package statestore
 
 import (
+	"time"
+
 	"github.com/elastic/beats/v7/libbeat/statestore/backend"
 	"github.com/elastic/go-concert/atomic"
 	"github.com/elastic/go-concert/unison"
@@ -121,6 +123,24 @@ func (s *Store) Set(key string, from interface{}) error {
 	return nil
 }
 
+// SetWithTTL inserts or overwrite a key value pair, that expires after ttl.
+// Expired keys are not visible anymore, and are removed by the storage
+// backend eventually. Calling Set on the key removes the TTL again.
+// SetWithTTL returns an error if the store has been closed, the value can
+// not be encoded by the store, or the storage backend did failed.
+func (s *Store) SetWithTTL(key string, from interface{}, ttl time.Duration) error {
+	const operation = "store/set-ttl"
+	if err := s.active.Add(1); err != nil {
+		return &ErrorClosed{operation: operation, name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	if err := s.shared.backend.SetWithTTL(key, from, ttl); err != nil {
+		return &ErrorOperation{name: s.shared.name, operation: operation, cause: err}
+	}
+	return nil
+}
+
 // Remove removes a key value pair from the store. Remove does not error if the
 // key is unknown to the store.
 // An error is returned if the store has already been closed or the operation
@@ -150,6 +170,18 @@ func (s *Store) Each(fn func(string, ValueDecoder) (bool, error)) error {
 	return s.shared.backend.Each(fn)
 }
 
+// EachPrefix iterates over all key-value pairs with keys starting with prefix.
+// The iteration stops if fn returns false or an error value != nil.
+// If the store has been closed already an error is returned.
+func (s *Store) EachPrefix(prefix string, fn func(string, ValueDecoder) (bool, error)) error {
+	if err := s.active.Add(1); err != nil {
+		return &ErrorClosed{operation: "store/each-prefix", name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	return s.shared.backend.EachPrefix(prefix, fn)
+}
+
 func (s *sharedStore) Retain() {
 	s.refCount.Inc()
 }
@@ -20,7 +20,9 @@ package storetest
 
 import (
 	"errors"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
 	"github.com/elastic/beats/v7/libbeat/statestore/backend"
@@ -42,11 +44,13 @@ type MemoryStore struct {
 }
 
 // MapStore implements a single in memory storage. The MapStore holds all
-// key-value pairs in a map[string]interface{}.
+// key-value pairs in a map[string]interface{}. The expiration times of keys
+// set with a TTL are stored in Expires.
 type MapStore struct {
-	mu     sync.RWMutex
-	closed bool
-	Table  map[string]interface{}
+	mu      sync.RWMutex
+	closed  bool
+	Table   map[string]interface{}
+	Expires map[string]time.Time
 }
 
 type valueUnpacker struct {
@@ -98,6 +102,21 @@ func (s *MapStore) init() {
 	if s.Table == nil {
 		s.Table = map[string]interface{}{}
 	}
+	if s.Expires == nil {
+		s.Expires = map[string]time.Time{}
+	}
+}
+
+// lookup returns the value for key, treating expired keys as unknown.
+func (s *MapStore) lookup(key string, now time.Time) (interface{}, bool) {
+	val, exists := s.Table[key]
+	if !exists {
+		return nil, false
+	}
+	if expires, ok := s.Expires[key]; ok && !now.Before(expires) {
+		return nil, false
+	}
+	return val, true
 }
 
 // Reopen marks the MapStore as open in case it has been closed already.  All
@@ -135,7 +154,7 @@ func (s *MapStore) Has(key string) (bool, error) {
 	}
 
 	s.init()
-	_, exists := s.Table[key]
+	_, exists := s.lookup(key, time.Now())
 	return exists, nil
 }
 
@@ -149,7 +168,7 @@ func (s *MapStore) Get(key string, into interface{}) error {
 	}
 
 	s.init()
-	val, exists := s.Table[key]
+	val, exists := s.lookup(key, time.Now())
 	if !exists {
 		return errUnknownKey
 	}
@@ -160,6 +179,17 @@ func (s *MapStore) Get(key string, into interface{}) error {
 // An error is returned if the store is marked as closed or the value being
 // passed in can not be encoded.
 func (s *MapStore) Set(key string, from interface{}) error {
+	return s.set(key, from, time.Time{})
+}
+
+// SetWithTTL inserts or overwrites a key-value pair that expires after ttl.
+// An error is returned if the store is marked as closed or the value being
+// passed in can not be encoded.
+func (s *MapStore) SetWithTTL(key string, from interface{}, ttl time.Duration) error {
+	return s.set(key, from, time.Now().Add(ttl))
+}
+
+func (s *MapStore) set(key string, from interface{}, expires time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.closed {
@@ -172,6 +202,11 @@ func (s *MapStore) Set(key string, from interface{}) error {
 		return err
 	}
 	s.Table[key] = tmp
+	if expires.IsZero() {
+		delete(s.Expires, key)
+	} else {
+		s.Expires[key] = expires
+	}
 	return nil
 }
 
@@ -186,6 +221,7 @@ func (s *MapStore) Remove(key string) error {
 
 	s.init()
 	delete(s.Table, key)
+	delete(s.Expires, key)
 	return nil
 }
 
@@ -193,6 +229,13 @@ func (s *MapStore) Remove(key string) error {
 // The iteration stops if fn returns false or an error.
 // Each returns an error if the store is closed, or fn returns an error.
 func (s *MapStore) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	return s.EachPrefix("", fn)
+}
+
+// EachPrefix iterates all key value pairs with keys starting with prefix.
+// The iteration stops if fn returns false or an error.
+// EachPrefix returns an error if the store is closed, or fn returns an error.
+func (s *MapStore) EachPrefix(prefix string, fn func(string, backend.ValueDecoder) (bool, error)) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.closed {
@@ -200,7 +243,16 @@ func (s *MapStore) Each(fn func(string, backend.ValueDecoder) (bool, error)) err
 	}
 
 	s.init()
-	for k, v := range s.Table {
+	now := time.Now()
+	for k := range s.Table {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		v, exists := s.lookup(k, now)
+		if !exists {
+			continue
+		}
+
 		cont, err := fn(k, CreateValueDecoder(v))
 		if !cont || err != nil {
 			return err
@@ -56,6 +56,10 @@ type TemplateConfig struct {
 	Order        int               `config:"order"`
 	Priority     int               `config:"priority"`
 	Type         IndexTemplateType `config:"type"`
+
+	// DataStream marks an index template as template for data streams. It is
+	// set by the index management if data streams are enabled in the output.
+	DataStream bool `config:",ignore"`
 }
 
 // TemplateSettings are part of the Elasticsearch template and hold index and source specific information.
@@ -201,10 +201,15 @@ func (t *Template) LoadMinimal() (common.MapStr, error) {
 	}
 
 	if t.config.Settings.Source != nil {
-		m["mappings"] = buildMappings(
+		mappings := buildMappings(
 			t.beatVersion, t.esVersion, t.beatName,
 			nil, nil,
 			common.MapStr(t.config.Settings.Source))
+		if t.isComposable() {
+			m.Put("template.mappings", mappings)
+		} else {
+			m["mappings"] = mappings
+		}
 	}
 
 	return m, nil
@@ -232,12 +237,28 @@ func (t *Template) loadMinimalComponent() common.MapStr {
 }
 
 func (t *Template) loadMinimalIndex() common.MapStr {
-	m := t.loadMinimalLegacy()
+	if !t.isComposable() {
+		m := t.loadMinimalLegacy()
+		m["priority"] = t.priority
+		delete(m, "order")
+		return m
+	}
+
+	m := t.loadMinimalComponent()
+	m["index_patterns"] = []string{t.GetPattern()}
 	m["priority"] = t.priority
-	delete(m, "order")
+	m["data_stream"] = common.MapStr{}
 	return m
 }
 
+// isComposable returns true if the template is an index template for data
+// streams, which uses the composable template layout with settings and
+// mappings nested under "template". Other index templates keep the layout
+// of legacy templates.
+func (t *Template) isComposable() bool {
+	return t.templateType == IndexTemplateIndex && t.config.DataStream
+}
+
 // GetName returns the name of the template
 func (t *Template) GetName() string {
 	return t.name
@@ -301,9 +322,17 @@ func (t *Template) generateComponent(properties common.MapStr) common.MapStr {
 }
 
 func (t *Template) generateIndex(properties common.MapStr) common.MapStr {
-	tmpl := t.generateLegacy(properties)
+	if !t.isComposable() {
+		tmpl := t.generateLegacy(properties)
+		tmpl["priority"] = t.priority
+		delete(tmpl, "order")
+		return tmpl
+	}
+
+	tmpl := t.generateComponent(properties)
+	tmpl["index_patterns"] = []string{t.GetPattern()}
 	tmpl["priority"] = t.priority
-	delete(tmpl, "order")
+	tmpl["data_stream"] = common.MapStr{}
 	return tmpl
 }
 
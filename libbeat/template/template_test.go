@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/version"
@@ -131,6 +132,67 @@ func TestTemplate(t *testing.T) {
 		template.Assert("mappings._meta", common.MapStr{"beat": "testbeat", "version": currentVersion})
 		template.Assert("settings.index.max_docvalue_fields_search", 200)
 	})
+
+	t.Run("index template without data streams", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Type = IndexTemplateIndex
+		template := createTestTemplate(t, currentVersion, "7.9.0", config)
+		template.Assert("index_patterns", []string{"testbeat-" + currentVersion + "-*"})
+		template.Assert("priority", 150)
+		template.Assert("mappings._meta", common.MapStr{"beat": "testbeat", "version": currentVersion})
+		template.Assert("settings.index.max_docvalue_fields_search", 200)
+		template.AssertMissing("order")
+		template.AssertMissing("template")
+		template.AssertMissing("data_stream")
+	})
+
+	t.Run("data stream index template", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Type = IndexTemplateIndex
+		config.DataStream = true
+		config.Pattern = "logs-*-*"
+		template := createTestTemplate(t, currentVersion, "7.9.0", config)
+		template.Assert("index_patterns", []string{"logs-*-*"})
+		template.Assert("data_stream", common.MapStr{})
+		template.Assert("template.mappings._meta", common.MapStr{"beat": "testbeat", "version": currentVersion})
+	})
+}
+
+func TestTemplateLayoutWithoutDataStreams(t *testing.T) {
+	currentVersion := getVersion("")
+	source := map[string]interface{}{"enabled": false}
+
+	generate := func(templateType IndexTemplateType, dataStream bool) (common.MapStr, common.MapStr) {
+		config := DefaultConfig()
+		config.Type = templateType
+		config.DataStream = dataStream
+		config.Settings.Source = source
+		template := createTestTemplate(t, currentVersion, "7.9.0", config)
+		minimal, err := template.tmpl.LoadMinimal()
+		require.NoError(t, err)
+		return template.data, minimal
+	}
+
+	t.Run("legacy template ignores data streams", func(t *testing.T) {
+		full, minimal := generate(IndexTemplateLegacy, false)
+		fullDS, minimalDS := generate(IndexTemplateLegacy, true)
+		assert.Equal(t, full, fullDS)
+		assert.Equal(t, minimal, minimalDS)
+		assert.Equal(t, common.MapStr(source), full["mappings"].(common.MapStr)["_source"])
+		assert.Equal(t, common.MapStr(source), minimal["mappings"].(common.MapStr)["_source"])
+	})
+
+	t.Run("index template keeps legacy layout", func(t *testing.T) {
+		legacy, legacyMinimal := generate(IndexTemplateLegacy, false)
+		full, minimal := generate(IndexTemplateIndex, false)
+
+		for _, m := range []common.MapStr{legacy, legacyMinimal} {
+			delete(m, "order")
+			m["priority"] = 150
+		}
+		assert.Equal(t, legacy, full)
+		assert.Equal(t, legacyMinimal, minimal)
+	})
 }
 
 func createTestTemplate(t *testing.T, beatVersion, esVersion string, config TemplateConfig) *testTemplate {
@@ -35,6 +35,7 @@ type Connector struct {
 	eventMeta  common.EventMetadata
 	timeSeries bool
 	keepNull   bool
+	priority   int
 }
 
 type connectorConfig struct {
@@ -45,6 +46,9 @@ type connectorConfig struct {
 	// KeepNull determines whether published events will keep null values or omit them.
 	KeepNull bool `config:"keep_null"`
 
+	// QueuePriority selects the queue priority lane for the module's events.
+	QueuePriority int `config:"queue_priority" validate:"min=0"`
+
 	common.EventMetadata `config:",inline"` // Fields and tags to add to events.
 }
 
@@ -72,6 +76,7 @@ func NewConnector(
 		processors: processors,
 		eventMeta:  config.EventMetadata,
 		keepNull:   config.KeepNull,
+		priority:   config.QueuePriority,
 	}, nil
 }
 
@@ -98,6 +103,7 @@ func (c *Connector) UseMetricSetProcessors(r metricSetRegister, moduleName, metr
 
 func (c *Connector) Connect() (beat.Client, error) {
 	return c.pipeline.ConnectWith(beat.ClientConfig{
+		Priority: c.priority,
 		Processing: beat.ProcessingConfig{
 			EventMetadata: c.eventMeta,
 			Processor:     c.processors,